@@ -6,13 +6,13 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"test-server-go/internal/api_v1"
+	"test-server-go/internal/blobstore"
 	"test-server-go/internal/storage"
 	tl "test-server-go/internal/tools"
+	"time"
 )
 
 func (rs *Resolver) AdminGetVariants(w http.ResponseWriter, r *http.Request) {
@@ -38,6 +38,36 @@ func (rs *Resolver) AdminGetVariants(w http.ResponseWriter, r *http.Request) {
 	api_v1.RespondOK(w, products)
 }
 
+// AdminGetVariantPriceHistory returns the price changes of the variant for the chart, the period is set in days
+func (rs *Resolver) AdminGetVariantPriceHistory(w http.ResponseWriter, r *http.Request) {
+	variantId := strings.ToLower(r.FormValue("variant_id"))
+	if err := tl.Validate(variantId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Variant id: "+err.Error())
+		return
+	}
+	days := PriceHistoryDefaultDays
+	if value := r.FormValue("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > PriceHistoryMaxDays {
+			api_v1.RespondWithUnprocessableEntity(w, "Days: the value must be between 1 and "+strconv.Itoa(PriceHistoryMaxDays))
+			return
+		}
+		days = parsed
+	}
+
+	history, err := storage.GetVariantPriceHistory(r.Context(), rs.App.Postgres, variantId, days)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get variant price history", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, history)
+}
+
 func (rs *Resolver) AdminGetProducts(w http.ResponseWriter, r *http.Request) {
 	products, err := storage.AdminGetProducts(r.Context(), rs.App.Postgres)
 	if err != nil {
@@ -123,6 +153,8 @@ type AdminCreateVariantData struct {
 	Price           string  `json:"price"`
 	DiscountMoney   *string `json:"discount_money"`
 	DiscountPercent *string `json:"discount_percent"`
+	RegionName      *string `json:"region_name"`
+	PlatformName    *string `json:"platform_name"`
 }
 
 func (rs *Resolver) AdminCreateVariant(w http.ResponseWriter, r *http.Request) {
@@ -190,6 +222,32 @@ func (rs *Resolver) AdminCreateVariant(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// The variant without the region is activated in any region and the one without the platform is not bound to a platform
+	regionName := storage.RegionGlobal
+	if data.RegionName != nil && *data.RegionName != "" {
+		regionName = *data.RegionName
+		if _, err := storage.GetRegionNo(r.Context(), rs.App.Postgres, regionName); err == storage.NoResults {
+			api_v1.RespondWithUnprocessableEntity(w, "Region name: the region is unknown")
+			return
+		} else if err != nil {
+			rs.App.Logger.NewWarn("error in get region no", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+	var platformName string
+	if data.PlatformName != nil && *data.PlatformName != "" {
+		platformName = *data.PlatformName
+		if _, err := storage.GetPlatformNo(r.Context(), rs.App.Postgres, platformName); err == storage.NoResults {
+			api_v1.RespondWithUnprocessableEntity(w, "Platform name: the platform is unknown")
+			return
+		} else if err != nil {
+			rs.App.Logger.NewWarn("error in get platform no", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+
 	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
 	if err != nil {
 		rs.App.Logger.NewWarn("error in took jwt data", err)
@@ -197,7 +255,7 @@ func (rs *Resolver) AdminCreateVariant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = storage.CreateAdminVariant(r.Context(), rs.App.Postgres, data.ProductName, data.VariantName, data.ServiceName, data.StateName, data.SubtypeName, data.ItemName, data.Mask, data.Price, *data.DiscountMoney, *data.DiscountPercent, jwtData.AccountUuid); err != nil {
+	if err = storage.CreateAdminVariant(r.Context(), rs.App.Postgres, data.ProductName, data.VariantName, data.ServiceName, data.StateName, data.SubtypeName, data.ItemName, regionName, platformName, data.Mask, data.Price, *data.DiscountMoney, *data.DiscountPercent, jwtData.AccountUuid); err != nil {
 		api_v1.RespondWithInternalServerError(w)
 		rs.App.Logger.NewWarn("Error in create admin variant", err)
 		return
@@ -210,10 +268,22 @@ type AdminUpdateVariantData struct {
 	VariantName     *string `json:"variant_name"`
 	StateName       *string `json:"state_name"`
 	ItemName        *string `json:"item_name"`
+	RegionName      *string `json:"region_name"`
+	PlatformName    *string `json:"platform_name"`
 	Mask            *string `json:"mask"`
 	Price           *string `json:"price"`
 	DiscountMoney   *string `json:"discount_money"`
 	DiscountPercent *string `json:"discount_percent"`
+	// PreorderReleaseAt makes the variant a pre-order, the empty value ends the pre-order
+	PreorderReleaseAt *string `json:"preorder_release_at"`
+	// SupplierName binds the variant to the supplier of the config, the empty value unbinds it
+	SupplierName *string `json:"supplier_name"`
+	SupplierSku  *string `json:"supplier_sku"`
+	// SupplierCost is the cost price of a single content minted by the supplier, it is unknown without the value
+	SupplierCost *string `json:"supplier_cost"`
+	// SellerId gives the variant to the seller, the sales of the variant are credited to the seller.
+	// The empty value gives the variant back to the shop.
+	SellerId *string `json:"seller_id"`
 }
 
 func (rs *Resolver) AdminUpdateVariant(w http.ResponseWriter, r *http.Request) {
@@ -274,6 +344,41 @@ func (rs *Resolver) AdminUpdateVariant(w http.ResponseWriter, r *http.Request) {
 		}
 		updateData["variant_item"] = no
 	}
+	if data.RegionName != nil {
+		if err = tl.Validate(*data.RegionName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Region name: "+err.Error())
+			return
+		}
+		no, err := storage.GetRegionNo(r.Context(), rs.App.Postgres, *data.RegionName)
+		if err == storage.NoResults {
+			api_v1.RespondWithUnprocessableEntity(w, "Region name: the region is unknown")
+			return
+		} else if err != nil {
+			rs.App.Logger.NewWarn("Error in get region no: ", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		updateData["variant_region"] = no
+	}
+	// The empty platform unbinds the variant from the platform
+	if data.PlatformName != nil && *data.PlatformName == "" {
+		updateData["variant_platform"] = nil
+	} else if data.PlatformName != nil {
+		if err = tl.Validate(*data.PlatformName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Platform name: "+err.Error())
+			return
+		}
+		no, err := storage.GetPlatformNo(r.Context(), rs.App.Postgres, *data.PlatformName)
+		if err == storage.NoResults {
+			api_v1.RespondWithUnprocessableEntity(w, "Platform name: the platform is unknown")
+			return
+		} else if err != nil {
+			rs.App.Logger.NewWarn("Error in get platform no: ", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		updateData["variant_platform"] = no
+	}
 	if data.Mask != nil {
 		if err = tl.Validate(*data.Mask, tl.TextFieldValidatorsWithSpaces()...); err != nil {
 			api_v1.RespondWithUnprocessableEntity(w, "Mask: "+err.Error())
@@ -302,19 +407,137 @@ func (rs *Resolver) AdminUpdateVariant(w http.ResponseWriter, r *http.Request) {
 		}
 		updateData["discount_percent"] = *data.DiscountPercent
 	}
+	if data.PreorderReleaseAt != nil && *data.PreorderReleaseAt == "" {
+		updateData["preorder_release_at"] = nil
+	} else if data.PreorderReleaseAt != nil {
+		if _, err = time.Parse(time.DateTime, *data.PreorderReleaseAt); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Preorder release at: the value must be in the YYYY-MM-DD hh:mm:ss format")
+			return
+		}
+		// The stock of the bundle comes from its components, so the bundle can not await its own content
+		isBundle, err := rs.isBundle(r.Context(), id)
+		if err != nil {
+			rs.App.Logger.NewWarn("Error in get bundle components", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		} else if isBundle {
+			api_v1.RespondWithConflict(w, "Preorder release at: the bundle can not be a pre-order")
+			return
+		}
+		updateData["preorder_release_at"] = *data.PreorderReleaseAt
+	}
+	if data.SupplierName != nil && *data.SupplierName == "" {
+		updateData["variant_supplier"] = nil
+		updateData["supplier_sku"] = nil
+		updateData["supplier_cost"] = nil
+	} else if data.SupplierName != nil {
+		if !rs.App.Suppliers.Has(*data.SupplierName) {
+			api_v1.RespondWithUnprocessableEntity(w, "Supplier name: the supplier is unknown")
+			return
+		}
+		if data.SupplierSku == nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Supplier sku: the parameter value is empty")
+			return
+		}
+		if err = tl.Validate(*data.SupplierSku, tl.IsNotBlank(true), tl.IsMinMaxLen(1, MaxSupplierSkuLength), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Supplier sku: "+err.Error())
+			return
+		}
+		isBundle, err := rs.isBundle(r.Context(), id)
+		if err != nil {
+			rs.App.Logger.NewWarn("Error in get bundle components", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		} else if isBundle {
+			api_v1.RespondWithConflict(w, "Supplier name: the bundle can not be sold by a supplier")
+			return
+		}
+		updateData["variant_supplier"] = *data.SupplierName
+		updateData["supplier_sku"] = *data.SupplierSku
+		updateData["supplier_cost"] = nil
+		if data.SupplierCost != nil && *data.SupplierCost != "" {
+			if err = tl.Validate(*data.SupplierCost, tl.IsMoney(), tl.IsTrimmedSpace()); err != nil {
+				api_v1.RespondWithUnprocessableEntity(w, "Supplier cost: "+err.Error())
+				return
+			}
+			updateData["supplier_cost"] = *data.SupplierCost
+		}
+	} else if data.SupplierSku != nil || data.SupplierCost != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Supplier name: the parameter value is empty")
+		return
+	}
 
-	if len(updateData) == 0 {
+	var ownerId string
+	if data.SellerId != nil && *data.SellerId == "" {
+		_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in took jwt data", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		ownerId = jwtData.AccountUuid
+	} else if data.SellerId != nil {
+		if err = tl.Validate(*data.SellerId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Seller id: "+err.Error())
+			return
+		}
+		isSeller, err := storage.CheckSeller(r.Context(), rs.App.Postgres, *data.SellerId)
+		if err != nil {
+			rs.App.Logger.NewWarn("Error in check seller", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		} else if !isSeller {
+			api_v1.RespondWithUnprocessableEntity(w, "Seller id: the seller is unknown")
+			return
+		}
+		// The sale of the bundle credits the seller of the bundle only, so the bundles are kept by the shop
+		isBundle, err := rs.isBundle(r.Context(), id)
+		if err != nil {
+			rs.App.Logger.NewWarn("Error in get bundle components", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		isComponent, err := storage.IsBundleComponent(r.Context(), rs.App.Postgres, id)
+		if err != nil {
+			rs.App.Logger.NewWarn("Error in check bundle component", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		} else if isBundle || isComponent {
+			api_v1.RespondWithConflict(w, "Seller id: "+storage.SellerBundle.Error())
+			return
+		}
+		ownerId = *data.SellerId
+	}
+
+	if len(updateData) == 0 && ownerId == "" {
 		api_v1.RespondWithUnprocessableEntity(w, "No values")
 		return
 	}
 
-	if err = storage.UpdateAdminVariant(r.Context(), rs.App.Postgres, id, updateData); err == storage.FailedUpdate {
-		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant with this id not found")
-		return
-	} else if err != nil {
-		api_v1.RespondWithInternalServerError(w)
-		rs.App.Logger.NewWarn("Error in update admin variant", err)
-		return
+	// The owner is changed first, so the refused change leaves the variant as it was
+	if ownerId != "" {
+		if err = storage.SetVariantOwner(r.Context(), rs.App.Postgres, id, ownerId); err == storage.FailedUpdate {
+			api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant with this id not found")
+			return
+		} else if err == storage.VariantOwnerStock {
+			api_v1.RespondWithConflict(w, "Seller id: "+err.Error())
+			return
+		} else if err != nil {
+			rs.App.Logger.NewWarn("Error in set variant owner", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+
+	if len(updateData) > 0 {
+		if err = storage.UpdateAdminVariant(r.Context(), rs.App.Postgres, id, updateData); err == storage.FailedUpdate {
+			api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant with this id not found")
+			return
+		} else if err != nil {
+			api_v1.RespondWithInternalServerError(w)
+			rs.App.Logger.NewWarn("Error in update admin variant", err)
+			return
+		}
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -349,44 +572,84 @@ type AdminUploadVariantData []struct {
 	Data string `json:"data"`
 }
 
-func (rs *Resolver) AdminUploadVariant(w http.ResponseWriter, r *http.Request) {
-	id := r.FormValue("id")
-	if id == "" {
-		api_v1.RespondWithUnprocessableEntity(w, "Id: the parameter value is empty")
-		return
-	}
-	if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
-		api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
-		return
-	}
-
+// decodeUploadVariantData reads the uploaded contents of the variant, it responds with an error if they are invalid
+func decodeUploadVariantData(w http.ResponseWriter, r *http.Request) ([]string, bool) {
 	var data AdminUploadVariantData
 	decodeErr := json.NewDecoder(r.Body).Decode(&data)
 	if decodeErr != nil {
 		api_v1.RespondWithBadRequest(w, "")
-		return
+		return nil, false
 	}
 
 	if len(data) == 0 {
 		api_v1.RespondWithUnprocessableEntity(w, "No values")
-		return
+		return nil, false
 	}
 
 	var dataList []string
 	for i, obj := range data {
 		if err := tl.Validate(obj.Data, tl.LongTextFieldValidatorsWithSpaces()...); err != nil {
 			api_v1.RespondWithUnprocessableEntity(w, "Data["+strconv.Itoa(i+1)+"]: "+err.Error())
-			return
+			return nil, false
 		}
 		dataList = append(dataList, obj.Data)
 	}
 
-	err := storage.CreateAdminContent(r.Context(), rs.App.Postgres, id, dataList)
+	return dataList, true
+}
+
+func (rs *Resolver) AdminUploadVariant(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if id == "" {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: the parameter value is empty")
+		return
+	}
+	if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
+		return
+	}
+	// The supplier and the cost price of the uploaded batch are optional, the batch without the cost price is not counted in the margin
+	supplierName := r.FormValue("supplier_name")
+	if supplierName != "" {
+		if err := tl.Validate(supplierName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Supplier name: "+err.Error())
+			return
+		}
+	}
+	costPrice := r.FormValue("cost_price")
+	if costPrice != "" {
+		if err := tl.Validate(costPrice, tl.IsMoney(), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Cost price: "+err.Error())
+			return
+		}
+	}
+
+	dataList, ok := decodeUploadVariantData(w, r)
+	if !ok {
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
 	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	fulfilled, err := storage.CreateAdminContent(r.Context(), rs.App.Postgres, id, jwtData.AccountUuid, supplierName, costPrice, dataList)
+	if err == storage.BundleContent {
+		api_v1.RespondWithConflict(w, "Id: "+err.Error())
+		return
+	} else if err == storage.NoResults {
+		api_v1.RespondWithUnprocessableEntity(w, "Supplier name: the supplier is unknown")
+		return
+	} else if err != nil {
 		rs.App.Logger.NewWarn("error in create content", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	rs.invalidateCatalogCache(r.Context())
+	rs.SendOrderMails(r.Context(), fulfilled)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -428,6 +691,7 @@ func (rs *Resolver) AdminDeleteVariantUpload(w http.ResponseWriter, r *http.Requ
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	rs.invalidateCatalogCache(r.Context())
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -469,10 +733,14 @@ func (rs *Resolver) AdminDeleteProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := storage.DeleteAdminProduct(r.Context(), rs.App.Postgres, name); err != nil {
+	imageIds, err := storage.DeleteAdminProduct(r.Context(), rs.App.Postgres, name)
+	if err != nil {
 		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Name"))
 		return
 	}
+	if err = rs.removeProductImageBlobs(r.Context(), imageIds...); err != nil {
+		rs.App.Logger.NewWarn("error in remove product image files", err)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -488,6 +756,9 @@ func (rs *Resolver) AdminDeleteService(w http.ResponseWriter, r *http.Request) {
 		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Name"))
 		return
 	}
+	if err := rs.App.Blob.Delete(r.Context(), getSvgFileKey(name)); err != nil {
+		rs.App.Logger.NewWarn("error in delete svg file", err)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -546,52 +817,71 @@ func (rs *Resolver) AdminAddSubtype(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (rs *Resolver) AdminAddService(w http.ResponseWriter, r *http.Request) {
-	r.ParseMultipartForm(10 << 20)
+// readSvgFile returns the sanitized service icon or nil if the file is not attached
+func readSvgFile(r *http.Request) ([]byte, string) {
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		return nil, ""
+	}
+	defer file.Close()
 
-	serviceName := r.FormValue("service_name")
-	if serviceName == "" {
-		api_v1.RespondWithBadRequest(w, "")
-		return
+	if !strings.HasSuffix(strings.ToLower(handler.Filename), ".svg") || handler.Header.Get("Content-Type") != "image/svg+xml" {
+		return nil, "File: the file is not an svg image"
 	}
 
-	if err := storage.CreateAdminService(r.Context(), rs.App.Postgres, serviceName); err != nil {
-		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Service_name"))
-		return
+	content, err := io.ReadAll(io.LimitReader(file, SvgFileMaxSize+1))
+	if err != nil {
+		return nil, "File: the file cannot be read"
+	}
+	if len(content) > SvgFileMaxSize {
+		return nil, "File: the file is too large (maximum is " + strconv.Itoa(SvgFileMaxSize/1024) + " kilobytes)"
 	}
 
-	file, handler, err := r.FormFile("file")
-	serviceName = strings.ToLower(serviceName)
+	// The icons are shown inline on the site, so the scripts and the external references are removed
+	content, err = tl.SanitizeSvg(content)
 	if err != nil {
-		fmt.Println("Error Retrieving the File")
-		fmt.Println(err)
-		return
+		return nil, "File: " + err.Error()
 	}
-	defer file.Close()
 
-	if !strings.HasSuffix(handler.Filename, ".svg") || handler.Header.Get("Content-Type") != "image/svg+xml" {
+	return content, ""
+}
+
+func (rs *Resolver) AdminAddService(w http.ResponseWriter, r *http.Request) {
+	r.ParseMultipartForm(10 << 20)
+
+	serviceName := r.FormValue("service_name")
+	if serviceName == "" {
 		api_v1.RespondWithBadRequest(w, "")
 		return
 	}
 
-	path, err := tl.GetExecutablePath()
-	dir := filepath.Join(path, "resources", "svg_files")
-	fileName := strings.ReplaceAll(serviceName, " ", "-") + ".svg"
-	fullPath := filepath.Join(dir, fileName)
+	content, errText := readSvgFile(r)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
 
-	tempFile, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE, 0666)
-	if err != nil {
-		api_v1.RespondWithBadRequest(w, "")
+	if err := storage.CreateAdminService(r.Context(), rs.App.Postgres, serviceName); err != nil {
+		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Service_name"))
 		return
 	}
-	defer tempFile.Close()
-	io.Copy(tempFile, file)
+	if content != nil {
+		if err := rs.App.Blob.Put(r.Context(), getSvgFileKey(serviceName), content, "image/svg+xml"); err != nil {
+			rs.App.Logger.NewWarn("error in put svg file", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (rs *Resolver) AdminAddProduct(w http.ResponseWriter, r *http.Request) {
-	r.ParseMultipartForm(10 << 20)
+	r.Body = http.MaxBytesReader(w, r.Body, ProductImageMaxSize+1024*1024)
+	if err := r.ParseMultipartForm(ProductImageMaxSize); err != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
 
 	productName := r.FormValue("product_name")
 	tags := r.FormValue("tags")
@@ -601,35 +891,93 @@ func (rs *Resolver) AdminAddProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uuid, err := storage.CreateAdminProduct(r.Context(), rs.App.Postgres, productName, tags, description)
-	if err != nil {
-		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Service_name"))
-		return
+	// The image is optional, it is checked before the product is created
+	var image *preparedProductImage
+	if files := r.MultipartForm.File["file"]; len(files) > 0 {
+		prepared, errText, err := readProductImage(files[0])
+		if err != nil {
+			rs.App.Logger.NewWarn("error in process product image", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		} else if errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText)
+			return
+		}
+		image = &prepared
 	}
 
-	file, handler, err := r.FormFile("file")
-	productName = strings.ToLower(productName)
-	if err != nil {
-		fmt.Println("Error Retrieving the File")
-		fmt.Println(err)
+	// The image is stored first and added with the product, so the failed upload leaves no product without it
+	var newImage *storage.ProductImage
+	if image != nil {
+		stored, err := rs.putProductImage(r.Context(), *image)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in save product image", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		newImage = &stored
+	}
+
+	if _, err := storage.CreateAdminProduct(r.Context(), rs.App.Postgres, productName, tags, description, newImage); err != nil {
+		if newImage != nil {
+			rs.removeUnsavedProductImage(r.Context(), newImage.ImageId)
+		}
+		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Product_name"))
 		return
 	}
-	defer file.Close()
 
-	path, err := tl.GetExecutablePath()
-	dir := filepath.Join(path, "resources", "product_images")
-	fileName := uuid + filepath.Ext(handler.Filename)
-	fullPath := filepath.Join(dir, fileName)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	tempFile, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE, 0666)
-	if err != nil {
+func (rs *Resolver) AdminUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		ProductId   string  `json:"product_id"`
+		ProductName *string `json:"product_name"`
+		Tags        *string `json:"tags"`
+		Description *string `json:"description"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
 		api_v1.RespondWithBadRequest(w, "")
 		return
 	}
-	defer tempFile.Close()
-	io.Copy(tempFile, file)
 
-	w.WriteHeader(http.StatusNoContent)
+	// Block 1 - data validation
+	if err := tl.Validate(data.ProductId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Product id: "+err.Error())
+		return
+	}
+	if data.ProductName != nil {
+		if err := tl.Validate(*data.ProductName, tl.IsNotBlank(true), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Product name: "+err.Error())
+			return
+		}
+	}
+	if data.Description != nil {
+		if err := tl.Validate(*data.Description, tl.IsNotBlank(true)); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Description: "+err.Error())
+			return
+		}
+	}
+
+	// Block 2 - update the product
+	slug, err := storage.UpdateAdminProduct(r.Context(), rs.App.Postgres, data.ProductId, data.ProductName, data.Tags, data.Description)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Product was not found")
+		return
+	} else if err != nil {
+		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Product name"))
+		return
+	}
+
+	// Block 3 - send the result
+	response := struct {
+		Slug string `json:"slug"`
+	}{
+		Slug: slug,
+	}
+	api_v1.RespondOK(w, response)
 }
 
 func (rs *Resolver) AdminEditType(w http.ResponseWriter, r *http.Request) {
@@ -680,6 +1028,12 @@ func (rs *Resolver) AdminEditService(w http.ResponseWriter, r *http.Request) {
 
 	r.ParseMultipartForm(10 << 20)
 
+	content, errText := readSvgFile(r)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+
 	serviceName := r.FormValue("service_name2")
 	if serviceName != "" {
 		if err := storage.EditAdminService(r.Context(), rs.App.Postgres, serviceNameInUrl, serviceName); err != nil {
@@ -688,51 +1042,33 @@ func (rs *Resolver) AdminEditService(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	file, handler, err := r.FormFile("file")
-	if file != nil {
-		serviceName = strings.ToLower(serviceName)
-		if err != nil {
-			fmt.Println("Error Retrieving the File")
-			fmt.Println(err)
-			return
+	// The icon is kept under the current name of the service
+	oldKey, newKey := getSvgFileKey(serviceNameInUrl), getSvgFileKey(serviceNameInUrl)
+	if serviceName != "" {
+		newKey = getSvgFileKey(serviceName)
+	}
+	if content == nil && oldKey != newKey {
+		body, _, err := rs.App.Blob.Open(r.Context(), oldKey)
+		if err == nil {
+			content, err = io.ReadAll(body)
+			body.Close()
 		}
-		defer file.Close()
-
-		if !strings.HasSuffix(handler.Filename, ".svg") || handler.Header.Get("Content-Type") != "image/svg+xml" {
-			api_v1.RespondWithBadRequest(w, "")
+		if err != nil && err != blobstore.ErrNotFound {
+			rs.App.Logger.NewWarn("error in read svg file", err)
+			api_v1.RespondWithInternalServerError(w)
 			return
 		}
-
-		path, err := tl.GetExecutablePath()
-		dir := filepath.Join(path, "resources", "svg_files")
-		if serviceName == "" {
-			serviceName = serviceNameInUrl
-		}
-		fileName := strings.ReplaceAll(serviceName, " ", "-") + ".svg"
-		fullPath := filepath.Join(dir, fileName)
-
-		tempFile, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE, 0666)
-		if err != nil {
-			api_v1.RespondWithBadRequest(w, "")
+	}
+	if content != nil {
+		if err = rs.App.Blob.Put(r.Context(), newKey, content, "image/svg+xml"); err != nil {
+			rs.App.Logger.NewWarn("error in put svg file", err)
+			api_v1.RespondWithInternalServerError(w)
 			return
 		}
-		defer tempFile.Close()
-		io.Copy(tempFile, file)
 	}
-
-	if serviceName != "" {
-		path, _ := tl.GetExecutablePath()
-		oldFileName := strings.ReplaceAll(serviceNameInUrl, " ", "-") + ".svg"
-		newFileName := strings.ReplaceAll(serviceName, " ", "-") + ".svg"
-		oldPath := filepath.Join(path, "resources", "svg_files", oldFileName)
-		newPath := filepath.Join(path, "resources", "svg_files", newFileName)
-
-		if _, err := os.Stat(oldPath); err == nil {
-			err = os.Rename(oldPath, newPath)
-			if err != nil {
-				fmt.Println("Error renaming the file: ", err)
-				return
-			}
+	if oldKey != newKey {
+		if err = rs.App.Blob.Delete(r.Context(), oldKey); err != nil {
+			rs.App.Logger.NewWarn("error in delete svg file", err)
 		}
 	}
 
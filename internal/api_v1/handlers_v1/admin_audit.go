@@ -0,0 +1,78 @@
+package handlers_v1
+
+import (
+	"net/http"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+	"time"
+)
+
+type adminAuditResponse struct {
+	Actions []storage.AuditAction `json:"actions"`
+	Total   int                   `json:"total"`
+	Page    int                   `json:"page"`
+	Limit   int                   `json:"limit"`
+}
+
+// parseAuditTime accepts a date or a date with time in UTC
+func parseAuditTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.DateTime, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (rs *Resolver) AdminGetAudit(w http.ResponseWriter, r *http.Request) {
+	page, limit, errText := getPagination(r, AdminAuditDefaultLimit, AdminAuditMaxLimit)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+
+	filter := storage.AuditFilter{
+		ActorId:  r.FormValue("actor_id"),
+		Route:    r.FormValue("route"),
+		Table:    r.FormValue("table"),
+		EntityId: r.FormValue("entity_id"),
+	}
+	if filter.ActorId != "" {
+		if err := tl.Validate(filter.ActorId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Actor id: "+err.Error())
+			return
+		}
+	}
+
+	var err error
+	if filter.From, err = parseAuditTime(r.FormValue("from")); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "From: the value must be in the format "+time.DateOnly+" or "+time.DateTime)
+		return
+	}
+	if filter.To, err = parseAuditTime(r.FormValue("to")); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "To: the value must be in the format "+time.DateOnly+" or "+time.DateTime)
+		return
+	}
+
+	actions, total, err := storage.GetAuditActions(r.Context(), rs.App.Postgres, filter, limit, (page-1)*limit)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get audit actions", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, adminAuditResponse{
+		Actions: actions,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	})
+}
@@ -0,0 +1,98 @@
+package handlers_v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+func (rs *Resolver) AdminGetBundleComponents(w http.ResponseWriter, r *http.Request) {
+	variantId := r.FormValue("variant_id")
+	if err := tl.Validate(variantId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Variant id: "+err.Error())
+		return
+	}
+
+	components, err := storage.GetBundleComponents(r.Context(), rs.App.Postgres, variantId)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get bundle components", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, components)
+}
+
+// isBundle reports whether the variant has the components
+func (rs *Resolver) isBundle(ctx context.Context, variantId string) (bool, error) {
+	components, err := storage.GetBundleComponents(ctx, rs.App.Postgres, variantId)
+	return len(components) > 0, err
+}
+
+func (rs *Resolver) AdminUpdateBundleComponents(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		VariantId    string   `json:"variant_id"`
+		ComponentIds []string `json:"component_ids"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.VariantId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Variant id: "+err.Error())
+		return
+	}
+	componentIds := make([]string, 0, len(data.ComponentIds))
+	seen := make(map[string]bool)
+	for _, componentId := range data.ComponentIds {
+		if err := tl.Validate(componentId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Component ids: "+err.Error())
+			return
+		}
+		componentId = strings.ToLower(componentId)
+		if !seen[componentId] {
+			seen[componentId] = true
+			componentIds = append(componentIds, componentId)
+		}
+	}
+	// The repeated component counts once
+	if len(componentIds) == 1 {
+		api_v1.RespondWithUnprocessableEntity(w, "Component ids: the bundle must have at least two components")
+		return
+	}
+
+	// Block 2 - replace the components, the empty list turns the bundle into a regular variant
+	err := storage.UpdateBundleComponents(r.Context(), rs.App.Postgres, data.VariantId, componentIds)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant was not found")
+		return
+	} else if err == storage.BundleContent {
+		api_v1.RespondWithConflict(w, "Variant id: the variant with its own content, a pre-order or a variant of a supplier can not be a bundle")
+		return
+	} else if err == storage.FailedUpdate {
+		api_v1.RespondWithConflict(w, "Variant id: the component of another bundle can not be a bundle")
+		return
+	} else if err == storage.SellerBundle {
+		api_v1.RespondWithConflict(w, "Variant id: "+err.Error())
+		return
+	} else if err == storage.InvalidBundleComponent {
+		api_v1.RespondWithUnprocessableEntity(w, "Component ids: "+err.Error())
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update bundle components", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,250 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+	"time"
+)
+
+func (rs *Resolver) AdminGetCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := storage.GetCampaigns(r.Context(), rs.App.Postgres)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get campaigns", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, campaigns)
+}
+
+// validateCampaignTime checks the time of the campaign period, it is given in the same format as it is returned
+func validateCampaignTime(value, field string) string {
+	if _, err := time.Parse(time.DateTime, value); err != nil {
+		return field + ": the value must be in the YYYY-MM-DD hh:mm:ss format"
+	}
+	return ""
+}
+
+// validateCampaignDiscount checks that exactly one kind of the discount is given
+func validateCampaignDiscount(discountMoney *string, discountPercent *int) (*float64, string) {
+	if (discountMoney == nil) == (discountPercent == nil) {
+		return nil, "Discount: either discount_money or discount_percent must be set"
+	}
+	if discountPercent != nil {
+		if *discountPercent < 1 || *discountPercent > 100 {
+			return nil, "Discount percent: the value must be from 1 to 100"
+		}
+		return nil, ""
+	}
+
+	if err := tl.Validate(*discountMoney, tl.IsMoney(), tl.IsTrimmedSpace()); err != nil {
+		return nil, "Discount money: " + err.Error()
+	}
+	money, _ := strconv.ParseFloat(*discountMoney, 64)
+	if money <= 0 {
+		return nil, "Discount money: the value must be greater than zero"
+	}
+
+	return &money, ""
+}
+
+func validateCampaignTargets(targets storage.CampaignTargets) string {
+	if targets.Count() == 0 {
+		return "Targets: at least one variant, product, service or type must be set"
+	}
+	for _, id := range append(append([]string{}, targets.VariantIds...), targets.ProductIds...) {
+		if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
+			return "Targets: " + err.Error()
+		}
+	}
+
+	return ""
+}
+
+func (rs *Resolver) AdminCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		CampaignName    string                  `json:"campaign_name"`
+		StartsAt        string                  `json:"starts_at"`
+		EndsAt          string                  `json:"ends_at"`
+		Priority        int                     `json:"priority"`
+		DiscountMoney   *string                 `json:"discount_money"`
+		DiscountPercent *int                    `json:"discount_percent"`
+		Targets         storage.CampaignTargets `json:"targets"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - data validation
+	if err = tl.Validate(data.CampaignName, tl.IsNotBlank(true), tl.IsMinMaxLen(MinTextLength, MaxTextLength), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Campaign name: "+err.Error())
+		return
+	}
+	if errText := validateCampaignTime(data.StartsAt, "Starts at"); errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+	if errText := validateCampaignTime(data.EndsAt, "Ends at"); errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+	if data.EndsAt <= data.StartsAt {
+		api_v1.RespondWithUnprocessableEntity(w, "Ends at: the campaign must end after it starts")
+		return
+	}
+	discountMoney, errText := validateCampaignDiscount(data.DiscountMoney, data.DiscountPercent)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+	if errText = validateCampaignTargets(data.Targets); errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+
+	// Block 2 - create the campaign
+	campaignData := storage.CampaignData{
+		CampaignName: data.CampaignName,
+		StartsAt:     data.StartsAt,
+		EndsAt:       data.EndsAt,
+		Priority:     data.Priority,
+	}
+	if discountMoney != nil {
+		campaignData.DiscountMoney = *discountMoney
+	} else {
+		campaignData.DiscountPercent = *data.DiscountPercent
+	}
+
+	campaignId, err := storage.CreateCampaign(r.Context(), rs.App.Postgres, jwtData.AccountUuid, campaignData, data.Targets)
+	if err == storage.UnknownCampaignTarget {
+		api_v1.RespondWithUnprocessableEntity(w, "Targets: "+err.Error())
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in create campaign", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	// Block 3 - send the result
+	response := struct {
+		CampaignId string `json:"campaign_id"`
+	}{
+		CampaignId: campaignId,
+	}
+	api_v1.RespondWithCreated(w, response)
+}
+
+func (rs *Resolver) AdminUpdateCampaign(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		CampaignId      string                   `json:"campaign_id"`
+		CampaignName    *string                  `json:"campaign_name"`
+		StartsAt        *string                  `json:"starts_at"`
+		EndsAt          *string                  `json:"ends_at"`
+		Priority        *int                     `json:"priority"`
+		DiscountMoney   *string                  `json:"discount_money"`
+		DiscountPercent *int                     `json:"discount_percent"`
+		Targets         *storage.CampaignTargets `json:"targets"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.CampaignId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Campaign id: "+err.Error())
+		return
+	}
+	if data.CampaignName != nil {
+		if err := tl.Validate(*data.CampaignName, tl.IsNotBlank(true), tl.IsMinMaxLen(MinTextLength, MaxTextLength), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Campaign name: "+err.Error())
+			return
+		}
+	}
+	if data.StartsAt != nil {
+		if errText := validateCampaignTime(*data.StartsAt, "Starts at"); errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText)
+			return
+		}
+	}
+	if data.EndsAt != nil {
+		if errText := validateCampaignTime(*data.EndsAt, "Ends at"); errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText)
+			return
+		}
+	}
+	var discountMoney *float64
+	if data.DiscountMoney != nil || data.DiscountPercent != nil {
+		var errText string
+		if discountMoney, errText = validateCampaignDiscount(data.DiscountMoney, data.DiscountPercent); errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText)
+			return
+		}
+	}
+	if data.Targets != nil {
+		if errText := validateCampaignTargets(*data.Targets); errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText)
+			return
+		}
+	}
+
+	// Block 2 - update the campaign
+	err := storage.UpdateCampaign(r.Context(), rs.App.Postgres, data.CampaignId, data.CampaignName, data.StartsAt, data.EndsAt, data.Priority, discountMoney, data.DiscountPercent, data.Targets)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Campaign was not found")
+		return
+	} else if err == storage.UnknownCampaignTarget {
+		api_v1.RespondWithUnprocessableEntity(w, "Targets: "+err.Error())
+		return
+	} else if errText := storage.PgErrorsHandle(err, "Ends at"); errText != "" {
+		// The period check of the table fails if only one end of the period is moved past the other
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update campaign", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminDeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	campaignId := r.FormValue("campaign_id")
+	if err := tl.Validate(campaignId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Campaign id: "+err.Error())
+		return
+	}
+
+	err := storage.DeleteCampaign(r.Context(), rs.App.Postgres, campaignId)
+	if err == storage.FailedDelete {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Campaign was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete campaign", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,239 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/auth"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+func (rs *Resolver) AdminGetEmployees(w http.ResponseWriter, r *http.Request) {
+	employees, err := storage.GetEmployees(r.Context(), rs.App.Postgres)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get employees", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, employees)
+}
+
+func (rs *Resolver) AdminCreateEmployee(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		Login      string `json:"login"`
+		Password   string `json:"password"`
+		Surname    string `json:"surname"`
+		Name       string `json:"name"`
+		Patronymic string `json:"patronymic"`
+		Role       string `json:"role"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.Login, tl.IsNotBlank(true), tl.IsMinMaxLen(MinLoginLength, MaxLoginLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Login: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.Password, tl.IsNotBlank(true), tl.IsMinMaxLen(MinPasswordLength, MaxPasswordLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Password: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.Surname, tl.IsNotBlank(true), tl.IsMinMaxLen(1, MaxTextLength), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Surname: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.Name, tl.IsNotBlank(true), tl.IsMinMaxLen(1, MaxTextLength), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Name: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.Patronymic, tl.IsNotBlank(false), tl.IsMinMaxLen(0, MaxTextLength), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Patronymic: "+err.Error())
+		return
+	}
+	if !tl.StringInSlice(data.Role, storage.EmployeeRoles) {
+		api_v1.RespondWithUnprocessableEntity(w, "Role: the value must be one of "+strings.Join(storage.EmployeeRoles, ", "))
+		return
+	}
+
+	// Block 2 - check for an exists login
+	loginExist, err := storage.CheckAdmin(r.Context(), rs.App.Postgres, strings.ToLower(data.Login))
+	if err != nil {
+		rs.App.Logger.NewWarn("error in checked the employee existence", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if loginExist {
+		api_v1.RespondWithConflict(w, "Login: this login is already in use")
+		return
+	}
+
+	// Block 3 - create the employee
+	base64PasswordHash, base64Salt, err := auth.HashPassword(data.Password, "")
+	if err != nil {
+		rs.App.Logger.NewWarn("error in generated hash password", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	accountUuid, err := storage.CreateEmployee(r.Context(), rs.App.Postgres, data.Login, data.Surname, data.Name, data.Patronymic, data.Role, base64PasswordHash, base64Salt)
+	if err != nil {
+		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Login"))
+		return
+	}
+
+	// Block 4 - send the result
+	response := struct {
+		AccountId string `json:"account_id"`
+	}{
+		AccountId: accountUuid,
+	}
+	api_v1.RespondWithCreated(w, response)
+}
+
+func (rs *Resolver) AdminUpdateEmployee(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		AccountId  string  `json:"account_id"`
+		Password   *string `json:"password"`
+		Surname    *string `json:"surname"`
+		Name       *string `json:"name"`
+		Patronymic *string `json:"patronymic"`
+		Role       *string `json:"role"`
+		State      *string `json:"state"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - data validation
+	if err = tl.Validate(data.AccountId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Account id: "+err.Error())
+		return
+	}
+	if data.Password != nil {
+		if err = tl.Validate(*data.Password, tl.IsNotBlank(true), tl.IsMinMaxLen(MinPasswordLength, MaxPasswordLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Password: "+err.Error())
+			return
+		}
+	}
+	if data.Surname != nil {
+		if err = tl.Validate(*data.Surname, tl.IsNotBlank(true), tl.IsMinMaxLen(1, MaxTextLength), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Surname: "+err.Error())
+			return
+		}
+	}
+	if data.Name != nil {
+		if err = tl.Validate(*data.Name, tl.IsNotBlank(true), tl.IsMinMaxLen(1, MaxTextLength), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Name: "+err.Error())
+			return
+		}
+	}
+	if data.Patronymic != nil {
+		if err = tl.Validate(*data.Patronymic, tl.IsNotBlank(false), tl.IsMinMaxLen(0, MaxTextLength), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Patronymic: "+err.Error())
+			return
+		}
+	}
+	if data.Role != nil && !tl.StringInSlice(*data.Role, storage.EmployeeRoles) {
+		api_v1.RespondWithUnprocessableEntity(w, "Role: the value must be one of "+strings.Join(storage.EmployeeRoles, ", "))
+		return
+	}
+	if data.State != nil && *data.State != storage.AccountStateActive && *data.State != storage.AccountStateBlocked {
+		api_v1.RespondWithUnprocessableEntity(w, "State: the value must be active or blocked")
+		return
+	}
+	// The employee cannot take away their own access
+	if data.AccountId == jwtData.AccountUuid && (data.Role != nil || data.State != nil) {
+		api_v1.RespondWithConflict(w, "The role and the state of your own account cannot be changed")
+		return
+	}
+
+	// Block 2 - update the employee
+	var base64PasswordHash, base64Salt *string
+	if data.Password != nil {
+		hash, salt, err := auth.HashPassword(*data.Password, "")
+		if err != nil {
+			rs.App.Logger.NewWarn("error in generated hash password", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		base64PasswordHash, base64Salt = &hash, &salt
+	}
+
+	err = storage.UpdateEmployee(r.Context(), rs.App.Postgres, data.AccountId, data.Surname, data.Name, data.Patronymic, data.Role, data.State, base64PasswordHash, base64Salt)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Employee was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update employee", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - revoke the sessions after the password change
+	if data.Password != nil && data.AccountId != jwtData.AccountUuid {
+		if err = storage.CreateTokensRevocation(r.Context(), rs.App.Redis, data.AccountId, auth.TokenExpirationTime); err != nil {
+			rs.App.Logger.NewWarn("error in revoke account tokens", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+
+	// Block 4 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminDeleteEmployee(w http.ResponseWriter, r *http.Request) {
+	accountId := r.FormValue("account_id")
+	if err := tl.Validate(accountId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Account id: "+err.Error())
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if accountId == jwtData.AccountUuid {
+		api_v1.RespondWithConflict(w, "Your own account cannot be deleted")
+		return
+	}
+
+	state := storage.AccountStateDeleted
+	err = storage.UpdateEmployee(r.Context(), rs.App.Postgres, accountId, nil, nil, nil, nil, &state, nil, nil)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Employee was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete employee", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = storage.CreateTokensRevocation(r.Context(), rs.App.Redis, accountId, auth.TokenExpirationTime); err != nil {
+		rs.App.Logger.NewWarn("error in revoke account tokens", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package handlers_v1
+
+import (
+	"net/http"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+func (rs *Resolver) AdminGetPreorders(w http.ResponseWriter, r *http.Request) {
+	variantId := r.FormValue("variant_id")
+	if variantId != "" {
+		if err := tl.Validate(variantId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Variant id: "+err.Error())
+			return
+		}
+	}
+
+	queue, err := storage.GetPreorderQueue(r.Context(), rs.App.Postgres, variantId)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get preorder queue", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, queue)
+}
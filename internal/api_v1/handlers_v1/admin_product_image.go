@@ -0,0 +1,280 @@
+package handlers_v1
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/blobstore"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+
+	"github.com/google/uuid"
+)
+
+// productImageSizes are the maximum sides of the image renditions
+var productImageSizes = map[string]int{
+	storage.ProductImageThumbnail: 200,
+	storage.ProductImageMedium:    600,
+	storage.ProductImageLarge:     1200,
+}
+
+// productImageTypes are the image types accepted for the product gallery, detected by the magic bytes
+var productImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+type preparedProductImage struct {
+	width       int
+	height      int
+	contentHash string
+	renditions  map[string][]byte
+}
+
+// readProductImage reads the uploaded file and resizes it into the renditions.
+// The text of the validation error is returned separately from the internal errors.
+func readProductImage(fileHeader *multipart.FileHeader) (preparedProductImage, string, error) {
+	var prepared preparedProductImage
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return prepared, "", err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, ProductImageMaxSize+1))
+	if err != nil {
+		return prepared, "", err
+	}
+	if len(content) > ProductImageMaxSize {
+		return prepared, "File: the file is too large (maximum is " + strconv.Itoa(ProductImageMaxSize/1024/1024) + " megabytes)", nil
+	}
+	if !productImageTypes[http.DetectContentType(content)] {
+		return prepared, "File: the file is not a jpeg, png or gif image", nil
+	}
+
+	img, err := tl.DecodeImage(content, ProductImageMaxPixels)
+	if err == tl.ErrImageTooLarge {
+		return prepared, "File: the image resolution is too large (maximum is " + strconv.Itoa(ProductImageMaxPixels/1000000) + " megapixels)", nil
+	} else if err != nil {
+		return prepared, "File: the image is damaged", nil
+	}
+
+	hash := sha256.Sum256(content)
+	prepared = preparedProductImage{
+		width:       img.Bounds().Dx(),
+		height:      img.Bounds().Dy(),
+		contentHash: hex.EncodeToString(hash[:16]),
+		renditions:  make(map[string][]byte, len(productImageSizes)),
+	}
+	for size, maxSide := range productImageSizes {
+		if prepared.renditions[size], err = tl.EncodeJpeg(tl.ResizeImage(img, maxSide), ProductImageJpegQuality); err != nil {
+			return prepared, "", err
+		}
+	}
+
+	return prepared, "", nil
+}
+
+func getProductImageKey(imageId, size string) string {
+	return productImagesDir + "/" + path.Base(imageId) + "/" + size + ".jpg"
+}
+
+// putProductImage puts the renditions of the new image to the blob store and returns the image to add to the gallery.
+// The renditions are stored before the image is added, so every image of the gallery is known to have them.
+func (rs *Resolver) putProductImage(ctx context.Context, prepared preparedProductImage) (storage.ProductImage, error) {
+	image := storage.ProductImage{
+		ImageId:     uuid.NewString(),
+		Width:       prepared.width,
+		Height:      prepared.height,
+		ContentHash: prepared.contentHash,
+	}
+
+	for size, content := range prepared.renditions {
+		if err := rs.App.Blob.Put(ctx, getProductImageKey(image.ImageId, size), content, "image/jpeg"); err != nil {
+			rs.removeUnsavedProductImage(ctx, image.ImageId)
+			return image, err
+		}
+	}
+
+	return image, nil
+}
+
+// removeUnsavedProductImage removes the renditions of the image which was not added to the gallery
+func (rs *Resolver) removeUnsavedProductImage(ctx context.Context, imageId string) {
+	if err := rs.removeProductImageBlobs(ctx, imageId); err != nil {
+		rs.App.Logger.NewWarn("error in remove product image files", err)
+	}
+}
+
+// saveProductImage puts the renditions of the image to the blob store and adds the image to the end of the product gallery
+func (rs *Resolver) saveProductImage(ctx context.Context, productId string, prepared preparedProductImage) (storage.ProductImage, error) {
+	image, err := rs.putProductImage(ctx, prepared)
+	if err != nil {
+		return image, err
+	}
+
+	saved, err := storage.CreateProductImage(ctx, rs.App.Postgres, rs.App.Config.App.Service.Url.Server, productId, image.ImageId, image.Width, image.Height, image.ContentHash)
+	if err != nil {
+		rs.removeUnsavedProductImage(ctx, image.ImageId)
+		return saved, err
+	}
+
+	return saved, nil
+}
+
+// removeProductImageBlobs removes the renditions of the images
+func (rs *Resolver) removeProductImageBlobs(ctx context.Context, imageIds ...string) error {
+	for _, imageId := range imageIds {
+		if err := blobstore.DeletePrefix(ctx, rs.App.Blob, productImagesDir+"/"+path.Base(imageId)+"/"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rs *Resolver) AdminGetProductImages(w http.ResponseWriter, r *http.Request) {
+	productId := r.FormValue("product_id")
+	if err := tl.Validate(productId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Product id: "+err.Error())
+		return
+	}
+
+	images, err := storage.GetProductImages(r.Context(), rs.App.Postgres, rs.App.Config.App.Service.Url.Server, productId)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get product images", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, images)
+}
+
+func (rs *Resolver) AdminUploadProductImages(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	r.Body = http.MaxBytesReader(w, r.Body, ProductImageMaxSize*ProductImagesMaxUpload+1024*1024)
+	if err := r.ParseMultipartForm(ProductImageMaxSize); err != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	productId := r.FormValue("product_id")
+	if err := tl.Validate(productId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Product id: "+err.Error())
+		return
+	}
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		api_v1.RespondWithUnprocessableEntity(w, "File: the file is not attached")
+		return
+	}
+	if len(files) > ProductImagesMaxUpload {
+		api_v1.RespondWithUnprocessableEntity(w, "File: no more than "+strconv.Itoa(ProductImagesMaxUpload)+" files can be uploaded at once")
+		return
+	}
+
+	// Block 2 - process all the files before saving any of them
+	prepared := make([]preparedProductImage, 0, len(files))
+	for _, fileHeader := range files {
+		image, errText, err := readProductImage(fileHeader)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in process product image", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		} else if errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText+" ("+fileHeader.Filename+")")
+			return
+		}
+		prepared = append(prepared, image)
+	}
+
+	// Block 3 - save the images
+	images := make([]storage.ProductImage, 0, len(prepared))
+	for _, image := range prepared {
+		saved, err := rs.saveProductImage(r.Context(), productId, image)
+		if err == storage.NoResults {
+			api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Product was not found")
+			return
+		} else if err != nil {
+			rs.App.Logger.NewWarn("error in save product image", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		images = append(images, saved)
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	// Block 4 - send the result
+	api_v1.RespondWithCreated(w, images)
+}
+
+func (rs *Resolver) AdminUpdateProductImagesOrder(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		ProductId string   `json:"product_id"`
+		ImageIds  []string `json:"image_ids"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	if err := tl.Validate(data.ProductId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Product id: "+err.Error())
+		return
+	}
+	for _, imageId := range data.ImageIds {
+		if err := tl.Validate(imageId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Image ids: "+err.Error())
+			return
+		}
+	}
+
+	err := storage.UpdateProductImagesOrder(r.Context(), rs.App.Postgres, data.ProductId, data.ImageIds)
+	if err == storage.FailedUpdate {
+		api_v1.RespondWithConflict(w, "Image ids: the list must contain every image of the product exactly once")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update product images order", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminDeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	imageId := r.FormValue("image_id")
+	if err := tl.Validate(imageId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Image id: "+err.Error())
+		return
+	}
+
+	err := storage.DeleteProductImage(r.Context(), rs.App.Postgres, imageId)
+	if err == storage.FailedDelete {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Image was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete product image", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = rs.removeProductImageBlobs(r.Context(), imageId); err != nil {
+		rs.App.Logger.NewWarn("error in remove product image files", err)
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
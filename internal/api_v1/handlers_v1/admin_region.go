@@ -0,0 +1,111 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+func (rs *Resolver) AdminGetRegions(w http.ResponseWriter, r *http.Request) {
+	regions, err := storage.AdminGetRegions(r.Context(), rs.App.Postgres)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get regions", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, regions)
+}
+
+func (rs *Resolver) AdminGetPlatforms(w http.ResponseWriter, r *http.Request) {
+	platforms, err := storage.AdminGetPlatforms(r.Context(), rs.App.Postgres)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get platforms", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, platforms)
+}
+
+func (rs *Resolver) AdminGetActivationInstructions(w http.ResponseWriter, r *http.Request) {
+	serviceName := r.FormValue("service_name")
+
+	instructions, err := storage.GetActivationInstructions(r.Context(), rs.App.Postgres, serviceName)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get activation instructions", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, instructions)
+}
+
+func (rs *Resolver) AdminUpdateActivationInstruction(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		ServiceName string `json:"service_name"`
+		RegionName  string `json:"region_name"`
+		Instruction string `json:"instruction"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.ServiceName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Service name: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.RegionName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Region name: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.Instruction, tl.IsNotBlank(true), tl.IsMinMaxLen(MinInstructionLength, MaxInstructionLength), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Instruction: "+err.Error())
+		return
+	}
+
+	// Block 2 - create or replace the instruction
+	err := storage.UpdateActivationInstruction(r.Context(), rs.App.Postgres, data.ServiceName, data.RegionName, data.Instruction)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Service or region was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update activation instruction", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminDeleteActivationInstruction(w http.ResponseWriter, r *http.Request) {
+	serviceName := r.FormValue("service_name")
+	regionName := r.FormValue("region_name")
+	if err := tl.Validate(serviceName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Service name: "+err.Error())
+		return
+	}
+	if err := tl.Validate(regionName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Region name: "+err.Error())
+		return
+	}
+
+	err := storage.DeleteActivationInstruction(r.Context(), rs.App.Postgres, serviceName, regionName)
+	if err == storage.FailedDelete {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Activation instruction was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete activation instruction", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
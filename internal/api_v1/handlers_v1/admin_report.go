@@ -0,0 +1,62 @@
+package handlers_v1
+
+import (
+	"net/http"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	"time"
+)
+
+// ReportDefaultPeriod is the period of the reports and statements without the bounds
+const ReportDefaultPeriod = 30 * 24 * time.Hour
+
+// reportPeriod reads the from and to bounds of the report, the missing bounds are the last ReportDefaultPeriod.
+// It responds with an error if the bounds are invalid.
+func reportPeriod(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	to := r.FormValue("to")
+	if to == "" {
+		to = time.Now().Format(time.DateTime)
+	} else if _, err := time.Parse(time.DateTime, to); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "To: the value must be in the YYYY-MM-DD hh:mm:ss format")
+		return "", "", false
+	}
+	from := r.FormValue("from")
+	if from == "" {
+		toTime, _ := time.Parse(time.DateTime, to)
+		from = toTime.Add(-ReportDefaultPeriod).Format(time.DateTime)
+	} else if _, err := time.Parse(time.DateTime, from); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "From: the value must be in the YYYY-MM-DD hh:mm:ss format")
+		return "", "", false
+	}
+	if from >= to {
+		api_v1.RespondWithUnprocessableEntity(w, "From: the period must start before it ends")
+		return "", "", false
+	}
+
+	return from, to, true
+}
+
+func (rs *Resolver) AdminGetMarginReport(w http.ResponseWriter, r *http.Request) {
+	group := r.FormValue("group")
+	if group == "" {
+		group = storage.MarginGroupVariant
+	}
+	if !storage.IsMarginGroup(group) {
+		api_v1.RespondWithUnprocessableEntity(w, "Group: the value must be one of order, variant, supplier, day, week or month")
+		return
+	}
+
+	from, to, ok := reportPeriod(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := storage.GetMarginReport(r.Context(), rs.App.Postgres, group, from, to)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get margin report", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, report)
+}
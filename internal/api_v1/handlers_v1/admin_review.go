@@ -0,0 +1,123 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+type adminReviewsResponse struct {
+	Reviews []storage.AdminReview `json:"reviews"`
+	Total   int                   `json:"total"`
+	Page    int                   `json:"page"`
+	Limit   int                   `json:"limit"`
+}
+
+func (rs *Resolver) AdminGetReviews(w http.ResponseWriter, r *http.Request) {
+	page, limit, errText := getPagination(r, AdminReviewsDefaultLimit, AdminReviewsMaxLimit)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+	state := r.FormValue("state")
+	if state != "" && state != storage.ReviewStatePending && state != storage.ReviewStatePublished && state != storage.ReviewStateRejected {
+		api_v1.RespondWithUnprocessableEntity(w, "State: unknown state")
+		return
+	}
+	productId := r.FormValue("product_id")
+	if productId != "" {
+		if err := tl.Validate(productId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Product id: "+err.Error())
+			return
+		}
+	}
+
+	reviews, total, err := storage.GetAdminReviews(r.Context(), rs.App.Postgres, state, productId, limit, (page-1)*limit)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get reviews", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, adminReviewsResponse{
+		Reviews: reviews,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	})
+}
+
+func (rs *Resolver) AdminModerateReview(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		ReviewId string `json:"review_id"`
+		State    string `json:"state"`
+		Reason   string `json:"reason"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - data validation
+	if err = tl.Validate(data.ReviewId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Review id: "+err.Error())
+		return
+	}
+	if data.State != storage.ReviewStatePublished && data.State != storage.ReviewStateRejected {
+		api_v1.RespondWithUnprocessableEntity(w, "State: the review can only be published or rejected")
+		return
+	}
+	if data.Reason != "" {
+		if err = tl.Validate(data.Reason, tl.IsMinMaxLen(MinReasonLength, MaxReasonLength), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Reason: "+err.Error())
+			return
+		}
+	}
+
+	// Block 2 - moderate the review
+	err = storage.UpdateReviewState(r.Context(), rs.App.Postgres, jwtData.AccountUuid, data.ReviewId, data.State, data.Reason)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Review was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in moderate review", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminDeleteReview(w http.ResponseWriter, r *http.Request) {
+	reviewId := r.FormValue("review_id")
+	if err := tl.Validate(reviewId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Review id: "+err.Error())
+		return
+	}
+
+	err := storage.DeleteAdminReview(r.Context(), rs.App.Postgres, reviewId)
+	if err == storage.FailedDelete {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Review was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete review", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,219 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+// isCommissionPercent validates the commission of the seller, it is the percent with up to 2 decimals
+func isCommissionPercent() func(string) error {
+	return func(str string) error {
+		if err := tl.IsMoney()(str); err != nil {
+			return err
+		}
+		if percent, _ := strconv.ParseFloat(str, 64); percent > MaxCommissionPercent {
+			return errors.New("the value must not exceed " + strconv.Itoa(MaxCommissionPercent))
+		}
+		return nil
+	}
+}
+
+func (rs *Resolver) AdminGetSellers(w http.ResponseWriter, r *http.Request) {
+	sellers, err := storage.GetSellers(r.Context(), rs.App.Postgres)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get sellers", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, sellers)
+}
+
+func (rs *Resolver) AdminCreateSeller(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		AccountId         string `json:"account_id"`
+		CommissionPercent string `json:"commission_percent"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.AccountId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Account id: "+err.Error())
+		return
+	}
+	// The empty commission is the default one
+	if data.CommissionPercent != "" {
+		if err := tl.Validate(data.CommissionPercent, isCommissionPercent(), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Commission percent: "+err.Error())
+			return
+		}
+	}
+
+	// Block 2 - turn the user into the seller
+	err := storage.CreateSeller(r.Context(), rs.App.Postgres, data.AccountId, data.CommissionPercent)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "User was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in create seller", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminUpdateSeller(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		AccountId         string `json:"account_id"`
+		CommissionPercent string `json:"commission_percent"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.AccountId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Account id: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.CommissionPercent, tl.IsNotBlank(true), isCommissionPercent(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Commission percent: "+err.Error())
+		return
+	}
+
+	// Block 2 - update the commission, the recorded sales keep the old one
+	err := storage.UpdateSeller(r.Context(), rs.App.Postgres, data.AccountId, data.CommissionPercent)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Seller was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update seller", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminGetSellerStatement(w http.ResponseWriter, r *http.Request) {
+	sellerId := r.FormValue("seller_id")
+	if err := tl.Validate(sellerId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Seller id: "+err.Error())
+		return
+	}
+	from, to, ok := reportPeriod(w, r)
+	if !ok {
+		return
+	}
+
+	isSeller, err := storage.CheckSeller(r.Context(), rs.App.Postgres, sellerId)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in check seller", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	} else if !isSeller {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Seller was not found")
+		return
+	}
+
+	statement, err := storage.GetSellerStatement(r.Context(), rs.App.Postgres, sellerId, from, to)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get seller statement", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, statement)
+}
+
+func (rs *Resolver) AdminGetPayouts(w http.ResponseWriter, r *http.Request) {
+	sellerId := r.FormValue("seller_id")
+	if sellerId != "" {
+		if err := tl.Validate(sellerId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Seller id: "+err.Error())
+			return
+		}
+	}
+	// The requested payouts are shown by default, they are the ones waiting for the decision
+	state := r.FormValue("state")
+	if state == "" {
+		state = storage.PayoutStateRequested
+	} else if state == "all" {
+		state = ""
+	} else if state != storage.PayoutStateApproved && state != storage.PayoutStateRejected && state != storage.PayoutStateRequested {
+		api_v1.RespondWithUnprocessableEntity(w, "State: the value must be one of requested, approved, rejected or all")
+		return
+	}
+
+	payouts, err := storage.GetPayouts(r.Context(), rs.App.Postgres, sellerId, state)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get payouts", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, payouts)
+}
+
+func (rs *Resolver) AdminApprovePayout(w http.ResponseWriter, r *http.Request) {
+	rs.decidePayout(w, r, true)
+}
+
+func (rs *Resolver) AdminRejectPayout(w http.ResponseWriter, r *http.Request) {
+	rs.decidePayout(w, r, false)
+}
+
+func (rs *Resolver) decidePayout(w http.ResponseWriter, r *http.Request, approve bool) {
+	// Block 0 - decode data
+	var data struct {
+		PayoutId string `json:"payout_id"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.PayoutId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Payout id: "+err.Error())
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 2 - decide the payout
+	err = storage.DecidePayout(r.Context(), rs.App.Postgres, data.PayoutId, jwtData.AccountUuid, approve)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Requested payout was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in decide payout", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,134 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+func (rs *Resolver) AdminGetSuppliers(w http.ResponseWriter, r *http.Request) {
+	suppliers, err := storage.GetSuppliers(r.Context(), rs.App.Postgres)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get suppliers", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, suppliers)
+}
+
+func (rs *Resolver) AdminCreateSupplier(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		SupplierName string `json:"supplier_name"`
+		Contact      string `json:"contact"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.SupplierName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Supplier name: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.Contact, tl.IsNotBlank(false), tl.IsMinMaxLen(0, MaxContactLength), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Contact: "+err.Error())
+		return
+	}
+
+	// Block 2 - create the supplier
+	err := storage.CreateSupplier(r.Context(), rs.App.Postgres, data.SupplierName, data.Contact)
+	if errText := storage.PgErrorsHandle(err, "Supplier name"); errText != "" {
+		api_v1.RespondWithConflict(w, errText)
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in create supplier", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminUpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		SupplierName string  `json:"supplier_name"`
+		NewName      *string `json:"new_name"`
+		Contact      *string `json:"contact"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.SupplierName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Supplier name: "+err.Error())
+		return
+	}
+	if data.NewName == nil && data.Contact == nil {
+		api_v1.RespondWithUnprocessableEntity(w, "No values")
+		return
+	}
+	if data.NewName != nil {
+		if err := tl.Validate(*data.NewName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "New name: "+err.Error())
+			return
+		}
+	}
+	if data.Contact != nil {
+		if err := tl.Validate(*data.Contact, tl.IsNotBlank(false), tl.IsMinMaxLen(0, MaxContactLength), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Contact: "+err.Error())
+			return
+		}
+	}
+
+	// Block 2 - update the supplier
+	err := storage.UpdateSupplier(r.Context(), rs.App.Postgres, data.SupplierName, data.NewName, data.Contact)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Supplier was not found")
+		return
+	} else if errText := storage.PgErrorsHandle(err, "New name"); errText != "" {
+		api_v1.RespondWithConflict(w, errText)
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update supplier", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminDeleteSupplier(w http.ResponseWriter, r *http.Request) {
+	supplierName := r.FormValue("supplier_name")
+	if err := tl.Validate(supplierName, tl.TextFieldValidatorsWithSpaces()...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Supplier name: "+err.Error())
+		return
+	}
+
+	// The supplier of the uploaded batches is kept for the margin reports
+	err := storage.DeleteSupplier(r.Context(), rs.App.Postgres, supplierName)
+	if err == storage.FailedDelete {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Supplier was not found")
+		return
+	} else if errText := storage.PgErrorsHandle(err, "Supplier name"); errText != "" {
+		api_v1.RespondWithConflict(w, errText)
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete supplier", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,300 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/auth"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type adminUsersResponse struct {
+	Users []storage.AdminUser `json:"users"`
+	Total int                 `json:"total"`
+	Page  int                 `json:"page"`
+	Limit int                 `json:"limit"`
+}
+
+type adminUserResponse struct {
+	User       storage.AdminUser   `json:"user"`
+	OAuthLinks []storage.OAuthLink `json:"oauth_links"`
+	Orders     []storage.OrderData `json:"orders"`
+}
+
+// getPagination reads the page and the limit query params
+func getPagination(r *http.Request, defaultLimit, maxLimit int) (int, int, string) {
+	page, limit := 1, defaultLimit
+
+	if value := r.FormValue("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return 0, 0, "Page: the value must be a positive integer"
+		}
+		page = parsed
+	}
+	if value := r.FormValue("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLimit {
+			return 0, 0, "Limit: the value must be between 1 and " + strconv.Itoa(maxLimit)
+		}
+		limit = parsed
+	}
+
+	return page, limit, ""
+}
+
+func (rs *Resolver) AdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	page, limit, errText := getPagination(r, AdminUsersDefaultLimit, AdminUsersMaxLimit)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+	searchText := r.FormValue("search")
+	state := r.FormValue("state")
+	if state != "" && state != storage.AccountStateActive && state != storage.AccountStateBlocked && state != storage.AccountStateDeleted {
+		api_v1.RespondWithUnprocessableEntity(w, "State: unknown state")
+		return
+	}
+
+	users, total, err := storage.GetAdminUsers(r.Context(), rs.App.Postgres, searchText, state, limit, (page-1)*limit)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get users", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, adminUsersResponse{
+		Users: users,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+	})
+}
+
+func (rs *Resolver) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
+		return
+	}
+
+	user, err := storage.GetAdminUser(r.Context(), rs.App.Postgres, id)
+	if err == pgx.ErrNoRows {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "User was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get user", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	links, err := storage.GetOAuthLinks(r.Context(), rs.App.Postgres, id)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get oauth links", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	orders, err := storage.GetUserOrders(r.Context(), rs.App.Postgres, id)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get orders", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if orders == nil {
+		orders = []storage.OrderData{}
+	}
+
+	api_v1.RespondOK(w, adminUserResponse{
+		User:       user,
+		OAuthLinks: links,
+		Orders:     orders,
+	})
+}
+
+type adminUserActionRequest struct {
+	AccountId string `json:"account_id"`
+	Reason    string `json:"reason"`
+}
+
+// decodeAdminUserAction decodes and validates the account id and, if required, the reason
+func decodeAdminUserAction(w http.ResponseWriter, r *http.Request, reasonRequired bool) (adminUserActionRequest, bool) {
+	var data adminUserActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return data, false
+	}
+
+	if err := tl.Validate(data.AccountId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Account id: "+err.Error())
+		return data, false
+	}
+	if reasonRequired || data.Reason != "" {
+		if err := tl.Validate(data.Reason, tl.IsNotBlank(true), tl.IsMinMaxLen(MinReasonLength, MaxReasonLength), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Reason: "+err.Error())
+			return data, false
+		}
+	}
+
+	return data, true
+}
+
+func (rs *Resolver) updateUserAccountState(w http.ResponseWriter, r *http.Request, state string, reasonRequired bool) {
+	data, ok := decodeAdminUserAction(w, r, reasonRequired)
+	if !ok {
+		return
+	}
+
+	err := storage.UpdateUserAccountState(r.Context(), rs.App.Postgres, data.AccountId, state, data.Reason)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Active or blocked user was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update user account state", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AdminBlockUser(w http.ResponseWriter, r *http.Request) {
+	rs.updateUserAccountState(w, r, storage.AccountStateBlocked, true)
+}
+
+func (rs *Resolver) AdminUnblockUser(w http.ResponseWriter, r *http.Request) {
+	rs.updateUserAccountState(w, r, storage.AccountStateActive, false)
+}
+
+func (rs *Resolver) AdminResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	data, ok := decodeAdminUserAction(w, r, false)
+	if !ok {
+		return
+	}
+
+	user, err := storage.GetAdminUser(r.Context(), rs.App.Postgres, data.AccountId)
+	if err == pgx.ErrNoRows {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "User was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get user", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if user.State == storage.AccountStateDeleted {
+		api_v1.RespondWithConflict(w, "This account has been deleted")
+		return
+	}
+
+	// Block 1 - remove the password and revoke all the sessions
+	if err = storage.DeleteUserPassword(r.Context(), rs.App.Postgres, data.AccountId); err != nil {
+		rs.App.Logger.NewWarn("error in delete user password", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = storage.CreateTokensRevocation(r.Context(), rs.App.Redis, data.AccountId, auth.TokenExpirationTime); err != nil {
+		rs.App.Logger.NewWarn("error in revoke account tokens", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 2 - send the recovery link
+	response := struct {
+		EmailSent bool `json:"email_sent"`
+	}{}
+	if user.Email != nil {
+		if err = rs.sendPasswordRecovery(r, data.AccountId, user.Nickname, *user.Email, true); err != nil {
+			rs.App.Logger.NewWarn("error in sent password recovery", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		response.EmailSent = true
+	}
+
+	// Block 3 - send the result
+	api_v1.RespondOK(w, response)
+}
+
+func (rs *Resolver) AdminImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	data, ok := decodeAdminUserAction(w, r, true)
+	if !ok {
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - check the user
+	user, err := storage.GetAdminUser(r.Context(), rs.App.Postgres, data.AccountId)
+	if err == pgx.ErrNoRows {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "User was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get user", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if user.State != storage.AccountStateActive {
+		api_v1.RespondWithConflict(w, "Only active accounts can be impersonated")
+		return
+	}
+
+	// Block 2 - record the audit trail and issue the token
+	expiresAt := time.Now().Add(auth.ImpersonationExpirationTime)
+	impersonationId, err := storage.CreateImpersonation(r.Context(), rs.App.Postgres, jwtData.AccountUuid, data.AccountId, data.Reason, getClientIp(r), expiresAt)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in create impersonation", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	token, err := auth.GenerateImpersonationJwt(data.AccountId, jwtData.AccountUuid, expiresAt, rs.App.Config.App.Jwt)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in generated jwt", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	response := struct {
+		ImpersonationId string `json:"impersonation_id"`
+		Token           string `json:"token"`
+		ExpiresAt       string `json:"expires_at"`
+	}{
+		ImpersonationId: impersonationId,
+		Token:           token,
+		ExpiresAt:       expiresAt.UTC().Format(time.DateTime),
+	}
+	api_v1.RespondWithCreated(w, response)
+}
+
+func (rs *Resolver) AdminGetImpersonations(w http.ResponseWriter, r *http.Request) {
+	accountId := r.FormValue("account_id")
+	if accountId != "" {
+		if err := tl.Validate(accountId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Account id: "+err.Error())
+			return
+		}
+	}
+
+	impersonations, err := storage.GetImpersonations(r.Context(), rs.App.Postgres, accountId)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get impersonations", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, impersonations)
+}
@@ -8,6 +8,8 @@ import (
 	"test-server-go/internal/storage"
 	tl "test-server-go/internal/tools"
 	"time"
+
+	"github.com/jackc/pgx/v4"
 )
 
 type authUserResponse struct {
@@ -21,15 +23,16 @@ type authUserResponse struct {
 }
 
 type authAdminResponse struct {
-	Token              string  `json:"token"`
-	Role               string  `json:"role"`
-	Uuid               string  `json:"uuid"`
-	Login              string  `json:"login"`
-	Surname            string  `json:"surname"`
-	Name               string  `json:"name"`
-	Patronymic         *string `json:"patronymic"`
-	RegistrationMethod string  `json:"registration_method"`
-	AvatarUrl          string  `json:"avatar_url"`
+	Token              string   `json:"token"`
+	Role               string   `json:"role"`
+	Uuid               string   `json:"uuid"`
+	Login              string   `json:"login"`
+	Surname            string   `json:"surname"`
+	Name               string   `json:"name"`
+	Patronymic         *string  `json:"patronymic"`
+	Permissions        []string `json:"permissions"`
+	RegistrationMethod string   `json:"registration_method"`
+	AvatarUrl          string   `json:"avatar_url"`
 }
 
 func (rs *Resolver) AuthSignup(w http.ResponseWriter, r *http.Request) {
@@ -228,6 +231,10 @@ func (rs *Resolver) AuthLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Block 2 - check for an exists nickname and email
+	if !rs.checkLoginLock(w, r, loginLockIpPrefix+getClientIp(r)) {
+		return
+	}
+
 	nicknameExist, emailExist, err := storage.CheckUser(r.Context(), rs.App.Postgres, nickname, email)
 	if err != nil {
 		rs.App.Logger.NewWarn("error in checked the user existence", err)
@@ -235,6 +242,7 @@ func (rs *Resolver) AuthLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !nicknameExist && !emailExist {
+		rs.registerUserLoginFailure(r, "", "", "")
 		if nickname == "" {
 			api_v1.RedRespond(w, http.StatusNotFound, "Not found", "User with this email was not found")
 			return
@@ -250,6 +258,9 @@ func (rs *Resolver) AuthLogin(w http.ResponseWriter, r *http.Request) {
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	if !rs.checkLoginLock(w, r, loginLockAccountPrefix+userUuid) {
+		return
+	}
 
 	// Get account state and check on exists
 	state, role, err := storage.GetStateAccount(r.Context(), rs.App.Postgres, userUuid)
@@ -273,21 +284,32 @@ func (rs *Resolver) AuthLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check account role
-	if role != storage.AccountRoleUser {
+	if !tl.StringInSlice(role, storage.CustomerRoles) {
 		api_v1.RedRespond(w, http.StatusForbidden, "Forbidden", "This account has a different role")
 		return
 	}
 
+	// Accounts created through Google or Telegram may have no password
+	if base64PasswordHash == "" {
+		api_v1.RedRespond(w, http.StatusUnauthorized, "Unauthorized", "This account has no password. Sign in with the linked Google or Telegram account or recover the password")
+		return
+	}
+
 	result, err := auth.CompareHashPasswords(data.Password, base64PasswordHash, base64Salt)
 	if err != nil {
 		rs.App.Logger.NewWarn("error in compare hash passwords", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	} else if result == false {
+		rs.registerUserLoginFailure(r, userUuid, scannedNickname, scannedEmail)
 		api_v1.RedRespond(w, http.StatusUnauthorized, "Unauthorized", "Invalid password")
 		return
 	}
 
+	if err = storage.DeleteLoginFailures(r.Context(), rs.App.Redis, loginLockAccountPrefix+userUuid); err != nil {
+		rs.App.Logger.NewWarn("error in delete login failures", err)
+	}
+
 	// Block 4 - generate JWT
 	jwtToken, err := auth.GenerateJwt(userUuid, rs.App.Config.App.Jwt)
 	if err != nil {
@@ -299,7 +321,7 @@ func (rs *Resolver) AuthLogin(w http.ResponseWriter, r *http.Request) {
 	// Block 5 - send the result
 	response := authUserResponse{
 		Token:              jwtToken,
-		Role:               storage.AccountRoleUser,
+		Role:               role,
 		Uuid:               userUuid,
 		Nickname:           scannedNickname,
 		Email:              scannedEmail,
@@ -358,6 +380,10 @@ func (rs *Resolver) AuthAlogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Block 2 - check for an exists login
+	if !rs.checkLoginLock(w, r, loginLockIpPrefix+getClientIp(r)) {
+		return
+	}
+
 	loginExist, err := storage.CheckAdmin(r.Context(), rs.App.Postgres, data.Login)
 	if err != nil {
 		rs.App.Logger.NewWarn("error in checked the user existence", err)
@@ -365,6 +391,7 @@ func (rs *Resolver) AuthAlogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !loginExist {
+		rs.registerUserLoginFailure(r, "", "", "")
 		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Admin with this login was not found")
 		return
 	}
@@ -375,6 +402,9 @@ func (rs *Resolver) AuthAlogin(w http.ResponseWriter, r *http.Request) {
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	if !rs.checkLoginLock(w, r, loginLockAccountPrefix+adminUuid) {
+		return
+	}
 
 	// Get account state and check on exists
 	state, role, err := storage.GetStateAccount(r.Context(), rs.App.Postgres, adminUuid)
@@ -398,7 +428,7 @@ func (rs *Resolver) AuthAlogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check account role
-	if role != storage.AccountRoleAdmin {
+	if !tl.StringInSlice(role, storage.EmployeeRoles) {
 		api_v1.RedRespond(w, http.StatusForbidden, "Forbidden", "This account has a different role")
 		return
 	}
@@ -409,10 +439,22 @@ func (rs *Resolver) AuthAlogin(w http.ResponseWriter, r *http.Request) {
 		api_v1.RespondWithInternalServerError(w)
 		return
 	} else if result == false {
+		rs.registerUserLoginFailure(r, adminUuid, "", "")
 		api_v1.RedRespond(w, http.StatusUnauthorized, "Unauthorized", "Invalid password")
 		return
 	}
 
+	if err = storage.DeleteLoginFailures(r.Context(), rs.App.Redis, loginLockAccountPrefix+adminUuid); err != nil {
+		rs.App.Logger.NewWarn("error in delete login failures", err)
+	}
+
+	permissions, err := storage.GetRolePermissions(r.Context(), rs.App.Postgres, role)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get role permissions", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
 	// Block 4 - generate JWT
 	jwtToken, err := auth.GenerateJwt(adminUuid, rs.App.Config.App.Jwt)
 	if err != nil {
@@ -424,7 +466,8 @@ func (rs *Resolver) AuthAlogin(w http.ResponseWriter, r *http.Request) {
 	// Block 5 - send the result
 	response := authAdminResponse{
 		Token:              jwtToken,
-		Role:               storage.AccountRoleAdmin,
+		Role:               role,
+		Permissions:        permissions,
 		Uuid:               adminUuid,
 		Login:              scannedLogin,
 		Surname:            surname,
@@ -437,6 +480,137 @@ func (rs *Resolver) AuthAlogin(w http.ResponseWriter, r *http.Request) {
 	api_v1.RespondWithCreated(w, response)
 }
 
-func (rs *Resolver) AuthLoginWithToken(w http.ResponseWriter, r *http.Request)           {}
-func (rs *Resolver) AuthRecoverPassword(w http.ResponseWriter, r *http.Request)          {}
-func (rs *Resolver) AuthRecoverPasswordWithToken(w http.ResponseWriter, r *http.Request) {}
+func (rs *Resolver) AuthLoginWithToken(w http.ResponseWriter, r *http.Request) {}
+
+// sendPasswordRecovery stores the recovery token and sends the link to the user email
+func (rs *Resolver) sendPasswordRecovery(r *http.Request, accountUuid, nickname, email string, forced bool) error {
+	recoveryUrlToken, err := tl.GenerateURLToken(TokenLength)
+	if err != nil {
+		return err
+	}
+
+	if err = storage.CreateTempPasswordRecovery(r.Context(), rs.App.Redis, accountUuid, recoveryUrlToken, TempRegistrationExpiration); err != nil {
+		return err
+	}
+
+	url, err := tl.UrlSetParam(rs.App.Config.App.Service.Url.Client+"/recover-password", "token", recoveryUrlToken)
+	if err != nil {
+		return err
+	}
+
+	return rs.App.Mailer.SendPasswordRecovery(nickname, email, url, rs.App.Config.App.Service.Url.Client, forced)
+}
+
+func (rs *Resolver) AuthRecoverPassword(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		Email string `json:"email"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.Email, tl.IsNotBlank(true), tl.IsMinMaxLen(MinEmailLength, MaxEmailLength), tl.IsNotContainsSpace(), tl.IsEmail(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Email: "+err.Error())
+		return
+	}
+
+	// Block 2 - send the recovery link only to the active user.
+	// The result is the same for an unknown email to not disclose the registered ones.
+	userUuid, nickname, email, _, _, err := storage.GetUserData(r.Context(), rs.App.Postgres, "", data.Email)
+	if err == pgx.ErrNoRows {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get user data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	state, role, err := storage.GetStateAccount(r.Context(), rs.App.Postgres, userUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("Error in founding account in the list", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if state != storage.AccountStateActive || !tl.StringInSlice(role, storage.CustomerRoles) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err = rs.sendPasswordRecovery(r, userUuid, nickname, email, false); err != nil {
+		rs.App.Logger.NewWarn("error in sent password recovery", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) AuthRecoverPasswordWithToken(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.Token, tl.IsNotBlank(true), tl.IsLen(TokenLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Token: "+err.Error())
+		return
+	}
+	if err := tl.Validate(data.Password, tl.IsNotBlank(true), tl.IsMinMaxLen(MinPasswordLength, MaxPasswordLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Password: "+err.Error())
+		return
+	}
+
+	// Block 2 - get the account
+	accountUuid, err := storage.GetTempPasswordRecovery(r.Context(), rs.App.Redis, data.Token)
+	if err == storage.NoResults {
+		api_v1.RespondWithConflict(w, "Token: the token is invalid or expired")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in checked password recovery temp record", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - set the new password and revoke all the sessions
+	base64PasswordHash, base64Salt, err := auth.HashPassword(data.Password, "")
+	if err != nil {
+		rs.App.Logger.NewWarn("error in generated hash password", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = storage.UpdateUserPassword(r.Context(), rs.App.Postgres, accountUuid, base64PasswordHash, base64Salt); err != nil {
+		rs.App.Logger.NewWarn("error in update user password", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = storage.CreateTokensRevocation(r.Context(), rs.App.Redis, accountUuid, auth.TokenExpirationTime); err != nil {
+		rs.App.Logger.NewWarn("error in revoke account tokens", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = storage.DeleteTempPasswordRecovery(r.Context(), rs.App.Redis, data.Token); err != nil {
+		rs.App.Logger.NewWarn("error in delete password recovery temp record", err)
+	}
+	if err = storage.DeleteLoginFailures(r.Context(), rs.App.Redis, loginLockAccountPrefix+accountUuid); err != nil {
+		rs.App.Logger.NewWarn("error in delete login failures", err)
+	}
+
+	// Block 4 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
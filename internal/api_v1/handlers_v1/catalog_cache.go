@@ -0,0 +1,75 @@
+package handlers_v1
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	"time"
+)
+
+// serveCatalog sends the catalog response from the Redis cache or builds it with the build function and caches it.
+// The errors of the build function are returned without a response, so the handler answers them.
+// The cache failures are only logged, the response is built from Postgres then.
+func (rs *Resolver) serveCatalog(w http.ResponseWriter, r *http.Request, key string, build func() (interface{}, error)) error {
+	generation, modifiedAt, err := storage.GetCatalogCacheState(r.Context(), rs.App.Redis)
+	cacheAvailable := err == nil
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get catalog cache state", err)
+	}
+
+	var content []byte
+	if cacheAvailable {
+		content, err = storage.GetCatalogCache(r.Context(), rs.App.Redis, generation, key)
+		if err != nil && err != storage.NoResults {
+			rs.App.Logger.NewWarn("error in get catalog cache", err)
+		}
+	}
+
+	if content == nil {
+		result, err := build()
+		if err != nil {
+			return err
+		}
+		if content, err = json.Marshal(result); err != nil {
+			return err
+		}
+		content = append(content, '\n')
+
+		if cacheAvailable {
+			if err = storage.CreateCatalogCache(r.Context(), rs.App.Redis, generation, key, content, rs.catalogCacheExpiration(r.Context())); err != nil {
+				rs.App.Logger.NewWarn("error in create catalog cache", err)
+			}
+		} else {
+			modifiedAt = time.Now()
+		}
+	}
+
+	sum := sha256.Sum256(content)
+	api_v1.RespondOKWithValidators(w, r, content, `"`+hex.EncodeToString(sum[:16])+`"`, modifiedAt, CatalogCacheControl)
+
+	return nil
+}
+
+// catalogCacheExpiration keeps the entries until the nearest campaign start or end at most, because the prices change then
+func (rs *Resolver) catalogCacheExpiration(ctx context.Context) time.Duration {
+	untilChange, err := storage.GetNextCampaignChange(ctx, rs.App.Postgres)
+	if err == storage.NoResults {
+		return CatalogCacheExpiration
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get next campaign change", err)
+		return CatalogCacheMinExpiration
+	}
+
+	return max(min(untilChange, CatalogCacheExpiration), CatalogCacheMinExpiration)
+}
+
+// invalidateCatalogCache drops the cached catalog responses after the change of the stock, the prices or the images
+func (rs *Resolver) invalidateCatalogCache(ctx context.Context) {
+	if err := storage.UpdateCatalogCacheState(ctx, rs.App.Redis); err != nil {
+		rs.App.Logger.NewWarn("error in invalidate catalog cache", err)
+	}
+}
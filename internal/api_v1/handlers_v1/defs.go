@@ -3,7 +3,8 @@ package handlers_v1
 import "time"
 
 const (
-	TokenLength = 256
+	TokenLength      = 256
+	OAuthStateLength = 64
 
 	UUIDLength = 36
 
@@ -25,5 +26,71 @@ const (
 	MinTextLength = 3
 	MaxTextLength = 64
 
+	MinReasonLength = 3
+	MaxReasonLength = 512
+
+	MinReviewLength = 3
+	MaxReviewLength = 4096
+
+	MinInstructionLength = 3
+	MaxInstructionLength = 4096
+
+	MaxSupplierSkuLength = 128
+	MaxContactLength     = 256
+
+	// MaxCommissionPercent is the upper bound of the seller commission
+	MaxCommissionPercent = 100
+
+	// RegionHeader carries the region chosen by the buyer in the storefront, it takes precedence over the region of the profile
+	RegionHeader = "X-Region"
+
+	ProductsDefaultLimit = 24
+	ProductsMaxLimit     = 100
+	RelatedProductsLimit = 8
+
+	MaxSlugLength           = 128
+	SeoDescriptionMaxLength = 160
+
+	AdminUsersDefaultLimit = 20
+	AdminUsersMaxLimit     = 100
+
+	AdminAuditDefaultLimit = 50
+	AdminAuditMaxLimit     = 200
+
+	ReviewsDefaultLimit      = 10
+	ReviewsMaxLimit          = 50
+	AdminReviewsDefaultLimit = 50
+	AdminReviewsMaxLimit     = 200
+
+	PriceHistoryDefaultDays = 90
+	PriceHistoryMaxDays     = 730
+
 	TempRegistrationExpiration = 10 * time.Minute
+	OAuthStateExpiration       = 10 * time.Minute
+
+	ProfileImageMaxSize = 2 * 1024 * 1024 // 2 MB
+
+	SvgFileMaxSize           = 512 * 1024 // 512 KB
+	SvgContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox"
+
+	ProductImageMaxSize     = 10 * 1024 * 1024 // 10 MB
+	ProductImageMaxPixels   = 40000000         // 40 megapixels
+	ProductImagesMaxUpload  = 10
+	ProductImageJpegQuality = 85
+
+	BlobSignedUrlExpiration = 15 * time.Minute
+
+	// The catalog responses are revalidated on every request, the unchanged ones are answered with 304 from the Redis cache
+	CatalogCacheControl       = "public, no-cache"
+	CatalogCacheExpiration    = 10 * time.Minute
+	CatalogCacheMinExpiration = 1 * time.Second
+
+	ProductMainImageCacheControl      = "public, max-age=300"
+	ProductImageRenditionCacheControl = "public, max-age=31536000, immutable"
+
+	LoginFailuresWindow           = 1 * time.Hour
+	LoginAccountFailuresThreshold = 5
+	LoginIpFailuresThreshold      = 20
+	LoginLockBaseDuration         = 1 * time.Minute
+	LoginLockMaxDuration          = 1 * time.Hour
 )
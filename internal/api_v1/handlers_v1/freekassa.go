@@ -1,6 +1,7 @@
 package handlers_v1
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"test-server-go/internal/api_v1"
@@ -32,19 +33,73 @@ func (rs *Resolver) FreekassaNotification(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	email, nickname, content, productName, variantName, serviceName, itemName, err := storage.GetDataForFreekassa(r.Context(), rs.App.Postgres, splitID[len(splitID)-1])
+	orderId := splitID[len(splitID)-1]
+	fulfilled, err := storage.PayOrder(r.Context(), rs.App.Postgres, orderId)
 	if err != nil {
-		rs.App.Logger.NewWarn("error in get data for freekassa", err)
+		rs.App.Logger.NewWarn("error in pay order", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	// The sold count of the variant has changed
+	rs.invalidateCatalogCache(r.Context())
 
-	err = rs.App.Mailer.SendOrderContent(email, nickname, productName+" - "+variantName, serviceName, itemName, content, rs.App.Config.App.Service.Url.Client)
+	mail, err := storage.GetOrderMail(r.Context(), rs.App.Postgres, orderId)
 	if err != nil {
-		rs.App.Logger.NewWarn("error in send order content", err)
+		rs.App.Logger.NewWarn("error in get order mail", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	// The content of the order awaiting the supplier is minted and e-mailed by the supplier fulfiller
+	if !mail.AwaitingContent || !mail.OnDemand {
+		if err = rs.deliverOrderMail(orderId, mail); err != nil {
+			rs.App.Logger.NewWarn("error in send order content", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+	// The content taken by the payment may also fulfil the orders paid earlier
+	others := make([]string, 0, len(fulfilled))
+	for _, fulfilledId := range fulfilled {
+		if fulfilledId != orderId {
+			others = append(others, fulfilledId)
+		}
+	}
+	rs.SendOrderMails(r.Context(), others)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// sendOrderMail sends the content of the order, the order awaiting the content gets the confirmation of the payment.
+// The account without an e-mail gets nothing, the content is shown in the orders of its profile.
+func (rs *Resolver) sendOrderMail(ctx context.Context, orderId string) error {
+	mail, err := storage.GetOrderMail(ctx, rs.App.Postgres, orderId)
+	if err != nil {
+		return err
+	}
+
+	return rs.deliverOrderMail(orderId, mail)
+}
+
+func (rs *Resolver) deliverOrderMail(orderId string, mail storage.OrderMail) error {
+	if mail.Email == nil {
+		rs.App.Logger.NewInfo("the order mail is skipped, the account of the order " + orderId + " has no e-mail")
+		return nil
+	}
+
+	if mail.AwaitingContent && mail.ReleaseAt == "" {
+		return rs.App.Mailer.SendDelayedOrderNotice(*mail.Email, mail.Nickname, mail.ProductName+" - "+mail.VariantName, rs.App.Config.App.Service.Url.Client)
+	} else if mail.AwaitingContent {
+		return rs.App.Mailer.SendPreorderNotice(*mail.Email, mail.Nickname, mail.ProductName+" - "+mail.VariantName, mail.ReleaseAt, rs.App.Config.App.Service.Url.Client)
+	}
+	return rs.App.Mailer.SendOrderContent(*mail.Email, mail.Nickname, mail.ProductName+" - "+mail.VariantName, mail.ServiceName, mail.ItemName, mail.Content, mail.Instruction, rs.App.Config.App.Service.Url.Client)
+}
+
+// SendOrderMails sends the e-mails of the orders with sendOrderMail, mostly the content of the fulfilled awaiting orders.
+// The failed e-mails are only logged as the content is already shown in the orders of the profile.
+func (rs *Resolver) SendOrderMails(ctx context.Context, orderIds []string) {
+	for _, orderId := range orderIds {
+		if err := rs.sendOrderMail(ctx, orderId); err != nil {
+			rs.App.Logger.NewWarn("error in send pre-order content", err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package handlers_v1
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+	"time"
+)
+
+const (
+	loginLockAccountPrefix = "account:"
+	loginLockIpPrefix      = "ip:"
+)
+
+// getClientIp returns the client address set by RealIpMiddleware, it is the connection address
+// unless the connection comes from a trusted proxy
+func getClientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// getLoginLockDuration doubles the lock duration for every failure over the threshold
+func getLoginLockDuration(failures, threshold int64) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	duration := time.Duration(float64(LoginLockBaseDuration) * math.Pow(2, float64(failures-threshold)))
+	if duration <= 0 || duration > LoginLockMaxDuration {
+		duration = LoginLockMaxDuration
+	}
+	return duration
+}
+
+// checkLoginLock responds with 429 and returns false if the key is temporarily locked
+func (rs *Resolver) checkLoginLock(w http.ResponseWriter, r *http.Request, key string) bool {
+	ttl, err := storage.CheckLoginLockExists(r.Context(), rs.App.Redis, key)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in check login lock", err)
+		api_v1.RespondWithInternalServerError(w)
+		return false
+	}
+	if ttl > 0 {
+		seconds := int(math.Ceil(ttl.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		api_v1.RedRespond(w,
+			http.StatusTooManyRequests,
+			"Too many requests",
+			"Too many failed login attempts. Try again in "+strconv.Itoa(seconds)+" seconds")
+		return false
+	}
+
+	return true
+}
+
+// registerLoginFailure counts the failed attempt and locks the key when the threshold is exceeded.
+// It returns the lock expiration time, or zero time if the key was not locked.
+func (rs *Resolver) registerLoginFailure(ctx context.Context, key string, threshold int64) time.Time {
+	failures, err := storage.CreateLoginFailure(ctx, rs.App.Redis, key, LoginFailuresWindow)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in create login failure", err)
+		return time.Time{}
+	}
+
+	duration := getLoginLockDuration(failures, threshold)
+	if duration == 0 {
+		return time.Time{}
+	}
+
+	if err = storage.CreateLoginLock(ctx, rs.App.Redis, key, duration); err != nil {
+		rs.App.Logger.NewWarn("error in create login lock", err)
+		return time.Time{}
+	}
+
+	// Notify only about the first lock in the window
+	if failures != threshold {
+		return time.Time{}
+	}
+	return time.Now().Add(duration)
+}
+
+// registerUserLoginFailure counts the failure for the account and the ip, and notifies the user by email about the lock
+func (rs *Resolver) registerUserLoginFailure(r *http.Request, accountUuid, nickname, email string) {
+	ip := getClientIp(r)
+	rs.registerLoginFailure(r.Context(), loginLockIpPrefix+ip, LoginIpFailuresThreshold)
+
+	if accountUuid == "" {
+		return
+	}
+	lockedUntil := rs.registerLoginFailure(r.Context(), loginLockAccountPrefix+accountUuid, LoginAccountFailuresThreshold)
+	if lockedUntil.IsZero() || email == "" {
+		return
+	}
+
+	go func() {
+		if err := rs.App.Mailer.SendLoginLockNotice(email, nickname, ip, lockedUntil.UTC().Format(time.DateTime), rs.App.Config.App.Service.Url.Client); err != nil {
+			rs.App.Logger.NewWarn("error in send login lock notice", err)
+		}
+	}()
+}
+
+func (rs *Resolver) AdminGetLoginLocks(w http.ResponseWriter, r *http.Request) {
+	locks, err := storage.GetLoginLocks(r.Context(), rs.App.Redis)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get login locks", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, locks)
+}
+
+func (rs *Resolver) AdminDeleteLoginLock(w http.ResponseWriter, r *http.Request) {
+	accountId := r.FormValue("account_id")
+	ip := r.FormValue("ip")
+
+	var key string
+	if accountId != "" {
+		if err := tl.Validate(accountId, tl.UuidFieldValidators(true)...); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Account id: "+err.Error())
+			return
+		}
+		key = loginLockAccountPrefix + accountId
+	} else if ip != "" {
+		if net.ParseIP(ip) == nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Ip: the value is not an ip address")
+			return
+		}
+		key = loginLockIpPrefix + ip
+	} else {
+		api_v1.RespondWithUnprocessableEntity(w, "Account id and Ip: the values are empty")
+		return
+	}
+
+	if err := storage.DeleteLoginFailures(r.Context(), rs.App.Redis, key); err != nil {
+		rs.App.Logger.NewWarn("error in delete login failures", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,435 @@
+package handlers_v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/auth"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+	"unicode"
+)
+
+// generateFreeNickname builds a valid nickname from the provider data and makes it unique
+func (rs *Resolver) generateFreeNickname(ctx context.Context, base string) (string, error) {
+	var buf strings.Builder
+	for _, r := range tl.CyrillicToLatin(base) {
+		switch {
+		case r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)), r == '_', r == '-':
+			buf.WriteRune(r)
+		case unicode.IsSpace(r):
+			buf.WriteRune('_')
+		}
+	}
+	nickname := buf.String()
+	if len(nickname) > MaxNicknameLength-7 {
+		nickname = nickname[:MaxNicknameLength-7]
+	}
+	if len(nickname) < MinNicknameLength {
+		nickname = "user_" + nickname
+	}
+
+	for i := 0; i < 10; i++ {
+		candidate := nickname
+		if i > 0 {
+			suffix, err := tl.GenerateSixDigitNumber()
+			if err != nil {
+				return "", err
+			}
+			candidate += "_" + suffix
+		}
+
+		nicknameExist, _, err := storage.CheckUser(ctx, rs.App.Postgres, candidate, "")
+		if err != nil {
+			return "", err
+		}
+		if !nicknameExist {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate a free nickname for %q", base)
+}
+
+// checkUserAccount checks the account state and role, and responds with an error if the account cannot sign in.
+// The role of the account is returned.
+func (rs *Resolver) checkUserAccount(w http.ResponseWriter, r *http.Request, accountUuid string) (string, bool) {
+	state, role, err := storage.GetStateAccount(r.Context(), rs.App.Postgres, accountUuid)
+	if err != nil {
+		api_v1.RespondWithInternalServerError(w)
+		rs.App.Logger.NewWarn("Error in founding account in the list", err)
+		return "", false
+	} else if state == "" {
+		api_v1.RedRespond(w, http.StatusUnauthorized, "Unauthorized", "The account was not found in the list of users")
+		return "", false
+	}
+
+	switch state {
+	case storage.AccountStateBlocked:
+		api_v1.RedRespond(w, http.StatusForbidden, "Forbidden", "This account has been blocked")
+		return "", false
+	case storage.AccountStateDeleted:
+		api_v1.RedRespond(w, http.StatusForbidden, "Forbidden", "This account has been deleted")
+		return "", false
+	}
+
+	if !tl.StringInSlice(role, storage.CustomerRoles) {
+		api_v1.RedRespond(w, http.StatusForbidden, "Forbidden", "This account has a different role")
+		return "", false
+	}
+
+	return role, true
+}
+
+func (rs *Resolver) respondWithUserToken(w http.ResponseWriter, r *http.Request, accountUuid string) {
+	role, ok := rs.checkUserAccount(w, r, accountUuid)
+	if !ok {
+		return
+	}
+
+	nickname, email, registrationMethod, err := storage.GetUserProfile(r.Context(), rs.App.Postgres, accountUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get user profile", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	jwtToken, err := auth.GenerateJwt(accountUuid, rs.App.Config.App.Jwt)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in generated jwt", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	response := authUserResponse{
+		Token:              jwtToken,
+		Role:               role,
+		Uuid:               accountUuid,
+		Nickname:           nickname,
+		Email:              email,
+		RegistrationMethod: registrationMethod,
+		AvatarUrl:          rs.App.Config.App.Service.Url.Server + storage.ResourcesProfileImagePath + accountUuid,
+	}
+
+	api_v1.RespondWithCreated(w, response)
+}
+
+func (rs *Resolver) newOAuthState(w http.ResponseWriter, r *http.Request, provider, accountUuid string) (string, bool) {
+	state, err := tl.GenerateURLToken(OAuthStateLength)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in generated url token", err)
+		api_v1.RespondWithInternalServerError(w)
+		return "", false
+	}
+
+	if err = storage.CreateOAuthState(r.Context(), rs.App.Redis, state, provider, accountUuid, OAuthStateExpiration); err != nil {
+		rs.App.Logger.NewWarn("error in inserted oauth state", err)
+		api_v1.RespondWithInternalServerError(w)
+		return "", false
+	}
+
+	return state, true
+}
+
+type googleCallbackData struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// exchangeGoogleCode validates the state and exchanges the code, returning the google user and the account bound to the state
+func (rs *Resolver) exchangeGoogleCode(w http.ResponseWriter, r *http.Request) (*auth.GoogleUser, string, bool) {
+	var data googleCallbackData
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return nil, "", false
+	}
+
+	if err := tl.Validate(data.State, tl.IsNotBlank(true), tl.IsLen(OAuthStateLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "State: "+err.Error())
+		return nil, "", false
+	}
+	if err := tl.Validate(data.Code, tl.IsNotBlank(true), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Code: "+err.Error())
+		return nil, "", false
+	}
+
+	provider, accountUuid, err := storage.GetOAuthState(r.Context(), rs.App.Redis, data.State)
+	if err == storage.NoResults || (err == nil && provider != storage.OAuthProviderGoogle) {
+		api_v1.RespondWithConflict(w, "State: the state is invalid or expired")
+		return nil, "", false
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get oauth state", err)
+		api_v1.RespondWithInternalServerError(w)
+		return nil, "", false
+	}
+
+	user, err := rs.App.Google.Exchange(r.Context(), data.Code)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in exchange google code", err)
+		api_v1.RedRespond(w, http.StatusUnauthorized, "Unauthorized", "Google authorization failed")
+		return nil, "", false
+	}
+
+	return user, accountUuid, true
+}
+
+// verifyTelegramData decodes and verifies the Telegram Login Widget data
+func (rs *Resolver) verifyTelegramData(w http.ResponseWriter, r *http.Request) (*auth.TelegramUser, bool) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return nil, false
+	}
+
+	data := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if value == nil {
+			continue
+		}
+		data[key] = fmt.Sprint(value)
+	}
+
+	user, err := auth.VerifyTelegramLogin(data, rs.App.Config.OAuth.Telegram.BotToken, auth.TelegramLoginMaxAge)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in verify telegram login", err)
+		api_v1.RedRespond(w, http.StatusUnauthorized, "Unauthorized", "Telegram authorization failed")
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (rs *Resolver) AuthGoogleUrl(w http.ResponseWriter, r *http.Request) {
+	state, ok := rs.newOAuthState(w, r, storage.OAuthProviderGoogle, "")
+	if !ok {
+		return
+	}
+
+	response := struct {
+		Url string `json:"url"`
+	}{
+		Url: rs.App.Google.AuthCodeUrl(state),
+	}
+
+	api_v1.RespondOK(w, response)
+}
+
+func (rs *Resolver) AuthGoogle(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - check the state and exchange the code
+	user, stateAccountUuid, ok := rs.exchangeGoogleCode(w, r)
+	if !ok {
+		return
+	}
+	if stateAccountUuid != "" {
+		api_v1.RespondWithConflict(w, "State: the state was issued for linking an account")
+		return
+	}
+
+	// Block 1 - find the linked account
+	accountUuid, err := storage.GetOAuthAccount(r.Context(), rs.App.Postgres, storage.OAuthProviderGoogle, user.Subject)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get oauth account", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 2 - link the account with the same verified email or create a new one
+	if accountUuid == "" {
+		_, emailExist, err := storage.CheckUser(r.Context(), rs.App.Postgres, "", user.Email)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in checked the user existence", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		if emailExist {
+			accountUuid, _, _, _, _, err = storage.GetUserData(r.Context(), rs.App.Postgres, "", user.Email)
+			if err != nil {
+				rs.App.Logger.NewWarn("error in get user data", err)
+				api_v1.RespondWithInternalServerError(w)
+				return
+			}
+			if err = storage.CreateOAuthLink(r.Context(), rs.App.Postgres, accountUuid, storage.OAuthProviderGoogle, user.Subject, user.Email, "", ""); err != nil {
+				api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Google account"))
+				return
+			}
+		} else {
+			nickname, err := rs.generateFreeNickname(r.Context(), strings.Split(user.Email, "@")[0])
+			if err != nil {
+				rs.App.Logger.NewWarn("error in generate nickname", err)
+				api_v1.RespondWithInternalServerError(w)
+				return
+			}
+			accountUuid, err = storage.CreateOAuthUser(r.Context(), rs.App.Postgres, storage.OAuthProviderGoogle, user.Subject, user.Email, nickname, "", "")
+			if err != nil {
+				rs.App.Logger.NewWarn("error in registration oauth user", err)
+				api_v1.RespondWithInternalServerError(w)
+				return
+			}
+		}
+	}
+
+	// Block 3 - send the result
+	rs.respondWithUserToken(w, r, accountUuid)
+}
+
+func (rs *Resolver) AuthTelegram(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - verify the widget data
+	user, ok := rs.verifyTelegramData(w, r)
+	if !ok {
+		return
+	}
+
+	// Block 1 - find the linked account or create a new one
+	accountUuid, err := storage.GetOAuthAccount(r.Context(), rs.App.Postgres, storage.OAuthProviderTelegram, user.Id)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get oauth account", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if accountUuid == "" {
+		base := user.Username
+		if base == "" {
+			base = user.FirstName + " " + user.LastName
+		}
+		nickname, err := rs.generateFreeNickname(r.Context(), base)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in generate nickname", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		accountUuid, err = storage.CreateOAuthUser(r.Context(), rs.App.Postgres, storage.OAuthProviderTelegram, user.Id, "", nickname, user.Username, user.PhotoUrl)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in registration oauth user", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+
+	// Block 2 - send the result
+	rs.respondWithUserToken(w, r, accountUuid)
+}
+
+func (rs *Resolver) UserOAuthLinks(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	links, err := storage.GetOAuthLinks(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get oauth links", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, links)
+}
+
+func (rs *Resolver) UserGoogleLinkUrl(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	state, ok := rs.newOAuthState(w, r, storage.OAuthProviderGoogle, jwtData.AccountUuid)
+	if !ok {
+		return
+	}
+
+	response := struct {
+		Url string `json:"url"`
+	}{
+		Url: rs.App.Google.AuthCodeUrl(state),
+	}
+
+	api_v1.RespondOK(w, response)
+}
+
+func (rs *Resolver) UserGoogleLink(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	user, stateAccountUuid, ok := rs.exchangeGoogleCode(w, r)
+	if !ok {
+		return
+	}
+	if stateAccountUuid != jwtData.AccountUuid {
+		api_v1.RespondWithConflict(w, "State: the state was issued for another account")
+		return
+	}
+
+	if err = storage.CreateOAuthLink(r.Context(), rs.App.Postgres, jwtData.AccountUuid, storage.OAuthProviderGoogle, user.Subject, user.Email, "", ""); err != nil {
+		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Google account"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) UserTelegramLink(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	user, ok := rs.verifyTelegramData(w, r)
+	if !ok {
+		return
+	}
+
+	if err = storage.CreateOAuthLink(r.Context(), rs.App.Postgres, jwtData.AccountUuid, storage.OAuthProviderTelegram, user.Id, "", user.Username, user.PhotoUrl); err != nil {
+		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Telegram account"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) userOAuthUnlink(w http.ResponseWriter, r *http.Request, provider string) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = storage.DeleteOAuthLink(r.Context(), rs.App.Postgres, jwtData.AccountUuid, provider); err == storage.LastLoginMethod {
+		api_v1.RespondWithConflict(w, "Set a password or link another account before unlinking the last one")
+		return
+	} else if err == storage.FailedDelete {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "This account is not linked")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete oauth link", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) UserGoogleUnlink(w http.ResponseWriter, r *http.Request) {
+	rs.userOAuthUnlink(w, r, storage.OAuthProviderGoogle)
+}
+
+func (rs *Resolver) UserTelegramUnlink(w http.ResponseWriter, r *http.Request) {
+	rs.userOAuthUnlink(w, r, storage.OAuthProviderTelegram)
+}
@@ -1,32 +1,279 @@
 package handlers_v1
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"strings"
 	"test-server-go/internal/api_v1"
+	"test-server-go/internal/auth"
 	"test-server-go/internal/storage"
 	tl "test-server-go/internal/tools"
+	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
-func (rs *Resolver) ProductsDataForMainpage(w http.ResponseWriter, r *http.Request) {
-	id := r.FormValue("id")
-	if id != "" {
-		if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
-			api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
-			return
+// getStorefrontRegion returns the region of the buyer for the catalog requested without the region parameter:
+// the region of the request header, then the one of the profile of the signed-in buyer, like the checkout.
+// The catalog is public, so the request without a valid token gets all the regions.
+func (rs *Resolver) getStorefrontRegion(r *http.Request) (string, string, error) {
+	if strings.TrimSpace(r.Header.Get(RegionHeader)) != "" {
+		return rs.getBuyerRegion(r, "")
+	}
+
+	tokenString := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if tokenString == "" {
+		return "", "", nil
+	}
+	jwtData, err := auth.ParseJwtToken(tokenString, rs.App.Config.App.Jwt)
+	if err != nil || jwtData.ExpiresAt == nil || jwtData.ExpiresAt.Time.Before(time.Now()) {
+		return "", "", nil
+	}
+
+	region, err := storage.GetUserRegion(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+	return region, "", err
+}
+
+// getCatalogFilter reads the catalog filter, the region defaults to the one of the buyer
+func (rs *Resolver) getCatalogFilter(w http.ResponseWriter, r *http.Request) (storage.MainpageFilter, bool) {
+	filter, errText := getMainpageFilter(r)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return filter, false
+	}
+
+	// The response depends on the region of the buyer, so the caches must not share it between the buyers
+	w.Header().Add("Vary", RegionHeader+", Authorization")
+	if filter.Region == "" {
+		region, errText, err := rs.getStorefrontRegion(r)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in get buyer region", err)
+			api_v1.RespondWithInternalServerError(w)
+			return filter, false
+		} else if errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText)
+			return filter, false
 		}
+		filter.Region = strings.ToLower(region)
+	}
+
+	return filter, true
+}
+
+type mainpageProductsResponse struct {
+	Products []storage.Product `json:"products"`
+	Total    int               `json:"total"`
+	Page     int               `json:"page"`
+	Limit    int               `json:"limit"`
+}
+
+// getFormValues returns the values of the repeated parameter, the values may also be separated by commas
+func getFormValues(r *http.Request, key string) []string {
+	if err := r.ParseForm(); err != nil {
+		return nil
+	}
+
+	var values []string
+	for _, value := range r.Form[key] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+
+	return values
+}
+
+// getFormFloat returns nil if the parameter is not set
+func getFormFloat(r *http.Request, key string) (*float64, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		return nil, strconv.ErrSyntax
+	}
+
+	return &parsed, nil
+}
+
+// getMainpageFilter reads the storefront search and filters from the query parameters
+func getMainpageFilter(r *http.Request) (storage.MainpageFilter, string) {
+	filter := storage.MainpageFilter{
+		VariantId:    r.FormValue("id"),
+		SearchText:   r.FormValue("search"),
+		Types:        getFormValues(r, "type"),
+		Subtypes:     getFormValues(r, "subtype"),
+		Services:     getFormValues(r, "service"),
+		Platforms:    getFormValues(r, "platform"),
+		Region:       strings.TrimSpace(r.FormValue("region")),
+		DiscountOnly: r.FormValue("discount_only") == "true",
+		InStockOnly:  r.FormValue("in_stock") == "true",
+		SortBy:       r.FormValue("sort_by"),
+		SortType:     r.FormValue("sort_type"),
+	}
+
+	if filter.VariantId != "" {
+		if err := tl.Validate(filter.VariantId, tl.UuidFieldValidators(true)...); err != nil {
+			return filter, "Id: " + err.Error()
+		}
+	}
+
+	var err error
+	if filter.MinPrice, err = getFormFloat(r, "min_price"); err != nil {
+		return filter, "Min price: the value must be a non-negative number"
+	}
+	if filter.MaxPrice, err = getFormFloat(r, "max_price"); err != nil {
+		return filter, "Max price: the value must be a non-negative number"
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, "Max price: the value must not be less than the min price"
+	}
+
+	return filter, ""
+}
+
+func (rs *Resolver) ProductsDataForMainpage(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - data validation
+	filter, ok := rs.getCatalogFilter(w, r)
+	if !ok {
+		return
+	}
+	page, limit, errText := getPagination(r, ProductsDefaultLimit, ProductsMaxLimit)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
 	}
-	sortBy := r.FormValue("sort_by")
-	sortType := r.FormValue("sort_type")
-	searchText := r.FormValue("search")
+	filter.Limit, filter.Offset = limit, (page-1)*limit
 
-	// Block 1 - get products for mainpage
-	products, err := storage.GetProductsForMainpage(r.Context(), rs.App.Postgres, rs.App.Config.App.Service.Url.Server, id, searchText, sortBy, sortType)
+	// Block 1 - get products for mainpage and send the result
+	err := rs.serveCatalog(w, r, "mainpage:"+filter.CacheKey(), func() (interface{}, error) {
+		products, total, err := storage.GetProductsForMainpage(r.Context(), rs.App.Postgres, rs.App.Config.App.Service.Url.Server, filter)
+		return mainpageProductsResponse{
+			Products: products,
+			Total:    total,
+			Page:     page,
+			Limit:    limit,
+		}, err
+	})
 	if err != nil {
 		rs.App.Logger.NewWarn("error in get products for mainpage", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+}
+
+func (rs *Resolver) ProductsFacets(w http.ResponseWriter, r *http.Request) {
+	filter, ok := rs.getCatalogFilter(w, r)
+	if !ok {
+		return
+	}
+
+	err := rs.serveCatalog(w, r, "facets:"+filter.CacheKey(), func() (interface{}, error) {
+		return storage.GetMainpageFacets(r.Context(), rs.App.Postgres, filter)
+	})
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get products facets", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+}
+
+type productSeo struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	CanonicalUrl string `json:"canonical_url"`
+	ImageUrl     string `json:"image_url"`
+}
+
+type productPageResponse struct {
+	storage.Product
+	Images  []storage.ProductImage   `json:"images"`
+	Related []storage.RelatedProduct `json:"related"`
+	Seo     productSeo               `json:"seo"`
+}
+
+// seoDescription cuts the text on the word boundary, so it fits the search engine snippet
+func seoDescription(text string, maxLength int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	cut := string(runes[:maxLength-1])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+
+	return strings.TrimRight(cut, ",.:;–- ") + "…"
+}
+
+func (rs *Resolver) ProductGetBySlug(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	if err := tl.Validate(slug, tl.IsNotBlank(true), tl.IsMinMaxLen(1, MaxSlugLength), tl.IsNotContainsSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Slug: "+err.Error())
+		return
+	}
+
+	// Block 1 - get the product page and send the result
+	err := rs.serveCatalog(w, r, "product:"+slug, func() (interface{}, error) {
+		return rs.getProductPage(r.Context(), slug)
+	})
+	if err == nil {
+		return
+	}
+
+	// Block 2 - the old slugs are redirected to the current one
+	if err == storage.NoResults {
+		newSlug, err := storage.GetProductSlugRedirect(r.Context(), rs.App.Postgres, slug)
+		if err == storage.NoResults {
+			api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Product was not found")
+			return
+		} else if err != nil {
+			rs.App.Logger.NewWarn("error in get product slug redirect", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		http.Redirect(w, r, strings.TrimSuffix(r.URL.Path, slug)+newSlug, http.StatusMovedPermanently)
+		return
+	}
+
+	rs.App.Logger.NewWarn("error in get product page", err)
+	api_v1.RespondWithInternalServerError(w)
+}
+
+// getProductPage returns the product with the gallery, the related products and the SEO data or NoResults
+func (rs *Resolver) getProductPage(ctx context.Context, slug string) (productPageResponse, error) {
+	product, err := storage.GetProductBySlug(ctx, rs.App.Postgres, rs.App.Config.App.Service.Url.Server, slug)
+	if err != nil {
+		return productPageResponse{}, err
+	}
+
+	images, err := storage.GetProductImages(ctx, rs.App.Postgres, rs.App.Config.App.Service.Url.Server, product.ProductId)
+	if err != nil {
+		return productPageResponse{}, err
+	}
+
+	related, err := storage.GetRelatedProducts(ctx, rs.App.Postgres, rs.App.Config.App.Service.Url.Server, product.ProductId, RelatedProductsLimit)
+	if err != nil {
+		return productPageResponse{}, err
+	}
 
-	// Block 2 - send the result
-	api_v1.RespondOK(w, products)
+	return productPageResponse{
+		Product: product,
+		Images:  images,
+		Related: related,
+		Seo: productSeo{
+			Title:        product.ProductName,
+			Description:  seoDescription(product.Description, SeoDescriptionMaxLength),
+			CanonicalUrl: rs.App.Config.App.Service.Url.Client + "/product/" + product.Slug,
+			ImageUrl:     product.ProductImageUrl,
+		},
+	}, nil
 }
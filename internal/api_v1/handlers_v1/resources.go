@@ -2,69 +2,215 @@ package handlers_v1
 
 import (
 	"github.com/go-chi/chi/v5"
+	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
+	"strconv"
 	"strings"
 	"test-server-go/internal/api_v1"
+	"test-server-go/internal/blobstore"
+	"test-server-go/internal/storage"
 	tl "test-server-go/internal/tools"
 )
 
-func (rs *Resolver) ResourcesGetProductImage(w http.ResponseWriter, r *http.Request) {
-	path, err := tl.GetExecutablePath()
+// Blob store directories of the uploaded resources
+const (
+	profileImagesDir = "profile_images"
+	productImagesDir = "product_images"
+	svgFilesDir      = "svg_files"
+)
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// getProfileImageKey returns the key of the profile image named after its content, so the replaced image gets a new key
+func getProfileImageKey(accountId, contentHash, ext string) string {
+	return profileImagesDir + "/" + path.Base(accountId) + "-" + contentHash + ext
+}
+
+// profileImageETag returns the ETag of the profile image by the content hash in its key
+func profileImageETag(key string) string {
+	name := strings.TrimSuffix(path.Base(key), path.Ext(key))
+	return `"` + name[strings.LastIndex(name, "-")+1:] + `"`
+}
+
+// etagMatches reports whether the If-None-Match header of the request matches the ETag
+func etagMatches(r *http.Request, etag string) bool {
+	for _, value := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == "*" || value == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// getSvgFileKey returns the key of the service icon, the name is formatted the same way as in storage.GetSvgFileUrl
+func getSvgFileKey(serviceName string) string {
+	return svgFilesDir + "/" + path.Base(strings.ToLower(strings.ReplaceAll(serviceName, " ", "-"))) + ".svg"
+}
+
+// serveBlob redirects to the signed URL if the blob store gives it, so the API does not stream the file.
+// The store does not check the blob before the redirect, so the key must be known to exist from the database.
+// The signed URL keeps the content type and the cache control of the response, the ETag is checked before the redirect.
+// Otherwise the blob is sent with the headers, the seekable blobs support the conditional and range requests.
+func (rs *Resolver) serveBlob(w http.ResponseWriter, r *http.Request, key, contentType, cacheControl, etag string) {
+	if etag != "" && etagMatches(r, etag) {
+		w.Header().Set("ETag", etag)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	signedUrl, err := rs.App.Blob.SignedUrl(r.Context(), key, BlobSignedUrlExpiration,
+		blobstore.ResponseHeaders{ContentType: contentType, CacheControl: cacheControl})
 	if err != nil {
-		rs.App.Logger.NewWarn("error in get executable path", err)
+		rs.App.Logger.NewWarn("error in sign blob url", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	if signedUrl != "" {
+		// The redirect is cached for less time than the signature lives
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(BlobSignedUrlExpiration.Seconds())/2))
+		http.Redirect(w, r, signedUrl, http.StatusTemporaryRedirect)
+		return
+	}
 
-	dir := filepath.Join(path, "resources", "product_images")
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		rs.App.Logger.NewWarn("error in read files directory", err)
+	rs.sendBlob(w, r, key, contentType, cacheControl, etag)
+}
+
+// sendBlob streams the blob through the API, it is used when the response headers must be controlled by the API
+func (rs *Resolver) sendBlob(w http.ResponseWriter, r *http.Request, key, contentType, cacheControl, etag string) {
+	body, info, err := rs.App.Blob.Open(r.Context(), key)
+	if err == blobstore.ErrNotFound || err == blobstore.ErrInvalidKey {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "This file not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in open blob", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	defer body.Close()
+
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, seeker)
+		return
+	}
+
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if _, err = io.Copy(w, body); err != nil {
+		rs.App.Logger.NewWarn("error in send blob", err)
+	}
+}
 
-	var foundFile string
+func (rs *Resolver) ResourcesGetProfileImage(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	for _, file := range files {
-		if !file.IsDir() {
-			filename := file.Name()
-			fileID := strings.TrimSuffix(filename, filepath.Ext(filename))
-			if fileID == id {
-				foundFile = filename
-				break
-			}
-		}
+	if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
+		return
 	}
 
-	if foundFile == "" {
+	key, err := storage.GetProfileImageKey(r.Context(), rs.App.Postgres, strings.ToLower(id))
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get profile image", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if key == "" {
 		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "This file not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "image")
-	http.ServeFile(w, r, filepath.Join(dir, foundFile))
+	// The image may be replaced at any time, so it is revalidated with the ETag on every use
+	rs.serveBlob(w, r, key, imageContentType(key), "no-cache", profileImageETag(key))
 }
 
-func (rs *Resolver) ResourcesGetSvgFile(w http.ResponseWriter, r *http.Request) {
-	path, err := tl.GetExecutablePath()
-	if err != nil {
-		rs.App.Logger.NewWarn("error in get executable path", err)
+// imageContentType returns the content type by the extension of the uploaded image
+func imageContentType(key string) string {
+	for contentType, ext := range imageExtensions {
+		if strings.EqualFold(path.Ext(key), ext) {
+			return contentType
+		}
+	}
+	return ""
+}
+
+// serveProductImageRendition sends the rendition with the ETag, so the unchanged images are answered with 304
+func (rs *Resolver) serveProductImageRendition(w http.ResponseWriter, r *http.Request, imageId, contentHash, size, cacheControl string) {
+	rs.serveBlob(w, r, getProductImageKey(imageId, size), "image/jpeg", cacheControl, `"`+contentHash+"-"+size+`"`)
+}
+
+// ResourcesGetProductImage sends the main image of the product gallery
+func (rs *Resolver) ResourcesGetProductImage(w http.ResponseWriter, r *http.Request) {
+	id := strings.ToLower(chi.URLParam(r, "id"))
+	if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
+		return
+	}
+
+	imageId, contentHash, err := storage.GetProductMainImage(r.Context(), rs.App.Postgres, id)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "This file not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get product main image", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
 
-	dir := filepath.Join(path, "resources", "svg_files")
-	fileName := chi.URLParam(r, "id") + ".svg"
-	fullPath := filepath.Join(dir, fileName)
+	// The main image changes with the gallery order, so it is cached for a short time
+	rs.serveProductImageRendition(w, r, imageId, contentHash, storage.ProductImageMedium, ProductMainImageCacheControl)
+}
 
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+func (rs *Resolver) ResourcesGetProductImageRendition(w http.ResponseWriter, r *http.Request) {
+	id := strings.ToLower(chi.URLParam(r, "id"))
+	if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
+		return
+	}
+	size := chi.URLParam(r, "size")
+	if _, ok := productImageSizes[size]; !ok {
+		api_v1.RespondWithUnprocessableEntity(w, "Size: the value must be thumbnail, medium or large")
+		return
+	}
+
+	contentHash, err := storage.GetProductImageHash(r.Context(), rs.App.Postgres, id)
+	if err == storage.NoResults {
 		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "This file not found")
 		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get product image", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
 	}
 
-	w.Header().Set("Content-Type", "image/svg+xml")
-	http.ServeFile(w, r, fullPath)
+	// A new upload always gets a new image id, so the renditions never change
+	rs.serveProductImageRendition(w, r, id, contentHash, size, ProductImageRenditionCacheControl)
+}
+
+// ResourcesGetSvgFile sends the service icon with the policy forbidding the scripts and the external resources.
+// The icons are small and the object storage cannot set the policy, so they are never redirected to a signed URL.
+func (rs *Resolver) ResourcesGetSvgFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", SvgContentSecurityPolicy)
+	rs.sendBlob(w, r, getSvgFileKey(chi.URLParam(r, "id")), "image/svg+xml", "", "")
 }
@@ -0,0 +1,211 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type productReviewsResponse struct {
+	Reviews []storage.Review `json:"reviews"`
+	Total   int              `json:"total"`
+	Page    int              `json:"page"`
+	Limit   int              `json:"limit"`
+}
+
+func validateReviewRating(rating int) string {
+	if rating < 1 || rating > 5 {
+		return "Rating: the value must be from 1 to 5"
+	}
+	return ""
+}
+
+func validateReviewText(text string) string {
+	if err := tl.Validate(text, tl.IsNotBlank(true), tl.IsMinMaxLen(MinReviewLength, MaxReviewLength), tl.IsTrimmedSpace()); err != nil {
+		return "Review text: " + err.Error()
+	}
+	return ""
+}
+
+func (rs *Resolver) ProductGetReviews(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - data validation
+	slug := chi.URLParam(r, "slug")
+	if err := tl.Validate(slug, tl.IsNotBlank(true), tl.IsMinMaxLen(1, MaxSlugLength), tl.IsNotContainsSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Slug: "+err.Error())
+		return
+	}
+	page, limit, errText := getPagination(r, ReviewsDefaultLimit, ReviewsMaxLimit)
+	if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+
+	// Block 1 - get the published reviews and send the result
+	err := rs.serveCatalog(w, r, "reviews:"+slug+":"+strconv.Itoa(page)+":"+strconv.Itoa(limit), func() (interface{}, error) {
+		reviews, total, err := storage.GetProductReviews(r.Context(), rs.App.Postgres, slug, limit, (page-1)*limit)
+		return productReviewsResponse{
+			Reviews: reviews,
+			Total:   total,
+			Page:    page,
+			Limit:   limit,
+		}, err
+	})
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get product reviews", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+}
+
+func (rs *Resolver) UserCreateReview(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		ProductId  string `json:"product_id"`
+		Rating     int    `json:"rating"`
+		ReviewText string `json:"review_text"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - data validation
+	if err = tl.Validate(data.ProductId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Product id: "+err.Error())
+		return
+	}
+	if errText := validateReviewRating(data.Rating); errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+	if errText := validateReviewText(data.ReviewText); errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+
+	// Block 2 - create the review, it is shown after the moderation
+	reviewId, err := storage.CreateReview(r.Context(), rs.App.Postgres, jwtData.AccountUuid, data.ProductId, data.Rating, data.ReviewText)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Product was not found")
+		return
+	} else if err == storage.NotVerifiedBuyer {
+		api_v1.RedRespond(w, http.StatusForbidden, "Forbidden", "Only the buyers of the product can review it")
+		return
+	} else if err == storage.QueryExists {
+		api_v1.RespondWithConflict(w, "Product id: the product has already been reviewed")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in create review", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	response := struct {
+		ReviewId string `json:"review_id"`
+		State    string `json:"state"`
+	}{
+		ReviewId: reviewId,
+		State:    storage.ReviewStatePending,
+	}
+	api_v1.RespondWithCreated(w, response)
+}
+
+func (rs *Resolver) UserUpdateReview(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		ReviewId   string  `json:"review_id"`
+		Rating     *int    `json:"rating"`
+		ReviewText *string `json:"review_text"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - data validation
+	if err = tl.Validate(data.ReviewId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Review id: "+err.Error())
+		return
+	}
+	if data.Rating == nil && data.ReviewText == nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Review: either rating or review_text must be set")
+		return
+	}
+	if data.Rating != nil {
+		if errText := validateReviewRating(*data.Rating); errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText)
+			return
+		}
+	}
+	if data.ReviewText != nil {
+		if errText := validateReviewText(*data.ReviewText); errText != "" {
+			api_v1.RespondWithUnprocessableEntity(w, errText)
+			return
+		}
+	}
+
+	// Block 2 - update the review, the published one is hidden until the next moderation
+	err = storage.UpdateReview(r.Context(), rs.App.Postgres, jwtData.AccountUuid, data.ReviewId, data.Rating, data.ReviewText)
+	if err == storage.FailedUpdate {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Review was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update review", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) UserDeleteReview(w http.ResponseWriter, r *http.Request) {
+	reviewId := r.FormValue("review_id")
+	if err := tl.Validate(reviewId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Review id: "+err.Error())
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	err = storage.DeleteReview(r.Context(), rs.App.Postgres, jwtData.AccountUuid, reviewId)
+	if err == storage.FailedDelete {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Review was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete review", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,6 +2,7 @@ package handlers_v1
 
 import (
 	"github.com/go-chi/chi/v5"
+	"net/http"
 	"strconv"
 	"test-server-go/internal/api_v1"
 	"test-server-go/internal/freekassa"
@@ -61,69 +62,209 @@ func (rs *Resolver) registerRoutes(r chi.Router) {
 	r.Route("/auth", func(r chi.Router) {
 		r.Post("/signup", rs.AuthSignup)
 		r.Post("/signup-with-token", rs.AuthSignupWithToken)
+		r.Post("/email-with-token", rs.AuthEmailWithToken)
+		r.Post("/delete-with-token", rs.AuthDeleteWithToken)
 		r.Post("/login", rs.AuthLogin)
 		r.Post("/alogin", rs.AuthAlogin)
+		r.Get("/google", rs.AuthGoogleUrl)
+		r.Post("/google", rs.AuthGoogle)
+		r.Post("/telegram", rs.AuthTelegram)
 		//r.Post("/login-with-token", rs.AuthLoginWithToken)
-		//r.Post("/recover-password", rs.AuthRecoverPassword)
-		//r.Post("/recover-password-with-token", rs.AuthRecoverPasswordWithToken)
+		r.Post("/recover-password", rs.AuthRecoverPassword)
+		r.Post("/recover-password-with-token", rs.AuthRecoverPasswordWithToken)
 	})
 	r.Route("/product", func(r chi.Router) {
 		r.Get("/mainpage", rs.ProductsDataForMainpage)
+		r.Get("/facets", rs.ProductsFacets)
+		r.Get("/{slug}", rs.ProductGetBySlug)
+		r.Get("/{slug}/reviews", rs.ProductGetReviews)
 	})
 	r.Route("/user", func(r chi.Router) {
-		r.Use(api_v1.JwtAuthMiddleware(rs.App.Postgres, rs.App.Redis, rs.App.Logger, rs.App.Config.App.Jwt, storage.AccountRoleUser))
+		r.Use(api_v1.JwtAuthMiddleware(rs.App.Postgres, rs.App.Redis, rs.App.Logger, rs.App.Config.App.Jwt, storage.CustomerRoles...))
 		r.Get("/order", rs.UserProfileOrders)
-		r.Post("/payment", rs.UserNewPayment)
+		r.With(api_v1.DenyImpersonationMiddleware).Post("/payment", rs.UserNewPayment)
+		r.Route("/wishlist", func(r chi.Router) {
+			r.Get("/", rs.UserGetWishlist)
+			r.With(api_v1.DenyImpersonationMiddleware).Post("/", rs.UserUpdateWishlist)
+			r.With(api_v1.DenyImpersonationMiddleware).Delete("/", rs.UserDeleteWishlist)
+		})
+		r.Route("/review", func(r chi.Router) {
+			r.Use(api_v1.DenyImpersonationMiddleware)
+			r.Post("/", rs.UserCreateReview)
+			r.Patch("/", rs.UserUpdateReview)
+			r.Delete("/", rs.UserDeleteReview)
+		})
 		r.Route("/profile", func(r chi.Router) {
-			r.Patch("/", rs.UserProfileUpdate)
-			r.Delete("/", rs.UserProfileDelete)
+			r.Group(func(r chi.Router) {
+				r.Use(api_v1.DenyImpersonationMiddleware)
+				r.Patch("/", rs.UserProfileUpdate)
+				r.Delete("/", rs.UserProfileDelete)
+				r.Get("/dump", rs.UserProfileDump)
+				r.Post("/image", rs.UserProfileImageUpload)
+				r.Delete("/image", rs.UserProfileImageDelete)
+			})
+			r.Route("/oauth", func(r chi.Router) {
+				r.Get("/", rs.UserOAuthLinks)
+				r.Group(func(r chi.Router) {
+					r.Use(api_v1.DenyImpersonationMiddleware)
+					r.Get("/google", rs.UserGoogleLinkUrl)
+					r.Post("/google", rs.UserGoogleLink)
+					r.Delete("/google", rs.UserGoogleUnlink)
+					r.Post("/telegram", rs.UserTelegramLink)
+					r.Delete("/telegram", rs.UserTelegramUnlink)
+				})
+			})
 		})
 		r.Post("/logout", rs.AuthLogout)
-		//r.Post("/dump", rs.UserProfileDump)
+	})
+	r.Route("/seller", func(r chi.Router) {
+		r.Use(api_v1.JwtAuthMiddleware(rs.App.Postgres, rs.App.Redis, rs.App.Logger, rs.App.Config.App.Jwt, storage.AccountRoleSeller))
+		r.Route("/variant", func(r chi.Router) {
+			r.Get("/", rs.SellerGetVariants)
+			r.Route("/upload", func(r chi.Router) {
+				r.Get("/", rs.SellerGetVariantUploads)
+				r.With(api_v1.DenyImpersonationMiddleware).Post("/", rs.SellerUploadVariant)
+				r.With(api_v1.DenyImpersonationMiddleware).Delete("/", rs.SellerDeleteVariantUpload)
+			})
+		})
+		r.Get("/sale", rs.SellerGetSales)
+		r.Get("/statement", rs.SellerGetStatement)
+		r.Route("/payout", func(r chi.Router) {
+			r.Get("/", rs.SellerGetPayouts)
+			r.With(api_v1.DenyImpersonationMiddleware).Post("/", rs.SellerCreatePayout)
+		})
 	})
 	r.Route("/admin", func(r chi.Router) {
-		r.Use(api_v1.JwtAuthMiddleware(rs.App.Postgres, rs.App.Redis, rs.App.Logger, rs.App.Config.App.Jwt, storage.AccountRoleAdmin))
+		r.Use(api_v1.JwtAuthMiddleware(rs.App.Postgres, rs.App.Redis, rs.App.Logger, rs.App.Config.App.Jwt, storage.EmployeeRoles...))
+		r.Use(api_v1.AuditMiddleware(rs.App.Postgres, rs.App.Logger))
+		can := func(permission string) func(http.Handler) http.Handler {
+			return api_v1.PermissionMiddleware(rs.App.Postgres, rs.App.Logger, permission)
+		}
 		r.Route("/product", func(r chi.Router) {
-			r.Get("/", rs.AdminGetProducts)
-			r.Post("/", rs.AdminAddProduct)
-			r.Delete("/", rs.AdminDeleteProduct)
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetProducts)
+			r.With(can(storage.PermissionCatalogWrite)).Post("/", rs.AdminAddProduct)
+			r.With(can(storage.PermissionCatalogWrite)).Patch("/", rs.AdminUpdateProduct)
+			r.With(can(storage.PermissionCatalogWrite)).Delete("/", rs.AdminDeleteProduct)
+			r.Route("/image", func(r chi.Router) {
+				r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetProductImages)
+				r.With(can(storage.PermissionCatalogWrite)).Post("/", rs.AdminUploadProductImages)
+				r.With(can(storage.PermissionCatalogWrite)).Patch("/", rs.AdminUpdateProductImagesOrder)
+				r.With(can(storage.PermissionCatalogWrite)).Delete("/", rs.AdminDeleteProductImage)
+			})
 		})
 		r.Route("/service", func(r chi.Router) {
-			r.Get("/", rs.AdminGetServices)
-			r.Post("/", rs.AdminAddService)
-			r.Patch("/", rs.AdminEditService)
-			r.Delete("/", rs.AdminDeleteService)
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetServices)
+			r.With(can(storage.PermissionCatalogWrite)).Post("/", rs.AdminAddService)
+			r.With(can(storage.PermissionCatalogWrite)).Patch("/", rs.AdminEditService)
+			r.With(can(storage.PermissionCatalogWrite)).Delete("/", rs.AdminDeleteService)
 		})
 		r.Route("/state", func(r chi.Router) {
-			r.Get("/", rs.AdminGetStates)
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetStates)
 		})
 		r.Route("/item", func(r chi.Router) {
-			r.Get("/", rs.AdminGetItems)
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetItems)
+		})
+		r.Route("/region", func(r chi.Router) {
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetRegions)
+		})
+		r.Route("/platform", func(r chi.Router) {
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetPlatforms)
+		})
+		r.Route("/activation-instruction", func(r chi.Router) {
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetActivationInstructions)
+			r.With(can(storage.PermissionCatalogWrite)).Post("/", rs.AdminUpdateActivationInstruction)
+			r.With(can(storage.PermissionCatalogWrite)).Delete("/", rs.AdminDeleteActivationInstruction)
 		})
 		r.Route("/type", func(r chi.Router) {
-			r.Get("/", rs.AdminGetTypes)
-			r.Post("/", rs.AdminAddType)
-			r.Patch("/", rs.AdminEditType)
-			r.Delete("/", rs.AdminDeleteType)
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetTypes)
+			r.With(can(storage.PermissionCatalogWrite)).Post("/", rs.AdminAddType)
+			r.With(can(storage.PermissionCatalogWrite)).Patch("/", rs.AdminEditType)
+			r.With(can(storage.PermissionCatalogWrite)).Delete("/", rs.AdminDeleteType)
 		})
 		r.Route("/subtype", func(r chi.Router) {
-			r.Get("/", rs.AdminGetSubtypes)
-			r.Post("/", rs.AdminAddSubtype)
-			r.Patch("/", rs.AdminEditSubtype)
-			r.Delete("/", rs.AdminDeleteSubtype)
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetSubtypes)
+			r.With(can(storage.PermissionCatalogWrite)).Post("/", rs.AdminAddSubtype)
+			r.With(can(storage.PermissionCatalogWrite)).Patch("/", rs.AdminEditSubtype)
+			r.With(can(storage.PermissionCatalogWrite)).Delete("/", rs.AdminDeleteSubtype)
 		})
 		r.Route("/variant", func(r chi.Router) {
-			r.Get("/", rs.AdminGetVariants)
-			r.Post("/", rs.AdminCreateVariant)
-			r.Patch("/", rs.AdminUpdateVariant)
-			r.Delete("/", rs.AdminDeleteVariant)
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetVariants)
+			r.With(can(storage.PermissionCatalogWrite)).Post("/", rs.AdminCreateVariant)
+			r.With(can(storage.PermissionCatalogWrite)).Patch("/", rs.AdminUpdateVariant)
+			r.With(can(storage.PermissionCatalogWrite)).Delete("/", rs.AdminDeleteVariant)
+			r.With(can(storage.PermissionCatalogRead)).Get("/price-history", rs.AdminGetVariantPriceHistory)
+			r.With(can(storage.PermissionCatalogRead)).Get("/bundle", rs.AdminGetBundleComponents)
+			r.With(can(storage.PermissionCatalogWrite)).Patch("/bundle", rs.AdminUpdateBundleComponents)
 			r.Route("/upload", func(r chi.Router) {
-				r.Get("/", rs.AdminGetVariantUploads)
-				r.Post("/", rs.AdminUploadVariant)
-				r.Delete("/", rs.AdminDeleteVariantUpload)
+				r.With(can(storage.PermissionContentRead)).Get("/", rs.AdminGetVariantUploads)
+				r.With(can(storage.PermissionContentWrite)).Post("/", rs.AdminUploadVariant)
+				r.With(can(storage.PermissionContentWrite)).Delete("/", rs.AdminDeleteVariantUpload)
 			})
 		})
+		r.Route("/preorder", func(r chi.Router) {
+			r.With(can(storage.PermissionOrdersRead)).Get("/", rs.AdminGetPreorders)
+		})
+		r.Route("/supplier", func(r chi.Router) {
+			r.With(can(storage.PermissionContentRead)).Get("/", rs.AdminGetSuppliers)
+			r.With(can(storage.PermissionContentWrite)).Post("/", rs.AdminCreateSupplier)
+			r.With(can(storage.PermissionContentWrite)).Patch("/", rs.AdminUpdateSupplier)
+			r.With(can(storage.PermissionContentWrite)).Delete("/", rs.AdminDeleteSupplier)
+		})
+		r.Route("/report", func(r chi.Router) {
+			r.Use(can(storage.PermissionReportsRead))
+			r.Get("/margin", rs.AdminGetMarginReport)
+		})
+		r.Route("/seller", func(r chi.Router) {
+			r.With(can(storage.PermissionSellersManage)).Get("/", rs.AdminGetSellers)
+			r.With(can(storage.PermissionSellersManage)).Post("/", rs.AdminCreateSeller)
+			r.With(can(storage.PermissionSellersManage)).Patch("/", rs.AdminUpdateSeller)
+			r.With(can(storage.PermissionPayoutsApprove)).Get("/statement", rs.AdminGetSellerStatement)
+		})
+		r.Route("/payout", func(r chi.Router) {
+			r.Use(can(storage.PermissionPayoutsApprove))
+			r.Get("/", rs.AdminGetPayouts)
+			r.Post("/approve", rs.AdminApprovePayout)
+			r.Post("/reject", rs.AdminRejectPayout)
+		})
+		r.Route("/campaign", func(r chi.Router) {
+			r.With(can(storage.PermissionCatalogRead)).Get("/", rs.AdminGetCampaigns)
+			r.With(can(storage.PermissionCatalogWrite)).Post("/", rs.AdminCreateCampaign)
+			r.With(can(storage.PermissionCatalogWrite)).Patch("/", rs.AdminUpdateCampaign)
+			r.With(can(storage.PermissionCatalogWrite)).Delete("/", rs.AdminDeleteCampaign)
+		})
+		r.Route("/review", func(r chi.Router) {
+			r.Use(can(storage.PermissionReviewsModerate))
+			r.Get("/", rs.AdminGetReviews)
+			r.Patch("/", rs.AdminModerateReview)
+			r.Delete("/", rs.AdminDeleteReview)
+		})
+		r.Route("/user", func(r chi.Router) {
+			r.With(can(storage.PermissionUsersRead)).Get("/", rs.AdminGetUsers)
+			r.With(can(storage.PermissionUsersRead)).Get("/detail", rs.AdminGetUser)
+			r.With(can(storage.PermissionUsersBlock)).Post("/block", rs.AdminBlockUser)
+			r.With(can(storage.PermissionUsersBlock)).Post("/unblock", rs.AdminUnblockUser)
+			r.With(can(storage.PermissionUsersPasswordReset)).Post("/password-reset", rs.AdminResetUserPassword)
+			r.With(can(storage.PermissionUsersImpersonate)).Post("/impersonate", rs.AdminImpersonateUser)
+			r.With(can(storage.PermissionUsersRead)).Get("/impersonation", rs.AdminGetImpersonations)
+		})
+		r.Route("/employee", func(r chi.Router) {
+			r.Use(can(storage.PermissionEmployeesManage))
+			r.Get("/", rs.AdminGetEmployees)
+			r.Post("/", rs.AdminCreateEmployee)
+			r.Patch("/", rs.AdminUpdateEmployee)
+			r.Delete("/", rs.AdminDeleteEmployee)
+		})
+		r.Route("/audit", func(r chi.Router) {
+			r.Use(can(storage.PermissionAuditRead))
+			r.Get("/", rs.AdminGetAudit)
+		})
+		r.Route("/lockout", func(r chi.Router) {
+			r.Use(can(storage.PermissionSecurityManage))
+			r.Get("/", rs.AdminGetLoginLocks)
+			r.Delete("/", rs.AdminDeleteLoginLock)
+		})
 		r.Route("/database", func(r chi.Router) {
+			r.Use(can(storage.PermissionDatabaseManage))
 			r.Route("/postgres", func(r chi.Router) {
 				r.Get("/info", rs.ServerDatabasesPostgresInfo)
 				r.Post("/backup", rs.ServerDatabasesPostgresBackup)
@@ -131,8 +272,12 @@ func (rs *Resolver) registerRoutes(r chi.Router) {
 		})
 		r.Post("/logout", rs.AuthLogout)
 	})
+	r.Route("/profile", func(r chi.Router) {
+		r.Get("/image/{id}", rs.ResourcesGetProfileImage)
+	})
 	r.Route("/resources", func(r chi.Router) {
 		r.Get("/product_image/{id}", rs.ResourcesGetProductImage)
+		r.Get("/product_image/{id}/{size}", rs.ResourcesGetProductImageRendition)
 		r.Get("/svg/{id}", rs.ResourcesGetSvgFile)
 	})
 	r.Route("/freekassa", func(r chi.Router) {
@@ -0,0 +1,266 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+// The seller handlers take the seller from the token only, so a seller never reaches the data of another seller
+
+func (rs *Resolver) SellerGetVariants(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	variants, err := storage.GetSellerVariants(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get seller variants", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, variants)
+}
+
+// sellerVariantId reads the id of the variant and checks that the variant belongs to the seller.
+// The variant of another seller is not found, so its existence is not disclosed.
+func (rs *Resolver) sellerVariantId(w http.ResponseWriter, r *http.Request, sellerId string) (string, bool) {
+	id := r.FormValue("id")
+	if id == "" {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: the parameter value is empty")
+		return "", false
+	}
+	if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
+		return "", false
+	}
+
+	owned, err := storage.CheckSellerVariant(r.Context(), rs.App.Postgres, sellerId, id)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in check seller variant", err)
+		api_v1.RespondWithInternalServerError(w)
+		return "", false
+	} else if !owned {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant with this id not found")
+		return "", false
+	}
+
+	return id, true
+}
+
+func (rs *Resolver) SellerUploadVariant(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	id, ok := rs.sellerVariantId(w, r, jwtData.AccountUuid)
+	if !ok {
+		return
+	}
+	dataList, ok := decodeUploadVariantData(w, r)
+	if !ok {
+		return
+	}
+
+	// The seller content has no supplier, its cost is the share of the seller in the sale
+	fulfilled, err := storage.CreateAdminContent(r.Context(), rs.App.Postgres, id, jwtData.AccountUuid, "", "", dataList)
+	if err == storage.BundleContent {
+		api_v1.RespondWithConflict(w, "Id: "+err.Error())
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in create seller content", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+	rs.SendOrderMails(r.Context(), fulfilled)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) SellerGetVariantUploads(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	id, ok := rs.sellerVariantId(w, r, jwtData.AccountUuid)
+	if !ok {
+		return
+	}
+
+	contents, err := storage.GetAdminContents(r.Context(), rs.App.Postgres, id)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get seller contents", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, contents)
+}
+
+func (rs *Resolver) SellerDeleteVariantUpload(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if id == "" {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: the parameter value is empty")
+		return
+	}
+	if err := tl.Validate(id, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Id: "+err.Error())
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	owned, err := storage.CheckSellerContent(r.Context(), rs.App.Postgres, jwtData.AccountUuid, id)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in check seller content", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	} else if !owned {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Content with this id not found")
+		return
+	}
+
+	err = storage.DeleteAdminContent(r.Context(), rs.App.Postgres, id)
+	if err == storage.FailedDelete {
+		api_v1.RespondWithConflict(w, "Id: the sold content can not be deleted")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete seller content", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	rs.invalidateCatalogCache(r.Context())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) SellerGetSales(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportPeriod(w, r)
+	if !ok {
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	sales, err := storage.GetSellerSales(r.Context(), rs.App.Postgres, jwtData.AccountUuid, from, to)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get seller sales", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, sales)
+}
+
+func (rs *Resolver) SellerGetStatement(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportPeriod(w, r)
+	if !ok {
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	statement, err := storage.GetSellerStatement(r.Context(), rs.App.Postgres, jwtData.AccountUuid, from, to)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get seller statement", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, statement)
+}
+
+func (rs *Resolver) SellerGetPayouts(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	payouts, err := storage.GetPayouts(r.Context(), rs.App.Postgres, jwtData.AccountUuid, "")
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get seller payouts", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, payouts)
+}
+
+func (rs *Resolver) SellerCreatePayout(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		Amount string `json:"amount"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.Amount, tl.IsNotBlank(true), tl.IsMoney(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Amount: "+err.Error())
+		return
+	}
+	if amount, _ := strconv.ParseFloat(data.Amount, 64); amount <= 0 {
+		api_v1.RespondWithUnprocessableEntity(w, "Amount: the value must be greater than 0")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 2 - request the payout, it waits for the approval of the admin
+	payoutId, err := storage.CreatePayout(r.Context(), rs.App.Postgres, jwtData.AccountUuid, data.Amount)
+	if err == storage.InsufficientBalance {
+		api_v1.RespondWithConflict(w, "Amount: "+err.Error())
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in create payout", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	response := struct {
+		PayoutId string `json:"payout_id"`
+	}{
+		PayoutId: payoutId,
+	}
+	api_v1.RespondWithCreated(w, response)
+}
@@ -1,21 +1,178 @@
 package handlers_v1
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"test-server-go/internal/api_v1"
+	"test-server-go/internal/auth"
 	freekassa "test-server-go/internal/freekassa"
 	"test-server-go/internal/storage"
 	tl "test-server-go/internal/tools"
 )
 
 func (rs *Resolver) UserProfileDelete(w http.ResponseWriter, r *http.Request) {
-	//token, data, err := api_v1.ContextGetAuthenticated(r)
-	//if err != nil {
-	//	rs.Client.Logger.NewWarn("error in took jwt data", err)
-	//	api_v1.RespondWithInternalServerError(w)
-	//	return
-	//}
+	// Block 0 - decode data
+	var data struct {
+		Password *string `json:"password"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil && decodeErr != io.EOF {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	passwordHash, passwordSalt, err := storage.GetUserPassword(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get user password and salt", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - the account with a password is deleted after the password check
+	if passwordHash != "" {
+		if data.Password == nil || *data.Password == "" {
+			api_v1.RespondWithUnprocessableEntity(w, "Password: the value is blank")
+			return
+		}
+		result, err := auth.CompareHashPasswords(*data.Password, passwordHash, passwordSalt)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in compare hash passwords", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		} else if !result {
+			api_v1.RedRespond(w, http.StatusUnauthorized, "Unauthorized", "Invalid password")
+			return
+		}
+
+		if !rs.deleteUserAccount(w, r, jwtData.AccountUuid) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Block 2 - the account without a password is deleted after the email confirmation
+	nickname, email, _, err := storage.GetUserProfile(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get user profile", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if email == "" {
+		api_v1.RespondWithConflict(w, "Set a password or an email to confirm the account deletion")
+		return
+	}
+
+	confirmationUrlToken, err := tl.GenerateURLToken(TokenLength)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in generated url token", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = storage.CreateTempAccountDeletion(r.Context(), rs.App.Redis, jwtData.AccountUuid, confirmationUrlToken, TempRegistrationExpiration); err != nil {
+		rs.App.Logger.NewWarn("error in inserted account deletion temp record", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	url, err := tl.UrlSetParam(rs.App.Config.App.Service.Url.Client+"/confirm-deletion", "token", confirmationUrlToken)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in url set param", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = rs.App.Mailer.SendAccountDeletionConfirmation(nickname, email, url, rs.App.Config.App.Service.Url.Client); err != nil {
+		rs.App.Logger.NewWarn("error in sent account deletion confirmation", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	response := struct {
+		EmailConfirmationSent bool `json:"email_confirmation_sent"`
+	}{
+		EmailConfirmationSent: true,
+	}
+	api_v1.RespondWithAccepted(w, response)
+}
+
+func (rs *Resolver) AuthDeleteWithToken(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		Token string `json:"token"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.Token, tl.IsNotBlank(true), tl.IsLen(TokenLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Token: "+err.Error())
+		return
+	}
+
+	// Block 2 - get the account and delete it
+	accountUuid, err := storage.GetTempAccountDeletion(r.Context(), rs.App.Redis, data.Token)
+	if err == storage.NoResults {
+		api_v1.RespondWithConflict(w, "Token: the token is invalid or expired")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in checked account deletion temp record", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if !rs.deleteUserAccount(w, r, accountUuid) {
+		return
+	}
+
+	if err = storage.DeleteTempAccountDeletion(r.Context(), rs.App.Redis, data.Token); err != nil {
+		rs.App.Logger.NewWarn("error in delete account deletion temp record", err)
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUserAccount anonymises the account, revokes its tokens and removes the profile image
+func (rs *Resolver) deleteUserAccount(w http.ResponseWriter, r *http.Request, accountUuid string) bool {
+	if err := storage.DeleteUser(r.Context(), rs.App.Postgres, accountUuid); err != nil {
+		rs.App.Logger.NewWarn("error in delete user", err)
+		api_v1.RespondWithInternalServerError(w)
+		return false
+	}
+
+	if err := storage.CreateTokensRevocation(r.Context(), rs.App.Redis, accountUuid, auth.TokenExpirationTime); err != nil {
+		rs.App.Logger.NewWarn("error in revoke account tokens", err)
+		api_v1.RespondWithInternalServerError(w)
+		return false
+	}
+
+	if err := rs.removeProfileImage(r.Context(), accountUuid); err != nil {
+		rs.App.Logger.NewWarn("error in remove profile image", err)
+	}
+
+	return true
 }
 
 func (rs *Resolver) UserNewPayment(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +180,8 @@ func (rs *Resolver) UserNewPayment(w http.ResponseWriter, r *http.Request) {
 	var data struct {
 		VariantId string  `json:"variant_id"`
 		Coupon    *string `json:"coupon"`
+		// AcknowledgeRegion confirms the purchase of the key locked to another region than the one of the buyer
+		AcknowledgeRegion bool `json:"acknowledge_region"`
 	}
 	decodeErr := json.NewDecoder(r.Body).Decode(&data)
 	if decodeErr != nil {
@@ -51,17 +210,51 @@ func (rs *Resolver) UserNewPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Block 2 - create payment url and check on access
-	orderId, variantName, finalPrice, err := storage.CreateOrder(r.Context(), rs.App.Postgres, jwtData.AccountUuid, data.VariantId)
+	// Block 2 - the key locked to another region is bought only with the acknowledgement of the buyer
+	buyerRegion, errText, err := rs.getBuyerRegion(r, jwtData.AccountUuid)
 	if err != nil {
+		rs.App.Logger.NewWarn("error in get buyer region", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	} else if errText != "" {
+		api_v1.RespondWithUnprocessableEntity(w, errText)
+		return
+	}
+
+	variantRegion, err := storage.GetVariantRegion(r.Context(), rs.App.Postgres, data.VariantId)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant was not found")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in get variant region", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	regionMatches := storage.RegionMatches(variantRegion, buyerRegion)
+	if !regionMatches && !data.AcknowledgeRegion {
+		api_v1.RespondWithConflict(w, "Acknowledge region: the key is activated only in the region "+variantRegion+", confirm the purchase to continue")
+		return
+	}
+
+	// Block 3 - create payment url and check on access
+	orderId, variantName, finalPrice, err := storage.CreateOrder(r.Context(), rs.App.Postgres, jwtData.AccountUuid, data.VariantId, buyerRegion, !regionMatches)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant was not found")
+		return
+	} else if err == storage.OutOfStock {
+		api_v1.RespondWithConflict(w, "Variant id: "+err.Error())
+		return
+	} else if err != nil {
 		rs.App.Logger.NewWarn("error in get product variant for payment", err)
 		api_v1.RespondWithInternalServerError(w)
 		return
 	}
+	// The reserved item is not in stock anymore
+	rs.invalidateCatalogCache(r.Context())
 
 	url := freekassa.NewOrderUrl(rs.App.Freekassa, finalPrice, freekassa.CurrencyRUB, variantName+"_"+orderId)
 
-	// Block 3 - send the result
+	// Block 4 - send the result
 	response := struct {
 		PaymentUrl string `json:"payment_url"`
 	}{
@@ -71,6 +264,22 @@ func (rs *Resolver) UserNewPayment(w http.ResponseWriter, r *http.Request) {
 	api_v1.RespondWithCreated(w, response)
 }
 
+// getBuyerRegion returns the region of the buyer from the request header, then from the profile.
+// The region is empty if the buyer has not chosen it, the error text is returned for the unknown region of the header.
+func (rs *Resolver) getBuyerRegion(r *http.Request, accountUuid string) (string, string, error) {
+	if region := strings.TrimSpace(r.Header.Get(RegionHeader)); region != "" {
+		if _, err := storage.GetRegionNo(r.Context(), rs.App.Postgres, region); err == storage.NoResults {
+			return "", "Region: the region is unknown", nil
+		} else if err != nil {
+			return "", "", err
+		}
+		return strings.ToLower(region), "", nil
+	}
+
+	region, err := storage.GetUserRegion(r.Context(), rs.App.Postgres, accountUuid)
+	return region, "", err
+}
+
 func (rs *Resolver) UserProfileOrders(w http.ResponseWriter, r *http.Request) {
 	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
 	if err != nil {
@@ -89,5 +298,458 @@ func (rs *Resolver) UserProfileOrders(w http.ResponseWriter, r *http.Request) {
 	api_v1.RespondOK(w, orders)
 }
 
-func (rs *Resolver) UserProfileDump(w http.ResponseWriter, r *http.Request)   {}
-func (rs *Resolver) UserProfileUpdate(w http.ResponseWriter, r *http.Request) {}
+func (rs *Resolver) UserProfileDump(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		api_v1.RespondWithUnprocessableEntity(w, "Format: the value must be json or zip")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	dump, err := storage.GetUserDump(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get user dump", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	fileName := "dump-" + jwtData.AccountUuid
+	if format == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`.json"`)
+		api_v1.RespondOK(w, dump)
+		return
+	}
+
+	// The archive contains a file for every part of the dump and the profile image
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]interface{}{
+		"profile.json":     dump.Profile,
+		"oauth_links.json": dump.OAuthLinks,
+		"orders.json":      dump.Orders,
+		"wishlist.json":    dump.Wishlist,
+		"reviews.json":     dump.Reviews,
+		"activity.json":    dump.Activity,
+	}
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err == nil {
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(content)
+		}
+		if err != nil {
+			rs.App.Logger.NewWarn("error in write user dump archive", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+
+	if key, err := storage.GetProfileImageKey(r.Context(), rs.App.Postgres, jwtData.AccountUuid); err == nil && key != "" {
+		body, _, err := rs.App.Blob.Open(r.Context(), key)
+		if err == nil {
+			var f io.Writer
+			f, err = zw.Create("profile_image" + path.Ext(key))
+			if err == nil {
+				_, err = io.Copy(f, body)
+			}
+			body.Close()
+		}
+		if err != nil {
+			rs.App.Logger.NewWarn("error in write user dump archive", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+	if err = zw.Close(); err != nil {
+		rs.App.Logger.NewWarn("error in close user dump archive", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`.zip"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+type userProfileUpdateResponse struct {
+	Token                 *string `json:"token"`
+	Nickname              string  `json:"nickname"`
+	Email                 string  `json:"email"`
+	Region                string  `json:"region"`
+	EmailConfirmationSent bool    `json:"email_confirmation_sent"`
+}
+
+func (rs *Resolver) UserProfileUpdate(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		Nickname    *string `json:"nickname"`
+		Email       *string `json:"email"`
+		OldPassword *string `json:"old_password"`
+		NewPassword *string `json:"new_password"`
+		Region      *string `json:"region"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	nickname, email, _, err := storage.GetUserProfile(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get user profile", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - data validation
+	if data.Nickname == nil && data.Email == nil && data.NewPassword == nil && data.Region == nil {
+		api_v1.RespondWithUnprocessableEntity(w, "No values")
+		return
+	}
+	if data.Nickname != nil {
+		if err = tl.Validate(*data.Nickname, tl.IsNotBlank(true), tl.IsMinMaxLen(MinNicknameLength, MaxNicknameLength), tl.IsNotContainsSpace(), tl.IsNickname(), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Nickname: "+err.Error())
+			return
+		}
+		if *data.Nickname == nickname {
+			data.Nickname = nil
+		}
+	}
+	if data.Email != nil {
+		if err = tl.Validate(*data.Email, tl.IsNotBlank(true), tl.IsMinMaxLen(MinEmailLength, MaxEmailLength), tl.IsNotContainsSpace(), tl.IsEmail(), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "Email: "+err.Error())
+			return
+		}
+		if strings.EqualFold(*data.Email, email) {
+			data.Email = nil
+		}
+	}
+	if data.Region != nil && *data.Region != "" {
+		if _, err = storage.GetRegionNo(r.Context(), rs.App.Postgres, *data.Region); err == storage.NoResults {
+			api_v1.RespondWithUnprocessableEntity(w, "Region: the region is unknown")
+			return
+		} else if err != nil {
+			rs.App.Logger.NewWarn("error in get region no", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+	var passwordHash, passwordSalt string
+	if data.NewPassword != nil {
+		if err = tl.Validate(*data.NewPassword, tl.IsNotBlank(true), tl.IsMinMaxLen(MinPasswordLength, MaxPasswordLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+			api_v1.RespondWithUnprocessableEntity(w, "New password: "+err.Error())
+			return
+		}
+
+		passwordHash, passwordSalt, err = storage.GetUserPassword(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in get user password and salt", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		// Accounts created through Google or Telegram set the first password without the old one
+		if passwordHash != "" {
+			if data.OldPassword == nil || *data.OldPassword == "" {
+				api_v1.RespondWithUnprocessableEntity(w, "Old password: the value is blank")
+				return
+			}
+			result, err := auth.CompareHashPasswords(*data.OldPassword, passwordHash, passwordSalt)
+			if err != nil {
+				rs.App.Logger.NewWarn("error in compare hash passwords", err)
+				api_v1.RespondWithInternalServerError(w)
+				return
+			} else if !result {
+				api_v1.RedRespond(w, http.StatusUnauthorized, "Unauthorized", "Invalid old password")
+				return
+			}
+		}
+	}
+
+	// Block 2 - check for an exists nickname and email
+	if data.Nickname != nil || data.Email != nil {
+		var newNickname, newEmail string
+		if data.Nickname != nil && !strings.EqualFold(*data.Nickname, nickname) {
+			newNickname = *data.Nickname
+		}
+		if data.Email != nil {
+			newEmail = *data.Email
+
+			emailDomainExists, err := tl.CheckEmailDomainExistence(newEmail)
+			if err != nil {
+				rs.App.Logger.NewWarn("Error in checked the email domain: ", err)
+			} else if !emailDomainExists {
+				api_v1.RespondWithConflict(w, "Email: the email domain is not exist")
+				return
+			}
+		}
+
+		nicknameExist, emailExist, err := storage.CheckUser(r.Context(), rs.App.Postgres, newNickname, newEmail)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in checked the user existence", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		if newNickname != "" && nicknameExist {
+			api_v1.RespondWithConflict(w, "Nickname: this nickname is already in use")
+			return
+		}
+		if newEmail != "" && emailExist {
+			api_v1.RespondWithConflict(w, "Email: this email is already in use")
+			return
+		}
+	}
+
+	response := userProfileUpdateResponse{
+		Nickname: nickname,
+		Email:    email,
+	}
+
+	// Block 3 - update the nickname
+	if data.Nickname != nil {
+		if err = storage.UpdateUserNickname(r.Context(), rs.App.Postgres, jwtData.AccountUuid, *data.Nickname); err != nil {
+			api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Nickname"))
+			return
+		}
+		response.Nickname = *data.Nickname
+	}
+
+	// Block 4 - update the region, the empty value clears it
+	if data.Region != nil {
+		if err = storage.UpdateUserRegion(r.Context(), rs.App.Postgres, jwtData.AccountUuid, *data.Region); err != nil {
+			rs.App.Logger.NewWarn("error in update user region", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+	}
+	if response.Region, err = storage.GetUserRegion(r.Context(), rs.App.Postgres, jwtData.AccountUuid); err != nil {
+		rs.App.Logger.NewWarn("error in get user region", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 5 - update the password and revoke the other sessions
+	if data.NewPassword != nil {
+		base64PasswordHash, base64Salt, err := auth.HashPassword(*data.NewPassword, "")
+		if err != nil {
+			rs.App.Logger.NewWarn("error in generated hash password", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		if err = storage.UpdateUserPassword(r.Context(), rs.App.Postgres, jwtData.AccountUuid, base64PasswordHash, base64Salt); err != nil {
+			rs.App.Logger.NewWarn("error in update user password", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		if err = storage.CreateTokensRevocation(r.Context(), rs.App.Redis, jwtData.AccountUuid, auth.TokenExpirationTime); err != nil {
+			rs.App.Logger.NewWarn("error in revoke account tokens", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		jwtToken, err := auth.GenerateJwt(jwtData.AccountUuid, rs.App.Config.App.Jwt)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in generated jwt", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		response.Token = &jwtToken
+	}
+
+	// Block 6 - send the confirmation of the new email
+	if data.Email != nil {
+		confirmationUrlToken, err := tl.GenerateURLToken(TokenLength)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in generated url token", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		if err = storage.CreateTempEmailChange(r.Context(), rs.App.Redis, jwtData.AccountUuid, *data.Email, confirmationUrlToken, TempRegistrationExpiration); err != nil {
+			rs.App.Logger.NewWarn("error in inserted email change temp record", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		url, err := tl.UrlSetParam(rs.App.Config.App.Service.Url.Client+"/confirm-email", "token", confirmationUrlToken)
+		if err != nil {
+			rs.App.Logger.NewWarn("error in url set param", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+
+		if err = rs.App.Mailer.SendEmailChangeConfirmation(response.Nickname, *data.Email, url, rs.App.Config.App.Service.Url.Client); err != nil {
+			rs.App.Logger.NewWarn("error in sent email change confirmation", err)
+			api_v1.RespondWithInternalServerError(w)
+			return
+		}
+		response.EmailConfirmationSent = true
+	}
+
+	// Block 7 - send the result
+	api_v1.RespondOK(w, response)
+}
+
+func (rs *Resolver) AuthEmailWithToken(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		Token string `json:"token"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	// Block 1 - data validation
+	if err := tl.Validate(data.Token, tl.IsNotBlank(true), tl.IsLen(TokenLength), tl.IsNotContainsSpace(), tl.IsTrimmedSpace()); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Token: "+err.Error())
+		return
+	}
+
+	// Block 2 - get the requested email
+	accountUuid, email, err := storage.GetTempEmailChange(r.Context(), rs.App.Redis, data.Token)
+	if err == storage.NoResults {
+		api_v1.RespondWithConflict(w, "Token: the token is invalid or expired")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in checked email change temp record", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - check the email again and update it
+	_, emailExist, err := storage.CheckUser(r.Context(), rs.App.Postgres, "", email)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in checked the user existence", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if emailExist {
+		api_v1.RespondWithConflict(w, "Email: this email is already in use")
+		return
+	}
+
+	if err = storage.UpdateUserEmail(r.Context(), rs.App.Postgres, accountUuid, email); err != nil {
+		api_v1.RespondWithConflict(w, storage.PgErrorsHandle(err, "Email"))
+		return
+	}
+
+	if err = storage.DeleteTempEmailChange(r.Context(), rs.App.Redis, data.Token); err != nil {
+		rs.App.Logger.NewWarn("error in delete email change temp record", err)
+	}
+
+	// Block 4 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) UserProfileImageUpload(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = r.ParseMultipartForm(ProfileImageMaxSize); err != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "File: the file is not attached")
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, ProfileImageMaxSize+1))
+	if err != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+	if len(content) > ProfileImageMaxSize {
+		api_v1.RespondWithUnprocessableEntity(w, "File: the file is too large (maximum is "+strconv.Itoa(ProfileImageMaxSize/1024/1024)+" megabytes)")
+		return
+	}
+
+	contentType := http.DetectContentType(content)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		api_v1.RespondWithUnprocessableEntity(w, "File: the file is not a jpeg, png, gif or webp image")
+		return
+	}
+
+	// The image is stored before its key is saved, so the saved key always has the image
+	hash := sha256.Sum256(content)
+	key := getProfileImageKey(jwtData.AccountUuid, hex.EncodeToString(hash[:8]), ext)
+	if err = rs.App.Blob.Put(r.Context(), key, content, contentType); err != nil {
+		rs.App.Logger.NewWarn("error in write profile image", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	oldKey, err := storage.SetProfileImageKey(r.Context(), rs.App.Postgres, jwtData.AccountUuid, key)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in set profile image", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+	if oldKey != "" && oldKey != key {
+		if err = rs.App.Blob.Delete(r.Context(), oldKey); err != nil {
+			rs.App.Logger.NewWarn("error in remove old profile image", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) UserProfileImageDelete(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	if err = rs.removeProfileImage(r.Context(), jwtData.AccountUuid); err != nil {
+		rs.App.Logger.NewWarn("error in remove profile image", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeProfileImage clears the key of the profile image and removes the image, the accounts without a user profile have no image
+func (rs *Resolver) removeProfileImage(ctx context.Context, accountUuid string) error {
+	key, err := storage.SetProfileImageKey(ctx, rs.App.Postgres, accountUuid, "")
+	if err == storage.FailedUpdate {
+		return nil
+	} else if err != nil || key == "" {
+		return err
+	}
+
+	return rs.App.Blob.Delete(ctx, key)
+}
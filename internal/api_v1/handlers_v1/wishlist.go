@@ -0,0 +1,97 @@
+package handlers_v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"test-server-go/internal/api_v1"
+	"test-server-go/internal/storage"
+	tl "test-server-go/internal/tools"
+)
+
+func (rs *Resolver) UserGetWishlist(w http.ResponseWriter, r *http.Request) {
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	items, err := storage.GetWishlist(r.Context(), rs.App.Postgres, jwtData.AccountUuid)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in get wishlist", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	api_v1.RespondOK(w, items)
+}
+
+func (rs *Resolver) UserUpdateWishlist(w http.ResponseWriter, r *http.Request) {
+	// Block 0 - decode data
+	var data struct {
+		VariantId string `json:"variant_id"`
+		Notify    bool   `json:"notify"`
+	}
+	decodeErr := json.NewDecoder(r.Body).Decode(&data)
+	if decodeErr != nil {
+		api_v1.RespondWithBadRequest(w, "")
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 1 - data validation
+	if err = tl.Validate(data.VariantId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Variant id: "+err.Error())
+		return
+	}
+
+	// Block 2 - add the variant or change the subscription to its return
+	err = storage.UpdateWishlistItem(r.Context(), rs.App.Postgres, jwtData.AccountUuid, data.VariantId, data.Notify)
+	if err == storage.NoResults {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant was not found")
+		return
+	} else if err == storage.FailedUpdate {
+		api_v1.RespondWithConflict(w, "Notify: the variant is in stock now")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in update wishlist", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	// Block 3 - send the result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rs *Resolver) UserDeleteWishlist(w http.ResponseWriter, r *http.Request) {
+	variantId := r.FormValue("variant_id")
+	if err := tl.Validate(variantId, tl.UuidFieldValidators(true)...); err != nil {
+		api_v1.RespondWithUnprocessableEntity(w, "Variant id: "+err.Error())
+		return
+	}
+
+	_, jwtData, err := api_v1.ContextGetAuthenticated(r)
+	if err != nil {
+		rs.App.Logger.NewWarn("error in took jwt data", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	err = storage.DeleteWishlistItem(r.Context(), rs.App.Postgres, jwtData.AccountUuid, variantId)
+	if err == storage.FailedDelete {
+		api_v1.RedRespond(w, http.StatusNotFound, "Not found", "Variant was not found in the wishlist")
+		return
+	} else if err != nil {
+		rs.App.Logger.NewWarn("error in delete wishlist item", err)
+		api_v1.RespondWithInternalServerError(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -267,7 +268,8 @@ func GatewayTimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Han
 //	}
 //}
 
-func JwtAuthMiddleware(pdb *storage.Postgres, rdb *storage.Redis, logger *logger.Logger, secret, role string) func(http.Handler) http.Handler {
+// JwtAuthMiddleware authenticates the request and allows the accounts with any of the roles
+func JwtAuthMiddleware(pdb *storage.Postgres, rdb *storage.Redis, logger *logger.Logger, secret string, roles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -312,6 +314,18 @@ func JwtAuthMiddleware(pdb *storage.Postgres, rdb *storage.Redis, logger *logger
 				return
 			}
 
+			// Check if all account tokens issued before some moment were revoked
+			revokedBefore, err := storage.GetTokensRevocation(r.Context(), rdb, jwtData.AccountUuid)
+			if err != nil {
+				RespondWithInternalServerError(w)
+				logger.NewWarn("Error in getting tokens revocation", err)
+				return
+			}
+			if jwtData.IssuedAt == nil || jwtData.IssuedAt.Time.Before(revokedBefore) {
+				RedRespond(w, http.StatusForbidden, "Forbidden", "This token has been revoked")
+				return
+			}
+
 			// Get account state and check on exists
 			state, scannedRole, err := storage.GetStateAccount(r.Context(), pdb, jwtData.AccountUuid)
 			if err != nil {
@@ -334,7 +348,7 @@ func JwtAuthMiddleware(pdb *storage.Postgres, rdb *storage.Redis, logger *logger
 			}
 
 			// Check account role
-			if scannedRole != role {
+			if !tl.StringInSlice(scannedRole, roles) {
 				RedRespond(w, http.StatusForbidden, "Forbidden", "This account has a different role")
 				return
 			}
@@ -347,8 +361,176 @@ func JwtAuthMiddleware(pdb *storage.Postgres, rdb *storage.Redis, logger *logger
 				return
 			}
 
-			// Update last account activity
-			storage.UpdateLastAccountActivity(r.Context(), pdb, jwtData.AccountUuid)
+			// Update last account activity, unless an employee is acting as the user
+			if jwtData.ImpersonatorUuid == "" {
+				storage.UpdateLastAccountActivity(r.Context(), pdb, jwtData.AccountUuid)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// PermissionMiddleware forbids the request if the role of the authenticated account has no permission.
+// It must be used after JwtAuthMiddleware.
+func PermissionMiddleware(pdb *storage.Postgres, logger *logger.Logger, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, jwtData, err := ContextGetAuthenticated(r)
+			if err != nil {
+				RespondWithInternalServerError(w)
+				logger.NewWarn("Error in getting auth context key", err)
+				return
+			}
+
+			allowed, err := storage.CheckAccountPermission(r.Context(), pdb, jwtData.AccountUuid, permission)
+			if err != nil {
+				RespondWithInternalServerError(w)
+				logger.NewWarn("Error in checking account permission", err)
+				return
+			}
+			if !allowed {
+				RedRespond(w, http.StatusForbidden, "Forbidden", "This account has no permission: "+permission)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AuditMiddleware records every admin write request with the actor, the route and the ip.
+// The row changes made by the handler are linked with the record by the database triggers.
+// It must be used after JwtAuthMiddleware.
+func AuditMiddleware(pdb *storage.Postgres, logger *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			_, jwtData, err := ContextGetAuthenticated(r)
+			if err != nil {
+				RespondWithInternalServerError(w)
+				logger.NewWarn("Error in getting auth context key", err)
+				return
+			}
+
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+
+			// The write is not allowed without the audit record
+			actionId, err := storage.CreateAuditAction(r.Context(), pdb, jwtData.AccountUuid, r.Method, r.URL.Path, r.URL.RawQuery, ip)
+			if err != nil {
+				RespondWithInternalServerError(w)
+				logger.NewWarn("Error in creating audit action", err)
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(storage.ContextWithAuditAction(r.Context(), actionId)))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if err = storage.UpdateAuditActionStatus(context.Background(), pdb, actionId, status); err != nil {
+				logger.NewWarn("Error in updating audit action status", err)
+			}
+		})
+	}
+}
+
+// DenyImpersonationMiddleware forbids the request made with a token issued to an employee acting as the user
+func DenyImpersonationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, jwtData, err := ContextGetAuthenticated(r)
+		if err != nil {
+			RespondWithInternalServerError(w)
+			return
+		}
+		if jwtData.ImpersonatorUuid != "" {
+			RedRespond(w, http.StatusForbidden, "Forbidden", "This action is not allowed while impersonating the user")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DefaultTrustedProxies are trusted without the config, the server listens on localhost behind the local proxy
+var DefaultTrustedProxies = []string{"127.0.0.1/32", "::1/128"}
+
+// ParseTrustedProxies parses the addresses and the networks of the trusted proxies
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func isTrustedProxy(ip net.IP, trustedProxies []*net.IPNet) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RealIpMiddleware replaces the remote address of the request from the trusted proxy with the client address.
+// X-Forwarded-For is read from the right, as every proxy appends the address it is connected from: the first address
+// which is not a trusted proxy is the client, the addresses to its left are sent by the client itself and are ignored.
+// X-Real-IP and True-Client-IP are ignored, as the proxy may pass them from the client unchanged.
+func RealIpMiddleware(trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			peer := net.ParseIP(host)
+			if peer == nil || !isTrustedProxy(peer, trustedProxies) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var hops []string
+			for _, header := range r.Header.Values("X-Forwarded-For") {
+				hops = append(hops, strings.Split(header, ",")...)
+			}
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(hops[i]))
+				if ip == nil {
+					break
+				}
+				if !isTrustedProxy(ip, trustedProxies) || i == 0 {
+					r.RemoteAddr = ip.String()
+					break
+				}
+			}
 
 			next.ServeHTTP(w, r)
 		})
@@ -0,0 +1,60 @@
+package api_v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealIpMiddleware(t *testing.T) {
+	trustedProxies, err := ParseTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		clientIp   string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7:5000"},
+		{"spoofed header from the client", "203.0.113.7:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7:5000"},
+		{"client behind the proxy", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"spoofed hops before the client", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.1, 198.51.100.2, 203.0.113.7"}, "203.0.113.7"},
+		{"chain of the trusted proxies", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.1.2.3"}, "203.0.113.7"},
+		{"x-real-ip is ignored", "127.0.0.1:5000", map[string]string{"X-Real-IP": "198.51.100.1", "X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"proxy without the header", "127.0.0.1:5000", map[string]string{"X-Real-IP": "198.51.100.1"}, "127.0.0.1:5000"},
+		{"invalid hop", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "203.0.113.7, unknown"}, "127.0.0.1:5000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+
+			var clientIp string
+			handler := RealIpMiddleware(trustedProxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				clientIp = r.RemoteAddr
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, test.clientIp, clientIp)
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := ParseTrustedProxies(DefaultTrustedProxies)
+	require.NoError(t, err)
+	assert.Len(t, networks, 2)
+
+	_, err = ParseTrustedProxies([]string{"proxy.local"})
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
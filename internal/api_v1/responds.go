@@ -3,6 +3,8 @@ package api_v1
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type errorResponse struct {
@@ -89,3 +91,50 @@ func RespondOK(w http.ResponseWriter, result interface{}) {
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(result)
 }
+
+func RespondWithAccepted(w http.ResponseWriter, result interface{}) {
+	setStandardHeadersForJson(w)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// RespondOKWithValidators sends the encoded JSON with the ETag and Last-Modified validators.
+// The request revalidating the same content is answered with 304 Not Modified without the body.
+func RespondOKWithValidators(w http.ResponseWriter, r *http.Request, content []byte, etag string, lastModified time.Time, cacheControl string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", cacheControl)
+
+	if isNotModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	setStandardHeadersForJson(w)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(content)
+}
+
+// isNotModified checks the conditional request headers, If-None-Match takes precedence over If-Modified-Since
+func isNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
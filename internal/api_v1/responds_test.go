@@ -0,0 +1,48 @@
+package api_v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRespondOKWithValidators(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	etag := `"abc"`
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"no validators", nil, http.StatusOK},
+		{"matching etag", map[string]string{"If-None-Match": `"zzz", W/"abc"`}, http.StatusNotModified},
+		{"changed etag wins over the date", map[string]string{"If-None-Match": `"old"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/product/mainpage", nil)
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			RespondOKWithValidators(w, r, []byte("{}\n"), etag, modified, "public, no-cache")
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+			assert.Equal(t, modified.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+			if test.status == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+			} else {
+				assert.Equal(t, "{}\n", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Default Google OAuth2/OIDC endpoints.
+const (
+	GoogleAuthUrl     = "https://accounts.google.com/o/oauth2/v2/auth"
+	GoogleTokenUrl    = "https://oauth2.googleapis.com/token"
+	GoogleUserInfoUrl = "https://openidconnect.googleapis.com/v1/userinfo"
+
+	googleScope       = "openid email profile"
+	googleHttpTimeout = 10 * time.Second
+)
+
+// GoogleConfig holds the client credentials and the endpoints of the Google identity provider.
+// The endpoints can be overridden to point at a local stub identity provider.
+type GoogleConfig struct {
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	AuthUrl      string
+	TokenUrl     string
+	UserInfoUrl  string
+	client       *http.Client
+}
+
+// GoogleUser represents the OIDC claims returned by the userinfo endpoint.
+type GoogleUser struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+type googleTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+	Error       string `json:"error"`
+}
+
+// NewGoogleConfig creates a Google config. Empty endpoints are replaced with the Google defaults.
+func NewGoogleConfig(clientId, clientSecret, redirectUrl, authUrl, tokenUrl, userInfoUrl string) *GoogleConfig {
+	if authUrl == "" {
+		authUrl = GoogleAuthUrl
+	}
+	if tokenUrl == "" {
+		tokenUrl = GoogleTokenUrl
+	}
+	if userInfoUrl == "" {
+		userInfoUrl = GoogleUserInfoUrl
+	}
+
+	return &GoogleConfig{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		RedirectUrl:  redirectUrl,
+		AuthUrl:      authUrl,
+		TokenUrl:     tokenUrl,
+		UserInfoUrl:  userInfoUrl,
+		client:       &http.Client{Timeout: googleHttpTimeout},
+	}
+}
+
+// AuthCodeUrl returns the consent page url the client must be redirected to.
+// The state is returned back by Google and must be checked on the callback.
+func (c *GoogleConfig) AuthCodeUrl(state string) string {
+	values := url.Values{}
+	values.Set("client_id", c.ClientId)
+	values.Set("redirect_uri", c.RedirectUrl)
+	values.Set("response_type", "code")
+	values.Set("scope", googleScope)
+	values.Set("state", state)
+	values.Set("prompt", "select_account")
+
+	return c.AuthUrl + "?" + values.Encode()
+}
+
+// Exchange trades the authorization code for an access token and fetches the user claims.
+// Only users with a verified e-mail are accepted.
+func (c *GoogleConfig) Exchange(ctx context.Context, code string) (*GoogleUser, error) {
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+
+	values := url.Values{}
+	values.Set("code", code)
+	values.Set("client_id", c.ClientId)
+	values.Set("client_secret", c.ClientSecret)
+	values.Set("redirect_uri", c.RedirectUrl)
+	values.Set("grant_type", "authorization_code")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenUrl, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token googleTokenResponse
+	if err = c.doJson(req, &token); err != nil {
+		return nil, fmt.Errorf("error exchanging authorization code: %w", err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("error exchanging authorization code: %s", token.Error)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("error exchanging authorization code: empty access token")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, c.UserInfoUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var user GoogleUser
+	if err = c.doJson(req, &user); err != nil {
+		return nil, fmt.Errorf("error getting user info: %w", err)
+	}
+	if user.Subject == "" {
+		return nil, errors.New("error getting user info: empty subject")
+	}
+	if user.Email == "" || !user.EmailVerified {
+		return nil, errors.New("error getting user info: the email is not verified")
+	}
+
+	return &user, nil
+}
+
+func (c *GoogleConfig) doJson(req *http.Request, v interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %s", resp.Status)
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -11,9 +11,14 @@ import (
 // TokenExpirationTime specifies the token expiration time.
 const TokenExpirationTime = time.Hour * 24 * 21
 
+// ImpersonationExpirationTime specifies the expiration time of the token issued to an employee acting as a user.
+const ImpersonationExpirationTime = time.Hour
+
 // JwtData represents the custom JWT claims, which includes the account UUID and standard claims.
+// ImpersonatorUuid is set only in the tokens issued to an employee acting as the user.
 type JwtData struct {
-	AccountUuid string `json:"account_uuid"`
+	AccountUuid      string `json:"account_uuid"`
+	ImpersonatorUuid string `json:"impersonator_uuid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -31,6 +36,20 @@ func GenerateJwt(accountUuid string, secret string) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
+// GenerateImpersonationJwt generates a short-lived JWT token for an employee acting as the user.
+func GenerateImpersonationJwt(accountUuid, impersonatorUuid string, expiresAt time.Time, secret string) (string, error) {
+	claims := JwtData{
+		AccountUuid:      accountUuid,
+		ImpersonatorUuid: impersonatorUuid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS384, claims)
+	return token.SignedString([]byte(secret))
+}
+
 // ParseJwtToken parses a JWT token string and returns the custom claims or an error.
 // It verifies the token signature using the secret key and checks for token expiration.
 func ParseJwtToken(tokenString string, secret string) (*JwtData, error) {
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newGoogleStub(t *testing.T, emailVerified bool) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.FormValue("code") != "good-code" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "stub-token", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer stub-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(GoogleUser{
+			Subject:       "1234567890",
+			Email:         "user@example.com",
+			EmailVerified: emailVerified,
+			Name:          "Stub User",
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGoogleExchange(t *testing.T) {
+	server := newGoogleStub(t, true)
+	cfg := NewGoogleConfig("client", "secret", "http://localhost/callback", server.URL+"/auth", server.URL+"/token", server.URL+"/userinfo")
+
+	user, err := cfg.Exchange(context.Background(), "good-code")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	assert.Equalf(t, "1234567890", user.Subject, "subject should be equal")
+	assert.Equalf(t, "user@example.com", user.Email, "email should be equal")
+
+	_, err = cfg.Exchange(context.Background(), "bad-code")
+	assert.Errorf(t, err, "exchange with a bad code should fail")
+}
+
+func TestGoogleExchangeUnverifiedEmail(t *testing.T) {
+	server := newGoogleStub(t, false)
+	cfg := NewGoogleConfig("client", "secret", "http://localhost/callback", "", server.URL+"/token", server.URL+"/userinfo")
+
+	_, err := cfg.Exchange(context.Background(), "good-code")
+	assert.Errorf(t, err, "exchange with an unverified email should fail")
+	assert.Equalf(t, GoogleAuthUrl, cfg.AuthUrl, "empty auth url should be replaced with the default")
+}
+
+func signTelegramData(data map[string]string, botToken string) string {
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte("auth_date=" + data["auth_date"] + "\nfirst_name=" + data["first_name"] + "\nid=" + data["id"] + "\nusername=" + data["username"]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyTelegramLogin(t *testing.T) {
+	botToken := "123456:stub-bot-token"
+	data := map[string]string{
+		"id":         "987654321",
+		"first_name": "Stub",
+		"username":   "stub_user",
+		"auth_date":  strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	data["hash"] = signTelegramData(data, botToken)
+
+	user, err := VerifyTelegramLogin(data, botToken, TelegramLoginMaxAge)
+	if err != nil {
+		t.Fatalf("VerifyTelegramLogin failed: %v", err)
+	}
+	assert.Equalf(t, "987654321", user.Id, "id should be equal")
+	assert.Equalf(t, "stub_user", user.Username, "username should be equal")
+
+	_, err = VerifyTelegramLogin(data, "another-token", TelegramLoginMaxAge)
+	assert.Errorf(t, err, "verification with another bot token should fail")
+
+	data["username"] = "forged"
+	_, err = VerifyTelegramLogin(data, botToken, TelegramLoginMaxAge)
+	assert.Errorf(t, err, "verification of forged data should fail")
+}
+
+func TestVerifyTelegramLoginOutdated(t *testing.T) {
+	botToken := "123456:stub-bot-token"
+	data := map[string]string{
+		"id":         "987654321",
+		"first_name": "Stub",
+		"username":   "stub_user",
+		"auth_date":  strconv.FormatInt(time.Now().Add(-48*time.Hour).Unix(), 10),
+	}
+	data["hash"] = signTelegramData(data, botToken)
+
+	_, err := VerifyTelegramLogin(data, botToken, TelegramLoginMaxAge)
+	assert.Errorf(t, err, "verification of outdated data should fail")
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TelegramLoginMaxAge specifies how long the Telegram Login Widget data stays valid.
+const TelegramLoginMaxAge = 24 * time.Hour
+
+// TelegramUser represents the data sent by the Telegram Login Widget.
+type TelegramUser struct {
+	Id        string
+	FirstName string
+	LastName  string
+	Username  string
+	PhotoUrl  string
+	AuthDate  time.Time
+}
+
+// VerifyTelegramLogin checks the hash of the Telegram Login Widget data.
+// https://core.telegram.org/widgets/login#checking-authorization
+func VerifyTelegramLogin(data map[string]string, botToken string, maxAge time.Duration) (*TelegramUser, error) {
+	if botToken == "" {
+		return nil, errors.New("telegram bot token is not configured")
+	}
+
+	hash := data["hash"]
+	if hash == "" {
+		return nil, errors.New("missing hash")
+	}
+
+	// Build the data-check-string from all received fields except hash, sorted alphabetically
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if k != "hash" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+"="+data[k])
+	}
+
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return nil, errors.New("invalid hash")
+	}
+
+	authDate, err := strconv.ParseInt(data["auth_date"], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid auth date")
+	}
+	if time.Since(time.Unix(authDate, 0)) > maxAge {
+		return nil, errors.New("the authorization data is outdated")
+	}
+
+	if data["id"] == "" {
+		return nil, errors.New("missing id")
+	}
+
+	return &TelegramUser{
+		Id:        data["id"],
+		FirstName: data["first_name"],
+		LastName:  data["last_name"],
+		Username:  data["username"],
+		PhotoUrl:  data["photo_url"],
+		AuthDate:  time.Unix(authDate, 0),
+	}, nil
+}
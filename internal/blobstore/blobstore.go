@@ -0,0 +1,105 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"test-server-go/internal/config"
+	tl "test-server-go/internal/tools"
+	"time"
+)
+
+const (
+	TypeLocal = "local"
+	TypeS3    = "s3"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+type Info struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// ResponseHeaders replace the stored headers of the blob downloaded with the signed URL, the empty values are not replaced
+type ResponseHeaders struct {
+	ContentType  string
+	CacheControl string
+}
+
+// BlobStore keeps the uploaded resources. The keys are slash separated paths like "svg_files/steam.svg".
+type BlobStore interface {
+	Put(ctx context.Context, key string, content []byte, contentType string) error
+	// Open returns the blob content, the caller must close it. The content is an io.ReadSeeker if the store allows it.
+	Open(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	// Delete does not fail if the blob does not exist
+	Delete(ctx context.Context, key string) error
+	// List returns the keys starting with the prefix in the lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+	// SignedUrl returns a temporary URL to download the blob directly from the store, the store does not check
+	// that the blob exists. An empty URL means the store cannot do it and the blob is streamed through the API.
+	SignedUrl(ctx context.Context, key string, expiration time.Duration, headers ResponseHeaders) (string, error)
+}
+
+// NewBlobStore returns the store chosen in the config, the local store is used by default
+func NewBlobStore(cfg config.Config) (BlobStore, error) {
+	switch cfg.BlobStore.Type {
+	case TypeS3:
+		return NewS3(S3Config{
+			Endpoint:  cfg.BlobStore.S3.Endpoint,
+			Region:    cfg.BlobStore.S3.Region,
+			Bucket:    cfg.BlobStore.S3.Bucket,
+			AccessKey: cfg.BlobStore.S3.AccessKey,
+			SecretKey: cfg.BlobStore.S3.SecretKey,
+			PathStyle: cfg.BlobStore.S3.PathStyle,
+		})
+	case TypeLocal, "":
+		dir := cfg.BlobStore.Local.Dir
+		if dir == "" {
+			path, err := tl.GetExecutablePath()
+			if err != nil {
+				return nil, err
+			}
+			dir = filepath.Join(path, "resources")
+		}
+		return NewLocal(dir), nil
+	default:
+		return nil, errors.New("unknown blob store type: " + cfg.BlobStore.Type)
+	}
+}
+
+// DeletePrefix deletes all the blobs with the keys starting with the prefix
+func DeletePrefix(ctx context.Context, store BlobStore, prefix string) error {
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err = store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkKey rejects the keys which may leave the store root
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
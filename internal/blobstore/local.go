@@ -0,0 +1,153 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Local keeps the blobs as files under the root directory.
+// It is suitable for a single instance, the instances behind a load balancer need a shared store like S3.
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) *Local {
+	return &Local{root: filepath.Clean(root)}
+}
+
+func (l *Local) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(_ context.Context, key string, content []byte, _ string) error {
+	fullPath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+
+	// The file is replaced atomically, so the readers never see a partial content
+	tempFile, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err = tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tempFile.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), fullPath)
+}
+
+func (l *Local) Open(_ context.Context, key string) (io.ReadCloser, Info, error) {
+	fullPath, err := l.path(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	file, err := os.Open(fullPath)
+	if os.IsNotExist(err) {
+		return nil, Info{}, ErrNotFound
+	} else if err != nil {
+		return nil, Info{}, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Info{}, err
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, Info{}, ErrNotFound
+	}
+
+	return file, Info{
+		Size:        stat.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     stat.ModTime(),
+	}, nil
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	fullPath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// The emptied directories are removed up to the root
+	for dir := filepath.Dir(fullPath); dir != l.root && strings.HasPrefix(dir, l.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (l *Local) List(_ context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+
+	// Only the directory containing the prefix is walked
+	dir := l.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		if err := checkKey(prefix[:i]); err != nil {
+			return keys, err
+		}
+		dir = filepath.Join(l.root, filepath.FromSlash(prefix[:i]))
+	}
+
+	err := filepath.WalkDir(dir, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		relative, err := filepath.Rel(l.root, fullPath)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(relative); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+	sort.Strings(keys)
+
+	return keys, err
+}
+
+func (l *Local) SignedUrl(context.Context, string, time.Duration, ResponseHeaders) (string, error) {
+	return "", nil
+}
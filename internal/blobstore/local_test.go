@@ -0,0 +1,56 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	local := NewLocal(root)
+	ctx := context.Background()
+
+	require.NoError(t, local.Put(ctx, "product_images/a1/large.jpg", []byte("large"), "image/jpeg"))
+	require.NoError(t, local.Put(ctx, "product_images/a1/thumbnail.jpg", []byte("thumbnail"), "image/jpeg"))
+	require.NoError(t, local.Put(ctx, "product_images/b2.png", []byte("legacy"), "image/png"))
+
+	body, info, err := local.Open(ctx, "product_images/a1/large.jpg")
+	require.NoError(t, err)
+	content, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "large", string(content))
+	assert.Equal(t, "image/jpeg", info.ContentType)
+	_, seekable := body.(io.ReadSeeker)
+	assert.True(t, seekable, "local blobs should be seekable for range requests")
+
+	keys, err := local.List(ctx, "product_images/a1/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"product_images/a1/large.jpg", "product_images/a1/thumbnail.jpg"}, keys)
+
+	keys, err = local.List(ctx, "product_images/b2.")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"product_images/b2.png"}, keys)
+
+	require.NoError(t, DeletePrefix(ctx, local, "product_images/a1/"))
+	_, _, err = local.Open(ctx, "product_images/a1/large.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = os.Stat(filepath.Join(root, "product_images", "a1"))
+	assert.True(t, os.IsNotExist(err), "the emptied directory should be removed")
+
+	signedUrl, err := local.SignedUrl(ctx, "product_images/b2.png", 0, ResponseHeaders{})
+	require.NoError(t, err)
+	assert.Empty(t, signedUrl)
+}
+
+func TestCheckKey(t *testing.T) {
+	for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b", "a//b", "a\\b"} {
+		assert.ErrorIsf(t, checkKey(key), ErrInvalidKey, "key %q should be rejected", key)
+	}
+	assert.NoError(t, checkKey("svg_files/epic-games.svg"))
+}
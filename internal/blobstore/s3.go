@@ -0,0 +1,373 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service         = "s3"
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3DateFormat      = "20060102"
+	s3TimeFormat      = "20060102T150405Z"
+)
+
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g. "https://s3.eu-central-1.amazonaws.com" or "http://localhost:9000" for MinIO
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle puts the bucket into the path instead of the host name, MinIO and most S3-compatible services need it
+	PathStyle bool
+}
+
+// S3 keeps the blobs in an S3-compatible object storage, the requests are signed with AWS Signature Version 4
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, errors.New("the s3 endpoint must be an absolute url")
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("the s3 bucket is not set")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	return &S3{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+// S3Error is the error response of the service
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func readS3Error(res *http.Response) error {
+	s3Err := &S3Error{StatusCode: res.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	xml.Unmarshal(body, s3Err)
+
+	return s3Err
+}
+
+// bucketUrl returns the URL of the bucket, the key is appended to its path
+func (s *S3) bucketUrl() *url.URL {
+	u := *s.endpoint
+	if s.cfg.PathStyle {
+		u.Path += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+
+	return &u
+}
+
+func (s *S3) objectUrl(key string) *url.URL {
+	u := s.bucketUrl()
+	u.Path += "/" + key
+	u.RawPath = u.Path[:len(u.Path)-len(key)] + s3Escape(key, false)
+
+	return u
+}
+
+// s3Escape encodes the string as the signature requires: everything but the unreserved characters is percent-encoded
+func s3Escape(s string, escapeSlash bool) string {
+	var buf strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			buf.WriteByte(b)
+		case b == '/' && !escapeSlash:
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", b)
+		}
+	}
+
+	return buf.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signature calculates the signature of the canonical request
+func (s *S3) signature(method string, u *url.URL, query url.Values, headers map[string]string, payloadHash string, now time.Time) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		s3CanonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := s.scope(now)
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3TimeFormat),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+s.cfg.SecretKey), now.Format(s3DateFormat))
+	key = hmacSha256(key, s.cfg.Region)
+	key = hmacSha256(key, s3Service)
+	key = hmacSha256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSha256(key, stringToSign)), signedHeaders
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.Format(s3DateFormat) + "/" + s.cfg.Region + "/" + s3Service + "/aws4_request"
+}
+
+// do sends the request signed in the Authorization header
+func (s *S3) do(ctx context.Context, method string, u *url.URL, content []byte, contentType string) (*http.Response, error) {
+	now := s.now().UTC()
+	payloadHash := sha256Hex(content)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(s3TimeFormat),
+	}
+	signature, signedHeaders := s.signature(method, u, u.Query(), headers, payloadHash, now)
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("Authorization", s3Algorithm+" Credential="+s.cfg.AccessKey+"/"+s.scope(now)+", SignedHeaders="+signedHeaders+", Signature="+signature)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if method == http.MethodPut {
+		req.ContentLength = int64(len(content))
+	}
+
+	return s.client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	res, err := s.do(ctx, http.MethodPut, s.objectUrl(key), content, contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return readS3Error(res)
+	}
+
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	if err := checkKey(key); err != nil {
+		return nil, Info{}, err
+	}
+
+	res, err := s.do(ctx, http.MethodGet, s.objectUrl(key), nil, "")
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, Info{}, ErrNotFound
+	default:
+		defer res.Body.Close()
+		return nil, Info{}, readS3Error(res)
+	}
+
+	info := Info{
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+	if modTime, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+
+	return res.Body, info, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	res, err := s.do(ctx, http.MethodDelete, s.objectUrl(key), nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return readS3Error(res)
+	}
+
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	continuationToken := ""
+
+	for {
+		u := s.bucketUrl()
+		u.Path += "/"
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		u.RawQuery = s3CanonicalQuery(query)
+
+		res, err := s.do(ctx, http.MethodGet, u, nil, "")
+		if err != nil {
+			return keys, err
+		}
+		if res.StatusCode != http.StatusOK {
+			err = readS3Error(res)
+			res.Body.Close()
+			return keys, err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return keys, err
+		}
+
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// SignedUrl returns the pre-signed GET URL of the object, the signature is calculated locally without a request.
+// The response headers are signed as the response-* parameters of the URL.
+func (s *S3) SignedUrl(_ context.Context, key string, expiration time.Duration, headers ResponseHeaders) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	now := s.now().UTC()
+	u := s.objectUrl(key)
+	query := url.Values{
+		"X-Amz-Algorithm":     {s3Algorithm},
+		"X-Amz-Credential":    {s.cfg.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(s3TimeFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(expiration.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if headers.ContentType != "" {
+		query.Set("response-content-type", headers.ContentType)
+	}
+	if headers.CacheControl != "" {
+		query.Set("response-cache-control", headers.CacheControl)
+	}
+
+	signature, _ := s.signature(http.MethodGet, u, query, map[string]string{"host": u.Host}, s3UnsignedPayload, now)
+	query.Set("X-Amz-Signature", signature)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	return u.String(), nil
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	tl "test-server-go/internal/tools"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -21,6 +22,8 @@ type Config struct {
 		Port  int    `yaml:"port"`
 		Debug bool   `yaml:"debug"`
 		Jwt   string `yaml:"jwt"`
+		// TrustedProxies are the addresses or the networks of the proxies whose X-Forwarded-For is trusted
+		TrustedProxies []string `yaml:"trustedProxies"`
 	} `yaml:"app"`
 	Prometheus struct {
 		Port int `yaml:"port"`
@@ -52,6 +55,20 @@ type Config struct {
 		Port     int    `yaml:"port"`
 		Database int    `yaml:"database"`
 	} `yaml:"redis"`
+	BlobStore struct {
+		Type  string `yaml:"type"`
+		Local struct {
+			Dir string `yaml:"dir"`
+		} `yaml:"local"`
+		S3 struct {
+			Endpoint  string `yaml:"endpoint"`
+			Region    string `yaml:"region"`
+			Bucket    string `yaml:"bucket"`
+			AccessKey string `yaml:"accessKey"`
+			SecretKey string `yaml:"secretKey"`
+			PathStyle bool   `yaml:"pathStyle"`
+		} `yaml:"s3"`
+	} `yaml:"blobStore"`
 	Tls struct {
 		CertFile string `yaml:"certfile"`
 		KeyFile  string `yaml:"keyfile"`
@@ -64,6 +81,29 @@ type Config struct {
 			SecondSecretWord string `yaml:"secondSecretWord"`
 		} `yaml:"freekassa"`
 	} `yaml:"payments"`
+	OAuth struct {
+		Google struct {
+			ClientId     string `yaml:"clientId"`
+			ClientSecret string `yaml:"clientSecret"`
+			RedirectUrl  string `yaml:"redirectUrl"`
+			AuthUrl      string `yaml:"authUrl"`
+			TokenUrl     string `yaml:"tokenUrl"`
+			UserInfoUrl  string `yaml:"userInfoUrl"`
+		} `yaml:"google"`
+		Telegram struct {
+			BotToken string `yaml:"botToken"`
+		} `yaml:"telegram"`
+	} `yaml:"oauth"`
+	Suppliers []struct {
+		Name             string        `yaml:"name"`
+		Url              string        `yaml:"url"`
+		ApiKey           string        `yaml:"apiKey"`
+		Timeout          time.Duration `yaml:"timeout"`
+		Retries          int           `yaml:"retries"`
+		Backoff          time.Duration `yaml:"backoff"`
+		FailureThreshold int           `yaml:"failureThreshold"`
+		Cooldown         time.Duration `yaml:"cooldown"`
+	} `yaml:"suppliers"`
 }
 
 func SetupYaml() (*Config, error) {
@@ -120,6 +160,16 @@ func SetupYaml() (*Config, error) {
 	flag.IntVar(&cfg.Redis.Port, "redis-port", cfg.Redis.Port, "port for redis")
 	flag.IntVar(&cfg.Redis.Database, "redis-database", cfg.Redis.Database, "maintenance database for redis")
 
+	// Blob store
+	flag.StringVar(&cfg.BlobStore.Type, "blobstore-type", cfg.BlobStore.Type, "blob store for the uploaded resources: local or s3")
+	flag.StringVar(&cfg.BlobStore.Local.Dir, "blobstore-local-dir", cfg.BlobStore.Local.Dir, "directory of the local blob store")
+	flag.StringVar(&cfg.BlobStore.S3.Endpoint, "blobstore-s3-endpoint", cfg.BlobStore.S3.Endpoint, "s3 endpoint url")
+	flag.StringVar(&cfg.BlobStore.S3.Region, "blobstore-s3-region", cfg.BlobStore.S3.Region, "s3 region")
+	flag.StringVar(&cfg.BlobStore.S3.Bucket, "blobstore-s3-bucket", cfg.BlobStore.S3.Bucket, "s3 bucket")
+	flag.StringVar(&cfg.BlobStore.S3.AccessKey, "blobstore-s3-accessKey", cfg.BlobStore.S3.AccessKey, "s3 access key")
+	flag.StringVar(&cfg.BlobStore.S3.SecretKey, "blobstore-s3-secretKey", cfg.BlobStore.S3.SecretKey, "s3 secret key")
+	flag.BoolVar(&cfg.BlobStore.S3.PathStyle, "blobstore-s3-pathStyle", cfg.BlobStore.S3.PathStyle, "s3 path-style addressing")
+
 	// TLS
 	flag.StringVar(&cfg.Tls.CertFile, "tls-certfile", cfg.Tls.CertFile, "tls certificate file")
 	flag.StringVar(&cfg.Tls.KeyFile, "tls-keyfile", cfg.Tls.KeyFile, "tls key file")
@@ -130,6 +180,15 @@ func SetupYaml() (*Config, error) {
 	flag.StringVar(&cfg.Payments.Freekassa.FirstSecretWord, "payments-freekassa-firstSecretWord", cfg.Payments.Freekassa.FirstSecretWord, "payments first secret word for freekassa")
 	flag.StringVar(&cfg.Payments.Freekassa.SecondSecretWord, "payments-freekassa-secondSecretWord", cfg.Payments.Freekassa.SecondSecretWord, "payments second secret word for freekassa")
 
+	// OAuth
+	flag.StringVar(&cfg.OAuth.Google.ClientId, "oauth-google-clientId", cfg.OAuth.Google.ClientId, "google oauth client id")
+	flag.StringVar(&cfg.OAuth.Google.ClientSecret, "oauth-google-clientSecret", cfg.OAuth.Google.ClientSecret, "google oauth client secret")
+	flag.StringVar(&cfg.OAuth.Google.RedirectUrl, "oauth-google-redirectUrl", cfg.OAuth.Google.RedirectUrl, "google oauth redirect url")
+	flag.StringVar(&cfg.OAuth.Google.AuthUrl, "oauth-google-authUrl", cfg.OAuth.Google.AuthUrl, "google oauth authorization endpoint")
+	flag.StringVar(&cfg.OAuth.Google.TokenUrl, "oauth-google-tokenUrl", cfg.OAuth.Google.TokenUrl, "google oauth token endpoint")
+	flag.StringVar(&cfg.OAuth.Google.UserInfoUrl, "oauth-google-userInfoUrl", cfg.OAuth.Google.UserInfoUrl, "google oauth userinfo endpoint")
+	flag.StringVar(&cfg.OAuth.Telegram.BotToken, "oauth-telegram-botToken", cfg.OAuth.Telegram.BotToken, "telegram login widget bot token")
+
 	flag.Parse()
 
 	return &cfg, nil
@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"context"
+	"test-server-go/internal/storage"
+	"time"
+)
+
+// StockNotifier e-mails the subscribers of the variants which are back in stock.
+// The notices are claimed in batches, so several instances share the work and every notice is sent once.
+type StockNotifier struct {
+	// Claim marks up to the limit of the pending notices as sent and returns them ordered by the account
+	Claim func(ctx context.Context, limit int) ([]storage.StockNotice, error)
+	// Release returns the notices which were not sent to the queue
+	Release func(ctx context.Context, notices []storage.StockNotice) error
+	// Send e-mails all the notices of one account
+	Send func(notices []storage.StockNotice) error
+	// OnError reports the failures, the notifier keeps running after them
+	OnError func(error)
+
+	BatchSize int
+}
+
+// Run sends the pending notices on every signal and every interval, the interval catches the changes made by the other instances
+func (n *StockNotifier) Run(ctx context.Context, signals <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		case <-ticker.C:
+		}
+
+		n.sendPending(ctx)
+	}
+}
+
+// sendPending claims the batches until the queue is empty or the context is cancelled.
+// It stops after a failed send, the released notices would be claimed again at once, so they wait for the next run.
+func (n *StockNotifier) sendPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		notices, err := n.Claim(ctx, n.BatchSize)
+		if err != nil {
+			n.OnError(err)
+			return
+		}
+
+		failed := n.sendBatch(ctx, notices)
+
+		if failed || len(notices) < n.BatchSize {
+			return
+		}
+	}
+}
+
+// sendBatch sends one e-mail per account and reports whether any of them failed. The batch is sent completely
+// even on the shutdown, because its notices are already claimed.
+func (n *StockNotifier) sendBatch(ctx context.Context, notices []storage.StockNotice) bool {
+	failed := false
+	for start := 0; start < len(notices); {
+		end := start + 1
+		for end < len(notices) && notices[end].AccountId == notices[start].AccountId {
+			end++
+		}
+
+		group := notices[start:end]
+		if err := n.Send(group); err != nil {
+			failed = true
+			n.OnError(err)
+			if err = n.Release(context.WithoutCancel(ctx), group); err != nil {
+				n.OnError(err)
+			}
+		}
+
+		start = end
+	}
+
+	return failed
+}
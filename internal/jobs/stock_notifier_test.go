@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"test-server-go/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNoticeQueue hands out the queued notices in the claimed batches like ClaimStockNotices,
+// the released notices are queued again like ReleaseStockNotices
+type fakeNoticeQueue struct {
+	mu       sync.Mutex
+	queue    []storage.StockNotice
+	released []storage.StockNotice
+	claims   int
+}
+
+func (q *fakeNoticeQueue) claim(_ context.Context, limit int) ([]storage.StockNotice, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.claims++
+	n := min(limit, len(q.queue))
+	batch := q.queue[:n]
+	q.queue = q.queue[n:]
+	return batch, nil
+}
+
+func (q *fakeNoticeQueue) release(_ context.Context, notices []storage.StockNotice) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.released = append(q.released, notices...)
+	q.queue = append(q.queue, notices...)
+	return nil
+}
+
+func notice(accountId, variantId string) storage.StockNotice {
+	return storage.StockNotice{AccountId: accountId, Email: accountId + "@example.com", VariantId: variantId}
+}
+
+func TestStockNotifierGroupsByAccount(t *testing.T) {
+	queue := &fakeNoticeQueue{queue: []storage.StockNotice{
+		notice("a", "1"), notice("a", "2"), notice("b", "1"), notice("c", "3"), notice("c", "4"),
+	}}
+	var sent [][]string
+	notifier := &StockNotifier{
+		Claim:   queue.claim,
+		Release: queue.release,
+		Send: func(notices []storage.StockNotice) error {
+			var variants []string
+			for _, n := range notices {
+				assert.Equal(t, notices[0].AccountId, n.AccountId, "one e-mail should have the notices of one account")
+				variants = append(variants, n.AccountId+n.VariantId)
+			}
+			sent = append(sent, variants)
+			return nil
+		},
+		OnError:   func(err error) { t.Fatal(err) },
+		BatchSize: 10,
+	}
+
+	notifier.sendPending(context.Background())
+
+	assert.Equal(t, [][]string{{"a1", "a2"}, {"b1"}, {"c3", "c4"}}, sent)
+	assert.Equal(t, 1, queue.claims, "the short batch means the queue is empty")
+}
+
+func TestStockNotifierClaimsUntilEmpty(t *testing.T) {
+	queue := &fakeNoticeQueue{queue: []storage.StockNotice{
+		notice("a", "1"), notice("b", "1"), notice("c", "1"), notice("d", "1"),
+	}}
+	sent := 0
+	notifier := &StockNotifier{
+		Claim:     queue.claim,
+		Release:   queue.release,
+		Send:      func(notices []storage.StockNotice) error { sent += len(notices); return nil },
+		OnError:   func(err error) { t.Fatal(err) },
+		BatchSize: 2,
+	}
+
+	notifier.sendPending(context.Background())
+
+	assert.Equal(t, 4, sent)
+	assert.Equal(t, 3, queue.claims, "the full batches should be followed by another claim")
+}
+
+func TestStockNotifierReleasesFailedSends(t *testing.T) {
+	queue := &fakeNoticeQueue{queue: []storage.StockNotice{notice("a", "1"), notice("b", "1"), notice("b", "2")}}
+	var errs []error
+	notifier := &StockNotifier{
+		Claim:   queue.claim,
+		Release: queue.release,
+		Send: func(notices []storage.StockNotice) error {
+			if notices[0].AccountId == "b" {
+				return errors.New("smtp failure")
+			}
+			return nil
+		},
+		OnError:   func(err error) { errs = append(errs, err) },
+		BatchSize: 10,
+	}
+
+	notifier.sendPending(context.Background())
+
+	assert.Len(t, errs, 1)
+	assert.Equal(t, []storage.StockNotice{notice("b", "1"), notice("b", "2")}, queue.released, "only the failed account should be released")
+}
+
+func TestStockNotifierStopsAfterFailedBatch(t *testing.T) {
+	queue := &fakeNoticeQueue{queue: []storage.StockNotice{notice("a", "1"), notice("b", "1"), notice("c", "1")}}
+	var errs []error
+	notifier := &StockNotifier{
+		Claim:     queue.claim,
+		Release:   queue.release,
+		Send:      func([]storage.StockNotice) error { return errors.New("smtp failure") },
+		OnError:   func(err error) { errs = append(errs, err) },
+		BatchSize: 2,
+	}
+
+	notifier.sendPending(context.Background())
+
+	assert.Equal(t, 1, queue.claims, "the released notices should wait for the next run")
+	assert.Len(t, errs, 2)
+	assert.Len(t, queue.queue, 3, "the failed notices should be back in the queue")
+}
+
+func TestStockNotifierRunsOnSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := &fakeNoticeQueue{}
+	notifier := &StockNotifier{
+		Claim:     queue.claim,
+		Release:   queue.release,
+		Send:      func([]storage.StockNotice) error { return nil },
+		OnError:   func(err error) { t.Error(err) },
+		BatchSize: 10,
+	}
+	signals := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		notifier.Run(ctx, signals, time.Hour)
+		close(done)
+	}()
+
+	signals <- struct{}{}
+	assert.Eventually(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return queue.claims == 1
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"test-server-go/internal/storage"
+	"test-server-go/internal/supplier"
+	"time"
+)
+
+// SupplierFulfiller gets the content of the paid orders awaiting it from the suppliers of their variants.
+// The orders are claimed in batches, so several instances share the work. The failed orders are released
+// and retried by the next runs, the open breaker of the supplier lets them through after its cooldown.
+type SupplierFulfiller struct {
+	// Claim takes up to the limit of the orders awaiting the suppliers, the oldest payments first
+	Claim func(ctx context.Context, limit int) ([]storage.SupplierOrder, error)
+	// Release returns the orders which were not fulfilled to the queue
+	Release func(ctx context.Context, orders []storage.SupplierOrder) error
+	// Fetch mints the content of the order with its supplier
+	Fetch func(ctx context.Context, order storage.SupplierOrder) (string, error)
+	// Save saves the minted content of the order and returns the fulfilled orders
+	Save func(ctx context.Context, order storage.SupplierOrder, content string) ([]string, error)
+	// Notify e-mails the buyers of the orders, the orders still awaiting the content get the confirmation of the payment
+	Notify func(ctx context.Context, orderIds []string)
+	// OnError reports the failures, the fulfiller keeps running after them
+	OnError func(error)
+
+	BatchSize int
+}
+
+// Run fulfils the pending orders on every signal and every interval, the interval retries the failed orders
+// and catches the orders paid on the other instances
+func (f *SupplierFulfiller) Run(ctx context.Context, signals <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		case <-ticker.C:
+		}
+
+		f.fulfilPending(ctx)
+	}
+}
+
+// fulfilPending claims the batches until the queue is empty or the context is cancelled.
+// It stops after a released order, the order would be claimed again at once, so it waits for the next run.
+func (f *SupplierFulfiller) fulfilPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		orders, err := f.Claim(ctx, f.BatchSize)
+		if err != nil {
+			f.OnError(err)
+			return
+		}
+
+		released := f.fulfilBatch(ctx, orders)
+
+		if released || len(orders) < f.BatchSize {
+			return
+		}
+	}
+}
+
+// fulfilBatch fetches the content of every order and reports whether any order was released. After a failed fetch
+// the other orders of the supplier are released without the calls. The minted content is saved and e-mailed even
+// on the shutdown, because the supplier has already issued it.
+func (f *SupplierFulfiller) fulfilBatch(ctx context.Context, orders []storage.SupplierOrder) bool {
+	var released []storage.SupplierOrder
+	failedSuppliers := make(map[string]bool)
+
+	for _, order := range orders {
+		if ctx.Err() != nil || failedSuppliers[order.Supplier] {
+			released = append(released, order)
+			continue
+		}
+
+		content, err := f.Fetch(ctx, order)
+		if err != nil {
+			failedSuppliers[order.Supplier] = true
+			if ctx.Err() != nil {
+				released = append(released, order)
+				continue
+			}
+			// The open breaker was reported by the failure which opened it
+			if !errors.Is(err, supplier.ErrCircuitOpen) {
+				f.OnError(err)
+			}
+			// The buyer is told of the delay once, the content is e-mailed when the order is fulfilled
+			if order.FirstAttempt {
+				f.Notify(context.WithoutCancel(ctx), []string{order.OrderId})
+				order.FirstAttempt = false
+			}
+			released = append(released, order)
+			continue
+		}
+
+		// The content is minted once per order, so the failed save gets the same content on the retry
+		fulfilled, err := f.Save(context.WithoutCancel(ctx), order, content)
+		if err != nil {
+			f.OnError(err)
+			released = append(released, order)
+			continue
+		}
+		f.Notify(context.WithoutCancel(ctx), fulfilled)
+	}
+
+	if len(released) == 0 {
+		return false
+	}
+	if err := f.Release(context.WithoutCancel(ctx), released); err != nil {
+		f.OnError(err)
+	}
+
+	return true
+}
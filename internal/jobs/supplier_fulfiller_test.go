@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"test-server-go/internal/storage"
+	"test-server-go/internal/supplier"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOrderQueue hands out the queued orders in the claimed batches like ClaimSupplierOrders,
+// the released orders are queued again like ReleaseSupplierOrders
+type fakeOrderQueue struct {
+	queue    []storage.SupplierOrder
+	released []storage.SupplierOrder
+	claims   int
+}
+
+func (q *fakeOrderQueue) claim(_ context.Context, limit int) ([]storage.SupplierOrder, error) {
+	q.claims++
+	n := min(limit, len(q.queue))
+	batch := q.queue[:n]
+	q.queue = q.queue[n:]
+	return batch, nil
+}
+
+func (q *fakeOrderQueue) release(_ context.Context, orders []storage.SupplierOrder) error {
+	q.released = append(q.released, orders...)
+	q.queue = append(q.queue, orders...)
+	return nil
+}
+
+func supplierOrder(orderId, supplierName string) storage.SupplierOrder {
+	return storage.SupplierOrder{OrderId: orderId, Supplier: supplierName, Sku: "sku", FirstAttempt: true}
+}
+
+func TestSupplierFulfillerClaimsUntilEmpty(t *testing.T) {
+	queue := &fakeOrderQueue{queue: []storage.SupplierOrder{
+		supplierOrder("1", "a"), supplierOrder("2", "a"), supplierOrder("3", "b"),
+	}}
+	var notified []string
+	fulfiller := &SupplierFulfiller{
+		Claim:   queue.claim,
+		Release: queue.release,
+		Fetch: func(_ context.Context, order storage.SupplierOrder) (string, error) {
+			return "code-" + order.OrderId, nil
+		},
+		Save: func(_ context.Context, order storage.SupplierOrder, content string) ([]string, error) {
+			assert.Equal(t, "code-"+order.OrderId, content)
+			return []string{order.OrderId}, nil
+		},
+		Notify:    func(_ context.Context, orderIds []string) { notified = append(notified, orderIds...) },
+		OnError:   func(err error) { t.Fatal(err) },
+		BatchSize: 2,
+	}
+
+	fulfiller.fulfilPending(context.Background())
+
+	assert.Equal(t, []string{"1", "2", "3"}, notified)
+	assert.Equal(t, 2, queue.claims, "the short batch means the queue is empty")
+	assert.Empty(t, queue.released)
+}
+
+func TestSupplierFulfillerReleasesFailedSupplier(t *testing.T) {
+	queue := &fakeOrderQueue{queue: []storage.SupplierOrder{
+		supplierOrder("1", "a"), supplierOrder("2", "b"), supplierOrder("3", "a"),
+	}}
+	var fetched, notified []string
+	var errs []error
+	fulfiller := &SupplierFulfiller{
+		Claim:   queue.claim,
+		Release: queue.release,
+		Fetch: func(_ context.Context, order storage.SupplierOrder) (string, error) {
+			fetched = append(fetched, order.OrderId)
+			if order.Supplier == "a" {
+				return "", errors.New("supplier responded with status 502")
+			}
+			return "code", nil
+		},
+		Save: func(_ context.Context, order storage.SupplierOrder, _ string) ([]string, error) {
+			return []string{order.OrderId}, nil
+		},
+		Notify:    func(_ context.Context, orderIds []string) { notified = append(notified, orderIds...) },
+		OnError:   func(err error) { errs = append(errs, err) },
+		BatchSize: 3,
+	}
+
+	fulfiller.fulfilPending(context.Background())
+
+	assert.Equal(t, []string{"1", "2"}, fetched, "the failed supplier should not be called again in the batch")
+	assert.Equal(t, []string{"1", "2"}, notified, "the failed order should get the confirmation of the payment")
+	assert.Len(t, errs, 1)
+	assert.Equal(t, 1, queue.claims, "the released orders should wait for the next run")
+	assert.Equal(t, []storage.SupplierOrder{
+		{OrderId: "1", Supplier: "a", Sku: "sku"},
+		supplierOrder("3", "a"),
+	}, queue.released, "only the attempted order should lose its first attempt")
+
+	// The next run after the cooldown gets the content of the released orders
+	fetched, notified = nil, nil
+	fulfiller.Fetch = func(context.Context, storage.SupplierOrder) (string, error) { return "code", nil }
+	fulfiller.fulfilPending(context.Background())
+
+	assert.Equal(t, []string{"1", "3"}, notified)
+}
+
+func TestSupplierFulfillerOpenCircuit(t *testing.T) {
+	queue := &fakeOrderQueue{queue: []storage.SupplierOrder{{OrderId: "1", Supplier: "a", Sku: "sku"}}}
+	fulfiller := &SupplierFulfiller{
+		Claim:   queue.claim,
+		Release: queue.release,
+		Fetch: func(context.Context, storage.SupplierOrder) (string, error) {
+			return "", supplier.ErrCircuitOpen
+		},
+		Save: func(context.Context, storage.SupplierOrder, string) ([]string, error) {
+			t.Fatal("nothing should be saved")
+			return nil, nil
+		},
+		Notify:    func(context.Context, []string) { t.Fatal("the buyer has already been told of the delay") },
+		OnError:   func(err error) { t.Fatal(err) },
+		BatchSize: 10,
+	}
+
+	fulfiller.fulfilPending(context.Background())
+
+	assert.Len(t, queue.queue, 1, "the order should be retried after the cooldown")
+}
+
+func TestSupplierFulfillerShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := &fakeOrderQueue{queue: []storage.SupplierOrder{supplierOrder("1", "a"), supplierOrder("2", "b")}}
+	var saved []string
+	fulfiller := &SupplierFulfiller{
+		Claim:   queue.claim,
+		Release: queue.release,
+		Fetch: func(ctx context.Context, order storage.SupplierOrder) (string, error) {
+			// The shutdown comes while the code is minted
+			cancel()
+			return "code", nil
+		},
+		Save: func(ctx context.Context, order storage.SupplierOrder, _ string) ([]string, error) {
+			assert.NoError(t, ctx.Err(), "the minted content should be saved on the shutdown")
+			saved = append(saved, order.OrderId)
+			return []string{order.OrderId}, nil
+		},
+		Notify:    func(context.Context, []string) {},
+		OnError:   func(err error) { t.Fatal(err) },
+		BatchSize: 10,
+	}
+
+	fulfiller.fulfilPending(ctx)
+
+	assert.Equal(t, []string{"1"}, saved)
+	assert.Equal(t, []storage.SupplierOrder{supplierOrder("2", "b")}, queue.released, "the rest of the batch should be released untouched")
+}
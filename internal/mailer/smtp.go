@@ -86,7 +86,7 @@ func (m *Mailer) SendEmailConfirmation(nickname, email, confirmationUrl, clientA
 	return nil
 }
 
-func (m *Mailer) SendOrderContent(email, nickname, variantName, serviceName, itemName, orderContent, clientAppUrl string) error {
+func (m *Mailer) SendOrderContent(email, nickname, variantName, serviceName, itemName, orderContent, activationInstruction, clientAppUrl string) error {
 	templateFile, err := getPath("mailOrder.tmpl")
 	if err != nil {
 		return err
@@ -97,12 +97,44 @@ func (m *Mailer) SendOrderContent(email, nickname, variantName, serviceName, ite
 		return err
 	}
 
+	resources := map[string]interface{}{
+		"Nickname":              nickname,
+		"VariantName":           variantName,
+		"OrderContent":          orderContent,
+		"ActivationInstruction": activationInstruction,
+		"ServiceName":           strings.ToUpper(serviceName),
+		"ItemName":              strings.ToUpper(itemName),
+		"ClientAppUrl":          clientAppUrl,
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, resources); err != nil {
+		return err
+	}
+
+	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: содержимое заказа", buf.String()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendPreorderNotice confirms the payment of the pre-order, the content is sent later by SendOrderContent
+func (m *Mailer) SendPreorderNotice(email, nickname, variantName, releaseAt, clientAppUrl string) error {
+	templateFile, err := getPath("mailPreorder.tmpl")
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return err
+	}
+
 	resources := map[string]interface{}{
 		"Nickname":     nickname,
 		"VariantName":  variantName,
-		"OrderContent": orderContent,
-		"ServiceName":  strings.ToUpper(serviceName),
-		"ItemName":     strings.ToUpper(itemName),
+		"ReleaseAt":    releaseAt,
 		"ClientAppUrl": clientAppUrl,
 	}
 
@@ -111,7 +143,196 @@ func (m *Mailer) SendOrderContent(email, nickname, variantName, serviceName, ite
 		return err
 	}
 
-	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: содержимое заказа", buf.String()); err != nil {
+	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: предзаказ оплачен", buf.String()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendDelayedOrderNotice confirms the payment of the order left without the content by the supplier,
+// the content is sent later by SendOrderContent
+func (m *Mailer) SendDelayedOrderNotice(email, nickname, variantName, clientAppUrl string) error {
+	templateFile, err := getPath("mailOrderDelayed.tmpl")
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return err
+	}
+
+	resources := map[string]interface{}{
+		"Nickname":     nickname,
+		"VariantName":  variantName,
+		"ClientAppUrl": clientAppUrl,
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, resources); err != nil {
+		return err
+	}
+
+	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: заказ оплачен", buf.String()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *Mailer) SendLoginLockNotice(email, nickname, ip, lockedUntil, clientAppUrl string) error {
+	templateFile, err := getPath("mailLoginLock.tmpl")
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return err
+	}
+
+	resources := map[string]interface{}{
+		"Nickname":     nickname,
+		"Ip":           ip,
+		"LockedUntil":  lockedUntil,
+		"ClientAppUrl": clientAppUrl,
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, resources); err != nil {
+		return err
+	}
+
+	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: вход в учётную запись временно заблокирован", buf.String()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *Mailer) SendEmailChangeConfirmation(nickname, email, confirmationUrl, clientAppUrl string) error {
+	templateFile, err := getPath("mailEmailChange.tmpl")
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return err
+	}
+
+	resources := map[string]interface{}{
+		"Nickname":         nickname,
+		"Email":            email,
+		"ConfirmationLink": confirmationUrl,
+		"ClientAppUrl":     clientAppUrl,
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, resources); err != nil {
+		return err
+	}
+
+	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: подтверждение новой электронной почты", buf.String()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *Mailer) SendAccountDeletionConfirmation(nickname, email, confirmationUrl, clientAppUrl string) error {
+	templateFile, err := getPath("mailAccountDeletion.tmpl")
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return err
+	}
+
+	resources := map[string]interface{}{
+		"Nickname":         nickname,
+		"ConfirmationLink": confirmationUrl,
+		"ClientAppUrl":     clientAppUrl,
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, resources); err != nil {
+		return err
+	}
+
+	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: подтверждение удаления учётной записи", buf.String()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SendPasswordRecovery sends the link to set a new password.
+// Forced is set when the password was reset by the administration.
+func (m *Mailer) SendPasswordRecovery(nickname, email, recoveryUrl, clientAppUrl string, forced bool) error {
+	templateFile, err := getPath("mailPasswordRecovery.tmpl")
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return err
+	}
+
+	resources := map[string]interface{}{
+		"Nickname":     nickname,
+		"RecoveryLink": recoveryUrl,
+		"ClientAppUrl": clientAppUrl,
+		"Forced":       forced,
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, resources); err != nil {
+		return err
+	}
+
+	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: восстановление пароля", buf.String()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RestockVariant is the variant of the back in stock notice with the link to its product page
+type RestockVariant struct {
+	ProductName string
+	VariantName string
+	Url         string
+}
+
+// SendRestockNotice sends the list of the subscribed variants which are back in stock
+func (m *Mailer) SendRestockNotice(email, nickname string, variants []RestockVariant, clientAppUrl string) error {
+	templateFile, err := getPath("mailRestock.tmpl")
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFiles(templateFile)
+	if err != nil {
+		return err
+	}
+
+	resources := map[string]interface{}{
+		"Nickname":     nickname,
+		"Variants":     variants,
+		"ClientAppUrl": clientAppUrl,
+	}
+
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, resources); err != nil {
+		return err
+	}
+
+	if err = m.sendEmail([]string{email}, "Evgenick's Digitals: товары снова в наличии", buf.String()); err != nil {
 		return err
 	}
 
@@ -1,11 +1,14 @@
 package models
 
 import (
+	"test-server-go/internal/auth"
+	"test-server-go/internal/blobstore"
 	"test-server-go/internal/config"
 	"test-server-go/internal/freekassa"
 	"test-server-go/internal/logger"
 	"test-server-go/internal/mailer"
 	"test-server-go/internal/storage"
+	"test-server-go/internal/supplier"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -13,9 +16,12 @@ import (
 type Application struct {
 	Config    *config.Config
 	Postgres  *storage.Postgres
+	Blob      blobstore.BlobStore
 	Redis     *storage.Redis
 	Mailer    *mailer.Mailer
 	Logger    *logger.Logger
 	Router    *chi.Mux
 	Freekassa *freekassa.Config
+	Google    *auth.GoogleConfig
+	Suppliers *supplier.Registry
 }
@@ -8,13 +8,18 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
+	"test-server-go/internal/api_v1"
 	"test-server-go/internal/api_v1/handlers_v1"
+	"test-server-go/internal/auth"
+	"test-server-go/internal/blobstore"
 	"test-server-go/internal/config"
 	freekassa2 "test-server-go/internal/freekassa"
+	"test-server-go/internal/jobs"
 	"test-server-go/internal/logger"
 	"test-server-go/internal/mailer"
 	"test-server-go/internal/models"
 	"test-server-go/internal/storage"
+	"test-server-go/internal/supplier"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -25,6 +30,38 @@ func Run() {
 
 	setupRouter(*app)
 
+	// The catalog summary is refreshed in the background after the admin changes, then the cached responses are dropped
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	refreshDone := make(chan struct{})
+	go func() {
+		defer close(refreshDone)
+		app.Postgres.RunCatalogRefresher(refreshCtx, storage.CatalogRefreshDelay, storage.CatalogRefreshMaxDelay,
+			func(ctx context.Context) {
+				if err := storage.UpdateCatalogCacheState(ctx, app.Redis); err != nil {
+					app.Logger.NewWarn("error in invalidate catalog cache", err)
+				}
+			},
+			func(err error) {
+				app.Logger.NewWarn("error in refresh catalog", err)
+			})
+	}()
+
+	// The subscribers of the variants back in stock are e-mailed in the background
+	noticesCtx, stopNotices := context.WithCancel(context.Background())
+	noticesDone := make(chan struct{})
+	go func() {
+		defer close(noticesDone)
+		newStockNotifier(app).Run(noticesCtx, app.Postgres.StockNoticeSignals(), storage.StockNoticeInterval)
+	}()
+
+	// The content of the orders awaiting the suppliers is minted in the background
+	suppliesCtx, stopSupplies := context.WithCancel(context.Background())
+	suppliesDone := make(chan struct{})
+	go func() {
+		defer close(suppliesDone)
+		newSupplierFulfiller(app).Run(suppliesCtx, app.Postgres.SupplierOrderSignals(), storage.SupplierOrderInterval)
+	}()
+
 	prometheusServer := &http.Server{
 		Addr:    "localhost:" + strconv.Itoa(app.Config.Prometheus.Port),
 		Handler: app.Router,
@@ -86,6 +123,18 @@ func Run() {
 
 	apiV1Server.Shutdown(context.Background())
 	app.Logger.NewInfo("API v1 service is shut down")
+
+	stopRefresh()
+	<-refreshDone
+	app.Logger.NewInfo("Catalog refresher is stopped")
+
+	stopNotices()
+	<-noticesDone
+	app.Logger.NewInfo("Stock notifier is stopped")
+
+	stopSupplies()
+	<-suppliesDone
+	app.Logger.NewInfo("Supplier fulfiller is stopped")
 	app.Logger.NewInfo("Done")
 }
 
@@ -110,18 +159,41 @@ func setupConfig() *models.Application {
 		zapLogger.NewError("Error connecting to the PostgreSQL database", err)
 	}
 
+	// The suppliers of the config are accounted with the records of product.supplier
+	supplierNames := make([]string, 0, len(cfg.Suppliers))
+	for _, s := range cfg.Suppliers {
+		supplierNames = append(supplierNames, s.Name)
+	}
+	if err = storage.LinkSuppliers(ctx, pdb, supplierNames); err != nil {
+		zapLogger.NewWarn("Error linking the suppliers", err)
+	}
+
 	// Getting Redis
 	rdb, err := storage.NewRedis(ctx, *cfg)
 	if err != nil {
 		zapLogger.NewError("Error connecting to the Redis database", err)
 	}
 
+	// Getting the blob store
+	blob, err := blobstore.NewBlobStore(*cfg)
+	if err != nil {
+		zapLogger.NewError("Error creating the blob store", err)
+	}
+
 	freekassaCfg := freekassa2.NewConfig(
 		uint32(cfg.Payments.Freekassa.ShopId),
 		cfg.Payments.Freekassa.ApiKey,
 		cfg.Payments.Freekassa.FirstSecretWord,
 		cfg.Payments.Freekassa.SecondSecretWord)
 
+	googleCfg := auth.NewGoogleConfig(
+		cfg.OAuth.Google.ClientId,
+		cfg.OAuth.Google.ClientSecret,
+		cfg.OAuth.Google.RedirectUrl,
+		cfg.OAuth.Google.AuthUrl,
+		cfg.OAuth.Google.TokenUrl,
+		cfg.OAuth.Google.UserInfoUrl)
+
 	//balance, err := freekassa2.Balances(freekassaCfg)
 	//if err != nil {
 	//	fmt.Printf("BALANCE ERROR: %v\n", err)
@@ -141,11 +213,14 @@ func setupConfig() *models.Application {
 	application := models.Application{
 		Config:    cfg,
 		Postgres:  pdb,
+		Blob:      blob,
 		Redis:     rdb,
 		Mailer:    mailer.NewSmtp(*cfg),
 		Logger:    zapLogger,
 		Router:    chi.NewRouter(),
 		Freekassa: freekassaCfg,
+		Google:    googleCfg,
+		Suppliers: supplier.NewRegistry(*cfg),
 	}
 
 	if application.Config.App.Debug {
@@ -155,14 +230,87 @@ func setupConfig() *models.Application {
 	return &application
 }
 
+func newStockNotifier(app *models.Application) *jobs.StockNotifier {
+	return &jobs.StockNotifier{
+		Claim: func(ctx context.Context, limit int) ([]storage.StockNotice, error) {
+			return storage.ClaimStockNotices(ctx, app.Postgres, limit)
+		},
+		Release: func(ctx context.Context, notices []storage.StockNotice) error {
+			return storage.ReleaseStockNotices(ctx, app.Postgres, notices)
+		},
+		Send: func(notices []storage.StockNotice) error {
+			clientUrl := app.Config.App.Service.Url.Client
+			variants := make([]mailer.RestockVariant, 0, len(notices))
+			for _, notice := range notices {
+				variants = append(variants, mailer.RestockVariant{
+					ProductName: notice.ProductName,
+					VariantName: notice.VariantName,
+					Url:         clientUrl + "/product/" + notice.Slug,
+				})
+			}
+			return app.Mailer.SendRestockNotice(notices[0].Email, notices[0].Nickname, variants, clientUrl)
+		},
+		OnError: func(err error) {
+			app.Logger.NewWarn("error in send stock notices", err)
+		},
+		BatchSize: storage.StockNoticeBatchSize,
+	}
+}
+
+func newSupplierFulfiller(app *models.Application) *jobs.SupplierFulfiller {
+	rs := &handlers_v1.Resolver{App: app}
+
+	return &jobs.SupplierFulfiller{
+		Claim: func(ctx context.Context, limit int) ([]storage.SupplierOrder, error) {
+			return storage.ClaimSupplierOrders(ctx, app.Postgres, limit)
+		},
+		Release: func(ctx context.Context, orders []storage.SupplierOrder) error {
+			return storage.ReleaseSupplierOrders(ctx, app.Postgres, orders)
+		},
+		Fetch: func(ctx context.Context, order storage.SupplierOrder) (string, error) {
+			source, err := app.Suppliers.Source(order.Supplier)
+			if err != nil {
+				return "", err
+			}
+			return source.Fetch(ctx, order.Sku, order.OrderId)
+		},
+		Save: func(ctx context.Context, order storage.SupplierOrder, content string) ([]string, error) {
+			fulfilled, err := storage.FulfilSupplierOrder(ctx, app.Postgres, order.OrderId, content, order.Supplier)
+			if err != nil {
+				return nil, err
+			}
+			// The content which went to the pool of the variant changes its stock
+			if err = storage.UpdateCatalogCacheState(ctx, app.Redis); err != nil {
+				app.Logger.NewWarn("error in invalidate catalog cache", err)
+			}
+			return fulfilled, nil
+		},
+		Notify: rs.SendOrderMails,
+		OnError: func(err error) {
+			app.Logger.NewWarn("error in fulfil supplier orders", err)
+		},
+		BatchSize: storage.SupplierOrderBatchSize,
+	}
+}
+
 func setupRouter(app models.Application) {
 	r := app.Router
 
-	r.Use(middleware.RealIP)       // Using user real ip address
-	r.Use(middleware.Recoverer)    // Prevents server from crashing
-	r.Use(middleware.StripSlashes) // Optimizes paths
-	r.Use(middleware.Logger)       // Logging
-	r.Use(middleware.Compress(5))  // Supports compression
+	// The client address is taken from the trusted proxies only, so it can not be spoofed to get around the login locks
+	proxies := app.Config.App.TrustedProxies
+	if len(proxies) == 0 {
+		proxies = api_v1.DefaultTrustedProxies
+	}
+	trustedProxies, err := api_v1.ParseTrustedProxies(proxies)
+	if err != nil {
+		app.Logger.NewError("Error parsing the trusted proxies", err)
+	}
+
+	r.Use(api_v1.RealIpMiddleware(trustedProxies)) // Using user real ip address
+	r.Use(middleware.Recoverer)                    // Prevents server from crashing
+	r.Use(middleware.StripSlashes)                 // Optimizes paths
+	r.Use(middleware.Logger)                       // Logging
+	r.Use(middleware.Compress(5))                  // Supports compression
 
 	// prometheus routes
 	setupPrometheus(app, "/prometheus/metrics", strconv.Itoa(app.Config.Prometheus.Port))
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// catalogRefreshLockKey is the advisory lock key taken by the refresh, so the instances do not refresh the summary at the same time
+	catalogRefreshLockKey int64 = 0x636174616c6f67 // "catalog"
+	// catalogRefreshFlushTimeout limits the pending refresh run on the shutdown
+	catalogRefreshFlushTimeout = 30 * time.Second
+)
+
+// UpdateData requests the refresh of the catalog summary and returns immediately.
+// The requests are coalesced by the refresher started with RunCatalogRefresher.
+func UpdateData(_ context.Context, pdb *Postgres) error {
+	select {
+	case pdb.catalogRefresh <- struct{}{}:
+	default:
+		// A refresh is already pending
+	}
+
+	return nil
+}
+
+// RunCatalogRefresher refreshes the catalog summary after the requests of UpdateData stop coming for the delay,
+// but not later than the maxDelay after the first request. A pending refresh is run when the context is cancelled.
+// The onRefreshed function is called after every successful refresh.
+func (pdb *Postgres) RunCatalogRefresher(ctx context.Context, delay, maxDelay time.Duration, onRefreshed func(context.Context), onError func(error)) {
+	runDebounced(ctx, pdb.catalogRefresh, delay, maxDelay, func(ctx context.Context) {
+		if err := refreshCatalog(ctx, pdb); err != nil {
+			onError(err)
+			return
+		}
+		onRefreshed(ctx)
+	})
+}
+
+// refreshCatalog refreshes the summary concurrently, the storefront keeps reading the old rows until it is done
+func refreshCatalog(ctx context.Context, pdb *Postgres) error {
+	conn, err := pdb.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// The refresh started after the lock is taken sees all the changes committed before, so waiting for the lock is enough
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", catalogRefreshLockKey); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", catalogRefreshLockKey)
+
+	_, err = conn.Exec(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY product.product_variants_summary_all_data")
+
+	return err
+}
+
+// runDebounced calls fn once for the burst of the signals, when they stop coming for the delay or the maxDelay has passed since the first one
+func runDebounced(ctx context.Context, signals <-chan struct{}, delay, maxDelay time.Duration, fn func(context.Context)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
+
+		deadline := time.NewTimer(maxDelay)
+		quiet := time.NewTimer(delay)
+
+	burst:
+		for {
+			select {
+			case <-ctx.Done():
+				deadline.Stop()
+				quiet.Stop()
+				flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), catalogRefreshFlushTimeout)
+				fn(flushCtx)
+				cancel()
+				return
+			case <-signals:
+				quiet.Reset(delay)
+			case <-quiet.C:
+				break burst
+			case <-deadline.C:
+				break burst
+			}
+		}
+		deadline.Stop()
+		quiet.Stop()
+
+		fn(ctx)
+	}
+}
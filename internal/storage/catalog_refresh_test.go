@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDebouncedCoalescesBurst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan struct{}, 1)
+	var calls atomic.Int32
+	go runDebounced(ctx, signals, 50*time.Millisecond, time.Second, func(context.Context) { calls.Add(1) })
+
+	for i := 0; i < 5; i++ {
+		signals <- struct{}{}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load(), "the burst should be refreshed once")
+
+	signals <- struct{}{}
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestRunDebouncedMaxDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan struct{}, 1)
+	var calls atomic.Int32
+	go runDebounced(ctx, signals, 50*time.Millisecond, 150*time.Millisecond, func(context.Context) { calls.Add(1) })
+
+	// The signals never stop for the delay, so only the max delay triggers the call
+	stop := time.After(400 * time.Millisecond)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-stop:
+			break loop
+		case <-ticker.C:
+			select {
+			case signals <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	assert.GreaterOrEqual(t, calls.Load(), int32(2))
+}
+
+func TestRunDebouncedFlushesOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan struct{}, 1)
+	done := make(chan struct{})
+	var flushCtxErr error
+	var calls atomic.Int32
+	go func() {
+		runDebounced(ctx, signals, time.Hour, time.Hour, func(ctx context.Context) {
+			calls.Add(1)
+			flushCtxErr = ctx.Err()
+		})
+		close(done)
+	}()
+
+	signals <- struct{}{}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, int32(1), calls.Load(), "the pending refresh should run on the shutdown")
+	assert.NoError(t, flushCtxErr, "the pending refresh should not get the cancelled context")
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"strings"
+	"time"
 )
 
 // Names style:
@@ -23,8 +24,49 @@ const (
 	AccountRegistrationMethodTelegramAccount = "telegram account"
 	AccountRegistrationMethodGoogleAccount   = "google account"
 
-	AccountRoleUser  = "user"
-	AccountRoleAdmin = "admin"
+	AccountRoleUser           = "user"
+	AccountRoleAdmin          = "admin"
+	AccountRoleSupport        = "support"
+	AccountRoleContentManager = "content manager"
+	AccountRoleFinance        = "finance"
+	AccountRoleSeller         = "seller"
+
+	OAuthProviderGoogle   = "google"
+	OAuthProviderTelegram = "telegram"
+)
+
+// CustomerRoles are the roles allowed to sign in to the store, the seller is the user selling its own variants
+var CustomerRoles = []string{AccountRoleUser, AccountRoleSeller}
+
+// EmployeeRoles are the roles allowed to sign in to the admin panel
+var EmployeeRoles = []string{AccountRoleAdmin, AccountRoleSupport, AccountRoleContentManager, AccountRoleFinance}
+
+// Seller payouts
+const (
+	PayoutStateRequested = "requested"
+	PayoutStateApproved  = "approved"
+	PayoutStateRejected  = "rejected"
+)
+
+// Permissions
+const (
+	PermissionCatalogRead        = "catalog.read"
+	PermissionCatalogWrite       = "catalog.write"
+	PermissionContentRead        = "content.read"
+	PermissionContentWrite       = "content.write"
+	PermissionOrdersRead         = "orders.read"
+	PermissionUsersRead          = "users.read"
+	PermissionUsersBlock         = "users.block"
+	PermissionUsersPasswordReset = "users.password_reset"
+	PermissionUsersImpersonate   = "users.impersonate"
+	PermissionEmployeesManage    = "employees.manage"
+	PermissionSecurityManage     = "security.manage"
+	PermissionDatabaseManage     = "database.manage"
+	PermissionAuditRead          = "audit.read"
+	PermissionReviewsModerate    = "reviews.moderate"
+	PermissionReportsRead        = "reports.read"
+	PermissionSellersManage      = "sellers.manage"
+	PermissionPayoutsApprove     = "payouts.approve"
 )
 
 // Products
@@ -34,10 +76,36 @@ const (
 	ProductStateUnavailableWithoutPrice = "unavailable without price"
 	ProductStateInvisible               = "invisible"
 	ProductStateDeleted                 = "deleted"
+
+	CampaignStateScheduled = "scheduled"
+	CampaignStateRunning   = "running"
+	CampaignStateEnded     = "ended"
+
+	ReviewStatePending   = "pending"
+	ReviewStatePublished = "published"
+	ReviewStateRejected  = "rejected"
+
+	// RegionGlobal is the region of the keys activated in any region
+	RegionGlobal = "global"
+
+	ProductImageThumbnail = "thumbnail"
+	ProductImageMedium    = "medium"
+	ProductImageLarge     = "large"
 )
 
 // System
 const (
+	CatalogRefreshDelay    = 2 * time.Second
+	CatalogRefreshMaxDelay = 10 * time.Second
+
+	StockNoticeInterval  = 5 * time.Minute
+	StockNoticeBatchSize = 100
+
+	SupplierOrderInterval  = time.Minute
+	SupplierOrderBatchSize = 20
+	// SupplierClaimTimeout must be longer than the fetch of a batch with all the retries
+	SupplierClaimTimeout = 10 * time.Minute
+
 	ResourcesProfileImagePath = "/api/v1/profile/image/"
 	ResourcesProductImagePath = "/api/v1/resources/product_image/"
 	ResourcesSvgFilePath      = "/api/v1/resources/svg/"
@@ -50,6 +118,24 @@ var (
 
 	NoResults   = errors.New("no results")
 	QueryExists = errors.New("value already exists")
+
+	LastLoginMethod = errors.New("the last login method cannot be removed")
+
+	UnknownCampaignTarget = errors.New("the campaign target does not exist")
+
+	NotVerifiedBuyer = errors.New("only the buyers of the product can review it")
+
+	OutOfStock             = errors.New("the variant is out of stock")
+	BundleContent          = errors.New("the content of the bundle is uploaded to its components")
+	InvalidBundleComponent = errors.New("the bundle component must be an existing variant which is not a bundle")
+	// SellerBundle is returned for the bundle of a seller or a bundle with a component of a seller,
+	// the sale of the bundle credits the seller of the bundle only
+	SellerBundle = errors.New("the bundle and its components can not belong to a seller")
+	// VariantOwnerStock is returned for the change of the owner of the variant with the content or the awaiting orders,
+	// the new owner would be credited with the content of the old one
+	VariantOwnerStock = errors.New("the variant with the content or the awaiting orders can not change its owner")
+
+	InsufficientBalance = errors.New("the amount exceeds the available balance of the seller")
 )
 
 func GetProfileImageUrl(apiUrl, file string) string {
@@ -60,6 +146,10 @@ func GetProductImageUrl(apiUrl, file string) string {
 	return strings.ToLower(apiUrl + ResourcesProductImagePath + strings.ReplaceAll(file, " ", "-"))
 }
 
+func GetProductImageRenditionUrl(apiUrl, imageId, size string) string {
+	return strings.ToLower(apiUrl + ResourcesProductImagePath + imageId + "/" + size)
+}
+
 func GetSvgFileUrl(apiUrl, file string) string {
 	return strings.ToLower(apiUrl + ResourcesSvgFilePath + strings.ReplaceAll(file, " ", "-"))
 }
@@ -70,4 +160,5 @@ const (
 	PgNoUpdated  = "the data not updated"
 	PgForeignKey = "the value is using now"
 	PgNoUnique   = "the value not unique"
+	PgCheck      = "the value is out of the allowed range"
 )
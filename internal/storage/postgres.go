@@ -11,6 +11,12 @@ import (
 // Postgres is a struct that holds a connection to a database
 type Postgres struct {
 	*pgxpool.Pool
+	// catalogRefresh holds the pending request of the catalog summary refresh, see UpdateData
+	catalogRefresh chan struct{}
+	// stockNotices holds the pending wake up of the stock notifier, see StockNoticeSignals
+	stockNotices chan struct{}
+	// supplierOrders holds the pending wake up of the supplier fulfiller, see SupplierOrderSignals
+	supplierOrders chan struct{}
 }
 
 // NewPostgres creates a connection to a PostgreSQL database using the pgx driver and pgxpool
@@ -26,7 +32,14 @@ func NewPostgres(ctx context.Context, cfg config.Config) (*Postgres, error) {
 	dsn := fmt.Sprintf("%s:%s@%s:%d/%s",
 		cfg.Postgres.User, cfg.Postgres.Password, cfg.Postgres.Ip, cfg.Postgres.Port, cfg.Postgres.Database)
 
-	pool, err := pgxpool.Connect(ctx, "postgres://"+dsn+"?sslmode=disable")
+	poolConfig, err := pgxpool.ParseConfig("postgres://" + dsn + "?sslmode=disable")
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.BeforeAcquire = auditBeforeAcquire
+	poolConfig.AfterRelease = auditAfterRelease
+
+	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -38,5 +51,6 @@ func NewPostgres(ctx context.Context, cfg config.Config) (*Postgres, error) {
 		return nil, fmt.Errorf("unexpected test query result: %d", testResult)
 	}
 
-	return &Postgres{pool}, nil
+	return &Postgres{Pool: pool, catalogRefresh: make(chan struct{}, 1), stockNotices: make(chan struct{}, 1),
+		supplierOrders: make(chan struct{}, 1)}, nil
 }
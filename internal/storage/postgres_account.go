@@ -2,7 +2,6 @@ package storage
 
 import (
 	"context"
-	"errors"
 	"strings"
 	"time"
 
@@ -66,7 +65,7 @@ func GetUserData(ctx context.Context, pdb *Postgres, nickname, email string) (st
 	email = strings.ToLower(email)
 
 	err := pdb.Pool.QueryRow(ctx,
-		"select user_account, nickname, email, password, salt_for_password from account.user where lower(nickname) = $1 or email = $2",
+		"select user_account, nickname, COALESCE(email, ''), COALESCE(password, ''), COALESCE(salt_for_password, '') from account.user where lower(nickname) = $1 or email = $2",
 		nickname, email).Scan(&userUuid, &scannedNickname, &scannedEmail, &password, &salt)
 
 	return userUuid, scannedNickname, scannedEmail, password, salt, err
@@ -84,20 +83,20 @@ func GetAdminData(ctx context.Context, pdb *Postgres, login string) (string, str
 	return adminUuid, scannedLogin, surname, name, patronymic, password, salt, err
 }
 
-func GetStateAccount(ctx context.Context, pdb *Postgres, uuid string) (string, string, error) {
-	var stateName, roleName string
+func GetUserPassword(ctx context.Context, pdb *Postgres, uuid string) (string, string, error) {
+	var password, salt string
 
 	err := pdb.Pool.QueryRow(ctx,
-		"select ast.state_name, ar.role_name from account.account aa left join account.role ar on aa.account_role = ar.role_no left join account.state ast on aa.account_state = ast.state_no where aa.account_id = $1",
-		uuid).Scan(&stateName, &roleName)
+		"SELECT COALESCE(password, ''), COALESCE(salt_for_password, '') FROM account.user WHERE user_account = $1",
+		uuid).Scan(&password, &salt)
 
-	return stateName, roleName, err
+	return password, salt, err
 }
 
-func UpdateLastAccountActivity(ctx context.Context, pdb *Postgres, uuid string) error {
+func UpdateUserNickname(ctx context.Context, pdb *Postgres, uuid, nickname string) error {
 	result, err := pdb.Pool.Exec(ctx,
-		"UPDATE account.account SET last_activity = CURRENT_TIMESTAMP where account.account_id = $1",
-		uuid)
+		"UPDATE account.user SET nickname = $1, modified_at = CURRENT_TIMESTAMP WHERE user_account = $2",
+		nickname, uuid)
 	if err != nil {
 		return err
 	} else if result.RowsAffected() < 1 {
@@ -107,60 +106,179 @@ func UpdateLastAccountActivity(ctx context.Context, pdb *Postgres, uuid string)
 	return err
 }
 
-func DeleteUser(ctx context.Context, pdb *Postgres, uuid string) error {
+func UpdateUserPassword(ctx context.Context, pdb *Postgres, uuid, base64PasswordHash, base64Salt string) error {
 	result, err := pdb.Pool.Exec(ctx,
-		"DELETE FROM account.user WHERE user_account = $1",
-		uuid)
+		"UPDATE account.user SET password = $1, salt_for_password = $2, modified_at = CURRENT_TIMESTAMP WHERE user_account = $3",
+		base64PasswordHash, base64Salt, uuid)
 	if err != nil {
 		return err
 	} else if result.RowsAffected() < 1 {
-		return FailedDelete
+		return FailedUpdate
 	}
 
 	return err
 }
 
-func GetDataForFreekassa(ctx context.Context, pdb *Postgres, orderId string) (string, string, string, string, string, string, string, error) {
-	var email, nickname, content, productName, variantName, serviceName, itemName string
-	var paid bool
+func UpdateUserEmail(ctx context.Context, pdb *Postgres, uuid, email string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		"UPDATE account.user SET email = $1, modified_at = CURRENT_TIMESTAMP WHERE user_account = $2",
+		strings.ToLower(email), uuid)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedUpdate
+	}
 
-	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
-		if err := tx.QueryRow(context.Background(),
-			"SELECT paid FROM product.order WHERE order_id = $1",
-			orderId).Scan(&paid); err != nil {
-			return err
-		}
+	return err
+}
 
-		if paid {
-			return errors.New("order has already been paid")
-		}
+func GetStateAccount(ctx context.Context, pdb *Postgres, uuid string) (string, string, error) {
+	var stateName, roleName string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"select ast.state_name, ar.role_name from account.account aa left join account.role ar on aa.account_role = ar.role_no left join account.state ast on aa.account_state = ast.state_no where aa.account_id = $1",
+		uuid).Scan(&stateName, &roleName)
 
-		result, err := tx.Exec(context.Background(),
-			"UPDATE product.order SET paid = true WHERE order_id = $1",
-			orderId)
+	return stateName, roleName, err
+}
+
+func UpdateLastAccountActivity(ctx context.Context, pdb *Postgres, uuid string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		"UPDATE account.account SET last_activity = CURRENT_TIMESTAMP where account.account_id = $1",
+		uuid)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return err
+}
+
+// DeleteUser sets the account to the deleted state and anonymises the user data.
+// Orders are kept for accounting.
+func DeleteUser(ctx context.Context, pdb *Postgres, uuid string) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx,
+			"UPDATE account.account SET account_state = (SELECT state_no FROM account.state WHERE state_name = $1), last_change_state = CURRENT_TIMESTAMP, modified_at = CURRENT_TIMESTAMP WHERE account_id = $2",
+			AccountStateDeleted, uuid)
 		if err != nil {
 			return err
 		} else if result.RowsAffected() < 1 {
 			return FailedUpdate
 		}
 
-		if err = tx.QueryRow(context.Background(),
-			"SELECT au.email, au.nickname, pc.data FROM account.user au JOIN product.order po ON au.user_account = po.order_account JOIN product.content pc ON pc.content_order = po.order_id WHERE po.order_id = $1",
-			orderId).Scan(&email, &nickname, &content); err != nil {
+		result, err = tx.Exec(ctx,
+			"UPDATE account.user SET email = NULL, nickname = 'deleted_' || replace(user_account::text, '-', ''), password = NULL, salt_for_password = NULL, modified_at = CURRENT_TIMESTAMP, commentary = 'deleted by the user' WHERE user_account = $1",
+			uuid)
+		if err != nil {
 			return err
+		} else if result.RowsAffected() < 1 {
+			return FailedDelete
 		}
 
-		if err = tx.QueryRow(context.Background(),
-			"SELECT pp.product_name, pv.variant_name, ps.service_name, pi.item_name FROM product.order po JOIN product.content pc ON po.order_id = pc.content_order JOIN product.variant pv ON pc.content_variant = pv.variant_id JOIN product.product pp ON pv.product_id = pp.product_id JOIN product.service ps ON pv.variant_service = ps.service_no JOIN product.item pi ON pv.variant_item = pi.item_no WHERE po.order_id = $1",
-			orderId).Scan(&productName, &variantName, &serviceName, &itemName); err != nil {
+		if _, err = tx.Exec(ctx,
+			"DELETE FROM account.google_user WHERE account_id = $1",
+			uuid); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(ctx,
+			"DELETE FROM account.telegram_user WHERE account_id = $1",
+			uuid); err != nil {
 			return err
 		}
 
 		return nil
 	})
+}
 
-	UpdateData(ctx, pdb)
-	return email, nickname, content, productName, variantName, serviceName, itemName, err
+// OrderMail is the data of the order e-mail, the content is empty while the order awaits it
+// and the Email is nil for the accounts without an e-mail (signed up with Telegram or anonymised)
+type OrderMail struct {
+	Email           *string
+	Nickname        string
+	Content         string
+	ProductName     string
+	VariantName     string
+	ServiceName     string
+	ItemName        string
+	Instruction     string
+	AwaitingContent bool
+	// OnDemand is set for the variants minted by the supplier
+	OnDemand  bool
+	ReleaseAt string
+}
+
+// PayOrder marks the order as paid, FailedUpdate is returned if the order does not exist or has already been paid.
+// The seller of the variant is credited with the sale. The paid pre-order takes the free content of the variant
+// if there is any, the fulfilled pre-orders are returned.
+func PayOrder(ctx context.Context, pdb *Postgres, orderId string) ([]string, error) {
+	var fulfilled []string
+	var awaitingContent bool
+
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var variantId string
+		err := tx.QueryRow(ctx,
+			"UPDATE product.order SET paid = true, paid_at = CURRENT_TIMESTAMP, modified_at = CURRENT_TIMESTAMP WHERE order_id = $1 AND NOT paid RETURNING order_variant, awaiting_content",
+			orderId).Scan(&variantId, &awaitingContent)
+		if err == pgx.ErrNoRows {
+			return FailedUpdate
+		} else if err != nil {
+			return err
+		}
+
+		if err = recordSellerSale(ctx, tx, orderId); err != nil {
+			return err
+		}
+		if awaitingContent {
+			fulfilled, err = fulfilPreorders(ctx, tx, variantId)
+		}
+
+		return err
+	})
+	if err == nil && awaitingContent {
+		requestSupplierOrders(pdb)
+	}
+
+	return fulfilled, err
+}
+
+// GetOrderMail returns the data of the order e-mail.
+// The activation instructions of all the ordered contents are joined, so the bundle gets the instructions of every component.
+func GetOrderMail(ctx context.Context, pdb *Postgres, orderId string) (OrderMail, error) {
+	var mail OrderMail
+	var releaseAt *time.Time
+
+	err := pdb.Pool.QueryRow(ctx,
+		`SELECT au.email, au.nickname, COALESCE(oc.data, ''), pp.product_name, pv.variant_name, ps.service_name, pi.item_name,
+			(SELECT COALESCE(string_agg(DISTINCT vi.instruction, E'\n\n'), '') FROM product.content pc JOIN product.variant_instruction vi ON vi.variant_id = pc.content_variant WHERE pc.content_order = po.order_id),
+			po.awaiting_content, pv.variant_supplier IS NOT NULL, pv.preorder_release_at
+		FROM product.order po
+			JOIN account.user au ON au.user_account = po.order_account
+			JOIN product.variant pv ON pv.variant_id = po.order_variant
+			JOIN product.product pp ON pp.product_id = pv.product_id
+			JOIN product.service ps ON ps.service_no = pv.variant_service
+			JOIN product.item pi ON pi.item_no = pv.variant_item
+			LEFT JOIN product.order_content oc ON oc.order_id = po.order_id
+		WHERE po.order_id = $1`,
+		orderId).Scan(
+		&mail.Email,
+		&mail.Nickname,
+		&mail.Content,
+		&mail.ProductName,
+		&mail.VariantName,
+		&mail.ServiceName,
+		&mail.ItemName,
+		&mail.Instruction,
+		&mail.AwaitingContent,
+		&mail.OnDemand,
+		&releaseAt,
+	)
+	if releaseAt != nil {
+		mail.ReleaseAt = releaseAt.Format(time.DateTime)
+	}
+
+	return mail, err
 }
 
 type OrderData struct {
@@ -171,14 +289,16 @@ type OrderData struct {
 	DataContent string  `json:"data_content"`
 	Price       float64 `json:"price"`
 	Paid        bool    `json:"paid"`
-	CreatedAt   string  `json:"created_at"`
+	// AwaitingContent is set for the pre-order until its content is uploaded
+	AwaitingContent bool   `json:"awaiting_content"`
+	CreatedAt       string `json:"created_at"`
 }
 
 func GetUserOrders(ctx context.Context, pdb *Postgres, accountId string) ([]OrderData, error) {
 	var orders []OrderData
 
-	rows, err := pdb.Pool.Query(context.Background(),
-		"SELECT order_id, product_name, variant_name, service_name, data, po.price, paid, po.created_at FROM product.order po JOIN product.content pc ON po.order_id = pc.content_order JOIN product.variant pv ON pc.content_variant = pv.variant_id JOIN product.product pp ON pv.product_id = pp.product_id JOIN product.service ps ON pv.variant_service = ps.service_no WHERE po.order_account = $1 ORDER BY po.created_at desc",
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT po.order_id, product_name, variant_name, service_name, COALESCE(oc.data, ''), po.price, paid, po.awaiting_content, po.created_at FROM product.order po LEFT JOIN product.order_content oc ON po.order_id = oc.order_id JOIN product.variant pv ON po.order_variant = pv.variant_id JOIN product.product pp ON pv.product_id = pp.product_id JOIN product.service ps ON pv.variant_service = ps.service_no WHERE po.order_account = $1 ORDER BY po.created_at desc",
 		accountId)
 	if err != nil {
 		return orders, err
@@ -197,6 +317,7 @@ func GetUserOrders(ctx context.Context, pdb *Postgres, accountId string) ([]Orde
 			&order.DataContent,
 			&order.Price,
 			&order.Paid,
+			&order.AwaitingContent,
 			&createdAt,
 		); err != nil {
 			return nil, err
@@ -226,3 +347,116 @@ func GetUserOrders(ctx context.Context, pdb *Postgres, accountId string) ([]Orde
 //func CreateCsrfToken(ctx context.Context, pdb *Postgres, csrfToken string) error {
 //	return nil
 //}
+
+type UserDumpProfile struct {
+	AccountId          string  `json:"account_id"`
+	Nickname           string  `json:"nickname"`
+	Email              *string `json:"email"`
+	Region             *string `json:"region"`
+	RegistrationMethod string  `json:"registration_method"`
+	State              string  `json:"state"`
+	Role               string  `json:"role"`
+	CreatedAt          string  `json:"created_at"`
+	ModifiedAt         string  `json:"modified_at"`
+}
+
+type UserDumpActivity struct {
+	LastActivity    string `json:"last_activity"`
+	LastChangeState string `json:"last_change_state"`
+}
+
+type UserDump struct {
+	GeneratedAt string           `json:"generated_at"`
+	Profile     UserDumpProfile  `json:"profile"`
+	OAuthLinks  []OAuthLink      `json:"oauth_links"`
+	Orders      []OrderData      `json:"orders"`
+	Wishlist    []WishlistItem   `json:"wishlist"`
+	Reviews     []UserReview     `json:"reviews"`
+	Activity    UserDumpActivity `json:"activity"`
+}
+
+// GetUserDump collects all the data stored about the user
+func GetUserDump(ctx context.Context, pdb *Postgres, uuid string) (UserDump, error) {
+	var dump UserDump
+	var createdAt, modifiedAt, lastActivity, lastChangeState time.Time
+
+	if err := pdb.Pool.QueryRow(ctx,
+		"SELECT aa.account_id, au.nickname, au.email, pr.region_name, arm.registration_method_name, ast.state_name, ar.role_name, aa.created_at, au.modified_at, aa.last_activity, aa.last_change_state FROM account.account aa JOIN account.user au ON au.user_account = aa.account_id JOIN account.registration_method arm ON aa.registration_method = arm.registration_method_no JOIN account.state ast ON aa.account_state = ast.state_no JOIN account.role ar ON aa.account_role = ar.role_no LEFT JOIN product.region pr ON au.user_region = pr.region_no WHERE aa.account_id = $1",
+		uuid).Scan(
+		&dump.Profile.AccountId,
+		&dump.Profile.Nickname,
+		&dump.Profile.Email,
+		&dump.Profile.Region,
+		&dump.Profile.RegistrationMethod,
+		&dump.Profile.State,
+		&dump.Profile.Role,
+		&createdAt,
+		&modifiedAt,
+		&lastActivity,
+		&lastChangeState,
+	); err != nil {
+		return dump, err
+	}
+	dump.Profile.CreatedAt = createdAt.Format(time.DateTime)
+	dump.Profile.ModifiedAt = modifiedAt.Format(time.DateTime)
+	dump.Activity.LastActivity = lastActivity.Format(time.DateTime)
+	dump.Activity.LastChangeState = lastChangeState.Format(time.DateTime)
+
+	links, err := GetOAuthLinks(ctx, pdb, uuid)
+	if err != nil {
+		return dump, err
+	}
+	dump.OAuthLinks = links
+
+	orders, err := GetUserOrders(ctx, pdb, uuid)
+	if err != nil {
+		return dump, err
+	}
+	if orders == nil {
+		orders = []OrderData{}
+	}
+	dump.Orders = orders
+
+	if dump.Wishlist, err = GetWishlist(ctx, pdb, uuid); err != nil {
+		return dump, err
+	}
+
+	if dump.Reviews, err = GetUserReviews(ctx, pdb, uuid); err != nil {
+		return dump, err
+	}
+
+	dump.GeneratedAt = time.Now().UTC().Format(time.DateTime)
+	return dump, nil
+}
+
+// GetProfileImageKey returns the blob key of the profile image, the key is empty if the user has no image
+func GetProfileImageKey(ctx context.Context, pdb *Postgres, uuid string) (string, error) {
+	var key string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT COALESCE(profile_image, '') FROM account.user WHERE user_account = $1",
+		uuid).Scan(&key)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+
+	return key, err
+}
+
+// SetProfileImageKey replaces the blob key of the profile image and returns the old one, the empty key removes the image.
+// FailedUpdate is returned if the account has no user profile.
+func SetProfileImageKey(ctx context.Context, pdb *Postgres, uuid, key string) (string, error) {
+	var oldKey string
+
+	err := pdb.Pool.QueryRow(ctx,
+		`UPDATE account.user au SET profile_image = NULLIF($2, ''), modified_at = CURRENT_TIMESTAMP
+		FROM (SELECT user_account, profile_image FROM account.user WHERE user_account = $1 FOR UPDATE) old
+		WHERE au.user_account = old.user_account
+		RETURNING COALESCE(old.profile_image, '')`,
+		uuid, key).Scan(&oldKey)
+	if err == pgx.ErrNoRows {
+		return "", FailedUpdate
+	}
+
+	return oldKey, err
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type AdminUser struct {
+	AccountId          string  `json:"account_id"`
+	Nickname           string  `json:"nickname"`
+	Email              *string `json:"email"`
+	State              string  `json:"state"`
+	RegistrationMethod string  `json:"registration_method"`
+	HasPassword        bool    `json:"has_password"`
+	LastActivity       string  `json:"last_activity"`
+	LastChangeState    string  `json:"last_change_state"`
+	CreatedAt          string  `json:"created_at"`
+	Commentary         *string `json:"commentary"`
+}
+
+const adminUserSelect = "SELECT aa.account_id, au.nickname, au.email, ast.state_name, arm.registration_method_name, au.password IS NOT NULL, aa.last_activity, aa.last_change_state, aa.created_at, aa.commentary"
+
+const adminUserFrom = " FROM account.account aa JOIN account.user au ON au.user_account = aa.account_id JOIN account.state ast ON aa.account_state = ast.state_no JOIN account.registration_method arm ON aa.registration_method = arm.registration_method_no JOIN account.role ar ON aa.account_role = ar.role_no"
+
+type adminUserScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAdminUser(row adminUserScanner, extra ...interface{}) (AdminUser, error) {
+	var user AdminUser
+	var lastActivity, lastChangeState, createdAt time.Time
+
+	dest := append([]interface{}{
+		&user.AccountId,
+		&user.Nickname,
+		&user.Email,
+		&user.State,
+		&user.RegistrationMethod,
+		&user.HasPassword,
+		&lastActivity,
+		&lastChangeState,
+		&createdAt,
+		&user.Commentary,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return user, err
+	}
+	user.LastActivity = lastActivity.Format(time.DateTime)
+	user.LastChangeState = lastChangeState.Format(time.DateTime)
+	user.CreatedAt = createdAt.Format(time.DateTime)
+
+	return user, nil
+}
+
+// GetAdminUsers returns a page of the users and the total number of the users matching the search text and the state.
+// The search text is matched as a plain substring, so % and _ are not wildcards.
+func GetAdminUsers(ctx context.Context, pdb *Postgres, searchText, state string, limit, offset int) ([]AdminUser, int, error) {
+	users := []AdminUser{}
+	var total int
+
+	rows, err := pdb.Pool.Query(ctx,
+		adminUserSelect+", count(*) OVER()"+adminUserFrom+" WHERE ar.role_name = ANY($1) AND ($2 = '' OR strpos(lower(au.nickname), $2) > 0 OR strpos(lower(au.email), $2) > 0 OR aa.account_id::text = $2) AND ($3 = '' OR ast.state_name = $3) ORDER BY aa.created_at DESC, aa.account_id LIMIT $4 OFFSET $5",
+		CustomerRoles, strings.ToLower(strings.TrimSpace(searchText)), state, limit, offset)
+	if err != nil {
+		return users, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanAdminUser(rows, &total)
+		if err != nil {
+			return users, total, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return users, total, err
+	}
+
+	return users, total, nil
+}
+
+func GetAdminUser(ctx context.Context, pdb *Postgres, uuid string) (AdminUser, error) {
+	return scanAdminUser(pdb.Pool.QueryRow(ctx,
+		adminUserSelect+adminUserFrom+" WHERE ar.role_name = ANY($1) AND aa.account_id = $2",
+		CustomerRoles, uuid))
+}
+
+// UpdateUserAccountState changes the state of the user account and stores the reason in the commentary.
+// Deleted accounts are not changed.
+func UpdateUserAccountState(ctx context.Context, pdb *Postgres, uuid, state, commentary string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		"UPDATE account.account SET account_state = (SELECT state_no FROM account.state WHERE state_name = $1), last_change_state = CURRENT_TIMESTAMP, modified_at = CURRENT_TIMESTAMP, commentary = NULLIF($2, '') WHERE account_id = $3 AND account_role IN (SELECT role_no FROM account.role WHERE role_name = ANY($4)) AND account_state <> (SELECT state_no FROM account.state WHERE state_name = $5)",
+		state, commentary, uuid, CustomerRoles, AccountStateDeleted)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return nil
+}
+
+func DeleteUserPassword(ctx context.Context, pdb *Postgres, uuid string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		"UPDATE account.user SET password = NULL, salt_for_password = NULL, modified_at = CURRENT_TIMESTAMP WHERE user_account = $1",
+		uuid)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return nil
+}
+
+type Impersonation struct {
+	ImpersonationId string `json:"impersonation_id"`
+	EmployeeAccount string `json:"employee_account"`
+	EmployeeLogin   string `json:"employee_login"`
+	UserAccount     string `json:"user_account"`
+	Reason          string `json:"reason"`
+	Ip              string `json:"ip"`
+	ExpiresAt       string `json:"expires_at"`
+	CreatedAt       string `json:"created_at"`
+}
+
+func CreateImpersonation(ctx context.Context, pdb *Postgres, employeeUuid, userUuid, reason, ip string, expiresAt time.Time) (string, error) {
+	var impersonationId string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"INSERT INTO account.impersonation(employee_account, user_account, reason, ip, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING impersonation_id",
+		employeeUuid, userUuid, reason, ip, expiresAt.UTC()).Scan(&impersonationId)
+
+	return impersonationId, err
+}
+
+// GetImpersonations returns the impersonation audit trail, optionally filtered by the user account
+func GetImpersonations(ctx context.Context, pdb *Postgres, userUuid string) ([]Impersonation, error) {
+	impersonations := []Impersonation{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT ai.impersonation_id, ai.employee_account, COALESCE(ae.login, ''), ai.user_account, ai.reason, ai.ip, ai.expires_at, ai.created_at FROM account.impersonation ai LEFT JOIN account.employee ae ON ae.account_id = ai.employee_account WHERE $1 = '' OR ai.user_account::text = $1 ORDER BY ai.created_at DESC",
+		userUuid)
+	if err != nil {
+		return impersonations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var impersonation Impersonation
+		var expiresAt, createdAt time.Time
+
+		if err = rows.Scan(
+			&impersonation.ImpersonationId,
+			&impersonation.EmployeeAccount,
+			&impersonation.EmployeeLogin,
+			&impersonation.UserAccount,
+			&impersonation.Reason,
+			&impersonation.Ip,
+			&expiresAt,
+			&createdAt,
+		); err != nil {
+			return impersonations, err
+		}
+		impersonation.ExpiresAt = expiresAt.Format(time.DateTime)
+		impersonation.CreatedAt = createdAt.Format(time.DateTime)
+
+		impersonations = append(impersonations, impersonation)
+	}
+	if err = rows.Err(); err != nil {
+		return impersonations, err
+	}
+
+	return impersonations, nil
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type auditActionContextKey struct{}
+
+// ContextWithAuditAction binds the audit action to the context.
+// The row changes made by the queries with this context are linked with the action by the audit triggers.
+func ContextWithAuditAction(ctx context.Context, actionId string) context.Context {
+	return context.WithValue(ctx, auditActionContextKey{}, actionId)
+}
+
+func auditActionFromContext(ctx context.Context) string {
+	actionId, _ := ctx.Value(auditActionContextKey{}).(string)
+	return actionId
+}
+
+// auditConnections holds the pool connections with the audit action set for the session
+var auditConnections sync.Map
+
+// auditBeforeAcquire sets the audit action of the context for the session of the acquired connection
+func auditBeforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	actionId := auditActionFromContext(ctx)
+	if actionId == "" {
+		return true
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT set_config('app.audit_action', $1, false)", actionId); err != nil {
+		return false
+	}
+	auditConnections.Store(conn, struct{}{})
+
+	return true
+}
+
+// auditAfterRelease clears the audit action so it does not leak to the next request using the connection
+func auditAfterRelease(conn *pgx.Conn) bool {
+	if _, ok := auditConnections.LoadAndDelete(conn); !ok {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := conn.Exec(ctx, "SELECT set_config('app.audit_action', '', false)")
+
+	return err == nil
+}
+
+func CreateAuditAction(ctx context.Context, pdb *Postgres, actorUuid, method, route, query, ip string) (string, error) {
+	var actionId string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"INSERT INTO audit.admin_action(actor_account, method, route, query, ip) VALUES ($1, $2, $3, $4, $5) RETURNING action_id",
+		actorUuid, method, route, query, ip).Scan(&actionId)
+
+	return actionId, err
+}
+
+func UpdateAuditActionStatus(ctx context.Context, pdb *Postgres, actionId string, statusCode int) error {
+	result, err := pdb.Pool.Exec(ctx,
+		"UPDATE audit.admin_action SET status_code = $1 WHERE action_id = $2",
+		statusCode, actionId)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return nil
+}
+
+type AuditChange struct {
+	Table     string          `json:"table"`
+	Operation string          `json:"operation"`
+	EntityId  *string         `json:"entity_id"`
+	Diff      json.RawMessage `json:"diff"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+}
+
+type AuditAction struct {
+	ActionId   string        `json:"action_id"`
+	ActorId    string        `json:"actor_id"`
+	ActorLogin *string       `json:"actor_login"`
+	Method     string        `json:"method"`
+	Route      string        `json:"route"`
+	Query      string        `json:"query"`
+	Ip         string        `json:"ip"`
+	StatusCode *int          `json:"status_code"`
+	CreatedAt  string        `json:"created_at"`
+	Changes    []AuditChange `json:"changes"`
+}
+
+// AuditFilter contains the optional filters of the audit log. Empty values are ignored.
+type AuditFilter struct {
+	ActorId  string
+	Route    string
+	Table    string
+	EntityId string
+	From     *time.Time
+	To       *time.Time
+}
+
+// GetAuditActions returns a page of the admin actions with their row changes and the total number of the matching actions
+func GetAuditActions(ctx context.Context, pdb *Postgres, filter AuditFilter, limit, offset int) ([]AuditAction, int, error) {
+	actions := []AuditAction{}
+	var total int
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT aa.action_id, aa.actor_account, ae.login, aa.method, aa.route, aa.query, aa.ip, aa.status_code, aa.created_at,
+			COALESCE((SELECT json_agg(json_build_object('table', rc.table_name, 'operation', rc.operation, 'entity_id', rc.entity_id, 'diff', rc.diff, 'before', rc.before, 'after', rc.after) ORDER BY rc.change_no) FROM audit.row_change rc WHERE rc.action_id = aa.action_id), '[]')::text,
+			count(*) OVER()
+		FROM audit.admin_action aa
+		LEFT JOIN account.employee ae ON ae.account_id = aa.actor_account
+		WHERE ($1 = '' OR aa.actor_account::text = $1)
+			AND ($2 = '' OR aa.route LIKE $2 || '%')
+			AND (($3 = '' AND $4 = '') OR EXISTS(SELECT 1 FROM audit.row_change rc WHERE rc.action_id = aa.action_id AND ($3 = '' OR rc.table_name = $3) AND ($4 = '' OR rc.entity_id = $4)))
+			AND ($5::timestamp IS NULL OR aa.created_at >= $5)
+			AND ($6::timestamp IS NULL OR aa.created_at < $6)
+		ORDER BY aa.created_at DESC, aa.action_id
+		LIMIT $7 OFFSET $8`,
+		filter.ActorId, filter.Route, filter.Table, filter.EntityId, filter.From, filter.To, limit, offset)
+	if err != nil {
+		return actions, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action AuditAction
+		var createdAt time.Time
+		var changes string
+
+		if err = rows.Scan(
+			&action.ActionId,
+			&action.ActorId,
+			&action.ActorLogin,
+			&action.Method,
+			&action.Route,
+			&action.Query,
+			&action.Ip,
+			&action.StatusCode,
+			&createdAt,
+			&changes,
+			&total,
+		); err != nil {
+			return actions, total, err
+		}
+		action.CreatedAt = createdAt.Format(time.DateTime)
+
+		if err = json.Unmarshal([]byte(changes), &action.Changes); err != nil {
+			return actions, total, err
+		}
+
+		actions = append(actions, action)
+	}
+	if err = rows.Err(); err != nil {
+		return actions, total, err
+	}
+
+	return actions, total, nil
+}
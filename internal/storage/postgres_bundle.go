@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type BundleComponent struct {
+	VariantId       string `json:"variant_id"`
+	ProductName     string `json:"product_name"`
+	VariantName     string `json:"variant_name"`
+	Service         string `json:"service_name"`
+	State           string `json:"state_name"`
+	QuantityCurrent int    `json:"quantity_current"`
+}
+
+// GetBundleComponents returns the components of the bundle, the list is empty for the other variants
+func GetBundleComponents(ctx context.Context, pdb *Postgres, bundleId string) ([]BundleComponent, error) {
+	components := []BundleComponent{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT pv.variant_id, pp.product_name, pv.variant_name, ps.service_name, pst.state_name, pv.quantity_current
+		FROM product.bundle_component bc
+			JOIN product.variant pv ON pv.variant_id = bc.component_variant_id
+			JOIN product.product pp ON pp.product_id = pv.product_id
+			JOIN product.service ps ON ps.service_no = pv.variant_service
+			JOIN product.state pst ON pst.state_no = pv.variant_state
+		WHERE bc.bundle_variant_id = $1
+		ORDER BY pp.product_name, pv.variant_name`,
+		bundleId)
+	if err != nil {
+		return components, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var component BundleComponent
+		if err = rows.Scan(
+			&component.VariantId,
+			&component.ProductName,
+			&component.VariantName,
+			&component.Service,
+			&component.State,
+			&component.QuantityCurrent,
+		); err != nil {
+			return components, err
+		}
+		components = append(components, component)
+	}
+	if err = rows.Err(); err != nil {
+		return components, err
+	}
+
+	return components, nil
+}
+
+// UpdateBundleComponents replaces the components of the bundle, the empty list turns the bundle into a regular variant.
+// NoResults is returned if the bundle does not exist, BundleContent if it has its own content, is sold as a pre-order or by a supplier,
+// InvalidBundleComponent if a component does not exist or is a bundle itself, SellerBundle if the bundle or a component belongs to a seller
+// and FailedUpdate if the bundle is a component of another one.
+func UpdateBundleComponents(ctx context.Context, pdb *Postgres, bundleId string, componentIds []string) error {
+	unique := make([]string, 0, len(componentIds))
+	seen := make(map[string]bool)
+	for _, id := range componentIds {
+		id = strings.ToLower(id)
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var hasContent, isComponent, isSeller bool
+		err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM product.content WHERE content_variant = pv.variant_id) OR pv.preorder_release_at IS NOT NULL OR pv.variant_supplier IS NOT NULL,
+				EXISTS (SELECT 1 FROM product.bundle_component WHERE component_variant_id = pv.variant_id),
+				EXISTS (SELECT 1 FROM account.seller WHERE seller_account = pv.variant_account)
+			FROM product.variant pv WHERE pv.variant_id = $1 FOR UPDATE`,
+			bundleId).Scan(&hasContent, &isComponent, &isSeller)
+		if err == pgx.ErrNoRows {
+			return NoResults
+		} else if err != nil {
+			return err
+		}
+		if len(unique) > 0 && hasContent {
+			return BundleContent
+		} else if len(unique) > 0 && isComponent {
+			return FailedUpdate
+		} else if len(unique) > 0 && isSeller {
+			return SellerBundle
+		}
+
+		// The components are locked, so they can not be given to a seller while the bundle is updated
+		var hasSellerComponent bool
+		if err = tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM (SELECT variant_account FROM product.variant WHERE variant_id = ANY ($1::uuid[]) FOR UPDATE) pv
+				JOIN account.seller s ON s.seller_account = pv.variant_account)`,
+			unique).Scan(&hasSellerComponent); err != nil {
+			return err
+		} else if hasSellerComponent {
+			return SellerBundle
+		}
+
+		if _, err = tx.Exec(ctx, "DELETE FROM product.bundle_component WHERE bundle_variant_id = $1", bundleId); err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(ctx,
+			`INSERT INTO product.bundle_component(bundle_variant_id, component_variant_id)
+			SELECT $1, pv.variant_id FROM product.variant pv
+			WHERE pv.variant_id = ANY ($2::uuid[]) AND pv.variant_id <> $1
+				AND NOT EXISTS (SELECT 1 FROM product.bundle_component bc WHERE bc.bundle_variant_id = pv.variant_id)`,
+			bundleId, unique)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() != int64(len(unique)) {
+			return InvalidBundleComponent
+		}
+
+		return nil
+	})
+}
+
+// IsBundleComponent reports whether the variant is a component of a bundle
+func IsBundleComponent(ctx context.Context, pdb *Postgres, variantId string) (bool, error) {
+	var exists bool
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM product.bundle_component WHERE component_variant_id = $1)",
+		variantId).Scan(&exists)
+
+	return exists, err
+}
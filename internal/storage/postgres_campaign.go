@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// CampaignTargets are the variants, the products, the services and the types the campaign discount applies to
+type CampaignTargets struct {
+	VariantIds []string `json:"variant_ids"`
+	ProductIds []string `json:"product_ids"`
+	Services   []string `json:"services"`
+	Types      []string `json:"types"`
+}
+
+// normalize lowercases the targets and removes the duplicates, so they can be counted after the insert
+func (t CampaignTargets) normalize() CampaignTargets {
+	unique := func(values []string) []string {
+		result := make([]string, 0, len(values))
+		seen := make(map[string]bool)
+		for _, value := range values {
+			value = strings.ToLower(value)
+			if !seen[value] {
+				seen[value] = true
+				result = append(result, value)
+			}
+		}
+		return result
+	}
+
+	return CampaignTargets{
+		VariantIds: unique(t.VariantIds),
+		ProductIds: unique(t.ProductIds),
+		Services:   unique(t.Services),
+		Types:      unique(t.Types),
+	}
+}
+
+func (t CampaignTargets) Count() int {
+	return len(t.VariantIds) + len(t.ProductIds) + len(t.Services) + len(t.Types)
+}
+
+type Campaign struct {
+	CampaignId      string          `json:"campaign_id"`
+	CampaignName    string          `json:"campaign_name"`
+	StartsAt        string          `json:"starts_at"`
+	EndsAt          string          `json:"ends_at"`
+	Priority        int             `json:"priority"`
+	DiscountMoney   float64         `json:"discount_money"`
+	DiscountPercent int             `json:"discount_percent"`
+	State           string          `json:"state"`
+	Targets         CampaignTargets `json:"targets"`
+	CreatedAt       string          `json:"created_at"`
+	Commentary      *string         `json:"commentary"`
+}
+
+// CampaignData are the fields of a new campaign, the times are in the time.DateTime format
+type CampaignData struct {
+	CampaignName    string
+	StartsAt        string
+	EndsAt          string
+	Priority        int
+	DiscountMoney   float64
+	DiscountPercent int
+}
+
+func GetCampaigns(ctx context.Context, pdb *Postgres) ([]Campaign, error) {
+	campaigns := []Campaign{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT pc.campaign_id, pc.campaign_name, pc.starts_at, pc.ends_at, pc.priority, pc.discount_money::float8, pc.discount_percent,
+			CASE WHEN pc.starts_at > LOCALTIMESTAMP THEN $1 WHEN pc.ends_at <= LOCALTIMESTAMP THEN $3 ELSE $2 END,
+			COALESCE(array_agg(ct.variant_id::text) FILTER (WHERE ct.variant_id IS NOT NULL), '{}'),
+			COALESCE(array_agg(ct.product_id::text) FILTER (WHERE ct.product_id IS NOT NULL), '{}'),
+			COALESCE(array_agg(ps.service_name) FILTER (WHERE ps.service_name IS NOT NULL), '{}'),
+			COALESCE(array_agg(pt.type_name) FILTER (WHERE pt.type_name IS NOT NULL), '{}'),
+			pc.created_at, pc.commentary
+		FROM product.campaign pc
+			LEFT JOIN product.campaign_target ct ON ct.campaign_id = pc.campaign_id
+			LEFT JOIN product.service ps ON ps.service_no = ct.service_no
+			LEFT JOIN product.type pt ON pt.type_no = ct.type_no
+		GROUP BY pc.campaign_id
+		ORDER BY pc.ends_at <= LOCALTIMESTAMP, pc.starts_at DESC`,
+		CampaignStateScheduled, CampaignStateRunning, CampaignStateEnded)
+	if err != nil {
+		return campaigns, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var campaign Campaign
+		var startsAt, endsAt, createdAt time.Time
+
+		if err = rows.Scan(
+			&campaign.CampaignId,
+			&campaign.CampaignName,
+			&startsAt,
+			&endsAt,
+			&campaign.Priority,
+			&campaign.DiscountMoney,
+			&campaign.DiscountPercent,
+			&campaign.State,
+			&campaign.Targets.VariantIds,
+			&campaign.Targets.ProductIds,
+			&campaign.Targets.Services,
+			&campaign.Targets.Types,
+			&createdAt,
+			&campaign.Commentary,
+		); err != nil {
+			return campaigns, err
+		}
+		campaign.StartsAt = startsAt.Format(time.DateTime)
+		campaign.EndsAt = endsAt.Format(time.DateTime)
+		campaign.CreatedAt = createdAt.Format(time.DateTime)
+
+		campaigns = append(campaigns, campaign)
+	}
+	if err = rows.Err(); err != nil {
+		return campaigns, err
+	}
+
+	return campaigns, nil
+}
+
+func CreateCampaign(ctx context.Context, pdb *Postgres, accountId string, data CampaignData, targets CampaignTargets) (string, error) {
+	var campaignId string
+
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx,
+			"INSERT INTO product.campaign(campaign_name, starts_at, ends_at, priority, discount_money, discount_percent, campaign_account) VALUES ($1, $2::timestamp, $3::timestamp, $4, $5, $6, $7) RETURNING campaign_id",
+			data.CampaignName, data.StartsAt, data.EndsAt, data.Priority, data.DiscountMoney, data.DiscountPercent, accountId).Scan(&campaignId); err != nil {
+			return err
+		}
+
+		return createCampaignTargets(ctx, tx, campaignId, targets)
+	})
+
+	return campaignId, err
+}
+
+// createCampaignTargets inserts the targets of the campaign, UnknownCampaignTarget is returned if any of them does not exist
+func createCampaignTargets(ctx context.Context, tx pgx.Tx, campaignId string, targets CampaignTargets) error {
+	targets = targets.normalize()
+
+	res, err := tx.Exec(ctx,
+		"INSERT INTO product.campaign_target(campaign_id, variant_id) SELECT $1, variant_id FROM product.variant WHERE variant_id = ANY ($2::uuid[])",
+		campaignId, targets.VariantIds)
+	if err != nil {
+		return err
+	}
+	inserted := res.RowsAffected()
+
+	res, err = tx.Exec(ctx,
+		"INSERT INTO product.campaign_target(campaign_id, product_id) SELECT $1, product_id FROM product.product WHERE product_id = ANY ($2::uuid[])",
+		campaignId, targets.ProductIds)
+	if err != nil {
+		return err
+	}
+	inserted += res.RowsAffected()
+
+	res, err = tx.Exec(ctx,
+		"INSERT INTO product.campaign_target(campaign_id, service_no) SELECT $1, service_no FROM product.service WHERE lower(service_name) = ANY ($2)",
+		campaignId, targets.Services)
+	if err != nil {
+		return err
+	}
+	inserted += res.RowsAffected()
+
+	res, err = tx.Exec(ctx,
+		"INSERT INTO product.campaign_target(campaign_id, type_no) SELECT $1, type_no FROM product.type WHERE lower(type_name) = ANY ($2)",
+		campaignId, targets.Types)
+	if err != nil {
+		return err
+	}
+	inserted += res.RowsAffected()
+
+	if inserted != int64(targets.Count()) {
+		return UnknownCampaignTarget
+	}
+
+	return nil
+}
+
+// UpdateCampaign updates the non-nil fields of the campaign, the targets are replaced if they are given.
+// Setting one kind of the discount resets the other one.
+func UpdateCampaign(ctx context.Context, pdb *Postgres, campaignId string, campaignName, startsAt, endsAt *string, priority *int, discountMoney *float64, discountPercent *int, targets *CampaignTargets) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx,
+			`UPDATE product.campaign SET
+				campaign_name = COALESCE($2, campaign_name),
+				starts_at = COALESCE($3::timestamp, starts_at),
+				ends_at = COALESCE($4::timestamp, ends_at),
+				priority = COALESCE($5, priority),
+				discount_money = CASE WHEN $6::numeric IS NULL AND $7::smallint IS NULL THEN discount_money ELSE COALESCE($6, 0) END,
+				discount_percent = CASE WHEN $6::numeric IS NULL AND $7::smallint IS NULL THEN discount_percent ELSE COALESCE($7, 0) END,
+				modified_at = CURRENT_TIMESTAMP
+			WHERE campaign_id = $1`,
+			campaignId, campaignName, startsAt, endsAt, priority, discountMoney, discountPercent)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedUpdate
+		}
+
+		if targets == nil {
+			return nil
+		}
+
+		if _, err = tx.Exec(ctx, "DELETE FROM product.campaign_target WHERE campaign_id = $1", campaignId); err != nil {
+			return err
+		}
+
+		return createCampaignTargets(ctx, tx, campaignId, *targets)
+	})
+}
+
+func DeleteCampaign(ctx context.Context, pdb *Postgres, campaignId string) error {
+	res, err := pdb.Pool.Exec(ctx,
+		"DELETE FROM product.campaign WHERE campaign_id = $1",
+		campaignId)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() < 1 {
+		return FailedDelete
+	}
+
+	return nil
+}
+
+// GetNextCampaignChange returns the time until the nearest start or end of a campaign, the prices change at that moment.
+// NoResults is returned if there are no such campaigns.
+func GetNextCampaignChange(ctx context.Context, pdb *Postgres) (time.Duration, error) {
+	var seconds *float64
+
+	if err := pdb.Pool.QueryRow(ctx,
+		`SELECT EXTRACT(EPOCH FROM min(change_at) - LOCALTIMESTAMP)::float8 FROM (
+			SELECT starts_at AS change_at FROM product.campaign WHERE starts_at > LOCALTIMESTAMP
+			UNION ALL
+			SELECT ends_at FROM product.campaign WHERE ends_at > LOCALTIMESTAMP
+		) changes`).Scan(&seconds); err != nil {
+		return 0, err
+	} else if seconds == nil {
+		return 0, NoResults
+	}
+
+	return time.Duration(*seconds * float64(time.Second)), nil
+}
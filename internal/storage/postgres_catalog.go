@@ -0,0 +1,487 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	tl "test-server-go/internal/tools"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// MainpageFilter contains the storefront search, filters, sorting and pagination. Empty values are ignored.
+// The region keeps the variants activated in it, they are the variants of this region and the global ones.
+type MainpageFilter struct {
+	VariantId    string
+	ProductSlug  string
+	SearchText   string
+	Types        []string
+	Subtypes     []string
+	Services     []string
+	Platforms    []string
+	Region       string
+	MinPrice     *float64
+	MaxPrice     *float64
+	DiscountOnly bool
+	InStockOnly  bool
+	SortBy       string
+	SortType     string
+	Limit        int
+	Offset       int
+}
+
+// CacheKey returns the key of the filter for the response cache, the equivalent filters get the same key
+func (f MainpageFilter) CacheKey() string {
+	normalize := func(values []string) []string {
+		result := append([]string{}, values...)
+		sort.Strings(result)
+		return slices.Compact(result)
+	}
+
+	f.VariantId = strings.ToLower(f.VariantId)
+	f.SearchText = strings.TrimSpace(f.SearchText)
+	f.Types = normalize(f.Types)
+	f.Subtypes = normalize(f.Subtypes)
+	f.Services = normalize(f.Services)
+	f.Platforms = normalize(f.Platforms)
+	f.Region = strings.ToLower(f.Region)
+	f.SortBy = strings.ToLower(f.SortBy)
+	f.SortType = strings.ToLower(f.SortType)
+
+	content, _ := json.Marshal(f)
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Facet dimensions of the storefront filters
+const (
+	facetType     = "type"
+	facetSubtype  = "subtype"
+	facetService  = "service"
+	facetPlatform = "platform"
+	facetRegion   = "region"
+)
+
+// mainpageSortKeys maps the sort options to the product level sort expressions and their default directions
+var mainpageSortKeys = map[string]struct {
+	expression string
+	desc       bool
+}{
+	"product_name":     {"min(product_name)", false},
+	"type_name":        {"min(type_name)", false},
+	"subtype_name":     {"min(subtype_name)", false},
+	"variant_name":     {"min(variant_name)", false},
+	"price":            {"min(final_price)", false},
+	"final_price":      {"min(final_price)", false},
+	"discount_money":   {"max(discount_money)", true},
+	"discount_percent": {"max(discount_percent)", true},
+	"popularity":       {"sum(quantity_sold)", true},
+	"rating":           {"COALESCE(max(rating), 0)", true},
+	"relevance":        {"max(search_rank)", true},
+}
+
+// mainpageSearchCte matches the full-text query in all the configs and the trigram similarity for typos
+const mainpageSearchCte = "search AS (SELECT websearch_to_tsquery('simple', $1) || websearch_to_tsquery('russian', $1) || websearch_to_tsquery('english', $1) AS query, lower($1) AS text)"
+
+// mainpageArgs builds the positional arguments of the storefront queries
+type mainpageArgs []interface{}
+
+func (a *mainpageArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// matchedCte builds the CTE with the visible variants matching the search and the filters.
+// The filter of the excluded facet dimension is not applied to count the other values of this dimension.
+func (f MainpageFilter) matchedCte(args *mainpageArgs, excludedFacet string) string {
+	query := "matched AS (SELECT pvs.*, CASE WHEN search.text = '' THEN 0 ELSE ts_rank_cd(search_vector, search.query) + word_similarity(search.text, search_text) END AS search_rank " +
+		"FROM product.product_variants_live pvs, search " +
+		"WHERE state_name <> ALL (" + args.add([]string{ProductStateInvisible, ProductStateDeleted}) + ") " +
+		"AND (search.text = '' OR search_vector @@ search.query OR search.text <% search_text OR strpos(search_text, search.text) > 0)"
+
+	if f.VariantId != "" {
+		query += " AND variant_id = " + args.add(strings.ToLower(f.VariantId)) + "::uuid"
+	}
+	if f.ProductSlug != "" {
+		query += " AND product_slug = " + args.add(f.ProductSlug)
+	}
+	if len(f.Types) > 0 && excludedFacet != facetType {
+		query += " AND type_name = ANY (" + args.add(f.Types) + ")"
+	}
+	if len(f.Subtypes) > 0 && excludedFacet != facetSubtype {
+		query += " AND subtype_name = ANY (" + args.add(f.Subtypes) + ")"
+	}
+	if len(f.Services) > 0 && excludedFacet != facetService {
+		query += " AND service_name = ANY (" + args.add(f.Services) + ")"
+	}
+	if len(f.Platforms) > 0 && excludedFacet != facetPlatform {
+		query += " AND platform_name = ANY (" + args.add(f.Platforms) + ")"
+	}
+	if f.Region != "" && excludedFacet != facetRegion {
+		query += " AND region_name IN (" + args.add(RegionGlobal) + ", lower(" + args.add(f.Region) + "))"
+	}
+	if f.MinPrice != nil || f.MaxPrice != nil {
+		// The price of these variants is hidden
+		query += " AND state_name <> " + args.add(ProductStateUnavailableWithoutPrice)
+	}
+	if f.MinPrice != nil {
+		query += " AND final_price >= " + args.add(*f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		query += " AND final_price <= " + args.add(*f.MaxPrice)
+	}
+	if f.DiscountOnly {
+		query += " AND (discount_money > 0 OR discount_percent > 0)"
+	}
+	if f.InStockOnly {
+		query += " AND (quantity_current > 0 OR on_demand) AND state_name = " + args.add(ProductStateActive)
+	}
+
+	return query + ")"
+}
+
+// orderBy returns the product level sort expression and direction
+func (f MainpageFilter) orderBy() (string, string) {
+	sortBy := strings.ToLower(f.SortBy)
+	if sortBy == "" {
+		sortBy = "product_name"
+		if f.SearchText != "" {
+			sortBy = "relevance"
+		}
+	}
+	key, ok := mainpageSortKeys[sortBy]
+	if !ok {
+		key = mainpageSortKeys["product_name"]
+	}
+
+	direction := " ASC"
+	if key.desc {
+		direction = " DESC"
+	}
+	switch strings.ToLower(f.SortType) {
+	case "asc":
+		direction = " ASC"
+	case "desc":
+		direction = " DESC"
+	}
+
+	return key.expression, direction
+}
+
+// GetProductsForMainpage returns a page of the products matching the filter and the total number of the matching products.
+// If nothing is found, the search is repeated with the text converted to the other keyboard layout.
+func GetProductsForMainpage(ctx context.Context, pdb *Postgres, apiUrl string, filter MainpageFilter) ([]Product, int, error) {
+	filter.SearchText = strings.TrimSpace(filter.SearchText)
+
+	products, total, err := getProductsForMainpage(ctx, pdb, apiUrl, filter)
+	if err != nil || total > 0 || filter.SearchText == "" {
+		return products, total, err
+	}
+
+	switchedText := tl.SwitchKeyboardLayout(filter.SearchText)
+	if switchedText == strings.ToLower(filter.SearchText) {
+		return products, total, nil
+	}
+	filter.SearchText = switchedText
+
+	return getProductsForMainpage(ctx, pdb, apiUrl, filter)
+}
+
+func getProductsForMainpage(ctx context.Context, pdb *Postgres, apiUrl string, filter MainpageFilter) ([]Product, int, error) {
+	products := make([]Product, 0)
+	var total int
+
+	args := mainpageArgs{filter.SearchText}
+	sortExpression, direction := filter.orderBy()
+
+	// The page is selected on the product level and then joined with all the matching variants of the products
+	query := "WITH " + mainpageSearchCte + ", " + filter.matchedCte(&args, "") + ", " +
+		"product_page AS (SELECT product_id, " + sortExpression + " AS sort_key, max(search_rank) AS search_rank, count(*) OVER() AS total " +
+		"FROM matched GROUP BY product_id " +
+		"ORDER BY sort_key" + direction + ", min(product_name), product_id " +
+		"LIMIT " + args.add(filter.Limit) + " OFFSET " + args.add(filter.Offset) + ") " +
+		"SELECT m.type_name, m.subtype_name, m.service_name, m.product_name, m.product_slug, m.variant_name, m.state_name, m.price, m.discount_money, m.discount_percent, m.final_price, m.lowest_price_30d::float8, m.campaign_name, m.campaign_ends_at, m.item_name, m.region_name, m.platform_name, m.mask, m.text_quantity, m.description, m.product_id, m.variant_id, m.rating::float8, m.review_count, m.bundle_components, m.preorder_release_at, " +
+		"pp.search_rank, CASE WHEN search.text = '' THEN '' ELSE ts_headline('russian', m.description, search.query, 'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2') END, pp.total " +
+		"FROM product_page pp JOIN matched m ON m.product_id = pp.product_id, search " +
+		"ORDER BY pp.sort_key" + direction + ", m.product_name, pp.product_id, m.type_name, m.subtype_name, m.final_price, m.variant_name, m.variant_id"
+
+	rows, err := pdb.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return products, total, err
+	}
+	defer rows.Close()
+
+	// productIndex and subtypeIndex keep the order of the query while grouping the variants
+	productIndex := make(map[string]int)
+	subtypeIndex := make(map[string]int)
+
+	for rows.Next() {
+		var v Variant
+		var s Subtype
+		var p Product
+		var campaignEndsAt, preorderReleaseAt *time.Time
+
+		if err = rows.Scan(
+			&s.Type,
+			&s.SubtypeName,
+			&v.Service,
+			&p.ProductName,
+			&p.Slug,
+			&v.VariantName,
+			&v.State,
+			&v.Price,
+			&v.DiscountMoney,
+			&v.DiscountPercent,
+			&v.FinalPrice,
+			&v.LowestPrice30d,
+			&v.CampaignName,
+			&campaignEndsAt,
+			&v.Item,
+			&v.Region,
+			&v.Platform,
+			&v.Mask,
+			&v.TextQuantity,
+			&p.Description,
+			&p.ProductId,
+			&v.VariantId,
+			&p.Rating,
+			&p.ReviewCount,
+			&v.BundleComponents,
+			&preorderReleaseAt,
+			&p.SearchRank,
+			&p.SearchSnippet,
+			&total,
+		); err != nil {
+			return products, total, err
+		}
+
+		if v.State == ProductStateUnavailableWithoutPrice {
+			v.Price = 0
+			v.DiscountPercent = 0
+			v.DiscountMoney = 0
+			v.FinalPrice = 0
+			v.LowestPrice30d = nil
+			v.TextQuantity = ""
+			v.CampaignName = nil
+		} else if campaignEndsAt != nil {
+			v.CampaignEndsAt = campaignEndsAt.Format(time.DateTime)
+		}
+		if preorderReleaseAt != nil {
+			v.PreorderReleaseAt = preorderReleaseAt.Format(time.DateTime)
+		}
+		v.ServiceSvgUrl = GetSvgFileUrl(apiUrl, v.Service)
+
+		pi, ok := productIndex[p.ProductId]
+		if !ok {
+			p.ProductImageUrl = GetProductImageUrl(apiUrl, p.ProductId)
+			p.Subtypes = []Subtype{}
+			products = append(products, p)
+			pi = len(products) - 1
+			productIndex[p.ProductId] = pi
+		}
+
+		subtypeKey := p.ProductId + "/" + s.Type + "/" + s.SubtypeName
+		si, ok := subtypeIndex[subtypeKey]
+		if !ok {
+			s.Variants = []Variant{}
+			products[pi].Subtypes = append(products[pi].Subtypes, s)
+			si = len(products[pi].Subtypes) - 1
+			subtypeIndex[subtypeKey] = si
+		}
+
+		products[pi].Subtypes[si].Variants = append(products[pi].Subtypes[si].Variants, v)
+	}
+	if err = rows.Err(); err != nil {
+		return products, total, err
+	}
+
+	// The page is out of range, but the total is still needed for the pagination
+	if len(products) == 0 && filter.Offset > 0 {
+		args = mainpageArgs{filter.SearchText}
+		err = pdb.Pool.QueryRow(ctx,
+			"WITH "+mainpageSearchCte+", "+filter.matchedCte(&args, "")+" SELECT count(DISTINCT product_id) FROM matched",
+			args...).Scan(&total)
+	}
+
+	return products, total, err
+}
+
+type FacetValue struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type MainpageFacets struct {
+	Types     []FacetValue `json:"types"`
+	Subtypes  []FacetValue `json:"subtypes"`
+	Services  []FacetValue `json:"services"`
+	Platforms []FacetValue `json:"platforms"`
+	Regions   []FacetValue `json:"regions"`
+	MinPrice  *float64     `json:"min_price"`
+	MaxPrice  *float64     `json:"max_price"`
+}
+
+// GetMainpageFacets returns the number of the products for every type, subtype, service, platform and region.
+// The counts of a dimension are calculated with the filters of the other dimensions, so the selected values do not hide their alternatives.
+func GetMainpageFacets(ctx context.Context, pdb *Postgres, filter MainpageFilter) (MainpageFacets, error) {
+	filter.SearchText = strings.TrimSpace(filter.SearchText)
+
+	facets, err := getMainpageFacets(ctx, pdb, filter)
+	if err != nil || facets.MaxPrice != nil || len(facets.Types) > 0 || filter.SearchText == "" {
+		return facets, err
+	}
+
+	switchedText := tl.SwitchKeyboardLayout(filter.SearchText)
+	if switchedText == strings.ToLower(filter.SearchText) {
+		return facets, nil
+	}
+	filter.SearchText = switchedText
+
+	return getMainpageFacets(ctx, pdb, filter)
+}
+
+func getMainpageFacets(ctx context.Context, pdb *Postgres, filter MainpageFilter) (MainpageFacets, error) {
+	facets := MainpageFacets{
+		Types:     []FacetValue{},
+		Subtypes:  []FacetValue{},
+		Services:  []FacetValue{},
+		Platforms: []FacetValue{},
+		Regions:   []FacetValue{},
+	}
+
+	dimensions := []struct {
+		facet  string
+		column string
+		values *[]FacetValue
+	}{
+		{facetType, "type_name", &facets.Types},
+		{facetSubtype, "subtype_name", &facets.Subtypes},
+		{facetService, "service_name", &facets.Services},
+		{facetPlatform, "platform_name", &facets.Platforms},
+		{facetRegion, "", &facets.Regions},
+	}
+
+	for _, d := range dimensions {
+		args := mainpageArgs{filter.SearchText}
+		query := "WITH " + mainpageSearchCte + ", " + filter.matchedCte(&args, d.facet)
+		if d.facet == facetRegion {
+			// The global variants are counted in every region, as they are activated there too
+			query += " SELECT r.region_name, count(DISTINCT m.product_id) FROM product.region r JOIN matched m ON m.region_name IN (r.region_name, " + args.add(RegionGlobal) + ")" +
+				" GROUP BY r.region_no, r.region_name ORDER BY r.region_no"
+		} else {
+			query += " SELECT " + d.column + ", count(DISTINCT product_id) FROM matched WHERE " + d.column + " IS NOT NULL GROUP BY " + d.column + " ORDER BY " + d.column
+		}
+
+		rows, err := pdb.Pool.Query(ctx, query, args...)
+		if err != nil {
+			return facets, err
+		}
+
+		for rows.Next() {
+			var value FacetValue
+			if err = rows.Scan(&value.Name, &value.Count); err != nil {
+				rows.Close()
+				return facets, err
+			}
+			*d.values = append(*d.values, value)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return facets, err
+		}
+	}
+
+	// The price bounds ignore the price filter, so the slider shows the whole range
+	priceFilter := filter
+	priceFilter.MinPrice, priceFilter.MaxPrice = nil, nil
+	args := mainpageArgs{filter.SearchText}
+	err := pdb.Pool.QueryRow(ctx,
+		"WITH "+mainpageSearchCte+", "+priceFilter.matchedCte(&args, "")+
+			" SELECT min(final_price)::float8, max(final_price)::float8 FROM matched WHERE state_name <> "+args.add(ProductStateUnavailableWithoutPrice),
+		args...).Scan(&facets.MinPrice, &facets.MaxPrice)
+
+	return facets, err
+}
+
+// GetProductBySlug returns the product with all its visible variants
+func GetProductBySlug(ctx context.Context, pdb *Postgres, apiUrl, slug string) (Product, error) {
+	products, _, err := getProductsForMainpage(ctx, pdb, apiUrl, MainpageFilter{ProductSlug: strings.ToLower(slug), Limit: 1})
+	if err != nil {
+		return Product{}, err
+	} else if len(products) == 0 {
+		return Product{}, NoResults
+	}
+
+	return products[0], nil
+}
+
+// GetProductSlugRedirect returns the current slug of the product by its old slug
+func GetProductSlugRedirect(ctx context.Context, pdb *Postgres, oldSlug string) (string, error) {
+	var slug string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT pp.slug FROM product.slug_history psh JOIN product.product pp ON pp.product_id = psh.product_id WHERE psh.slug = $1",
+		strings.ToLower(oldSlug)).Scan(&slug)
+	if err == pgx.ErrNoRows {
+		return "", NoResults
+	}
+
+	return slug, err
+}
+
+type RelatedProduct struct {
+	ProductId       string   `json:"product_id"`
+	ProductImageUrl string   `json:"product_image_url"`
+	ProductName     string   `json:"product_name"`
+	Slug            string   `json:"slug"`
+	MinPrice        *float64 `json:"min_price"`
+}
+
+// GetRelatedProducts returns the visible products sharing the types with the product.
+// The products with more common subtypes go first, then the more popular ones.
+func GetRelatedProducts(ctx context.Context, pdb *Postgres, apiUrl, productId string, limit int) ([]RelatedProduct, error) {
+	products := []RelatedProduct{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`WITH source AS (SELECT DISTINCT type_name, subtype_name FROM product.product_variants_summary_all_data WHERE product_id = $1)
+		SELECT product_id, product_name, product_slug, (min(final_price) FILTER (WHERE state_name <> $3))::float8
+		FROM product.product_variants_live
+		WHERE product_id <> $1 AND state_name <> ALL ($2)
+		GROUP BY product_id, product_name, product_slug
+		HAVING count(*) FILTER (WHERE type_name IN (SELECT type_name FROM source)) > 0
+		ORDER BY count(DISTINCT (type_name, subtype_name)) FILTER (WHERE (type_name, subtype_name) IN (SELECT type_name, subtype_name FROM source)) DESC,
+			sum(quantity_sold) DESC, product_name
+		LIMIT $4`,
+		productId, []string{ProductStateInvisible, ProductStateDeleted}, ProductStateUnavailableWithoutPrice, limit)
+	if err != nil {
+		return products, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var product RelatedProduct
+		if err = rows.Scan(
+			&product.ProductId,
+			&product.ProductName,
+			&product.Slug,
+			&product.MinPrice,
+		); err != nil {
+			return products, err
+		}
+		product.ProductImageUrl = GetProductImageUrl(apiUrl, product.ProductId)
+
+		products = append(products, product)
+	}
+	if err = rows.Err(); err != nil {
+		return products, err
+	}
+
+	return products, nil
+}
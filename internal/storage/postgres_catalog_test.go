@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMainpageFilterCacheKey(t *testing.T) {
+	price := 100.0
+
+	a := MainpageFilter{Types: []string{"keys", "accounts"}, Services: []string{"steam"}, MinPrice: &price, SortBy: "Price", Limit: 20}
+	b := MainpageFilter{Types: []string{"accounts", "keys", "keys"}, Services: []string{"steam"}, MinPrice: &price, SortBy: "price", Limit: 20}
+	assert.Equal(t, a.CacheKey(), b.CacheKey(), "the equivalent filters should share the key")
+
+	c := b
+	c.Offset = 20
+	assert.NotEqual(t, b.CacheKey(), c.CacheKey(), "another page should get another key")
+
+	d := b
+	d.MinPrice = nil
+	assert.NotEqual(t, b.CacheKey(), d.CacheKey(), "another price range should get another key")
+
+	assert.Equal(t, []string{"keys", "accounts"}, a.Types, "the filter should not be changed")
+}
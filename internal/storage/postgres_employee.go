@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// CheckAccountPermission checks whether the role of the account has the permission
+func CheckAccountPermission(ctx context.Context, pdb *Postgres, accountUuid, permission string) (bool, error) {
+	var allowed bool
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM account.account aa JOIN account.role_permission arp ON arp.role_no = aa.account_role JOIN account.permission ap ON ap.permission_no = arp.permission_no WHERE aa.account_id = $1 AND ap.permission_name = $2)::boolean",
+		accountUuid, permission).Scan(&allowed)
+
+	return allowed, err
+}
+
+func GetRolePermissions(ctx context.Context, pdb *Postgres, role string) ([]string, error) {
+	permissions := []string{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT ap.permission_name FROM account.role ar JOIN account.role_permission arp ON arp.role_no = ar.role_no JOIN account.permission ap ON ap.permission_no = arp.permission_no WHERE ar.role_name = $1 ORDER BY ap.permission_name",
+		role)
+	if err != nil {
+		return permissions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			return permissions, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return permissions, err
+	}
+
+	return permissions, nil
+}
+
+type Employee struct {
+	AccountId   string   `json:"account_id"`
+	Login       string   `json:"login"`
+	Surname     string   `json:"surname"`
+	Name        string   `json:"name"`
+	Patronymic  *string  `json:"patronymic"`
+	Role        string   `json:"role"`
+	State       string   `json:"state"`
+	Permissions []string `json:"permissions"`
+	CreatedAt   string   `json:"created_at"`
+	Commentary  *string  `json:"commentary"`
+}
+
+func GetEmployees(ctx context.Context, pdb *Postgres) ([]Employee, error) {
+	employees := []Employee{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT aa.account_id, ae.login, ae.surname, ae.name, ae.patronymic, ar.role_name, ast.state_name, aa.created_at, ae.commentary, COALESCE(array_agg(ap.permission_name ORDER BY ap.permission_name) FILTER (WHERE ap.permission_name IS NOT NULL), '{}') FROM account.employee ae JOIN account.account aa ON aa.account_id = ae.account_id JOIN account.role ar ON aa.account_role = ar.role_no JOIN account.state ast ON aa.account_state = ast.state_no LEFT JOIN account.role_permission arp ON arp.role_no = ar.role_no LEFT JOIN account.permission ap ON ap.permission_no = arp.permission_no GROUP BY aa.account_id, ae.login, ae.surname, ae.name, ae.patronymic, ar.role_name, ast.state_name, aa.created_at, ae.commentary ORDER BY ae.login")
+	if err != nil {
+		return employees, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var employee Employee
+		var createdAt time.Time
+
+		if err = rows.Scan(
+			&employee.AccountId,
+			&employee.Login,
+			&employee.Surname,
+			&employee.Name,
+			&employee.Patronymic,
+			&employee.Role,
+			&employee.State,
+			&createdAt,
+			&employee.Commentary,
+			&employee.Permissions,
+		); err != nil {
+			return employees, err
+		}
+		employee.CreatedAt = createdAt.Format(time.DateTime)
+
+		employees = append(employees, employee)
+	}
+	if err = rows.Err(); err != nil {
+		return employees, err
+	}
+
+	return employees, nil
+}
+
+func CreateEmployee(ctx context.Context, pdb *Postgres, login, surname, name, patronymic, role, base64PasswordHash, base64Salt string) (string, error) {
+	var result string
+
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			"INSERT INTO account.account(account_role, registration_method) SELECT ar.role_no, arm.registration_method_no FROM account.role ar, account.registration_method arm WHERE ar.role_name = $1 AND arm.registration_method_name = $2 RETURNING account_id",
+			role, AccountRegistrationMethodFromAdminPanel).Scan(&result)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(ctx,
+			"INSERT INTO account.employee(account_id, login, surname, name, patronymic, password, salt_for_password) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)",
+			result, strings.ToLower(login), surname, name, patronymic, base64PasswordHash, base64Salt)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedInsert
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// UpdateEmployee updates the non-nil fields of the employee
+func UpdateEmployee(ctx context.Context, pdb *Postgres, uuid string, surname, name, patronymic, role, state, base64PasswordHash, base64Salt *string) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx,
+			"UPDATE account.employee SET surname = COALESCE($2, surname), name = COALESCE($3, name), patronymic = CASE WHEN $4::text IS NULL THEN patronymic ELSE NULLIF($4, '') END, password = COALESCE($5, password), salt_for_password = COALESCE($6, salt_for_password), modified_at = CURRENT_TIMESTAMP WHERE account_id = $1",
+			uuid, surname, name, patronymic, base64PasswordHash, base64Salt)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedUpdate
+		}
+
+		if role == nil && state == nil {
+			return nil
+		}
+
+		res, err = tx.Exec(ctx,
+			"UPDATE account.account SET account_role = COALESCE((SELECT role_no FROM account.role WHERE role_name = $2), account_role), account_state = COALESCE((SELECT state_no FROM account.state WHERE state_name = $3), account_state), last_change_state = CASE WHEN $3::text IS NULL THEN last_change_state ELSE CURRENT_TIMESTAMP END, modified_at = CURRENT_TIMESTAMP WHERE account_id = $1",
+			uuid, role, state)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedUpdate
+		}
+
+		return nil
+	})
+}
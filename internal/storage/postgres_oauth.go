@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func oauthTable(provider string) (string, string, error) {
+	switch provider {
+	case OAuthProviderGoogle:
+		return "account.google_user", "google_id", nil
+	case OAuthProviderTelegram:
+		return "account.telegram_user", "telegram_id", nil
+	default:
+		return "", "", errors.New("unknown oauth provider: " + provider)
+	}
+}
+
+func oauthRegistrationMethod(provider string) string {
+	if provider == OAuthProviderGoogle {
+		return AccountRegistrationMethodGoogleAccount
+	}
+	return AccountRegistrationMethodTelegramAccount
+}
+
+func insertOAuthLink(ctx context.Context, tx pgx.Tx, accountUuid, provider, externalId, email, username, photoUrl string) error {
+	var query string
+	var args []interface{}
+
+	switch provider {
+	case OAuthProviderGoogle:
+		query = "INSERT INTO account.google_user(account_id, google_id, email) VALUES ($1, $2, $3)"
+		args = []interface{}{accountUuid, externalId, strings.ToLower(email)}
+	case OAuthProviderTelegram:
+		query = "INSERT INTO account.telegram_user(account_id, telegram_id, username, photo_url) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))"
+		args = []interface{}{accountUuid, externalId, username, photoUrl}
+	default:
+		return errors.New("unknown oauth provider: " + provider)
+	}
+
+	res, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() < 1 {
+		return FailedInsert
+	}
+
+	return nil
+}
+
+// GetOAuthAccount returns the account linked with the external provider id or an empty string
+func GetOAuthAccount(ctx context.Context, pdb *Postgres, provider, externalId string) (string, error) {
+	var accountUuid string
+
+	table, column, err := oauthTable(provider)
+	if err != nil {
+		return accountUuid, err
+	}
+
+	err = pdb.Pool.QueryRow(ctx,
+		"SELECT account_id FROM "+table+" WHERE "+column+" = $1",
+		externalId).Scan(&accountUuid)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+
+	return accountUuid, err
+}
+
+func CreateOAuthUser(ctx context.Context, pdb *Postgres, provider, externalId, email, nickname, username, photoUrl string) (string, error) {
+	var result string
+	email = strings.ToLower(email)
+
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			"INSERT INTO account.account(registration_method) SELECT registration_method_no FROM account.registration_method WHERE registration_method_name = $1 RETURNING account_id",
+			oauthRegistrationMethod(provider)).Scan(&result)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(ctx,
+			"INSERT INTO account.user(user_account, email, nickname) VALUES ($1, NULLIF($2, ''), $3)",
+			result, email, nickname)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedInsert
+		}
+
+		return insertOAuthLink(ctx, tx, result, provider, externalId, email, username, photoUrl)
+	})
+
+	return result, err
+}
+
+func CreateOAuthLink(ctx context.Context, pdb *Postgres, accountUuid, provider, externalId, email, username, photoUrl string) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		return insertOAuthLink(ctx, tx, accountUuid, provider, externalId, email, username, photoUrl)
+	})
+}
+
+// DeleteOAuthLink unlinks the provider from the account.
+// It returns LastLoginMethod if the account would be left without a password and without any linked provider.
+func DeleteOAuthLink(ctx context.Context, pdb *Postgres, accountUuid, provider string) error {
+	table, _, err := oauthTable(provider)
+	if err != nil {
+		return err
+	}
+
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var hasPassword bool
+		var linksCount int
+
+		if err := tx.QueryRow(ctx,
+			"SELECT EXISTS(SELECT 1 FROM account.user WHERE user_account = $1 AND password IS NOT NULL)::boolean, (SELECT count(*) FROM account.google_user WHERE account_id = $1) + (SELECT count(*) FROM account.telegram_user WHERE account_id = $1)",
+			accountUuid).Scan(&hasPassword, &linksCount); err != nil {
+			return err
+		}
+		if !hasPassword && linksCount <= 1 {
+			return LastLoginMethod
+		}
+
+		res, err := tx.Exec(ctx,
+			"DELETE FROM "+table+" WHERE account_id = $1",
+			accountUuid)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedDelete
+		}
+
+		return nil
+	})
+}
+
+type OAuthLink struct {
+	Provider   string  `json:"provider"`
+	ExternalId string  `json:"external_id"`
+	Name       *string `json:"name"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+func GetOAuthLinks(ctx context.Context, pdb *Postgres, accountUuid string) ([]OAuthLink, error) {
+	links := []OAuthLink{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT $2::text, google_id, email, created_at FROM account.google_user WHERE account_id = $1 UNION ALL SELECT $3::text, telegram_id, username, created_at FROM account.telegram_user WHERE account_id = $1",
+		accountUuid, OAuthProviderGoogle, OAuthProviderTelegram)
+	if err != nil {
+		return links, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link OAuthLink
+		var createdAt time.Time
+
+		if err = rows.Scan(
+			&link.Provider,
+			&link.ExternalId,
+			&link.Name,
+			&createdAt,
+		); err != nil {
+			return links, err
+		}
+		link.CreatedAt = createdAt.Format(time.DateTime)
+
+		links = append(links, link)
+	}
+	if err = rows.Err(); err != nil {
+		return links, err
+	}
+
+	return links, nil
+}
+
+func GetUserProfile(ctx context.Context, pdb *Postgres, accountUuid string) (string, string, string, error) {
+	var nickname, email, registrationMethod string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT au.nickname, COALESCE(au.email, ''), arm.registration_method_name FROM account.user au JOIN account.account aa ON au.user_account = aa.account_id JOIN account.registration_method arm ON aa.registration_method = arm.registration_method_no WHERE au.user_account = $1",
+		accountUuid).Scan(&nickname, &email, &registrationMethod)
+
+	return nickname, email, registrationMethod, err
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type PreorderQueueItem struct {
+	OrderId     string  `json:"order_id"`
+	VariantId   string  `json:"variant_id"`
+	ProductName string  `json:"product_name"`
+	VariantName string  `json:"variant_name"`
+	AccountId   string  `json:"account_id"`
+	Nickname    string  `json:"nickname"`
+	Price       float64 `json:"price"`
+	Paid        bool    `json:"paid"`
+	// Position is the place of the paid pre-order in the queue of the variant, the unpaid ones are not queued
+	Position  *int    `json:"position"`
+	ReleaseAt *string `json:"release_at"`
+	PaidAt    *string `json:"paid_at"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// fulfilPreorders reserves the free contents of the variant for its paid pre-orders in the order of the payment.
+// The fulfilled orders are returned in the same order.
+func fulfilPreorders(ctx context.Context, tx pgx.Tx, variantId string) ([]string, error) {
+	orderIds := []string{}
+
+	// The window functions can not be used with the locks, so the locked rows are numbered outside
+	rows, err := tx.Query(ctx,
+		`WITH queue AS (
+			SELECT order_id, row_number() OVER (ORDER BY paid_at, order_id) AS position
+			FROM (SELECT order_id, paid_at FROM product.order WHERE order_variant = $1 AND awaiting_content AND paid FOR UPDATE) po
+		), free AS (
+			SELECT content_id, row_number() OVER (ORDER BY created_at, content_id) AS position
+			FROM (SELECT content_id, created_at FROM product.content WHERE content_variant = $1 AND content_order IS NULL FOR UPDATE SKIP LOCKED) pc
+		), assigned AS (
+			UPDATE product.content pc SET content_order = queue.order_id, modified_at = CURRENT_TIMESTAMP
+			FROM queue JOIN free ON free.position = queue.position
+			WHERE pc.content_id = free.content_id
+			RETURNING pc.content_order
+		), fulfilled AS (
+			UPDATE product.order po SET awaiting_content = false, fulfilled_at = CURRENT_TIMESTAMP, modified_at = CURRENT_TIMESTAMP
+			FROM assigned WHERE po.order_id = assigned.content_order
+			RETURNING po.order_id, po.paid_at
+		)
+		SELECT order_id FROM fulfilled ORDER BY paid_at, order_id`,
+		variantId)
+	if err != nil {
+		return orderIds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderId string
+		if err = rows.Scan(&orderId); err != nil {
+			return orderIds, err
+		}
+		orderIds = append(orderIds, orderId)
+	}
+	if err = rows.Err(); err != nil {
+		return orderIds, err
+	}
+	rows.Close()
+
+	if len(orderIds) > 0 {
+		if _, err = tx.Exec(ctx,
+			"UPDATE product.variant SET quantity_current = quantity_current - $1 WHERE variant_id = $2",
+			len(orderIds), variantId); err != nil {
+			return orderIds, err
+		}
+	}
+
+	return orderIds, nil
+}
+
+// GetPreorderQueue returns the pre-orders awaiting the content, of all the variants if the variant is empty.
+// The paid pre-orders go first in the order of the payment.
+func GetPreorderQueue(ctx context.Context, pdb *Postgres, variantId string) ([]PreorderQueueItem, error) {
+	items := []PreorderQueueItem{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT po.order_id, po.order_variant, pp.product_name, pv.variant_name, po.order_account, au.nickname, po.price::float8, po.paid,
+			CASE WHEN po.paid THEN row_number() OVER (PARTITION BY po.order_variant, po.paid ORDER BY po.paid_at, po.order_id) END,
+			pv.preorder_release_at, po.paid_at, po.created_at
+		FROM product.order po
+			JOIN product.variant pv ON pv.variant_id = po.order_variant
+			JOIN product.product pp ON pp.product_id = pv.product_id
+			JOIN account.user au ON au.user_account = po.order_account
+		WHERE po.awaiting_content AND ($1 = '' OR po.order_variant = NULLIF($1, '')::uuid)
+		ORDER BY pp.product_name, pv.variant_name, po.paid DESC, po.paid_at, po.created_at, po.order_id`,
+		variantId)
+	if err != nil {
+		return items, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item PreorderQueueItem
+		var releaseAt, paidAt *time.Time
+		var createdAt time.Time
+
+		if err = rows.Scan(
+			&item.OrderId,
+			&item.VariantId,
+			&item.ProductName,
+			&item.VariantName,
+			&item.AccountId,
+			&item.Nickname,
+			&item.Price,
+			&item.Paid,
+			&item.Position,
+			&releaseAt,
+			&paidAt,
+			&createdAt,
+		); err != nil {
+			return items, err
+		}
+		if releaseAt != nil {
+			formatted := releaseAt.Format(time.DateTime)
+			item.ReleaseAt = &formatted
+		}
+		if paidAt != nil {
+			formatted := paidAt.Format(time.DateTime)
+			item.PaidAt = &formatted
+		}
+		item.CreatedAt = createdAt.Format(time.DateTime)
+
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return items, err
+	}
+
+	return items, nil
+}
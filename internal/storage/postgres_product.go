@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	tl "test-server-go/internal/tools"
 	"time"
 
 	"github.com/jackc/pgx/v4"
@@ -24,6 +26,18 @@ type Variant struct {
 	DiscountMoney   float64 `json:"discount_money"`
 	DiscountPercent int     `json:"discount_percent"`
 	FinalPrice      float64 `json:"final_price"`
+	// LowestPrice30d is the lowest own price of the 30 days before the current reduction, it is shown next to the discounts
+	LowestPrice30d *float64 `json:"lowest_price_30d"`
+	// CampaignName and CampaignEndsAt are set while the price is lowered by a sale campaign
+	CampaignName   *string `json:"campaign_name,omitempty"`
+	CampaignEndsAt string  `json:"campaign_ends_at,omitempty"`
+	// BundleComponents are the names of the variants sold together in the bundle
+	BundleComponents []string `json:"bundle_components,omitempty"`
+	// Region is the activation region of the key, Platform is set for the keys bound to a platform
+	Region   string  `json:"region"`
+	Platform *string `json:"platform"`
+	// PreorderReleaseAt is set while the variant is sold as a pre-order
+	PreorderReleaseAt string `json:"preorder_release_at,omitempty"`
 }
 
 type Subtype struct {
@@ -33,133 +47,17 @@ type Subtype struct {
 }
 
 type Product struct {
-	ProductId       string    `json:"product_id"`
-	ProductImageUrl string    `json:"product_image_url"`
-	ProductName     string    `json:"product_name"`
-	Description     string    `json:"description"`
-	Subtypes        []Subtype `json:"subtypes"`
-}
-
-func GetProductsForMainpage(ctx context.Context, pdb *Postgres, apiUrl, id, searchText, sort, sortType string) ([]Product, error) {
-	productsMap := make(map[string]*Product)
-	products := make([]Product, 0, len(productsMap))
-
-	query := "SELECT type_name, subtype_name, service_name, product_name, variant_name, state_name, price, discount_money, discount_percent, final_price, item_name, mask, text_quantity, description, product_id, variant_id FROM product.product_variants_summary_all_data WHERE CONCAT(product_name, variant_name, tags, description) ILIKE ANY (ARRAY[$1])"
-	if id != "" {
-		query += " AND variant_id = '" + strings.ToLower(id) + "'"
-	}
-	query += getSort(0, sort, sortType, []string{"type_name", "subtype_name", "product_name", "variant_name", "price", "final_price", "discount_money", "discount_percent"})
-
-	rows, err := pdb.Pool.Query(context.Background(), query, getTextWithPercents(searchText))
-	if err != nil {
-		return products, err
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		var v Variant
-		var s Subtype
-		var p Product
-
-		if err = rows.Scan(
-			&s.Type,
-			&s.SubtypeName,
-			&v.Service,
-			&p.ProductName,
-			&v.VariantName,
-			&v.State,
-			&v.Price,
-			&v.DiscountMoney,
-			&v.DiscountPercent,
-			&v.FinalPrice,
-			&v.Item,
-			&v.Mask,
-			&v.TextQuantity,
-			&p.Description,
-			&p.ProductId,
-			&v.VariantId,
-		); err != nil {
-			return products, err
-		}
-
-		if _, ok := productsMap[p.ProductName]; !ok {
-			productsMap[p.ProductName] = &Product{
-				ProductName:     p.ProductName,
-				ProductId:       p.ProductId,
-				ProductImageUrl: GetProductImageUrl(apiUrl, p.ProductId),
-				Description:     p.Description,
-				Subtypes:        []Subtype{},
-			}
-		}
-
-		var subtypeExists bool
-
-		// Checking if a subtype exists
-		for _, existingSubtype := range productsMap[p.ProductName].Subtypes {
-			if existingSubtype.SubtypeName == s.SubtypeName && existingSubtype.Type == s.Type {
-				subtypeExists = true
-				break
-			}
-		}
-
-		// If the subtype does not exist, add it
-		if !subtypeExists {
-			productsMap[p.ProductName].Subtypes = append(productsMap[p.ProductName].Subtypes, Subtype{
-				SubtypeName: s.SubtypeName,
-				Type:        s.Type,
-				Variants:    []Variant{},
-			})
-		}
-
-		// Adding a variant to the subtype
-		for i, st := range productsMap[p.ProductName].Subtypes {
-			if st.SubtypeName == s.SubtypeName && st.Type == s.Type {
-				if v.State == ProductStateInvisible || v.State == ProductStateDeleted {
-					continue
-				} else if v.State == ProductStateUnavailableWithoutPrice {
-					v.Price = 0
-					v.DiscountPercent = 0
-					v.DiscountMoney = 0
-					v.FinalPrice = 0
-					v.TextQuantity = ""
-				}
-				v.ServiceSvgUrl = GetSvgFileUrl(apiUrl, v.Service)
-				productsMap[p.ProductName].Subtypes[i].Variants = append(productsMap[p.ProductName].Subtypes[i].Variants, v)
-				break
-			}
-		}
-	}
-	if err = rows.Err(); err != nil {
-		return products, err
-	}
-
-	for productName, product := range productsMap {
-		for i := len(product.Subtypes) - 1; i >= 0; i-- {
-			if len(product.Subtypes[i].Variants) == 0 {
-				productsMap[productName].Subtypes = append(productsMap[productName].Subtypes[:i], productsMap[productName].Subtypes[i+1:]...)
-			}
-		}
-	}
-
-	var deleteKeys []string
-	for productName, product := range productsMap {
-		// If there are no subtypes left in the product, add the product's key to the deleteKeys slice
-		if len(product.Subtypes) == 0 {
-			deleteKeys = append(deleteKeys, productName)
-		}
-	}
-	// Delete products with no subtypes from productsMap
-	for _, key := range deleteKeys {
-		delete(productsMap, key)
-	}
-
-	// Create the products slice from the remaining items in productsMap
-	for _, product := range productsMap {
-		products = append(products, *product)
-	}
-
-	return products, err
+	ProductId       string `json:"product_id"`
+	ProductImageUrl string `json:"product_image_url"`
+	ProductName     string `json:"product_name"`
+	Slug            string `json:"slug"`
+	Description     string `json:"description"`
+	// Rating is the average of the published reviews, it is nil until the first one
+	Rating        *float64  `json:"rating"`
+	ReviewCount   int       `json:"review_count"`
+	SearchRank    float64   `json:"search_rank,omitempty"`
+	SearchSnippet string    `json:"search_snippet,omitempty"`
+	Subtypes      []Subtype `json:"subtypes"`
 }
 
 type AdminProducts struct {
@@ -175,6 +73,10 @@ type AdminProducts struct {
 	Service         string  `json:"service_name"`
 	State           string  `json:"state_name"`
 	Item            string  `json:"item_name"`
+	Region          string  `json:"region_name"`
+	Platform        *string `json:"platform_name"`
+	Supplier        *string `json:"supplier_name"`
+	SupplierSku     *string `json:"supplier_sku"`
 	Mask            string  `json:"mask"`
 	TextQuantity    string  `json:"text_quantity"`
 	QuantityCurrent int     `json:"quantity_current"`
@@ -183,12 +85,13 @@ type AdminProducts struct {
 	DiscountMoney   float64 `json:"discount_money"`
 	DiscountPercent int     `json:"discount_percent"`
 	FinalPrice      float64 `json:"final_price"`
+	CampaignName    *string `json:"campaign_name"`
 }
 
 func GetAdminVariants(ctx context.Context, pdb *Postgres, apiUrl, id, searchText, sort, sortType, activeFirst string) ([]AdminProducts, error) {
 	var products []AdminProducts
 
-	query := "SELECT product_id, product_name, description, type_name, subtype_name, variant_id, variant_name, service_name, state_name, item_name, mask, text_quantity, quantity_current, quantity_sold, price, discount_money, discount_percent, final_price FROM product.product_variants_summary_all_data WHERE CONCAT(product_name, variant_name, tags, description) ILIKE ANY (ARRAY[$1])"
+	query := "SELECT product_id, product_name, description, type_name, subtype_name, variant_id, variant_name, service_name, state_name, item_name, region_name, platform_name, variant_supplier, supplier_sku, mask, text_quantity, quantity_current, quantity_sold, price, discount_money, discount_percent, final_price, campaign_name FROM product.product_variants_live WHERE CONCAT(product_name, variant_name, tags, description) ILIKE ANY (ARRAY[$1])"
 	if id != "" {
 		query += " AND variant_id = '" + strings.ToLower(id) + "'"
 	}
@@ -201,7 +104,7 @@ func GetAdminVariants(ctx context.Context, pdb *Postgres, apiUrl, id, searchText
 	}
 	query += getSort(ind, sort, sortType, []string{"CASE WHEN state_name = 'active' THEN 0 ELSE 1 END", "type_name", "subtype_name", "product_name", "variant_name", "price", "final_price", "discount_money", "discount_percent", "quantity_current"})
 
-	rows, err := pdb.Pool.Query(context.Background(), query, getTextWithPercents(searchText))
+	rows, err := pdb.Pool.Query(ctx, query, getTextWithPercents(searchText))
 	if err != nil {
 		return products, err
 	}
@@ -220,6 +123,10 @@ func GetAdminVariants(ctx context.Context, pdb *Postgres, apiUrl, id, searchText
 			&p.Service,
 			&p.State,
 			&p.Item,
+			&p.Region,
+			&p.Platform,
+			&p.Supplier,
+			&p.SupplierSku,
 			&p.Mask,
 			&p.TextQuantity,
 			&p.QuantityCurrent,
@@ -228,6 +135,7 @@ func GetAdminVariants(ctx context.Context, pdb *Postgres, apiUrl, id, searchText
 			&p.DiscountMoney,
 			&p.DiscountPercent,
 			&p.FinalPrice,
+			&p.CampaignName,
 		)
 		if err != nil {
 			return products, err
@@ -256,7 +164,7 @@ type ProductItem struct {
 func AdminGetItems(ctx context.Context, pdb *Postgres) ([]ProductItem, error) {
 	var items []ProductItem
 
-	rows, err := pdb.Pool.Query(context.Background(),
+	rows, err := pdb.Pool.Query(ctx,
 		"SELECT item_no, item_name, created_at, modified_at, commentary FROM product.item")
 	if err != nil {
 		return items, err
@@ -306,7 +214,7 @@ func AdminGetServices(ctx context.Context, pdb *Postgres, apiUrl, serviceName st
 	}
 	query += " ORDER BY service_name"
 
-	rows, err := pdb.Pool.Query(context.Background(),
+	rows, err := pdb.Pool.Query(ctx,
 		query)
 	if err != nil {
 		return services, err
@@ -350,7 +258,7 @@ type ProductState struct {
 func AdminGetStates(ctx context.Context, pdb *Postgres) ([]ProductState, error) {
 	var states []ProductState
 
-	rows, err := pdb.Pool.Query(context.Background(),
+	rows, err := pdb.Pool.Query(ctx,
 		"SELECT state_no, state_name, created_at, modified_at, commentary FROM product.state ORDER BY state_name")
 	if err != nil {
 		return states, err
@@ -400,7 +308,7 @@ func AdminGetTypes(ctx context.Context, pdb *Postgres, typeName string) ([]Produ
 	}
 	query += " ORDER BY type_name"
 
-	rows, err := pdb.Pool.Query(context.Background(),
+	rows, err := pdb.Pool.Query(ctx,
 		query)
 	if err != nil {
 		return types, err
@@ -453,7 +361,7 @@ func AdminGetSubtypes(ctx context.Context, pdb *Postgres, typeName, subtypeName
 	}
 	query += " ORDER BY subtype_name"
 
-	rows, err := pdb.Pool.Query(context.Background(),
+	rows, err := pdb.Pool.Query(ctx,
 		query)
 	if err != nil {
 		return subtypes, err
@@ -488,6 +396,7 @@ func AdminGetSubtypes(ctx context.Context, pdb *Postgres, typeName, subtypeName
 type Product2 struct {
 	ProductId   string  `json:"product_id"`
 	ProductName string  `json:"product_name"`
+	Slug        string  `json:"slug"`
 	Description string  `json:"description"`
 	Tags        *string `json:"tags"`
 	CreatedAt   string  `json:"created_at"`
@@ -498,8 +407,8 @@ type Product2 struct {
 func AdminGetProducts(ctx context.Context, pdb *Postgres) ([]Product2, error) {
 	var products []Product2
 
-	rows, err := pdb.Pool.Query(context.Background(),
-		"SELECT product_id, product_name, description, tags, created_at, modified_at, commentary FROM product.product ORDER BY product_name")
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT product_id, product_name, slug, description, tags, created_at, modified_at, commentary FROM product.product ORDER BY product_name")
 	if err != nil {
 		return products, err
 	}
@@ -512,6 +421,7 @@ func AdminGetProducts(ctx context.Context, pdb *Postgres) ([]Product2, error) {
 		if err = rows.Scan(
 			&product.ProductId,
 			&product.ProductName,
+			&product.Slug,
 			&product.Description,
 			&product.Tags,
 			&createdAt,
@@ -532,44 +442,58 @@ func AdminGetProducts(ctx context.Context, pdb *Postgres) ([]Product2, error) {
 	return products, err
 }
 
-func CreateAdminVariant(ctx context.Context, pdb *Postgres, productName, variantName, serviceName, stateName, subtypeName, itemName, mask, price, discountMoney, discountPercent, accountId string) error {
+// CreateAdminVariant adds the variant to the product, the empty platform means the variant is not bound to a platform
+func CreateAdminVariant(ctx context.Context, pdb *Postgres, productName, variantName, serviceName, stateName, subtypeName, itemName, regionName, platformName, mask, price, discountMoney, discountPercent, accountId string) error {
 	var productId string
-	var serviceId, stateId, subtypeId, itemId int
+	var serviceId, stateId, subtypeId, itemId, regionId int
+	var platformId *int
 	var localDiscountMoney float64
 	var localDiscountPercent int
 
 	localDiscountMoney, _ = strconv.ParseFloat(discountMoney, 64)
 	localDiscountPercent, _ = strconv.Atoi(discountPercent)
 
-	if err := pdb.Pool.QueryRow(context.Background(),
+	if err := pdb.Pool.QueryRow(ctx,
 		"SELECT product_id FROM product.product WHERE product_name = $1",
 		productName).Scan(&productId); err != nil {
 		return err
 	}
-	if err := pdb.Pool.QueryRow(context.Background(),
+	if err := pdb.Pool.QueryRow(ctx,
 		"SELECT service_no FROM product.service WHERE service_name = $1",
 		serviceName).Scan(&serviceId); err != nil {
 		return err
 	}
-	if err := pdb.Pool.QueryRow(context.Background(),
+	if err := pdb.Pool.QueryRow(ctx,
 		"SELECT state_no FROM product.state WHERE state_name = $1",
 		stateName).Scan(&stateId); err != nil {
 		return err
 	}
-	if err := pdb.Pool.QueryRow(context.Background(),
+	if err := pdb.Pool.QueryRow(ctx,
 		"SELECT subtype_no FROM product.subtype WHERE subtype_name = $1",
 		subtypeName).Scan(&subtypeId); err != nil {
 		return err
 	}
-	if err := pdb.Pool.QueryRow(context.Background(),
+	if err := pdb.Pool.QueryRow(ctx,
 		"SELECT item_no FROM product.item WHERE item_name = $1",
 		itemName).Scan(&itemId); err != nil {
 		return err
 	}
+	if err := pdb.Pool.QueryRow(ctx,
+		"SELECT region_no FROM product.region WHERE lower(region_name) = lower($1)",
+		regionName).Scan(&regionId); err != nil {
+		return err
+	}
+	if platformName != "" {
+		if err := pdb.Pool.QueryRow(ctx,
+			"SELECT platform_no FROM product.platform WHERE lower(platform_name) = lower($1)",
+			platformName).Scan(&platformId); err != nil {
+			return err
+		}
+	}
 
-	result, err := pdb.Pool.Exec(context.Background(),
-		"INSERT INTO product.variant(product_id, variant_name, variant_service, variant_state, variant_subtype, variant_item, mask, price, discount_money, discount_percent, variant_account) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
-		productId, variantName, serviceId, stateId, subtypeId, itemId, mask, price, localDiscountMoney, localDiscountPercent, accountId)
+	result, err := pdb.Pool.Exec(ctx,
+		"INSERT INTO product.variant(product_id, variant_name, variant_service, variant_state, variant_subtype, variant_item, variant_region, variant_platform, mask, price, discount_money, discount_percent, variant_account) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)",
+		productId, variantName, serviceId, stateId, subtypeId, itemId, regionId, platformId, mask, price, localDiscountMoney, localDiscountPercent, accountId)
 	if err != nil {
 		return err
 	} else if result.RowsAffected() < 1 {
@@ -580,11 +504,21 @@ func CreateAdminVariant(ctx context.Context, pdb *Postgres, productName, variant
 	return err
 }
 
-func UpdateData(ctx context.Context, pdb *Postgres) error {
-	_, err := pdb.Pool.Exec(context.Background(),
-		"REFRESH MATERIALIZED VIEW product.product_variants_summary_all_data")
-
-	return err
+// adminVariantUpdatableColumns lists the variant columns that UpdateAdminVariant may change
+var adminVariantUpdatableColumns = map[string]bool{
+	"variant_name":        true,
+	"variant_state":       true,
+	"variant_item":        true,
+	"variant_region":      true,
+	"variant_platform":    true,
+	"preorder_release_at": true,
+	"variant_supplier":    true,
+	"supplier_sku":        true,
+	"supplier_cost":       true,
+	"mask":                true,
+	"price":               true,
+	"discount_money":      true,
+	"discount_percent":    true,
 }
 
 func UpdateAdminVariant(ctx context.Context, pdb *Postgres, id string, updateData map[string]interface{}) error {
@@ -592,17 +526,30 @@ func UpdateAdminVariant(ctx context.Context, pdb *Postgres, id string, updateDat
 		return errors.New("no data provided for update")
 	}
 
+	// Sort the columns to build the same query for the same set of fields
+	columns := make([]string, 0, len(updateData))
+	for key := range updateData {
+		if !adminVariantUpdatableColumns[key] {
+			return errors.New("the variant column can not be updated: " + key)
+		}
+		columns = append(columns, key)
+	}
+	sort.Strings(columns)
+
 	// Build SQL query
 	query := "UPDATE product.variant SET"
 	var args []interface{}
 	i := 1
-	for key, val := range updateData {
+	for _, key := range columns {
 		query += fmt.Sprintf(" %s = $%d,", key, i)
-		args = append(args, val)
+		args = append(args, updateData[key])
 		i++
 	}
+	if _, ok := updateData["variant_state"]; ok {
+		query += " last_change_state = CURRENT_TIMESTAMP,"
+	}
 
-	query = query[:len(query)-1] + " WHERE variant_id = $" + strconv.Itoa(i)
+	query += " modified_at = CURRENT_TIMESTAMP WHERE variant_id = $" + strconv.Itoa(i)
 	args = append(args, id)
 
 	result, err := pdb.Pool.Exec(ctx, query, args...)
@@ -611,13 +558,16 @@ func UpdateAdminVariant(ctx context.Context, pdb *Postgres, id string, updateDat
 	} else if result.RowsAffected() < 1 {
 		return FailedUpdate
 	}
+	if _, ok := updateData["variant_state"]; ok {
+		requestStockNotices(pdb)
+	}
 
 	UpdateData(ctx, pdb)
 	return nil
 }
 
 func AdminDeleteVariant(ctx context.Context, pdb *Postgres, variantId string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"DELETE FROM product.variant WHERE variant_id = $1",
 		variantId)
 
@@ -645,21 +595,53 @@ func GetStateNo(ctx context.Context, pdb *Postgres, stateName string) (int, erro
 	return stateNo, err
 }
 
-func CreateAdminContent(ctx context.Context, pdb *Postgres, variantId string, data []string) error {
+// CreateAdminContent adds the content to the variant as a single batch with the optional supplier and cost price.
+// BundleContent is returned for the bundles and NoResults if the supplier does not exist.
+// The paid pre-orders of the variant get the new content first, the fulfilled orders are returned in the order of the payment.
+func CreateAdminContent(ctx context.Context, pdb *Postgres, variantId, accountId, supplierName, costPrice string, data []string) ([]string, error) {
+	var fulfilled []string
+
 	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
 		res, err := tx.Exec(ctx,
-			"UPDATE product.variant SET quantity_current = quantity_current + $1 WHERE variant_id = $2",
+			"UPDATE product.variant SET quantity_current = quantity_current + $1 WHERE variant_id = $2 AND NOT EXISTS (SELECT 1 FROM product.bundle_component WHERE bundle_variant_id = $2)",
 			len(data), variantId)
 		if err != nil {
 			return err
 		} else if res.RowsAffected() < 1 {
+			var isBundle bool
+			if err = tx.QueryRow(ctx,
+				"SELECT EXISTS (SELECT 1 FROM product.bundle_component WHERE bundle_variant_id = $1)",
+				variantId).Scan(&isBundle); err != nil {
+				return err
+			} else if isBundle {
+				return BundleContent
+			}
 			return FailedUpdate
 		}
 
+		var supplierNo *int
+		if supplierName != "" {
+			err = tx.QueryRow(ctx,
+				"SELECT supplier_no FROM product.supplier WHERE lower(supplier_name) = lower($1)",
+				supplierName).Scan(&supplierNo)
+			if err == pgx.ErrNoRows {
+				return NoResults
+			} else if err != nil {
+				return err
+			}
+		}
+
+		var batchId string
+		if err = tx.QueryRow(ctx,
+			"INSERT INTO product.content_batch(batch_variant, batch_supplier, cost_price, quantity, batch_account) VALUES ($1, $2, NULLIF($3, '')::numeric, $4, $5) RETURNING batch_id",
+			variantId, supplierNo, costPrice, len(data), accountId).Scan(&batchId); err != nil {
+			return err
+		}
+
 		for _, val := range data {
 			res, err = tx.Exec(ctx,
-				"INSERT INTO product.content(content_variant, data) VALUES ($1, $2)",
-				variantId, val)
+				"INSERT INTO product.content(content_variant, content_batch, data) VALUES ($1, $2, $3)",
+				variantId, batchId, val)
 			if err != nil {
 				return err
 			} else if res.RowsAffected() < 1 {
@@ -667,59 +649,105 @@ func CreateAdminContent(ctx context.Context, pdb *Postgres, variantId string, da
 			}
 		}
 
+		fulfilled, err = fulfilPreorders(ctx, tx, variantId)
 		return err
 	})
+	if err == nil {
+		requestStockNotices(pdb)
+	}
 
-	UpdateData(ctx, pdb)
-	return err
+	return fulfilled, err
 }
 
-func CreateOrder(ctx context.Context, pdb *Postgres, accountId, variantId string) (string, string, float64, error) {
+// CreateOrder reserves a content of the active variant for the new order, the bundle reserves a content of every component.
+// The pre-order variant out of stock is ordered without the content, the order awaits it until the content is uploaded.
+// The order keeps the region of the buyer and whether the buyer acknowledged that the key is locked to another region.
+// NoResults is returned if the variant is not active and OutOfStock if any of the contents is not available.
+func CreateOrder(ctx context.Context, pdb *Postgres, accountId, variantId, buyerRegion string, regionAcknowledged bool) (string, string, float64, error) {
 	var orderId, variantName string
 	var finalPrice float64
 
 	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
-		if err := tx.QueryRow(ctx,
-			"UPDATE product.variant SET quantity_current = quantity_current - 1 WHERE variant_id = $1 AND quantity_current > 0 AND variant_state = (SELECT state_no FROM product.state WHERE state_name = 'active') RETURNING variant_name",
-			variantId).Scan(&variantName); err != nil {
+		var componentIds []string
+		// The pre-order and the variant of the supplier may be sold without the content, the order awaits it
+		var deferrable, awaitingContent bool
+		err := tx.QueryRow(ctx,
+			`SELECT pv.variant_name, pv.preorder_release_at IS NOT NULL OR pv.variant_supplier IS NOT NULL,
+				COALESCE(array_agg(bc.component_variant_id::text ORDER BY bc.component_variant_id) FILTER (WHERE bc.component_variant_id IS NOT NULL), '{}')
+			FROM product.variant pv LEFT JOIN product.bundle_component bc ON bc.bundle_variant_id = pv.variant_id
+			WHERE pv.variant_id = $1 AND pv.variant_state = (SELECT state_no FROM product.state WHERE state_name = $2)
+			GROUP BY pv.variant_id`,
+			variantId, ProductStateActive).Scan(&variantName, &deferrable, &componentIds)
+		if err == pgx.ErrNoRows {
+			return NoResults
+		} else if err != nil {
 			return err
 		}
 
-		if err := tx.QueryRow(ctx,
-			"INSERT INTO product.order (order_account, price) SELECT $1, pp.final_price FROM product.product_variants_summary_all_data pp JOIN product.variant pv ON pv.variant_id = pp.variant_id WHERE pv.variant_id = $2 RETURNING order_id, price",
-			accountId, variantId).Scan(&orderId, &finalPrice); err != nil {
-			return err
+		// The components are locked in the same order by all the orders, so the concurrent orders of the bundles do not deadlock
+		contentVariants := componentIds
+		if len(contentVariants) == 0 {
+			contentVariants = []string{variantId}
+		}
+		for _, contentVariant := range contentVariants {
+			res, err := tx.Exec(ctx,
+				"UPDATE product.variant SET quantity_current = quantity_current - 1 WHERE variant_id = $1 AND quantity_current > 0 AND variant_state <> (SELECT state_no FROM product.state WHERE state_name = $2)",
+				contentVariant, ProductStateDeleted)
+			if err != nil {
+				return err
+			} else if res.RowsAffected() < 1 && deferrable && len(componentIds) == 0 {
+				awaitingContent = true
+			} else if res.RowsAffected() < 1 {
+				return OutOfStock
+			}
 		}
 
-		result, err := tx.Exec(ctx,
-			"UPDATE product.content SET content_order = $1 WHERE content_variant = $2 AND content_order IS NULL AND content_id = (SELECT content_id FROM product.content WHERE content_variant = $2 AND content_order IS NULL LIMIT 1)",
-			orderId, variantId)
-		if err != nil {
+		if err = tx.QueryRow(ctx,
+			"INSERT INTO product.order (order_account, order_variant, price, order_campaign, order_region, region_acknowledged, awaiting_content) SELECT $1, variant_id, final_price, campaign_id, (SELECT region_no FROM product.region WHERE lower(region_name) = lower($3)), $4, $5 FROM product.variant_price WHERE variant_id = $2 RETURNING order_id, price",
+			accountId, variantId, buyerRegion, regionAcknowledged, awaitingContent).Scan(&orderId, &finalPrice); err != nil {
 			return err
-		} else if result.RowsAffected() < 1 {
-			return FailedUpdate
+		}
+		if awaitingContent {
+			return nil
 		}
 
-		return err
+		for _, contentVariant := range contentVariants {
+			result, err := tx.Exec(ctx,
+				"UPDATE product.content SET content_order = $1 WHERE content_id = (SELECT content_id FROM product.content WHERE content_variant = $2 AND content_order IS NULL LIMIT 1 FOR UPDATE SKIP LOCKED)",
+				orderId, contentVariant)
+			if err != nil {
+				return err
+			} else if result.RowsAffected() < 1 {
+				return OutOfStock
+			}
+		}
+
+		return nil
 	})
 
-	UpdateData(ctx, pdb)
 	return orderId, variantName, finalPrice, err
 }
 
 type GetAdminContentsData struct {
-	ContentId  string  `json:"content_id"`
-	Data       string  `json:"data"`
-	CreatedAt  string  `json:"created_at"`
-	ModifiedAt string  `json:"modified_at"`
-	Commentary *string `json:"commentary"`
+	ContentId    string   `json:"content_id"`
+	Data         string   `json:"data"`
+	BatchId      *string  `json:"batch_id"`
+	SupplierName *string  `json:"supplier_name"`
+	CostPrice    *float64 `json:"cost_price"`
+	CreatedAt    string   `json:"created_at"`
+	ModifiedAt   string   `json:"modified_at"`
+	Commentary   *string  `json:"commentary"`
 }
 
 func GetAdminContents(ctx context.Context, pdb *Postgres, id string) ([]GetAdminContentsData, error) {
 	var contents []GetAdminContentsData
 
-	rows, err := pdb.Pool.Query(context.Background(),
-		"SELECT content_id, data, created_at, modified_at, commentary FROM product.content WHERE content_variant = $1 ORDER BY created_at DESC",
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT pc.content_id, pc.data, pc.content_batch, ps.supplier_name, cb.cost_price::float8, pc.created_at, pc.modified_at, pc.commentary
+		FROM product.content pc
+			LEFT JOIN product.content_batch cb ON cb.batch_id = pc.content_batch
+			LEFT JOIN product.supplier ps ON ps.supplier_no = cb.batch_supplier
+		WHERE pc.content_variant = $1 ORDER BY pc.created_at DESC`,
 		id)
 	if err != nil {
 		return contents, err
@@ -733,6 +761,9 @@ func GetAdminContents(ctx context.Context, pdb *Postgres, id string) ([]GetAdmin
 		if err = rows.Scan(
 			&content.ContentId,
 			&content.Data,
+			&content.BatchId,
+			&content.SupplierName,
+			&content.CostPrice,
 			&createdAt,
 			&modifiedAt,
 			&content.Commentary,
@@ -763,7 +794,7 @@ func DeleteAdminContent(ctx context.Context, pdb *Postgres, id string) error {
 			return FailedUpdate
 		}
 
-		res, err = tx.Exec(context.Background(),
+		res, err = tx.Exec(ctx,
 			"DELETE FROM product.content WHERE content_id = $1 AND content_order IS NULL",
 			id)
 		if err != nil {
@@ -777,11 +808,11 @@ func DeleteAdminContent(ctx context.Context, pdb *Postgres, id string) error {
 		return err
 	}
 
-	return UpdateData(ctx, pdb)
+	return nil
 }
 
 func DeleteAdminType(ctx context.Context, pdb *Postgres, id string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"DELETE FROM product.type WHERE type_name = $1",
 		id)
 
@@ -790,7 +821,7 @@ func DeleteAdminType(ctx context.Context, pdb *Postgres, id string) error {
 }
 
 func DeleteAdminSubtype(ctx context.Context, pdb *Postgres, id string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"DELETE FROM product.subtype WHERE subtype_name = $1",
 		id)
 
@@ -799,7 +830,7 @@ func DeleteAdminSubtype(ctx context.Context, pdb *Postgres, id string) error {
 }
 
 func DeleteAdminService(ctx context.Context, pdb *Postgres, id string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"DELETE FROM product.service WHERE service_name = $1",
 		id)
 
@@ -807,17 +838,36 @@ func DeleteAdminService(ctx context.Context, pdb *Postgres, id string) error {
 	return err
 }
 
-func DeleteAdminProduct(ctx context.Context, pdb *Postgres, id string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
-		"DELETE FROM product.product WHERE product_name = $1",
+// DeleteAdminProduct deletes the product and returns the ids of its gallery images to remove their files
+func DeleteAdminProduct(ctx context.Context, pdb *Postgres, id string) ([]string, error) {
+	imageIds := []string{}
+
+	// The images deleted by the cascade are still visible in the snapshot of the statement
+	rows, err := pdb.Pool.Query(ctx,
+		"WITH deleted AS (DELETE FROM product.product WHERE product_name = $1 RETURNING product_id) SELECT image_id FROM product.image WHERE product_id IN (SELECT product_id FROM deleted)",
 		id)
+	if err != nil {
+		return imageIds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var imageId string
+		if err = rows.Scan(&imageId); err != nil {
+			return imageIds, err
+		}
+		imageIds = append(imageIds, imageId)
+	}
+	if err = rows.Err(); err != nil {
+		return imageIds, err
+	}
 
 	UpdateData(ctx, pdb)
-	return err
+	return imageIds, nil
 }
 
 func CreateAdminType(ctx context.Context, pdb *Postgres, name string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"INSERT INTO product.type(type_name) VALUES ($1)",
 		name)
 
@@ -828,13 +878,13 @@ func CreateAdminType(ctx context.Context, pdb *Postgres, name string) error {
 func CreateAdminSubtype(ctx context.Context, pdb *Postgres, name, name2 string) error {
 	var typeNo int
 
-	if err := pdb.Pool.QueryRow(context.Background(),
+	if err := pdb.Pool.QueryRow(ctx,
 		"SELECT type_no FROM product.type WHERE type_name = $1",
 		name2).Scan(&typeNo); err != nil {
 		return err
 	}
 
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"INSERT INTO product.subtype(type_no, subtype_name) VALUES ($1, $2)",
 		typeNo, name)
 
@@ -843,7 +893,7 @@ func CreateAdminSubtype(ctx context.Context, pdb *Postgres, name, name2 string)
 }
 
 func CreateAdminService(ctx context.Context, pdb *Postgres, name string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"INSERT INTO product.service(service_name) VALUES ($1)",
 		name)
 
@@ -851,12 +901,28 @@ func CreateAdminService(ctx context.Context, pdb *Postgres, name string) error {
 	return err
 }
 
-func CreateAdminProduct(ctx context.Context, pdb *Postgres, productName, tags, description string) (string, error) {
+// CreateAdminProduct adds the product and returns its id, the image with the stored renditions becomes the first one of its gallery
+func CreateAdminProduct(ctx context.Context, pdb *Postgres, productName, tags, description string, image *ProductImage) (string, error) {
 	var uuid string
 
-	if err := pdb.Pool.QueryRow(context.Background(),
-		"INSERT INTO product.product(product_name, tags, description) VALUES ($1, $2, $3) RETURNING product_id",
-		productName, tags, description).Scan(&uuid); err != nil {
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		slug, err := getFreeProductSlug(ctx, tx, productName, "")
+		if err != nil {
+			return err
+		}
+
+		if err = tx.QueryRow(ctx,
+			"INSERT INTO product.product(product_name, slug, tags, description) VALUES ($1, $2, $3, $4) RETURNING product_id",
+			productName, slug, tags, description).Scan(&uuid); err != nil || image == nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx,
+			"INSERT INTO product.image(image_id, product_id, position, width, height, content_hash) VALUES ($1, $2, 0, $3, $4, $5)",
+			image.ImageId, uuid, image.Width, image.Height, image.ContentHash)
+		return err
+	})
+	if err != nil {
 		return "", err
 	}
 
@@ -864,8 +930,100 @@ func CreateAdminProduct(ctx context.Context, pdb *Postgres, productName, tags, d
 	return uuid, nil
 }
 
+// UpdateAdminProduct updates the non-nil fields of the product and returns its slug.
+// After a rename the old slug is kept in the history to redirect the old links.
+func UpdateAdminProduct(ctx context.Context, pdb *Postgres, productId string, productName, tags, description *string) (string, error) {
+	var slug string
+
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var currentName string
+		if err := tx.QueryRow(ctx,
+			"SELECT product_name, slug FROM product.product WHERE product_id = $1 FOR UPDATE",
+			productId).Scan(&currentName, &slug); err == pgx.ErrNoRows {
+			return NoResults
+		} else if err != nil {
+			return err
+		}
+
+		if productName != nil && *productName != currentName {
+			newSlug, err := getFreeProductSlug(ctx, tx, *productName, productId)
+			if err != nil {
+				return err
+			}
+
+			if newSlug != slug {
+				if _, err = tx.Exec(ctx,
+					"INSERT INTO product.slug_history(slug, product_id) VALUES ($1, $2)",
+					slug, productId); err != nil {
+					return err
+				}
+				// The product may get back one of its old slugs
+				if _, err = tx.Exec(ctx,
+					"DELETE FROM product.slug_history WHERE slug = $1 AND product_id = $2",
+					newSlug, productId); err != nil {
+					return err
+				}
+				slug = newSlug
+			}
+		}
+
+		res, err := tx.Exec(ctx,
+			"UPDATE product.product SET product_name = COALESCE($2, product_name), slug = $3, tags = CASE WHEN $4::text IS NULL THEN tags ELSE NULLIF($4, '') END, description = COALESCE($5, description), modified_at = CURRENT_TIMESTAMP WHERE product_id = $1",
+			productId, productName, slug, tags, description)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedUpdate
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	UpdateData(ctx, pdb)
+	return slug, nil
+}
+
+// getFreeProductSlug generates the slug from the product name and adds a number suffix if the slug is taken by another product.
+// The current and the old slugs of the product itself are considered free.
+func getFreeProductSlug(ctx context.Context, tx pgx.Tx, productName, productId string) (string, error) {
+	base := tl.Slugify(productName)
+	if base == "" {
+		base = "product"
+	}
+
+	rows, err := tx.Query(ctx,
+		"SELECT slug FROM product.product WHERE (slug = $1 OR slug LIKE $1 || '-%') AND product_id::text <> $2 UNION SELECT slug FROM product.slug_history WHERE (slug = $1 OR slug LIKE $1 || '-%') AND product_id::text <> $2",
+		base, productId)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var slug string
+		if err = rows.Scan(&slug); err != nil {
+			return "", err
+		}
+		taken[slug] = true
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	slug := base
+	for i := 2; taken[slug]; i++ {
+		slug = base + "-" + strconv.Itoa(i)
+	}
+
+	return slug, nil
+}
+
 func EditAdminType(ctx context.Context, pdb *Postgres, name, newName string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"UPDATE product.type SET type_name = $1 WHERE type_name = $2",
 		newName, name)
 
@@ -874,7 +1032,7 @@ func EditAdminType(ctx context.Context, pdb *Postgres, name, newName string) err
 }
 
 func EditAdminSubtype(ctx context.Context, pdb *Postgres, name, newName string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"UPDATE product.subtype SET subtype_name = $1 WHERE subtype_name = $2",
 		newName, name)
 
@@ -883,10 +1041,125 @@ func EditAdminSubtype(ctx context.Context, pdb *Postgres, name, newName string)
 }
 
 func EditAdminService(ctx context.Context, pdb *Postgres, name, newName string) error {
-	_, err := pdb.Pool.Exec(context.Background(),
+	_, err := pdb.Pool.Exec(ctx,
 		"UPDATE product.service SET service_name = $1 WHERE service_name = $2",
 		newName, name)
 
 	UpdateData(ctx, pdb)
 	return err
 }
+
+type PricePoint struct {
+	Price           float64 `json:"price"`
+	DiscountMoney   float64 `json:"discount_money"`
+	DiscountPercent int     `json:"discount_percent"`
+	FinalPrice      float64 `json:"final_price"`
+	ChangedAt       string  `json:"changed_at"`
+}
+
+type PriceCampaign struct {
+	CampaignId      string  `json:"campaign_id"`
+	CampaignName    string  `json:"campaign_name"`
+	StartsAt        string  `json:"starts_at"`
+	EndsAt          string  `json:"ends_at"`
+	Priority        int     `json:"priority"`
+	DiscountMoney   float64 `json:"discount_money"`
+	DiscountPercent int     `json:"discount_percent"`
+}
+
+type VariantPriceHistory struct {
+	VariantId string          `json:"variant_id"`
+	History   []PricePoint    `json:"history"`
+	Campaigns []PriceCampaign `json:"campaigns"`
+}
+
+// GetVariantPriceHistory returns the own price changes of the variant for the last days and the campaigns targeting it in this period.
+// The history starts with the price in force at the beginning of the period, so the chart does not begin empty.
+func GetVariantPriceHistory(ctx context.Context, pdb *Postgres, variantId string, days int) (VariantPriceHistory, error) {
+	result := VariantPriceHistory{
+		VariantId: variantId,
+		History:   []PricePoint{},
+		Campaigns: []PriceCampaign{},
+	}
+
+	var exists bool
+	if err := pdb.Pool.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM product.variant WHERE variant_id = $1)",
+		variantId).Scan(&exists); err != nil {
+		return result, err
+	} else if !exists {
+		return result, NoResults
+	}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT price::float8, discount_money::float8, discount_percent, final_price::float8, changed_at
+		FROM product.price_history
+		WHERE variant_id = $1 AND changed_at >= COALESCE((SELECT max(changed_at) FROM product.price_history WHERE variant_id = $1 AND changed_at <= LOCALTIMESTAMP - make_interval(days => $2)), '-infinity'::timestamp)
+		ORDER BY changed_at, history_no`,
+		variantId, days)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var point PricePoint
+		var changedAt time.Time
+
+		if err = rows.Scan(
+			&point.Price,
+			&point.DiscountMoney,
+			&point.DiscountPercent,
+			&point.FinalPrice,
+			&changedAt,
+		); err != nil {
+			return result, err
+		}
+		point.ChangedAt = changedAt.Format(time.DateTime)
+
+		result.History = append(result.History, point)
+	}
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+
+	rows, err = pdb.Pool.Query(ctx,
+		`SELECT pc.campaign_id, pc.campaign_name, pc.starts_at, pc.ends_at, pc.priority, pc.discount_money::float8, pc.discount_percent
+		FROM product.campaign pc
+		WHERE pc.ends_at > LOCALTIMESTAMP - make_interval(days => $2) AND EXISTS (
+			SELECT 1 FROM product.campaign_target ct, product.variant pv JOIN product.subtype st ON pv.variant_subtype = st.subtype_no
+			WHERE ct.campaign_id = pc.campaign_id AND pv.variant_id = $1
+				AND (ct.variant_id = pv.variant_id OR ct.product_id = pv.product_id OR ct.service_no = pv.variant_service OR ct.type_no = st.type_no))
+		ORDER BY pc.starts_at`,
+		variantId, days)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var campaign PriceCampaign
+		var startsAt, endsAt time.Time
+
+		if err = rows.Scan(
+			&campaign.CampaignId,
+			&campaign.CampaignName,
+			&startsAt,
+			&endsAt,
+			&campaign.Priority,
+			&campaign.DiscountMoney,
+			&campaign.DiscountPercent,
+		); err != nil {
+			return result, err
+		}
+		campaign.StartsAt = startsAt.Format(time.DateTime)
+		campaign.EndsAt = endsAt.Format(time.DateTime)
+
+		result.Campaigns = append(result.Campaigns, campaign)
+	}
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type ProductImage struct {
+	ImageId      string `json:"image_id"`
+	Position     int    `json:"position"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	ContentHash  string `json:"-"`
+	ThumbnailUrl string `json:"thumbnail_url"`
+	MediumUrl    string `json:"medium_url"`
+	LargeUrl     string `json:"large_url"`
+}
+
+func (i *ProductImage) setUrls(apiUrl string) {
+	i.ThumbnailUrl = GetProductImageRenditionUrl(apiUrl, i.ImageId, ProductImageThumbnail)
+	i.MediumUrl = GetProductImageRenditionUrl(apiUrl, i.ImageId, ProductImageMedium)
+	i.LargeUrl = GetProductImageRenditionUrl(apiUrl, i.ImageId, ProductImageLarge)
+}
+
+// CreateProductImage adds the image to the end of the product gallery. The id is chosen by the caller,
+// so the renditions are stored before the image appears in the gallery.
+func CreateProductImage(ctx context.Context, pdb *Postgres, apiUrl, productId, imageId string, width, height int, contentHash string) (ProductImage, error) {
+	image := ProductImage{Width: width, Height: height, ContentHash: contentHash}
+
+	err := pdb.Pool.QueryRow(ctx,
+		"INSERT INTO product.image(image_id, product_id, position, width, height, content_hash) SELECT $5, product_id, COALESCE((SELECT max(position) + 1 FROM product.image WHERE product_id = $1), 0), $2, $3, $4 FROM product.product WHERE product_id = $1 RETURNING image_id, position",
+		productId, width, height, contentHash, imageId).Scan(&image.ImageId, &image.Position)
+	if err == pgx.ErrNoRows {
+		return image, NoResults
+	} else if err != nil {
+		return image, err
+	}
+	image.setUrls(apiUrl)
+
+	return image, nil
+}
+
+func GetProductImages(ctx context.Context, pdb *Postgres, apiUrl, productId string) ([]ProductImage, error) {
+	images := []ProductImage{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT image_id, position, width, height, content_hash FROM product.image WHERE product_id = $1 ORDER BY position, created_at",
+		productId)
+	if err != nil {
+		return images, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var image ProductImage
+		if err = rows.Scan(
+			&image.ImageId,
+			&image.Position,
+			&image.Width,
+			&image.Height,
+			&image.ContentHash,
+		); err != nil {
+			return images, err
+		}
+		image.setUrls(apiUrl)
+
+		images = append(images, image)
+	}
+	if err = rows.Err(); err != nil {
+		return images, err
+	}
+
+	return images, nil
+}
+
+// GetProductImageHash returns the content hash of the image, which is used as its ETag
+func GetProductImageHash(ctx context.Context, pdb *Postgres, imageId string) (string, error) {
+	var contentHash string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT content_hash FROM product.image WHERE image_id = $1",
+		imageId).Scan(&contentHash)
+	if err == pgx.ErrNoRows {
+		return "", NoResults
+	}
+
+	return contentHash, err
+}
+
+// GetProductMainImage returns the id and the content hash of the first image in the product gallery
+func GetProductMainImage(ctx context.Context, pdb *Postgres, productId string) (string, string, error) {
+	var imageId, contentHash string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT image_id, content_hash FROM product.image WHERE product_id = $1 ORDER BY position, created_at LIMIT 1",
+		productId).Scan(&imageId, &contentHash)
+	if err == pgx.ErrNoRows {
+		return "", "", NoResults
+	}
+
+	return imageId, contentHash, err
+}
+
+// UpdateProductImagesOrder sets the gallery order, the list must contain every image of the product exactly once
+func UpdateProductImagesOrder(ctx context.Context, pdb *Postgres, productId string, imageIds []string) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var count int
+		if err := tx.QueryRow(ctx,
+			"SELECT count(*) FROM product.image WHERE product_id = $1",
+			productId).Scan(&count); err != nil {
+			return err
+		}
+		if count != len(imageIds) {
+			return FailedUpdate
+		}
+
+		res, err := tx.Exec(ctx,
+			"UPDATE product.image pi SET position = o.position - 1 FROM unnest($2::uuid[]) WITH ORDINALITY AS o(image_id, position) WHERE pi.image_id = o.image_id AND pi.product_id = $1",
+			productId, imageIds)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() != int64(count) {
+			return FailedUpdate
+		}
+
+		return nil
+	})
+}
+
+// DeleteProductImage deletes the image and closes the gap in the gallery order
+func DeleteProductImage(ctx context.Context, pdb *Postgres, imageId string) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var productId string
+		var position int
+		if err := tx.QueryRow(ctx,
+			"DELETE FROM product.image WHERE image_id = $1 RETURNING product_id, position",
+			imageId).Scan(&productId, &position); err == pgx.ErrNoRows {
+			return FailedDelete
+		} else if err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx,
+			"UPDATE product.image SET position = position - 1 WHERE product_id = $1 AND position > $2",
+			productId, position)
+
+		return err
+	})
+}
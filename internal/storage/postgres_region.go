@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type ProductRegion struct {
+	RegionNo   int     `json:"region_no"`
+	RegionName string  `json:"region_name"`
+	CreatedAt  string  `json:"created_at"`
+	ModifiedAt string  `json:"modified_at"`
+	Commentary *string `json:"commentary"`
+}
+
+type ProductPlatform struct {
+	PlatformNo   int     `json:"platform_no"`
+	PlatformName string  `json:"platform_name"`
+	CreatedAt    string  `json:"created_at"`
+	ModifiedAt   string  `json:"modified_at"`
+	Commentary   *string `json:"commentary"`
+}
+
+type ActivationInstruction struct {
+	ServiceName string `json:"service_name"`
+	RegionName  string `json:"region_name"`
+	Instruction string `json:"instruction"`
+	CreatedAt   string `json:"created_at"`
+	ModifiedAt  string `json:"modified_at"`
+}
+
+// RegionMatches reports whether the key of the variant region is activated in the region of the buyer.
+// The keys of the global region are activated everywhere, the unknown region of the buyer matches only them.
+func RegionMatches(variantRegion, buyerRegion string) bool {
+	return variantRegion == RegionGlobal || (buyerRegion != "" && strings.EqualFold(variantRegion, buyerRegion))
+}
+
+func AdminGetRegions(ctx context.Context, pdb *Postgres) ([]ProductRegion, error) {
+	regions := []ProductRegion{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT region_no, region_name, created_at, modified_at, commentary FROM product.region ORDER BY region_no")
+	if err != nil {
+		return regions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var region ProductRegion
+		var createdAt, modifiedAt time.Time
+
+		if err = rows.Scan(
+			&region.RegionNo,
+			&region.RegionName,
+			&createdAt,
+			&modifiedAt,
+			&region.Commentary,
+		); err != nil {
+			return regions, err
+		}
+		region.CreatedAt = createdAt.Format(time.DateTime)
+		region.ModifiedAt = modifiedAt.Format(time.DateTime)
+
+		regions = append(regions, region)
+	}
+	if err = rows.Err(); err != nil {
+		return regions, err
+	}
+
+	return regions, nil
+}
+
+func AdminGetPlatforms(ctx context.Context, pdb *Postgres) ([]ProductPlatform, error) {
+	platforms := []ProductPlatform{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT platform_no, platform_name, created_at, modified_at, commentary FROM product.platform ORDER BY platform_name")
+	if err != nil {
+		return platforms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var platform ProductPlatform
+		var createdAt, modifiedAt time.Time
+
+		if err = rows.Scan(
+			&platform.PlatformNo,
+			&platform.PlatformName,
+			&createdAt,
+			&modifiedAt,
+			&platform.Commentary,
+		); err != nil {
+			return platforms, err
+		}
+		platform.CreatedAt = createdAt.Format(time.DateTime)
+		platform.ModifiedAt = modifiedAt.Format(time.DateTime)
+
+		platforms = append(platforms, platform)
+	}
+	if err = rows.Err(); err != nil {
+		return platforms, err
+	}
+
+	return platforms, nil
+}
+
+// GetRegionNo returns the number of the region by its name, NoResults is returned for the unknown region
+func GetRegionNo(ctx context.Context, pdb *Postgres, regionName string) (int, error) {
+	var regionNo int
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT region_no FROM product.region WHERE lower(region_name) = lower($1)",
+		regionName).Scan(&regionNo)
+	if err == pgx.ErrNoRows {
+		return 0, NoResults
+	}
+
+	return regionNo, err
+}
+
+// GetPlatformNo returns the number of the platform by its name, NoResults is returned for the unknown platform
+func GetPlatformNo(ctx context.Context, pdb *Postgres, platformName string) (int, error) {
+	var platformNo int
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT platform_no FROM product.platform WHERE lower(platform_name) = lower($1)",
+		platformName).Scan(&platformNo)
+	if err == pgx.ErrNoRows {
+		return 0, NoResults
+	}
+
+	return platformNo, err
+}
+
+// GetVariantRegion returns the region of the variant, NoResults is returned if the variant does not exist
+func GetVariantRegion(ctx context.Context, pdb *Postgres, variantId string) (string, error) {
+	var regionName string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT r.region_name FROM product.variant pv JOIN product.region r ON r.region_no = pv.variant_region WHERE pv.variant_id = $1",
+		variantId).Scan(&regionName)
+	if err == pgx.ErrNoRows {
+		return "", NoResults
+	}
+
+	return regionName, err
+}
+
+// GetUserRegion returns the region chosen in the profile of the user, the value is empty if the region is not chosen
+// or the account has no user profile (the employees)
+func GetUserRegion(ctx context.Context, pdb *Postgres, uuid string) (string, error) {
+	var regionName string
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT COALESCE(r.region_name, '') FROM account.user au LEFT JOIN product.region r ON r.region_no = au.user_region WHERE au.user_account = $1",
+		uuid).Scan(&regionName)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+
+	return regionName, err
+}
+
+// UpdateUserRegion changes the region of the user profile, the empty region clears it
+func UpdateUserRegion(ctx context.Context, pdb *Postgres, uuid, regionName string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		"UPDATE account.user SET user_region = (SELECT region_no FROM product.region WHERE lower(region_name) = lower($1)), modified_at = CURRENT_TIMESTAMP WHERE user_account = $2",
+		regionName, uuid)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return nil
+}
+
+// GetActivationInstructions returns the activation instructions, all of them if the service is empty
+func GetActivationInstructions(ctx context.Context, pdb *Postgres, serviceName string) ([]ActivationInstruction, error) {
+	instructions := []ActivationInstruction{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT ps.service_name, r.region_name, pai.instruction, pai.created_at, pai.modified_at
+		FROM product.activation_instruction pai
+			JOIN product.service ps ON ps.service_no = pai.service_no
+			JOIN product.region r ON r.region_no = pai.region_no
+		WHERE $1 = '' OR lower(ps.service_name) = lower($1)
+		ORDER BY ps.service_name, r.region_no`,
+		serviceName)
+	if err != nil {
+		return instructions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var instruction ActivationInstruction
+		var createdAt, modifiedAt time.Time
+
+		if err = rows.Scan(
+			&instruction.ServiceName,
+			&instruction.RegionName,
+			&instruction.Instruction,
+			&createdAt,
+			&modifiedAt,
+		); err != nil {
+			return instructions, err
+		}
+		instruction.CreatedAt = createdAt.Format(time.DateTime)
+		instruction.ModifiedAt = modifiedAt.Format(time.DateTime)
+
+		instructions = append(instructions, instruction)
+	}
+	if err = rows.Err(); err != nil {
+		return instructions, err
+	}
+
+	return instructions, nil
+}
+
+// UpdateActivationInstruction creates or replaces the instruction of the service in the region.
+// NoResults is returned if the service or the region does not exist.
+func UpdateActivationInstruction(ctx context.Context, pdb *Postgres, serviceName, regionName, instruction string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		`INSERT INTO product.activation_instruction(service_no, region_no, instruction)
+		SELECT ps.service_no, r.region_no, $3 FROM product.service ps, product.region r
+		WHERE lower(ps.service_name) = lower($1) AND lower(r.region_name) = lower($2)
+		ON CONFLICT (service_no, region_no) DO UPDATE SET instruction = EXCLUDED.instruction, modified_at = CURRENT_TIMESTAMP`,
+		serviceName, regionName, instruction)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return NoResults
+	}
+
+	return nil
+}
+
+func DeleteActivationInstruction(ctx context.Context, pdb *Postgres, serviceName, regionName string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		`DELETE FROM product.activation_instruction pai
+		USING product.service ps, product.region r
+		WHERE ps.service_no = pai.service_no AND r.region_no = pai.region_no
+			AND lower(ps.service_name) = lower($1) AND lower(r.region_name) = lower($2)`,
+		serviceName, regionName)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedDelete
+	}
+
+	return nil
+}
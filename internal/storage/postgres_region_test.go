@@ -0,0 +1,15 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegionMatches(t *testing.T) {
+	assert.True(t, RegionMatches(RegionGlobal, "eu"), "the global key should be activated in any region")
+	assert.True(t, RegionMatches(RegionGlobal, ""), "the global key should not need the region of the buyer")
+	assert.True(t, RegionMatches("ru/cis", "RU/CIS"))
+	assert.False(t, RegionMatches("ru/cis", "eu"))
+	assert.False(t, RegionMatches("eu", ""), "the unknown region of the buyer should not match the region locked key")
+}
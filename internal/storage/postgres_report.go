@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"math"
+)
+
+// The groupings of the margin report
+const (
+	MarginGroupOrder    = "order"
+	MarginGroupVariant  = "variant"
+	MarginGroupSupplier = "supplier"
+	MarginGroupDay      = "day"
+	MarginGroupWeek     = "week"
+	MarginGroupMonth    = "month"
+)
+
+// marginGroups maps the grouping of the margin report to the expressions of its key and name.
+// The content without the supplier is grouped under the empty key.
+var marginGroups = map[string][2]string{
+	MarginGroupOrder:    {"cs.order_id::text", "pp.product_name || ' - ' || pv.variant_name"},
+	MarginGroupVariant:  {"cs.order_variant::text", "pp.product_name || ' - ' || pv.variant_name"},
+	MarginGroupSupplier: {"COALESCE(cs.batch_supplier::text, '')", "COALESCE(ps.supplier_name, '')"},
+	MarginGroupDay:      {"to_char(date_trunc('day', cs.paid_at), 'YYYY-MM-DD')", "to_char(date_trunc('day', cs.paid_at), 'YYYY-MM-DD')"},
+	MarginGroupWeek:     {"to_char(date_trunc('week', cs.paid_at), 'YYYY-MM-DD')", "to_char(date_trunc('week', cs.paid_at), 'YYYY-MM-DD')"},
+	MarginGroupMonth:    {"to_char(date_trunc('month', cs.paid_at), 'YYYY-MM')", "to_char(date_trunc('month', cs.paid_at), 'YYYY-MM')"},
+}
+
+// MarginReportRow is the margin of the group of the sold content. Uncosted is the number of the sold contents
+// with the unknown cost price, they are counted in the revenue but not in the cost.
+type MarginReportRow struct {
+	Key      string   `json:"key"`
+	Name     string   `json:"name"`
+	Orders   int      `json:"orders"`
+	Sold     int      `json:"sold"`
+	Revenue  float64  `json:"revenue"`
+	Cost     float64  `json:"cost"`
+	Profit   float64  `json:"profit"`
+	Margin   *float64 `json:"margin"`
+	Uncosted int      `json:"uncosted"`
+}
+
+func IsMarginGroup(group string) bool {
+	_, ok := marginGroups[group]
+	return ok
+}
+
+// marginPercent returns the profit as the percent of the revenue, there is no margin without the revenue
+func marginPercent(revenue, profit float64) *float64 {
+	if revenue <= 0 {
+		return nil
+	}
+
+	margin := math.Round(profit/revenue*10000) / 100
+	return &margin
+}
+
+// GetMarginReport returns the margin of the content paid in the period [from, to) grouped by the grouping
+func GetMarginReport(ctx context.Context, pdb *Postgres, group, from, to string) ([]MarginReportRow, error) {
+	report := []MarginReportRow{}
+
+	expressions, ok := marginGroups[group]
+	if !ok {
+		return report, NoResults
+	}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT "+expressions[0]+", "+expressions[1]+`, count(DISTINCT cs.order_id), count(*),
+			sum(cs.revenue)::float8, COALESCE(sum(cs.cost), 0)::float8, count(*) FILTER (WHERE cs.cost IS NULL)
+		FROM product.content_sale cs
+			JOIN product.variant pv ON pv.variant_id = cs.order_variant
+			JOIN product.product pp ON pp.product_id = pv.product_id
+			LEFT JOIN product.supplier ps ON ps.supplier_no = cs.batch_supplier
+		WHERE cs.paid_at >= $1::timestamp AND cs.paid_at < $2::timestamp
+		GROUP BY 1, 2
+		ORDER BY 1`,
+		from, to)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row MarginReportRow
+
+		if err = rows.Scan(
+			&row.Key,
+			&row.Name,
+			&row.Orders,
+			&row.Sold,
+			&row.Revenue,
+			&row.Cost,
+			&row.Uncosted,
+		); err != nil {
+			return report, err
+		}
+		row.Revenue = math.Round(row.Revenue*100) / 100
+		row.Cost = math.Round(row.Cost*100) / 100
+		row.Profit = math.Round((row.Revenue-row.Cost)*100) / 100
+		row.Margin = marginPercent(row.Revenue, row.Profit)
+
+		report = append(report, row)
+	}
+	if err = rows.Err(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
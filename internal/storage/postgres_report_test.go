@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarginPercent(t *testing.T) {
+	assert.Nil(t, marginPercent(0, 0))
+	assert.Nil(t, marginPercent(0, -10))
+
+	margin := marginPercent(300, 100)
+	if assert.NotNil(t, margin) {
+		assert.Equal(t, 33.33, *margin)
+	}
+	margin = marginPercent(100, -25)
+	if assert.NotNil(t, margin) {
+		assert.Equal(t, -25.0, *margin)
+	}
+}
+
+func TestMarginGroups(t *testing.T) {
+	for _, group := range []string{MarginGroupOrder, MarginGroupVariant, MarginGroupSupplier, MarginGroupDay, MarginGroupWeek, MarginGroupMonth} {
+		assert.True(t, IsMarginGroup(group), group)
+	}
+	assert.False(t, IsMarginGroup("year"))
+	assert.False(t, IsMarginGroup("1; DROP TABLE product.order"))
+}
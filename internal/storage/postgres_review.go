@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type Review struct {
+	ReviewId   string `json:"review_id"`
+	Nickname   string `json:"nickname"`
+	Rating     int    `json:"rating"`
+	ReviewText string `json:"review_text"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type AdminReview struct {
+	ReviewId         string  `json:"review_id"`
+	ProductId        string  `json:"product_id"`
+	ProductName      string  `json:"product_name"`
+	AccountId        string  `json:"account_id"`
+	Nickname         string  `json:"nickname"`
+	Rating           int     `json:"rating"`
+	ReviewText       string  `json:"review_text"`
+	State            string  `json:"state"`
+	ModerationReason *string `json:"moderation_reason"`
+	ModeratedAt      string  `json:"moderated_at"`
+	CreatedAt        string  `json:"created_at"`
+	ModifiedAt       string  `json:"modified_at"`
+}
+
+type UserReview struct {
+	ReviewId         string  `json:"review_id"`
+	ProductId        string  `json:"product_id"`
+	ProductName      string  `json:"product_name"`
+	Rating           int     `json:"rating"`
+	ReviewText       string  `json:"review_text"`
+	State            string  `json:"state"`
+	ModerationReason *string `json:"moderation_reason"`
+	CreatedAt        string  `json:"created_at"`
+	ModifiedAt       string  `json:"modified_at"`
+}
+
+// GetProductReviews returns a page of the published reviews of the product and their total number
+func GetProductReviews(ctx context.Context, pdb *Postgres, slug string, limit, offset int) ([]Review, int, error) {
+	reviews := []Review{}
+	var total int
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT pr.review_id, au.nickname, pr.rating, pr.review_text, pr.created_at, count(*) OVER()
+		FROM product.review pr
+			JOIN product.product pp ON pp.product_id = pr.product_id
+			JOIN account.user au ON au.user_account = pr.review_account
+		WHERE pp.slug = $1 AND pr.review_state = $2
+		ORDER BY pr.created_at DESC, pr.review_id
+		LIMIT $3 OFFSET $4`,
+		slug, ReviewStatePublished, limit, offset)
+	if err != nil {
+		return reviews, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var review Review
+		var createdAt time.Time
+
+		if err = rows.Scan(&review.ReviewId, &review.Nickname, &review.Rating, &review.ReviewText, &createdAt, &total); err != nil {
+			return reviews, total, err
+		}
+		review.CreatedAt = createdAt.Format(time.DateTime)
+
+		reviews = append(reviews, review)
+	}
+	if err = rows.Err(); err != nil {
+		return reviews, total, err
+	}
+
+	return reviews, total, nil
+}
+
+// CreateReview adds the review of the product waiting for the moderation.
+// NoResults is returned if the product does not exist, NotVerifiedBuyer if the account has not paid for any of its variants
+// or the bundles containing them
+// and QueryExists if the account has already reviewed it.
+func CreateReview(ctx context.Context, pdb *Postgres, accountId, productId string, rating int, reviewText string) (string, error) {
+	var reviewId string
+
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var productExists, verifiedBuyer bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM product.product WHERE product_id = $1),
+				EXISTS (
+					SELECT 1 FROM product.order po
+						JOIN product.content pc ON pc.content_order = po.order_id
+						JOIN product.variant pv ON pv.variant_id IN (pc.content_variant, po.order_variant)
+					WHERE po.order_account = $2 AND po.paid AND pv.product_id = $1
+				)`,
+			productId, accountId).Scan(&productExists, &verifiedBuyer); err != nil {
+			return err
+		}
+		if !productExists {
+			return NoResults
+		} else if !verifiedBuyer {
+			return NotVerifiedBuyer
+		}
+
+		err := tx.QueryRow(ctx,
+			"INSERT INTO product.review(product_id, review_account, rating, review_text) VALUES ($1, $2, $3, $4) ON CONFLICT (product_id, review_account) DO NOTHING RETURNING review_id",
+			productId, accountId, rating, reviewText).Scan(&reviewId)
+		if err == pgx.ErrNoRows {
+			return QueryExists
+		}
+
+		return err
+	})
+
+	return reviewId, err
+}
+
+// UpdateReview changes the non-nil fields of the own review, the changed review is moderated again
+func UpdateReview(ctx context.Context, pdb *Postgres, accountId, reviewId string, rating *int, reviewText *string) error {
+	res, err := pdb.Pool.Exec(ctx,
+		`UPDATE product.review SET
+			rating = COALESCE($3, rating),
+			review_text = COALESCE($4, review_text),
+			review_state = $5,
+			moderation_reason = NULL,
+			moderated_by = NULL,
+			moderated_at = NULL,
+			modified_at = CURRENT_TIMESTAMP
+		WHERE review_id = $1 AND review_account = $2`,
+		reviewId, accountId, rating, reviewText, ReviewStatePending)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return nil
+}
+
+func DeleteReview(ctx context.Context, pdb *Postgres, accountId, reviewId string) error {
+	res, err := pdb.Pool.Exec(ctx,
+		"DELETE FROM product.review WHERE review_id = $1 AND review_account = $2",
+		reviewId, accountId)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() < 1 {
+		return FailedDelete
+	}
+
+	return nil
+}
+
+// GetAdminReviews returns a page of the reviews in the state, the oldest ones go first so the queue is moderated in order
+func GetAdminReviews(ctx context.Context, pdb *Postgres, state, productId string, limit, offset int) ([]AdminReview, int, error) {
+	reviews := []AdminReview{}
+	var total int
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT pr.review_id, pr.product_id, pp.product_name, pr.review_account, au.nickname, pr.rating, pr.review_text,
+			pr.review_state, pr.moderation_reason, pr.moderated_at, pr.created_at, pr.modified_at, count(*) OVER()
+		FROM product.review pr
+			JOIN product.product pp ON pp.product_id = pr.product_id
+			JOIN account.user au ON au.user_account = pr.review_account
+		WHERE ($1 = '' OR pr.review_state = $1) AND ($2 = '' OR pr.product_id::text = $2)
+		ORDER BY pr.created_at, pr.review_id
+		LIMIT $3 OFFSET $4`,
+		state, productId, limit, offset)
+	if err != nil {
+		return reviews, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var review AdminReview
+		var moderatedAt *time.Time
+		var createdAt, modifiedAt time.Time
+
+		if err = rows.Scan(
+			&review.ReviewId,
+			&review.ProductId,
+			&review.ProductName,
+			&review.AccountId,
+			&review.Nickname,
+			&review.Rating,
+			&review.ReviewText,
+			&review.State,
+			&review.ModerationReason,
+			&moderatedAt,
+			&createdAt,
+			&modifiedAt,
+			&total,
+		); err != nil {
+			return reviews, total, err
+		}
+		if moderatedAt != nil {
+			review.ModeratedAt = moderatedAt.Format(time.DateTime)
+		}
+		review.CreatedAt = createdAt.Format(time.DateTime)
+		review.ModifiedAt = modifiedAt.Format(time.DateTime)
+
+		reviews = append(reviews, review)
+	}
+	if err = rows.Err(); err != nil {
+		return reviews, total, err
+	}
+
+	return reviews, total, nil
+}
+
+// UpdateReviewState publishes or rejects the review, the reason of the decision is kept with the review
+func UpdateReviewState(ctx context.Context, pdb *Postgres, moderatorId, reviewId, state, reason string) error {
+	res, err := pdb.Pool.Exec(ctx,
+		"UPDATE product.review SET review_state = $3, moderation_reason = NULLIF($4, ''), moderated_by = $2, moderated_at = CURRENT_TIMESTAMP, modified_at = CURRENT_TIMESTAMP WHERE review_id = $1",
+		reviewId, moderatorId, state, reason)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return nil
+}
+
+func DeleteAdminReview(ctx context.Context, pdb *Postgres, reviewId string) error {
+	res, err := pdb.Pool.Exec(ctx,
+		"DELETE FROM product.review WHERE review_id = $1",
+		reviewId)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() < 1 {
+		return FailedDelete
+	}
+
+	return nil
+}
+
+// GetUserReviews returns all the reviews written by the user in any state
+func GetUserReviews(ctx context.Context, pdb *Postgres, accountId string) ([]UserReview, error) {
+	reviews := []UserReview{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT pr.review_id, pr.product_id, pp.product_name, pr.rating, pr.review_text, pr.review_state,
+			pr.moderation_reason, pr.created_at, pr.modified_at
+		FROM product.review pr
+			JOIN product.product pp ON pp.product_id = pr.product_id
+		WHERE pr.review_account = $1
+		ORDER BY pr.created_at DESC, pr.review_id`,
+		accountId)
+	if err != nil {
+		return reviews, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var review UserReview
+		var createdAt, modifiedAt time.Time
+
+		if err = rows.Scan(
+			&review.ReviewId,
+			&review.ProductId,
+			&review.ProductName,
+			&review.Rating,
+			&review.ReviewText,
+			&review.State,
+			&review.ModerationReason,
+			&createdAt,
+			&modifiedAt,
+		); err != nil {
+			return reviews, err
+		}
+		review.CreatedAt = createdAt.Format(time.DateTime)
+		review.ModifiedAt = modifiedAt.Format(time.DateTime)
+
+		reviews = append(reviews, review)
+	}
+	if err = rows.Err(); err != nil {
+		return reviews, err
+	}
+
+	return reviews, nil
+}
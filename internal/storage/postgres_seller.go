@@ -0,0 +1,517 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Seller is the account selling its own variants. Reserved is the amount of the requested payouts,
+// the seller may request the balance without it.
+type Seller struct {
+	AccountId         string  `json:"account_id"`
+	Nickname          string  `json:"nickname"`
+	Email             *string `json:"email"`
+	CommissionPercent float64 `json:"commission_percent"`
+	Balance           float64 `json:"balance"`
+	Reserved          float64 `json:"reserved"`
+	CreatedAt         string  `json:"created_at"`
+}
+
+type SellerVariant struct {
+	VariantId       string  `json:"variant_id"`
+	ProductName     string  `json:"product_name"`
+	VariantName     string  `json:"variant_name"`
+	Service         string  `json:"service_name"`
+	State           string  `json:"state_name"`
+	TextQuantity    string  `json:"text_quantity"`
+	QuantityCurrent int     `json:"quantity_current"`
+	QuantitySold    int     `json:"quantity_sold"`
+	Price           float64 `json:"price"`
+	FinalPrice      float64 `json:"final_price"`
+}
+
+// SellerSale is the paid order of the seller variant, the buyer is not shown to the seller
+type SellerSale struct {
+	OrderId     string  `json:"order_id"`
+	ProductName string  `json:"product_name"`
+	VariantName string  `json:"variant_name"`
+	Gross       float64 `json:"gross"`
+	Commission  float64 `json:"commission"`
+	Amount      float64 `json:"amount"`
+	PaidAt      string  `json:"paid_at"`
+}
+
+// LedgerEntry is the change of the seller balance: the sale of the order or the approved payout
+type LedgerEntry struct {
+	EntryId    string  `json:"entry_id"`
+	OrderId    *string `json:"order_id"`
+	PayoutId   *string `json:"payout_id"`
+	Gross      float64 `json:"gross"`
+	Commission float64 `json:"commission"`
+	Amount     float64 `json:"amount"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+// SellerStatement is the balance of the seller in the period [from, to) with the entries of the period
+type SellerStatement struct {
+	From           string        `json:"from"`
+	To             string        `json:"to"`
+	OpeningBalance float64       `json:"opening_balance"`
+	Sales          float64       `json:"sales"`
+	Commission     float64       `json:"commission"`
+	Payouts        float64       `json:"payouts"`
+	ClosingBalance float64       `json:"closing_balance"`
+	Entries        []LedgerEntry `json:"entries"`
+}
+
+type SellerPayout struct {
+	PayoutId  string  `json:"payout_id"`
+	SellerId  string  `json:"seller_id"`
+	Nickname  string  `json:"nickname"`
+	Amount    float64 `json:"amount"`
+	Balance   float64 `json:"balance"`
+	State     string  `json:"state"`
+	DecidedBy *string `json:"decided_by"`
+	DecidedAt *string `json:"decided_at"`
+	CreatedAt string  `json:"created_at"`
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func GetSellers(ctx context.Context, pdb *Postgres) ([]Seller, error) {
+	sellers := []Seller{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT s.seller_account, au.nickname, au.email, s.commission_percent::float8,
+			COALESCE((SELECT sum(sl.amount) FROM account.seller_ledger sl WHERE sl.seller_account = s.seller_account), 0)::float8,
+			COALESCE((SELECT sum(sp.amount) FROM account.seller_payout sp WHERE sp.seller_account = s.seller_account AND sp.payout_state = $1), 0)::float8,
+			s.created_at
+		FROM account.seller s JOIN account.user au ON au.user_account = s.seller_account
+		ORDER BY au.nickname`,
+		PayoutStateRequested)
+	if err != nil {
+		return sellers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seller Seller
+		var createdAt time.Time
+
+		if err = rows.Scan(
+			&seller.AccountId,
+			&seller.Nickname,
+			&seller.Email,
+			&seller.CommissionPercent,
+			&seller.Balance,
+			&seller.Reserved,
+			&createdAt,
+		); err != nil {
+			return sellers, err
+		}
+		seller.Balance = roundMoney(seller.Balance)
+		seller.Reserved = roundMoney(seller.Reserved)
+		seller.CreatedAt = createdAt.Format(time.DateTime)
+
+		sellers = append(sellers, seller)
+	}
+	if err = rows.Err(); err != nil {
+		return sellers, err
+	}
+
+	return sellers, nil
+}
+
+// CreateSeller turns the user account into the seller, the empty commission is the default one.
+// FailedUpdate is returned if the account is not a user.
+func CreateSeller(ctx context.Context, pdb *Postgres, accountId, commissionPercent string) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx,
+			`UPDATE account.account SET account_role = (SELECT role_no FROM account.role WHERE role_name = $2), modified_at = CURRENT_TIMESTAMP
+			WHERE account_id = $1 AND account_role = (SELECT role_no FROM account.role WHERE role_name = $3)
+				AND EXISTS (SELECT 1 FROM account.user WHERE user_account = $1)`,
+			accountId, AccountRoleSeller, AccountRoleUser)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedUpdate
+		}
+
+		if commissionPercent == "" {
+			_, err = tx.Exec(ctx, "INSERT INTO account.seller(seller_account) VALUES ($1)", accountId)
+		} else {
+			_, err = tx.Exec(ctx,
+				"INSERT INTO account.seller(seller_account, commission_percent) VALUES ($1, $2::numeric)",
+				accountId, commissionPercent)
+		}
+		return err
+	})
+}
+
+// UpdateSeller changes the commission of the seller, it applies to the orders paid after the change.
+// FailedUpdate is returned if the seller does not exist.
+func UpdateSeller(ctx context.Context, pdb *Postgres, accountId, commissionPercent string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		"UPDATE account.seller SET commission_percent = $2::numeric, modified_at = CURRENT_TIMESTAMP WHERE seller_account = $1",
+		accountId, commissionPercent)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return nil
+}
+
+func CheckSeller(ctx context.Context, pdb *Postgres, accountId string) (bool, error) {
+	var exists bool
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM account.seller WHERE seller_account = $1)",
+		accountId).Scan(&exists)
+
+	return exists, err
+}
+
+// SetVariantOwner gives the variant to the seller or back to the shop. VariantOwnerStock is returned while the variant
+// has the free content, the content reserved by the unpaid orders or the paid orders awaiting the content,
+// FailedUpdate is returned if the variant does not exist.
+func SetVariantOwner(ctx context.Context, pdb *Postgres, variantId, accountId string) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var ownerId string
+		var hasStock bool
+		err := tx.QueryRow(ctx,
+			`SELECT pv.variant_account,
+				EXISTS (SELECT 1 FROM product.content pc LEFT JOIN product.order po ON po.order_id = pc.content_order
+					WHERE pc.content_variant = pv.variant_id AND (pc.content_order IS NULL OR NOT po.paid))
+				OR EXISTS (SELECT 1 FROM product.order po WHERE po.order_variant = pv.variant_id AND po.paid AND po.awaiting_content)
+			FROM product.variant pv WHERE pv.variant_id = $1 FOR UPDATE OF pv`,
+			variantId).Scan(&ownerId, &hasStock)
+		if err == pgx.ErrNoRows {
+			return FailedUpdate
+		} else if err != nil {
+			return err
+		}
+
+		if ownerId == accountId {
+			return nil
+		} else if hasStock {
+			return VariantOwnerStock
+		}
+
+		_, err = tx.Exec(ctx,
+			"UPDATE product.variant SET variant_account = $2, modified_at = CURRENT_TIMESTAMP WHERE variant_id = $1",
+			variantId, accountId)
+		return err
+	})
+}
+
+// recordSellerSale credits the seller of the paid order with its price without the commission,
+// nothing is recorded for the variants of the shop
+func recordSellerSale(ctx context.Context, tx pgx.Tx, orderId string) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO account.seller_ledger(seller_account, entry_order, gross, commission, amount)
+		SELECT s.seller_account, po.order_id, po.price, c.commission, po.price - c.commission
+		FROM product.order po
+			JOIN product.variant pv ON pv.variant_id = po.order_variant
+			JOIN account.seller s ON s.seller_account = pv.variant_account,
+			LATERAL (SELECT round(po.price * s.commission_percent / 100, 2) AS commission) c
+		WHERE po.order_id = $1`,
+		orderId)
+
+	return err
+}
+
+// GetSellerVariants returns the variants of the seller only
+func GetSellerVariants(ctx context.Context, pdb *Postgres, sellerId string) ([]SellerVariant, error) {
+	variants := []SellerVariant{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT m.variant_id, m.product_name, m.variant_name, m.service_name, m.state_name, m.text_quantity,
+			m.quantity_current, m.quantity_sold, m.price, m.final_price
+		FROM product.product_variants_live m JOIN product.variant pv ON pv.variant_id = m.variant_id
+		WHERE pv.variant_account = $1
+		ORDER BY m.product_name, m.variant_name`,
+		sellerId)
+	if err != nil {
+		return variants, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variant SellerVariant
+
+		if err = rows.Scan(
+			&variant.VariantId,
+			&variant.ProductName,
+			&variant.VariantName,
+			&variant.Service,
+			&variant.State,
+			&variant.TextQuantity,
+			&variant.QuantityCurrent,
+			&variant.QuantitySold,
+			&variant.Price,
+			&variant.FinalPrice,
+		); err != nil {
+			return variants, err
+		}
+
+		variants = append(variants, variant)
+	}
+	if err = rows.Err(); err != nil {
+		return variants, err
+	}
+
+	return variants, nil
+}
+
+// CheckSellerVariant reports whether the variant belongs to the seller
+func CheckSellerVariant(ctx context.Context, pdb *Postgres, sellerId, variantId string) (bool, error) {
+	var exists bool
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM product.variant WHERE variant_id = $1 AND variant_account = $2)",
+		variantId, sellerId).Scan(&exists)
+
+	return exists, err
+}
+
+// CheckSellerContent reports whether the content belongs to the variant of the seller
+func CheckSellerContent(ctx context.Context, pdb *Postgres, sellerId, contentId string) (bool, error) {
+	var exists bool
+
+	err := pdb.Pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM product.content pc JOIN product.variant pv ON pv.variant_id = pc.content_variant WHERE pc.content_id = $1 AND pv.variant_account = $2)",
+		contentId, sellerId).Scan(&exists)
+
+	return exists, err
+}
+
+// GetSellerSales returns the sales of the seller in the period [from, to)
+func GetSellerSales(ctx context.Context, pdb *Postgres, sellerId, from, to string) ([]SellerSale, error) {
+	sales := []SellerSale{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT po.order_id, pp.product_name, pv.variant_name, sl.gross::float8, sl.commission::float8, sl.amount::float8, po.paid_at
+		FROM account.seller_ledger sl
+			JOIN product.order po ON po.order_id = sl.entry_order
+			JOIN product.variant pv ON pv.variant_id = po.order_variant
+			JOIN product.product pp ON pp.product_id = pv.product_id
+		WHERE sl.seller_account = $1 AND sl.created_at >= $2::timestamp AND sl.created_at < $3::timestamp
+		ORDER BY sl.created_at DESC`,
+		sellerId, from, to)
+	if err != nil {
+		return sales, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sale SellerSale
+		var paidAt time.Time
+
+		if err = rows.Scan(
+			&sale.OrderId,
+			&sale.ProductName,
+			&sale.VariantName,
+			&sale.Gross,
+			&sale.Commission,
+			&sale.Amount,
+			&paidAt,
+		); err != nil {
+			return sales, err
+		}
+		sale.PaidAt = paidAt.Format(time.DateTime)
+
+		sales = append(sales, sale)
+	}
+	if err = rows.Err(); err != nil {
+		return sales, err
+	}
+
+	return sales, nil
+}
+
+// newSellerStatement sums the entries of the period, the payouts are shown as the positive amount
+func newSellerStatement(from, to string, openingBalance float64, entries []LedgerEntry) SellerStatement {
+	statement := SellerStatement{From: from, To: to, OpeningBalance: roundMoney(openingBalance), Entries: entries}
+
+	closing := statement.OpeningBalance
+	for _, entry := range entries {
+		if entry.PayoutId != nil {
+			statement.Payouts -= entry.Amount
+		} else {
+			statement.Sales += entry.Gross
+			statement.Commission += entry.Commission
+		}
+		closing += entry.Amount
+	}
+	statement.Sales = roundMoney(statement.Sales)
+	statement.Commission = roundMoney(statement.Commission)
+	statement.Payouts = roundMoney(statement.Payouts)
+	statement.ClosingBalance = roundMoney(closing)
+
+	return statement
+}
+
+// GetSellerStatement returns the balance statement of the seller in the period [from, to)
+func GetSellerStatement(ctx context.Context, pdb *Postgres, sellerId, from, to string) (SellerStatement, error) {
+	var openingBalance float64
+	if err := pdb.Pool.QueryRow(ctx,
+		"SELECT COALESCE(sum(amount), 0)::float8 FROM account.seller_ledger WHERE seller_account = $1 AND created_at < $2::timestamp",
+		sellerId, from).Scan(&openingBalance); err != nil {
+		return SellerStatement{}, err
+	}
+
+	entries := []LedgerEntry{}
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT entry_id, entry_order, entry_payout, gross::float8, commission::float8, amount::float8, created_at
+		FROM account.seller_ledger
+		WHERE seller_account = $1 AND created_at >= $2::timestamp AND created_at < $3::timestamp
+		ORDER BY created_at, entry_id`,
+		sellerId, from, to)
+	if err != nil {
+		return SellerStatement{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry LedgerEntry
+		var createdAt time.Time
+
+		if err = rows.Scan(
+			&entry.EntryId,
+			&entry.OrderId,
+			&entry.PayoutId,
+			&entry.Gross,
+			&entry.Commission,
+			&entry.Amount,
+			&createdAt,
+		); err != nil {
+			return SellerStatement{}, err
+		}
+		entry.CreatedAt = createdAt.Format(time.DateTime)
+
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return SellerStatement{}, err
+	}
+
+	return newSellerStatement(from, to, openingBalance, entries), nil
+}
+
+// CreatePayout requests the payout of the seller balance, the balance at the request time is kept with the request.
+// InsufficientBalance is returned if the amount exceeds the balance without the payouts requested earlier.
+func CreatePayout(ctx context.Context, pdb *Postgres, sellerId, amount string) (string, error) {
+	var payoutId string
+
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		// The requests of the seller are serialized, so they can not reserve the same balance twice
+		err := tx.QueryRow(ctx,
+			"SELECT seller_account FROM account.seller WHERE seller_account = $1 FOR UPDATE",
+			sellerId).Scan(&sellerId)
+		if err == pgx.ErrNoRows {
+			return NoResults
+		} else if err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(ctx,
+			`INSERT INTO account.seller_payout(seller_account, amount, balance)
+			SELECT $1, $2::numeric, b.balance
+			FROM (SELECT
+				COALESCE((SELECT sum(amount) FROM account.seller_ledger WHERE seller_account = $1), 0) AS balance,
+				COALESCE((SELECT sum(amount) FROM account.seller_payout WHERE seller_account = $1 AND payout_state = $3), 0) AS reserved) b
+			WHERE b.balance - b.reserved >= $2::numeric
+			RETURNING payout_id`,
+			sellerId, amount, PayoutStateRequested).Scan(&payoutId)
+		if err == pgx.ErrNoRows {
+			return InsufficientBalance
+		}
+		return err
+	})
+
+	return payoutId, err
+}
+
+// GetPayouts returns the payouts of the seller or of all the sellers if the seller is empty, the empty state means any state
+func GetPayouts(ctx context.Context, pdb *Postgres, sellerId, state string) ([]SellerPayout, error) {
+	payouts := []SellerPayout{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT sp.payout_id, sp.seller_account, au.nickname, sp.amount::float8, sp.balance::float8, sp.payout_state,
+			sp.decided_by, sp.decided_at, sp.created_at
+		FROM account.seller_payout sp JOIN account.user au ON au.user_account = sp.seller_account
+		WHERE ($1 = '' OR sp.seller_account = NULLIF($1, '')::uuid) AND ($2 = '' OR sp.payout_state = $2)
+		ORDER BY sp.created_at DESC`,
+		sellerId, state)
+	if err != nil {
+		return payouts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var payout SellerPayout
+		var decidedAt *time.Time
+		var createdAt time.Time
+
+		if err = rows.Scan(
+			&payout.PayoutId,
+			&payout.SellerId,
+			&payout.Nickname,
+			&payout.Amount,
+			&payout.Balance,
+			&payout.State,
+			&payout.DecidedBy,
+			&decidedAt,
+			&createdAt,
+		); err != nil {
+			return payouts, err
+		}
+		if decidedAt != nil {
+			formatted := decidedAt.Format(time.DateTime)
+			payout.DecidedAt = &formatted
+		}
+		payout.CreatedAt = createdAt.Format(time.DateTime)
+
+		payouts = append(payouts, payout)
+	}
+	if err = rows.Err(); err != nil {
+		return payouts, err
+	}
+
+	return payouts, nil
+}
+
+// DecidePayout approves or rejects the requested payout, the approved one is debited from the seller balance.
+// FailedUpdate is returned if the payout does not exist or has already been decided.
+func DecidePayout(ctx context.Context, pdb *Postgres, payoutId, employeeId string, approve bool) error {
+	state := PayoutStateRejected
+	if approve {
+		state = PayoutStateApproved
+	}
+
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		res, err := tx.Exec(ctx,
+			`UPDATE account.seller_payout SET payout_state = $2, decided_by = $3, decided_at = CURRENT_TIMESTAMP, modified_at = CURRENT_TIMESTAMP
+			WHERE payout_id = $1 AND payout_state = $4`,
+			payoutId, state, employeeId, PayoutStateRequested)
+		if err != nil {
+			return err
+		} else if res.RowsAffected() < 1 {
+			return FailedUpdate
+		}
+
+		if approve {
+			_, err = tx.Exec(ctx,
+				"INSERT INTO account.seller_ledger(seller_account, entry_payout, gross, amount) SELECT seller_account, payout_id, -amount, -amount FROM account.seller_payout WHERE payout_id = $1",
+				payoutId)
+		}
+		return err
+	})
+}
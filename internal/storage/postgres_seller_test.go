@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSellerStatement(t *testing.T) {
+	orderId := "3f0c1b4e-7a51-4f0e-9a57-6f2a2d1c9e10"
+	payoutId := "9d8e7f6a-5b4c-4d3e-8f2a-1b0c9d8e7f6a"
+	entries := []LedgerEntry{
+		{OrderId: &orderId, Gross: 10.10, Commission: 1.01, Amount: 9.09},
+		{OrderId: &orderId, Gross: 20.20, Commission: 2.02, Amount: 18.18},
+		{PayoutId: &payoutId, Gross: -15, Amount: -15},
+	}
+
+	statement := newSellerStatement("2026-01-01 00:00:00", "2026-02-01 00:00:00", 5.005, entries)
+
+	assert.Equal(t, 5.01, statement.OpeningBalance)
+	assert.Equal(t, 30.3, statement.Sales)
+	assert.Equal(t, 3.03, statement.Commission)
+	assert.Equal(t, 15.0, statement.Payouts)
+	assert.Equal(t, 17.28, statement.ClosingBalance)
+	assert.Len(t, statement.Entries, 3)
+}
+
+func TestNewSellerStatementWithoutEntries(t *testing.T) {
+	statement := newSellerStatement("2026-01-01 00:00:00", "2026-02-01 00:00:00", 12.5, []LedgerEntry{})
+
+	assert.Equal(t, 12.5, statement.OpeningBalance)
+	assert.Equal(t, 12.5, statement.ClosingBalance)
+	assert.Zero(t, statement.Sales)
+	assert.Zero(t, statement.Payouts)
+	assert.NotNil(t, statement.Entries)
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Supplier is the record of the supplier of the uploaded content, the batches of the content refer to it
+type Supplier struct {
+	SupplierNo   int     `json:"supplier_no"`
+	SupplierName string  `json:"supplier_name"`
+	Contact      *string `json:"contact"`
+	CreatedAt    string  `json:"created_at"`
+	ModifiedAt   string  `json:"modified_at"`
+	Commentary   *string `json:"commentary"`
+}
+
+func GetSuppliers(ctx context.Context, pdb *Postgres) ([]Supplier, error) {
+	suppliers := []Supplier{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		"SELECT supplier_no, supplier_name, contact, created_at, modified_at, commentary FROM product.supplier ORDER BY supplier_name")
+	if err != nil {
+		return suppliers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var supplier Supplier
+		var createdAt, modifiedAt time.Time
+
+		if err = rows.Scan(
+			&supplier.SupplierNo,
+			&supplier.SupplierName,
+			&supplier.Contact,
+			&createdAt,
+			&modifiedAt,
+			&supplier.Commentary,
+		); err != nil {
+			return suppliers, err
+		}
+		supplier.CreatedAt = createdAt.Format(time.DateTime)
+		supplier.ModifiedAt = modifiedAt.Format(time.DateTime)
+
+		suppliers = append(suppliers, supplier)
+	}
+	if err = rows.Err(); err != nil {
+		return suppliers, err
+	}
+
+	return suppliers, nil
+}
+
+// CreateSupplier adds the supplier, the empty contact is not saved
+func CreateSupplier(ctx context.Context, pdb *Postgres, supplierName, contact string) error {
+	_, err := pdb.Pool.Exec(ctx,
+		"INSERT INTO product.supplier(supplier_name, contact) VALUES ($1, NULLIF($2, ''))",
+		supplierName, contact)
+
+	return err
+}
+
+// UpdateSupplier changes the name and the contact of the supplier, the nil values are not changed and the empty contact is cleared.
+// FailedUpdate is returned if the supplier does not exist.
+func UpdateSupplier(ctx context.Context, pdb *Postgres, supplierName string, newName, contact *string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		`UPDATE product.supplier SET supplier_name = COALESCE($2, supplier_name),
+			contact = CASE WHEN $3::text IS NULL THEN contact ELSE NULLIF($3, '') END, modified_at = CURRENT_TIMESTAMP
+		WHERE lower(supplier_name) = lower($1)`,
+		supplierName, newName, contact)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedUpdate
+	}
+
+	return nil
+}
+
+// DeleteSupplier deletes the supplier without the batches, the foreign key error is returned otherwise
+func DeleteSupplier(ctx context.Context, pdb *Postgres, supplierName string) error {
+	result, err := pdb.Pool.Exec(ctx,
+		"DELETE FROM product.supplier WHERE lower(supplier_name) = lower($1)",
+		supplierName)
+	if err != nil {
+		return err
+	} else if result.RowsAffected() < 1 {
+		return FailedDelete
+	}
+
+	return nil
+}
+
+// SupplierOrder is the paid order awaiting the content from the supplier of its variant.
+// FirstAttempt is set until the supplier is called for the order for the first time.
+type SupplierOrder struct {
+	OrderId      string
+	Supplier     string
+	Sku          string
+	FirstAttempt bool
+}
+
+// ClaimSupplierOrders claims up to the limit of the paid orders awaiting the content from the suppliers, the oldest payments first.
+// The claim lasts for SupplierClaimTimeout, so the orders of the stopped instance are taken by the others after it.
+func ClaimSupplierOrders(ctx context.Context, pdb *Postgres, limit int) ([]SupplierOrder, error) {
+	orders := []SupplierOrder{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`WITH due AS (
+			SELECT po.order_id, po.supplier_claimed_at IS NULL AS first_attempt
+			FROM product.order po
+				JOIN product.variant pv ON pv.variant_id = po.order_variant
+			WHERE po.paid AND po.awaiting_content AND pv.variant_supplier IS NOT NULL
+				AND (po.supplier_claimed_at IS NULL OR po.supplier_claimed_at < CURRENT_TIMESTAMP - make_interval(secs => $1))
+			ORDER BY po.paid_at
+			LIMIT $2
+			FOR UPDATE OF po SKIP LOCKED
+		), claimed AS (
+			UPDATE product.order po SET supplier_claimed_at = CURRENT_TIMESTAMP
+			FROM due WHERE po.order_id = due.order_id
+			RETURNING po.order_id, po.order_variant, po.paid_at, due.first_attempt
+		)
+		SELECT c.order_id, pv.variant_supplier, pv.supplier_sku, c.first_attempt
+		FROM claimed c
+			JOIN product.variant pv ON pv.variant_id = c.order_variant
+		ORDER BY c.paid_at`,
+		SupplierClaimTimeout.Seconds(), limit)
+	if err != nil {
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order SupplierOrder
+		if err = rows.Scan(&order.OrderId, &order.Supplier, &order.Sku, &order.FirstAttempt); err != nil {
+			return orders, err
+		}
+
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		return orders, err
+	}
+
+	return orders, nil
+}
+
+// ReleaseSupplierOrders returns the claimed orders to the queue at once, the orders keep their FirstAttempt
+func ReleaseSupplierOrders(ctx context.Context, pdb *Postgres, orders []SupplierOrder) error {
+	orderIds := make([]string, 0, len(orders))
+	firstAttempts := make([]bool, 0, len(orders))
+	for _, order := range orders {
+		orderIds = append(orderIds, order.OrderId)
+		firstAttempts = append(firstAttempts, order.FirstAttempt)
+	}
+
+	_, err := pdb.Pool.Exec(ctx,
+		`UPDATE product.order po
+		SET supplier_claimed_at = CASE WHEN released.first_attempt THEN NULL ELSE CURRENT_TIMESTAMP - make_interval(secs => $3) END
+		FROM unnest($1::uuid[], $2::bool[]) AS released(order_id, first_attempt)
+		WHERE po.order_id = released.order_id`,
+		orderIds, firstAttempts, SupplierClaimTimeout.Seconds())
+
+	return err
+}
+
+// requestSupplierOrders wakes up the supplier fulfiller of this instance after an order awaiting the content is paid
+func requestSupplierOrders(pdb *Postgres) {
+	select {
+	case pdb.supplierOrders <- struct{}{}:
+	default:
+		// A run is already pending
+	}
+}
+
+// SupplierOrderSignals returns the channel signalled by the payments of the orders awaiting the content
+func (pdb *Postgres) SupplierOrderSignals() <-chan struct{} {
+	return pdb.supplierOrders
+}
+
+// LinkSuppliers adds the records of the suppliers of the config, so their minted content is accounted like the uploads
+func LinkSuppliers(ctx context.Context, pdb *Postgres, supplierNames []string) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		for _, supplierName := range supplierNames {
+			if _, err := linkSupplier(ctx, tx, supplierName); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// linkSupplier returns the record of the supplier of the config, the missing record is added
+func linkSupplier(ctx context.Context, tx pgx.Tx, supplierName string) (int, error) {
+	var supplierNo int
+
+	err := tx.QueryRow(ctx,
+		`WITH added AS (
+			INSERT INTO product.supplier(supplier_name) VALUES ($1)
+			ON CONFLICT ((lower(supplier_name))) DO NOTHING
+			RETURNING supplier_no
+		)
+		SELECT supplier_no FROM added
+		UNION ALL
+		SELECT supplier_no FROM product.supplier WHERE lower(supplier_name) = lower($1)
+		LIMIT 1`,
+		supplierName).Scan(&supplierNo)
+
+	return supplierNo, err
+}
+
+// FulfilSupplierOrder saves the content minted by the supplier for the order and returns the fulfilled orders.
+// The content gets a batch of its own with the supplier and the cost price of the variant, the batch belongs to
+// the owner of the variant like the uploads. If the order was fulfilled by an upload meanwhile, the minted content
+// is not lost: it goes to the pool of the variant and fulfils the next awaiting order if there is one.
+// NoResults is returned if the order does not exist.
+func FulfilSupplierOrder(ctx context.Context, pdb *Postgres, orderId, content, supplierName string) ([]string, error) {
+	var fulfilled []string
+
+	err := execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var variantId string
+		var awaiting bool
+		err := tx.QueryRow(ctx,
+			"SELECT order_variant, paid AND awaiting_content FROM product.order WHERE order_id = $1 FOR UPDATE",
+			orderId).Scan(&variantId, &awaiting)
+		if err == pgx.ErrNoRows {
+			return NoResults
+		} else if err != nil {
+			return err
+		}
+
+		supplierNo, err := linkSupplier(ctx, tx, supplierName)
+		if err != nil {
+			return err
+		}
+		var batchId string
+		if err = tx.QueryRow(ctx,
+			`INSERT INTO product.content_batch(batch_variant, batch_supplier, cost_price, quantity, batch_account)
+			SELECT variant_id, $2, supplier_cost, 1, variant_account FROM product.variant WHERE variant_id = $1
+			RETURNING batch_id`,
+			variantId, supplierNo).Scan(&batchId); err != nil {
+			return err
+		}
+
+		if awaiting {
+			if _, err = tx.Exec(ctx,
+				"UPDATE product.order SET awaiting_content = false, fulfilled_at = CURRENT_TIMESTAMP, modified_at = CURRENT_TIMESTAMP WHERE order_id = $1",
+				orderId); err != nil {
+				return err
+			}
+			if _, err = tx.Exec(ctx,
+				"INSERT INTO product.content (content_variant, content_order, content_batch, data, commentary) VALUES ($1, $2, $3, $4, $5)",
+				variantId, orderId, batchId, content, "supplier: "+supplierName); err != nil {
+				return err
+			}
+			fulfilled = []string{orderId}
+			return nil
+		}
+
+		if _, err = tx.Exec(ctx,
+			"INSERT INTO product.content (content_variant, content_batch, data, commentary) VALUES ($1, $2, $3, $4)",
+			variantId, batchId, content, "supplier: "+supplierName); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(ctx,
+			"UPDATE product.variant SET quantity_current = quantity_current + 1 WHERE variant_id = $1",
+			variantId); err != nil {
+			return err
+		}
+		fulfilled, err = fulfilPreorders(ctx, tx, variantId)
+		return err
+	})
+
+	return fulfilled, err
+}
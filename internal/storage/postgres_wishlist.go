@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+type WishlistItem struct {
+	VariantId   string   `json:"variant_id"`
+	ProductName string   `json:"product_name"`
+	Slug        string   `json:"slug"`
+	VariantName string   `json:"variant_name"`
+	Service     string   `json:"service"`
+	State       string   `json:"state"`
+	FinalPrice  *float64 `json:"final_price"`
+	InStock     bool     `json:"in_stock"`
+	Notify      bool     `json:"notify"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+// StockNotice is the variant back in stock for the subscribed account
+type StockNotice struct {
+	AccountId   string
+	Email       string
+	Nickname    string
+	VariantId   string
+	ProductName string
+	VariantName string
+	Slug        string
+}
+
+// GetWishlist returns the visible variants of the wishlist, the latest added go first
+func GetWishlist(ctx context.Context, pdb *Postgres, accountId string) ([]WishlistItem, error) {
+	items := []WishlistItem{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`SELECT pw.variant_id, m.product_name, m.product_slug, m.variant_name, m.service_name, m.state_name,
+			CASE WHEN m.state_name = $2 THEN NULL ELSE m.final_price::float8 END,
+			m.state_name = $3 AND m.quantity_current > 0, pw.notify, pw.created_at
+		FROM product.wishlist pw
+			JOIN product.product_variants_live m ON m.variant_id = pw.variant_id
+		WHERE pw.account_id = $1 AND m.state_name <> ALL ($4)
+		ORDER BY pw.created_at DESC, pw.variant_id`,
+		accountId, ProductStateUnavailableWithoutPrice, ProductStateActive, []string{ProductStateInvisible, ProductStateDeleted})
+	if err != nil {
+		return items, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item WishlistItem
+		var createdAt time.Time
+
+		if err = rows.Scan(
+			&item.VariantId,
+			&item.ProductName,
+			&item.Slug,
+			&item.VariantName,
+			&item.Service,
+			&item.State,
+			&item.FinalPrice,
+			&item.InStock,
+			&item.Notify,
+			&createdAt,
+		); err != nil {
+			return items, err
+		}
+		item.CreatedAt = createdAt.Format(time.DateTime)
+
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return items, err
+	}
+
+	return items, nil
+}
+
+// UpdateWishlistItem adds the visible variant to the wishlist or changes its notify flag.
+// NoResults is returned if the variant is not visible. The back in stock notice can not be requested
+// for the variant which can be bought now, FailedUpdate is returned then.
+func UpdateWishlistItem(ctx context.Context, pdb *Postgres, accountId, variantId string, notify bool) error {
+	return execInTx(ctx, pdb.Pool, func(tx pgx.Tx) error {
+		var available bool
+		err := tx.QueryRow(ctx,
+			`SELECT ps.state_name = $2 AND vs.quantity_current > 0
+			FROM product.variant pv
+				JOIN product.state ps ON ps.state_no = pv.variant_state
+				JOIN product.variant_stock vs ON vs.variant_id = pv.variant_id
+			WHERE pv.variant_id = $1 AND ps.state_name <> ALL ($3)`,
+			variantId, ProductStateActive, []string{ProductStateInvisible, ProductStateDeleted}).Scan(&available)
+		if err == pgx.ErrNoRows {
+			return NoResults
+		} else if err != nil {
+			return err
+		}
+		if notify && available {
+			return FailedUpdate
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO product.wishlist(account_id, variant_id, notify) VALUES ($1, $2, $3)
+			ON CONFLICT (account_id, variant_id) DO UPDATE SET notify = EXCLUDED.notify, notified_at = NULL, modified_at = CURRENT_TIMESTAMP`,
+			accountId, variantId, notify)
+
+		return err
+	})
+}
+
+func DeleteWishlistItem(ctx context.Context, pdb *Postgres, accountId, variantId string) error {
+	res, err := pdb.Pool.Exec(ctx,
+		"DELETE FROM product.wishlist WHERE account_id = $1 AND variant_id = $2",
+		accountId, variantId)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() < 1 {
+		return FailedDelete
+	}
+
+	return nil
+}
+
+// ClaimStockNotices marks up to the limit of the pending notices of the variants back in stock as sent and returns them
+// ordered by the account. The rows are skipped while another instance holds them, so every notice is claimed once.
+// Only the active accounts with an e-mail are notified.
+func ClaimStockNotices(ctx context.Context, pdb *Postgres, limit int) ([]StockNotice, error) {
+	notices := []StockNotice{}
+
+	rows, err := pdb.Pool.Query(ctx,
+		`WITH due AS (
+			SELECT pw.account_id, pw.variant_id
+			FROM product.wishlist pw
+				JOIN product.variant pv ON pv.variant_id = pw.variant_id
+				JOIN product.variant_stock vs ON vs.variant_id = pw.variant_id
+				JOIN product.state ps ON ps.state_no = pv.variant_state
+				JOIN account.account aa ON aa.account_id = pw.account_id
+				JOIN account.state ast ON ast.state_no = aa.account_state
+				JOIN account.user au ON au.user_account = pw.account_id
+			WHERE pw.notify AND pw.notified_at IS NULL AND vs.quantity_current > 0 AND ps.state_name = $1
+				AND ast.state_name = $2 AND au.email IS NOT NULL
+			ORDER BY pw.account_id, pw.created_at
+			LIMIT $3
+			FOR UPDATE OF pw SKIP LOCKED
+		), claimed AS (
+			UPDATE product.wishlist pw SET notified_at = CURRENT_TIMESTAMP
+			FROM due WHERE pw.account_id = due.account_id AND pw.variant_id = due.variant_id
+			RETURNING pw.account_id, pw.variant_id
+		)
+		SELECT c.account_id, au.email, au.nickname, c.variant_id, pp.product_name, pv.variant_name, pp.slug
+		FROM claimed c
+			JOIN account.user au ON au.user_account = c.account_id
+			JOIN product.variant pv ON pv.variant_id = c.variant_id
+			JOIN product.product pp ON pp.product_id = pv.product_id
+		ORDER BY c.account_id, pp.product_name, pv.variant_name`,
+		ProductStateActive, AccountStateActive, limit)
+	if err != nil {
+		return notices, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notice StockNotice
+		if err = rows.Scan(
+			&notice.AccountId,
+			&notice.Email,
+			&notice.Nickname,
+			&notice.VariantId,
+			&notice.ProductName,
+			&notice.VariantName,
+			&notice.Slug,
+		); err != nil {
+			return notices, err
+		}
+		notices = append(notices, notice)
+	}
+	if err = rows.Err(); err != nil {
+		return notices, err
+	}
+
+	return notices, nil
+}
+
+// ReleaseStockNotices returns the claimed notices which were not sent, so they are claimed again by the next run
+func ReleaseStockNotices(ctx context.Context, pdb *Postgres, notices []StockNotice) error {
+	accountIds := make([]string, 0, len(notices))
+	variantIds := make([]string, 0, len(notices))
+	for _, notice := range notices {
+		accountIds = append(accountIds, notice.AccountId)
+		variantIds = append(variantIds, notice.VariantId)
+	}
+
+	_, err := pdb.Pool.Exec(ctx,
+		`UPDATE product.wishlist pw SET notified_at = NULL
+		FROM unnest($1::uuid[], $2::uuid[]) AS released(account_id, variant_id)
+		WHERE pw.account_id = released.account_id AND pw.variant_id = released.variant_id`,
+		accountIds, variantIds)
+
+	return err
+}
+
+// requestStockNotices wakes up the stock notifier of this instance after the stock or the state of a variant is changed
+func requestStockNotices(pdb *Postgres) {
+	select {
+	case pdb.stockNotices <- struct{}{}:
+	default:
+		// A run is already pending
+	}
+}
+
+// StockNoticeSignals returns the channel signalled by the changes which may bring the variants back in stock
+func (pdb *Postgres) StockNoticeSignals() <-chan struct{} {
+	return pdb.stockNotices
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,8 +17,17 @@ import (
 // For deleting a record: Delete<Type>
 
 const (
-	BlockedTokenPath     = "jwt_stoplist:"
-	TempRegistrationPath = "registration_temp_data:"
+	BlockedTokenPath         = "jwt_stoplist:"
+	TempRegistrationPath     = "registration_temp_data:"
+	OAuthStatePath           = "oauth_state:"
+	LoginFailuresPath        = "login_failures:"
+	LoginLockPath            = "login_lock:"
+	TempEmailChangePath      = "email_change_temp:"
+	TokensRevocationPath     = "jwt_revoked_before:"
+	TempAccountDeletionPath  = "account_deletion_temp:"
+	TempPasswordRecoveryPath = "password_recovery_temp:"
+	CatalogCachePath         = "catalog_cache:"
+	CatalogCacheStatePath    = "catalog_cache_state"
 )
 
 func CreateBlockedToken(ctx context.Context, rdb *Redis, token string, expiration time.Duration) error {
@@ -101,3 +111,274 @@ func DeleteTempRegistration(ctx context.Context, rdb *Redis, confirmationToken s
 
 	return err
 }
+
+func CreateOAuthState(ctx context.Context, rdb *Redis, state, provider, accountUuid string, expiration time.Duration) error {
+	exists, err := rdb.Client.Exists(ctx, OAuthStatePath+state).Result()
+	if err != nil {
+		return err
+	} else if exists > 0 {
+		return QueryExists
+	}
+
+	err = execInPipeline(ctx, rdb.Client, func(pipe redis.Pipeliner) error {
+		if err = pipe.HSet(ctx, OAuthStatePath+state, "provider", provider, "account", accountUuid).Err(); err != nil {
+			return err
+		}
+
+		err = pipe.Expire(ctx, OAuthStatePath+state, expiration).Err()
+		return err
+	})
+
+	return err
+}
+
+// GetOAuthState returns the provider and the account bound to the state and removes the state, so it can be used only once.
+// The state is read and removed in one transaction, NoResults is returned to every caller but the one which removed it.
+func GetOAuthState(ctx context.Context, rdb *Redis, state string) (string, string, error) {
+	var data *redis.MapStringStringCmd
+	var del *redis.IntCmd
+
+	err := execInPipeline(ctx, rdb.Client, func(pipe redis.Pipeliner) error {
+		data = pipe.HGetAll(ctx, OAuthStatePath+state)
+		del = pipe.Del(ctx, OAuthStatePath+state)
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if del.Val() != 1 || len(data.Val()) == 0 {
+		return "", "", NoResults
+	}
+
+	return data.Val()["provider"], data.Val()["account"], nil
+}
+
+// CreateLoginFailure increments the failed login attempts counter and returns the number of failures within the window
+func CreateLoginFailure(ctx context.Context, rdb *Redis, key string, window time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+
+	err := execInPipeline(ctx, rdb.Client, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, LoginFailuresPath+key)
+		return pipe.ExpireNX(ctx, LoginFailuresPath+key, window).Err()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+func CreateLoginLock(ctx context.Context, rdb *Redis, key string, expiration time.Duration) error {
+	return rdb.Client.Set(ctx, LoginLockPath+key, time.Now().Add(expiration).Format(time.RFC3339), expiration).Err()
+}
+
+// CheckLoginLockExists returns the remaining lock time or zero if the key is not locked
+func CheckLoginLockExists(ctx context.Context, rdb *Redis, key string) (time.Duration, error) {
+	ttl, err := rdb.Client.TTL(ctx, LoginLockPath+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+func DeleteLoginFailures(ctx context.Context, rdb *Redis, key string) error {
+	return rdb.Client.Del(ctx, LoginFailuresPath+key, LoginLockPath+key).Err()
+}
+
+type LoginLock struct {
+	Key         string `json:"key"`
+	Failures    int64  `json:"failures"`
+	LockedUntil string `json:"locked_until"`
+}
+
+func GetLoginLocks(ctx context.Context, rdb *Redis) ([]LoginLock, error) {
+	locks := []LoginLock{}
+
+	iter := rdb.Client.Scan(ctx, 0, LoginLockPath+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := strings.TrimPrefix(iter.Val(), LoginLockPath)
+
+		until, err := rdb.Client.Get(ctx, LoginLockPath+key).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return locks, err
+		}
+
+		failures, err := rdb.Client.Get(ctx, LoginFailuresPath+key).Int64()
+		if err != nil && err != redis.Nil {
+			return locks, err
+		}
+
+		locks = append(locks, LoginLock{
+			Key:         key,
+			Failures:    failures,
+			LockedUntil: until,
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return locks, err
+	}
+
+	return locks, nil
+}
+
+func CreateTempEmailChange(ctx context.Context, rdb *Redis, accountUuid, email, confirmationToken string, expiration time.Duration) error {
+	email = strings.ToLower(email)
+
+	exists, err := rdb.Client.Exists(ctx, TempEmailChangePath+confirmationToken).Result()
+	if err != nil {
+		return err
+	} else if exists > 0 {
+		return QueryExists
+	}
+
+	err = execInPipeline(ctx, rdb.Client, func(pipe redis.Pipeliner) error {
+		if err = pipe.HSet(ctx, TempEmailChangePath+confirmationToken, "account", accountUuid, "email", email).Err(); err != nil {
+			return err
+		}
+
+		err = pipe.Expire(ctx, TempEmailChangePath+confirmationToken, expiration).Err()
+		return err
+	})
+
+	return err
+}
+
+func GetTempEmailChange(ctx context.Context, rdb *Redis, confirmationToken string) (string, string, error) {
+	data, err := rdb.Client.HGetAll(ctx, TempEmailChangePath+confirmationToken).Result()
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(data) == 0 {
+		return "", "", NoResults
+	}
+
+	return data["account"], data["email"], nil
+}
+
+func DeleteTempEmailChange(ctx context.Context, rdb *Redis, confirmationToken string) error {
+	return rdb.Client.Del(ctx, TempEmailChangePath+confirmationToken).Err()
+}
+
+// CreateTokensRevocation revokes all account tokens issued before the current moment
+func CreateTokensRevocation(ctx context.Context, rdb *Redis, accountUuid string, expiration time.Duration) error {
+	return rdb.Client.Set(ctx, TokensRevocationPath+accountUuid, time.Now().Unix(), expiration).Err()
+}
+
+// GetTokensRevocation returns the moment before which all account tokens are revoked, or zero time
+func GetTokensRevocation(ctx context.Context, rdb *Redis, accountUuid string) (time.Time, error) {
+	result, err := rdb.Client.Get(ctx, TokensRevocationPath+accountUuid).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(result, 0), nil
+}
+
+func CreateTempAccountDeletion(ctx context.Context, rdb *Redis, accountUuid, confirmationToken string, expiration time.Duration) error {
+	exists, err := rdb.Client.Exists(ctx, TempAccountDeletionPath+confirmationToken).Result()
+	if err != nil {
+		return err
+	} else if exists > 0 {
+		return QueryExists
+	}
+
+	return rdb.Client.Set(ctx, TempAccountDeletionPath+confirmationToken, accountUuid, expiration).Err()
+}
+
+func GetTempAccountDeletion(ctx context.Context, rdb *Redis, confirmationToken string) (string, error) {
+	result, err := rdb.Client.Get(ctx, TempAccountDeletionPath+confirmationToken).Result()
+	if err == redis.Nil {
+		return "", NoResults
+	}
+
+	return result, err
+}
+
+func DeleteTempAccountDeletion(ctx context.Context, rdb *Redis, confirmationToken string) error {
+	return rdb.Client.Del(ctx, TempAccountDeletionPath+confirmationToken).Err()
+}
+
+func CreateTempPasswordRecovery(ctx context.Context, rdb *Redis, accountUuid, confirmationToken string, expiration time.Duration) error {
+	exists, err := rdb.Client.Exists(ctx, TempPasswordRecoveryPath+confirmationToken).Result()
+	if err != nil {
+		return err
+	} else if exists > 0 {
+		return QueryExists
+	}
+
+	return rdb.Client.Set(ctx, TempPasswordRecoveryPath+confirmationToken, accountUuid, expiration).Err()
+}
+
+func GetTempPasswordRecovery(ctx context.Context, rdb *Redis, confirmationToken string) (string, error) {
+	result, err := rdb.Client.Get(ctx, TempPasswordRecoveryPath+confirmationToken).Result()
+	if err == redis.Nil {
+		return "", NoResults
+	}
+
+	return result, err
+}
+
+func DeleteTempPasswordRecovery(ctx context.Context, rdb *Redis, confirmationToken string) error {
+	return rdb.Client.Del(ctx, TempPasswordRecoveryPath+confirmationToken).Err()
+}
+
+// GetCatalogCacheState returns the generation of the catalog cache and the time of the last catalog change.
+// The entries are keyed by the generation, so they are dropped at once when it is incremented.
+func GetCatalogCacheState(ctx context.Context, rdb *Redis) (int64, time.Time, error) {
+	values, err := rdb.Client.HMGet(ctx, CatalogCacheStatePath, "generation", "modified_at").Result()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var generation int64
+	if value, ok := values[0].(string); ok {
+		generation, _ = strconv.ParseInt(value, 10, 64)
+	}
+	var modifiedAt time.Time
+	if value, ok := values[1].(string); ok {
+		modifiedAt, _ = time.Parse(time.RFC3339, value)
+	}
+	if modifiedAt.IsZero() {
+		// The cache state is lost, so it is created and the time starts from now
+		modifiedAt = time.Now().UTC().Truncate(time.Second)
+		if err = rdb.Client.HSetNX(ctx, CatalogCacheStatePath, "modified_at", modifiedAt.Format(time.RFC3339)).Err(); err != nil {
+			return 0, time.Time{}, err
+		}
+	}
+
+	return generation, modifiedAt, nil
+}
+
+// UpdateCatalogCacheState starts a new generation of the catalog cache after the catalog is changed
+func UpdateCatalogCacheState(ctx context.Context, rdb *Redis) error {
+	return execInPipeline(ctx, rdb.Client, func(pipe redis.Pipeliner) error {
+		if err := pipe.HIncrBy(ctx, CatalogCacheStatePath, "generation", 1).Err(); err != nil {
+			return err
+		}
+		return pipe.HSet(ctx, CatalogCacheStatePath, "modified_at", time.Now().UTC().Format(time.RFC3339)).Err()
+	})
+}
+
+func CreateCatalogCache(ctx context.Context, rdb *Redis, generation int64, key string, content []byte, expiration time.Duration) error {
+	return rdb.Client.Set(ctx, CatalogCachePath+strconv.FormatInt(generation, 10)+":"+key, content, expiration).Err()
+}
+
+// GetCatalogCache returns the cached response or NoResults
+func GetCatalogCache(ctx context.Context, rdb *Redis, generation int64, key string) ([]byte, error) {
+	content, err := rdb.Client.Get(ctx, CatalogCachePath+strconv.FormatInt(generation, 10)+":"+key).Bytes()
+	if err == redis.Nil {
+		return nil, NoResults
+	}
+
+	return content, err
+}
@@ -135,6 +135,8 @@ func PgErrorsHandle(err error, name string) string {
 			return name + ": " + PgForeignKey
 		case "23505":
 			return name + ": " + PgNoUnique
+		case "23514":
+			return name + ": " + PgCheck
 		default:
 			return ""
 		}
@@ -0,0 +1,54 @@
+package supplier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	assert.True(t, b.Allow())
+	b.Failure()
+	assert.True(t, b.Allow(), "the breaker opens only at the threshold")
+	b.Success()
+	b.Failure()
+	assert.True(t, b.Allow(), "the success resets the failures")
+	b.Failure()
+	assert.False(t, b.Allow(), "the breaker opens at the threshold")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.Allow(), "the trial call is let through after the cooldown")
+	assert.False(t, b.Allow(), "only a single trial call is let through")
+	b.Failure()
+	assert.False(t, b.Allow(), "the failed trial opens the breaker again")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.True(t, b.Allow(), "the successful trial closes the breaker")
+	assert.True(t, b.Allow())
+}
+
+func TestBreakerCancel(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	assert.True(t, b.Allow())
+	b.Cancel()
+	assert.True(t, b.Allow(), "the cancelled call does not count as a failure")
+	b.Failure()
+	assert.False(t, b.Allow())
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.Allow())
+	b.Cancel()
+	assert.True(t, b.Allow(), "the cancelled trial lets the next trial through")
+	b.Success()
+	assert.True(t, b.Allow())
+}
@@ -0,0 +1,166 @@
+package supplier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout          = 10 * time.Second
+	defaultBackoff          = 500 * time.Millisecond
+	defaultFailureThreshold = 5
+	defaultCooldown         = time.Minute
+	maxResponseSize         = 64 << 10
+)
+
+type HTTPConfig struct {
+	Url    string
+	ApiKey string
+	// Timeout limits every attempt, Backoff is the delay before the first retry and doubles for the next ones
+	Timeout          time.Duration
+	Retries          int
+	Backoff          time.Duration
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+// HTTP mints the codes with the supplier API:
+//
+//	POST {url}/codes {"sku": "...", "order_id": "..."} -> {"code": "..."}
+//
+// The order id is also sent in the Idempotency-Key header, so the retries do not mint the extra codes.
+type HTTP struct {
+	cfg     HTTPConfig
+	client  *http.Client
+	breaker *Breaker
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+func NewHTTP(cfg HTTPConfig) *HTTP {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultCooldown
+	}
+	cfg.Url = strings.TrimSuffix(cfg.Url, "/")
+
+	return &HTTP{
+		cfg:     cfg,
+		client:  &http.Client{},
+		breaker: NewBreaker(cfg.FailureThreshold, cfg.Cooldown),
+		sleep:   sleep,
+	}
+}
+
+// Fetch mints the code of the sku for the order. The failed call counts against the breaker only after the retries,
+// the rejection of the request does not count as the supplier answered it, nor does the call cancelled by the caller.
+func (h *HTTP) Fetch(ctx context.Context, sku, orderId string) (string, error) {
+	if !h.breaker.Allow() {
+		return "", ErrCircuitOpen
+	}
+
+	var err error
+	for attempt := 0; attempt <= h.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			if err = h.sleep(ctx, h.cfg.Backoff<<(attempt-1)); err != nil {
+				break
+			}
+		}
+
+		var code string
+		var retry bool
+		code, retry, err = h.mint(ctx, sku, orderId)
+		if err == nil {
+			h.breaker.Success()
+			return code, nil
+		} else if !retry {
+			h.breaker.Success()
+			return "", err
+		}
+	}
+
+	if ctx.Err() != nil {
+		h.breaker.Cancel()
+		return "", err
+	}
+
+	h.breaker.Failure()
+	return "", err
+}
+
+// mint makes a single attempt, the returned flag reports whether the attempt may be retried
+func (h *HTTP) mint(ctx context.Context, sku, orderId string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.Timeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{"sku": sku, "order_id": orderId})
+	if err != nil {
+		return "", false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.Url+"/codes", bytes.NewReader(body))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+h.cfg.ApiKey)
+	req.Header.Set("Idempotency-Key", orderId)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", true, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return "", true, fmt.Errorf("supplier responded with status %d", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated:
+		return "", false, fmt.Errorf("%w: status %d: %s", ErrRejected, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var result struct {
+		Code string `json:"code"`
+	}
+	if err = json.Unmarshal(respBody, &result); err != nil {
+		return "", true, err
+	} else if strings.TrimSpace(result.Code) == "" {
+		return "", true, errors.New("supplier responded without the code")
+	}
+
+	return result.Code, false, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
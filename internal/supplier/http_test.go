@@ -0,0 +1,196 @@
+package supplier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSupplier is a local stand-in of the supplier API. The responses are taken from the queue of the statuses,
+// the successful one mints a code once per idempotency key.
+type mockSupplier struct {
+	mu       sync.Mutex
+	statuses []int
+	delay    time.Duration
+	calls    int
+	keys     []string
+	codes    map[string]string
+}
+
+func (m *mockSupplier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/codes" || r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Sku     string `json:"sku"`
+		OrderId string `json:"order_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Sku == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.calls++
+	key := r.Header.Get("Idempotency-Key")
+	m.keys = append(m.keys, key)
+	status := http.StatusCreated
+	if len(m.statuses) > 0 {
+		status, m.statuses = m.statuses[0], m.statuses[1:]
+	}
+	delay := m.delay
+	m.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != http.StatusCreated {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":"failed"}`))
+		return
+	}
+
+	m.mu.Lock()
+	code, ok := m.codes[key]
+	if !ok {
+		code = req.Sku + "-" + key
+		m.codes[key] = code
+	}
+	m.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"code": code})
+}
+
+func (m *mockSupplier) callCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.calls
+}
+
+func newMockSupplier(t *testing.T, cfg HTTPConfig, statuses ...int) (*mockSupplier, *HTTP) {
+	mock := &mockSupplier{statuses: statuses, codes: map[string]string{}}
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	cfg.Url = server.URL + "/"
+	cfg.ApiKey = "secret"
+	h := NewHTTP(cfg)
+	h.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+
+	return mock, h
+}
+
+func TestHTTPFetch(t *testing.T) {
+	mock, h := newMockSupplier(t, HTTPConfig{})
+
+	code, err := h.Fetch(context.Background(), "g-coins-500", "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, "g-coins-500-order-1", code)
+	assert.Equal(t, []string{"order-1"}, mock.keys)
+}
+
+func TestHTTPFetchRetries(t *testing.T) {
+	mock, h := newMockSupplier(t, HTTPConfig{Retries: 2}, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	code, err := h.Fetch(context.Background(), "g-coins-500", "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, "g-coins-500-order-1", code)
+	assert.Equal(t, 3, mock.callCount())
+	assert.Equal(t, []string{"order-1", "order-1", "order-1"}, mock.keys, "the retries reuse the idempotency key")
+}
+
+func TestHTTPFetchRejected(t *testing.T) {
+	mock, h := newMockSupplier(t, HTTPConfig{Retries: 2, FailureThreshold: 1}, http.StatusUnprocessableEntity)
+
+	_, err := h.Fetch(context.Background(), "unknown", "order-1")
+	assert.True(t, errors.Is(err, ErrRejected))
+	assert.Equal(t, 1, mock.callCount(), "the rejected request is not retried")
+
+	_, err = h.Fetch(context.Background(), "g-coins-500", "order-2")
+	assert.NoError(t, err, "the rejection does not open the breaker")
+}
+
+func TestHTTPFetchTimeout(t *testing.T) {
+	mock, h := newMockSupplier(t, HTTPConfig{Timeout: 20 * time.Millisecond, Retries: 1})
+	mock.delay = time.Second
+
+	_, err := h.Fetch(context.Background(), "g-coins-500", "order-1")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	// The timed out request may reach the supplier after the client gave up on it
+	assert.Eventually(t, func() bool { return mock.callCount() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestHTTPFetchCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock, h := newMockSupplier(t, HTTPConfig{Retries: 1, FailureThreshold: 2, Cooldown: time.Minute},
+		http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	h.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		_, err := h.Fetch(context.Background(), "g-coins-500", "order-1")
+		assert.Error(t, err)
+	}
+	_, err := h.Fetch(context.Background(), "g-coins-500", "order-1")
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 4, mock.callCount(), "the open breaker does not call the supplier")
+
+	now = now.Add(time.Minute)
+	code, err := h.Fetch(context.Background(), "g-coins-500", "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, "g-coins-500-order-1", code)
+}
+
+func TestHTTPFetchCancelled(t *testing.T) {
+	mock, h := newMockSupplier(t, HTTPConfig{Retries: 1, FailureThreshold: 1})
+	mock.delay = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, err := h.Fetch(ctx, "g-coins-500", "order-1")
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	mock.mu.Lock()
+	mock.delay = 0
+	mock.mu.Unlock()
+	_, err = h.Fetch(context.Background(), "g-coins-500", "order-1")
+	assert.NoError(t, err, "the cancelled call does not open the breaker")
+}
+
+func TestRegistrySource(t *testing.T) {
+	registry := &Registry{sources: map[string]ContentSource{}}
+	_, h := newMockSupplier(t, HTTPConfig{})
+	registry.Add("mock", h)
+
+	source, err := registry.Source("")
+	require.NoError(t, err)
+	_, err = source.Fetch(context.Background(), "", "order-1")
+	assert.Equal(t, ErrManual, err)
+
+	source, err = registry.Source("mock")
+	require.NoError(t, err)
+	assert.Same(t, h, source)
+
+	_, err = registry.Source("unknown")
+	assert.Equal(t, ErrUnknownSupplier, err)
+	assert.True(t, registry.Has("mock"))
+	assert.False(t, registry.Has("unknown"))
+}
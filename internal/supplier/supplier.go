@@ -0,0 +1,75 @@
+package supplier
+
+import (
+	"context"
+	"errors"
+	"test-server-go/internal/config"
+)
+
+var (
+	// ErrManual means the source does not fetch the content, the content is uploaded by the admins
+	ErrManual          = errors.New("content is fulfilled manually")
+	ErrUnknownSupplier = errors.New("unknown supplier")
+	ErrCircuitOpen     = errors.New("supplier circuit is open")
+	ErrRejected        = errors.New("supplier rejected the request")
+)
+
+// ContentSource gives the content of the paid order of the variant. The order id identifies the request,
+// so the repeated request of the same order must not mint another code.
+type ContentSource interface {
+	Fetch(ctx context.Context, sku, orderId string) (string, error)
+}
+
+// Pool is the source of the variants without a supplier. Their content is uploaded to product.content
+// and reserved by the checkout, so there is nothing to fetch at the fulfilment time.
+type Pool struct{}
+
+func (Pool) Fetch(ctx context.Context, sku, orderId string) (string, error) {
+	return "", ErrManual
+}
+
+// Registry keeps the suppliers of the config by their names
+type Registry struct {
+	sources map[string]ContentSource
+}
+
+func NewRegistry(cfg config.Config) *Registry {
+	registry := &Registry{sources: make(map[string]ContentSource, len(cfg.Suppliers))}
+	for _, s := range cfg.Suppliers {
+		registry.sources[s.Name] = NewHTTP(HTTPConfig{
+			Url:              s.Url,
+			ApiKey:           s.ApiKey,
+			Timeout:          s.Timeout,
+			Retries:          s.Retries,
+			Backoff:          s.Backoff,
+			FailureThreshold: s.FailureThreshold,
+			Cooldown:         s.Cooldown,
+		})
+	}
+
+	return registry
+}
+
+// Add registers the source under the name, it replaces the source with the same name
+func (r *Registry) Add(name string, source ContentSource) {
+	r.sources[name] = source
+}
+
+func (r *Registry) Has(name string) bool {
+	_, ok := r.sources[name]
+	return ok
+}
+
+// Source returns the content source of the variant by its supplier, the empty supplier means the pool
+func (r *Registry) Source(name string) (ContentSource, error) {
+	if name == "" {
+		return Pool{}, nil
+	}
+
+	source, ok := r.sources[name]
+	if !ok {
+		return nil, ErrUnknownSupplier
+	}
+
+	return source, nil
+}
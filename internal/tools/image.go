@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+var ErrImageTooLarge = errors.New("the image resolution is too large")
+
+// DecodeImage decodes a jpeg, png or gif image, checking the resolution before the pixels are allocated
+func DecodeImage(content []byte, maxPixels int) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	return img, err
+}
+
+// ResizeImage scales the image down to fit the square with the maxSide side, keeping the aspect ratio.
+// The smaller images are not enlarged. The transparent pixels are put on the white background.
+func ResizeImage(src image.Image, maxSide int) *image.RGBA {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := srcWidth, srcHeight
+	if srcWidth > maxSide || srcHeight > maxSide {
+		if srcWidth >= srcHeight {
+			dstWidth, dstHeight = maxSide, max(1, srcHeight*maxSide/srcWidth)
+		} else {
+			dstWidth, dstHeight = max(1, srcWidth*maxSide/srcHeight), maxSide
+		}
+	}
+
+	flat := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+	if dstWidth == srcWidth && dstHeight == srcHeight {
+		return flat
+	}
+
+	// Every destination pixel is the average of the source pixels it covers
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for dy := 0; dy < dstHeight; dy++ {
+		y0, y1 := dy*srcHeight/dstHeight, max((dy+1)*srcHeight/dstHeight, dy*srcHeight/dstHeight+1)
+		for dx := 0; dx < dstWidth; dx++ {
+			x0, x1 := dx*srcWidth/dstWidth, max((dx+1)*srcWidth/dstWidth, dx*srcWidth/dstWidth+1)
+
+			var r, g, b, a, count int
+			for y := y0; y < y1; y++ {
+				row := flat.Pix[y*flat.Stride+x0*4 : y*flat.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += int(row[i])
+					g += int(row[i+1])
+					b += int(row[i+2])
+					a += int(row[i+3])
+					count++
+				}
+			}
+
+			offset := dy*dst.Stride + dx*4
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
+
+func EncodeJpeg(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResizeImage(t *testing.T) {
+	tests := []struct {
+		width, height  int
+		maxSide        int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{1600, 800, 400, 400, 200},
+		{800, 1600, 400, 200, 400},
+		{300, 200, 400, 300, 200},
+		{2000, 1, 100, 100, 1},
+	}
+
+	for _, test := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, test.width, test.height))
+		size := ResizeImage(src, test.maxSide).Bounds().Size()
+		assert.Equalf(t, image.Pt(test.expectedWidth, test.expectedHeight), size, "%dx%d resized to %d", test.width, test.height, test.maxSide)
+	}
+}
+
+func TestResizeImageAveragesAndFlattens(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		src.Set(x, 0, color.NRGBA{A: 255})
+		src.Set(x, 1, color.NRGBA{A: 0})
+	}
+
+	dst := ResizeImage(src, 2)
+
+	// A black and a transparent (white) pixel are averaged to grey
+	assert.Equal(t, color.RGBA{R: 127, G: 127, B: 127, A: 255}, dst.RGBAAt(0, 0))
+}
+
+func TestDecodeImage(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 100, 100))))
+
+	img, err := DecodeImage(buf.Bytes(), 100*100)
+	require.NoError(t, err)
+	assert.Equal(t, 100, img.Bounds().Dx())
+
+	_, err = DecodeImage(buf.Bytes(), 100*100-1)
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+
+	_, err = DecodeImage([]byte("not an image"), 100*100)
+	assert.Error(t, err)
+}
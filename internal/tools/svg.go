@@ -0,0 +1,216 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+var ErrInvalidSvg = errors.New("the file is not a valid svg image")
+
+// svgRemovedElements are dropped together with their content
+var svgRemovedElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"audio":         true,
+	"video":         true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// svgReferenceAttributes are the attributes loading the referenced resource, only the local "#id" references are kept
+var svgReferenceAttributes = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"action": true,
+}
+
+// SanitizeSvg parses the svg image and writes it back without the scripts, the event handlers, the foreignObject
+// elements and the external references. The documents with a DTD, the broken XML and the non-svg roots are rejected.
+func SanitizeSvg(content []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = true
+
+	var out bytes.Buffer
+	var stack []xml.Name
+	// skipDepth is the depth of the removed element, its content is skipped until the element is closed
+	skipDepth := 0
+	// styleText collects the style sheet of the style element, it is checked as a whole, as the comments
+	// and the CDATA sections may split it into several tokens
+	var styleText bytes.Buffer
+	hasRoot := false
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, ErrInvalidSvg
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				if hasRoot || !strings.EqualFold(t.Name.Local, "svg") {
+					return nil, ErrInvalidSvg
+				}
+				hasRoot = true
+			}
+			stack = append(stack, t.Name)
+
+			if skipDepth > 0 {
+				continue
+			}
+			if isRemovedSvgElement(t) {
+				skipDepth = len(stack)
+				continue
+			}
+			writeSvgStartElement(&out, t)
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1] != t.Name {
+				return nil, ErrInvalidSvg
+			}
+			stack = stack[:len(stack)-1]
+
+			if skipDepth > 0 {
+				if len(stack) < skipDepth {
+					skipDepth = 0
+				}
+				continue
+			}
+			if strings.EqualFold(t.Name.Local, "style") {
+				// The style sheets must not load anything either
+				if isSafeSvgStyle(styleText.String()) {
+					xml.EscapeText(&out, styleText.Bytes())
+				}
+				styleText.Reset()
+			}
+			out.WriteString("</" + svgQualifiedName(t.Name) + ">")
+		case xml.CharData:
+			if len(stack) == 0 {
+				if len(bytes.TrimSpace(t)) != 0 {
+					return nil, ErrInvalidSvg
+				}
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			if strings.EqualFold(stack[len(stack)-1].Local, "style") {
+				styleText.Write(t)
+				continue
+			}
+			xml.EscapeText(&out, t)
+		case xml.Directive:
+			// A DTD can declare the entities expanding into the markup or loading the external files
+			return nil, ErrInvalidSvg
+		case xml.ProcInst, xml.Comment:
+			// The processing instructions like xml-stylesheet can load the external resources, they are dropped with the comments
+		}
+	}
+
+	if !hasRoot || len(stack) != 0 {
+		return nil, ErrInvalidSvg
+	}
+
+	return out.Bytes(), nil
+}
+
+func isRemovedSvgElement(t xml.StartElement) bool {
+	if svgRemovedElements[strings.ToLower(t.Name.Local)] {
+		return true
+	}
+
+	// The animations can set an event handler or a javascript link on the other element
+	switch strings.ToLower(t.Name.Local) {
+	case "set", "animate":
+		for _, attr := range t.Attr {
+			if strings.EqualFold(attr.Name.Local, "attributeName") {
+				name := strings.ToLower(attr.Value)
+				if i := strings.LastIndex(name, ":"); i >= 0 {
+					name = name[i+1:]
+				}
+				return strings.HasPrefix(name, "on") || svgReferenceAttributes[name]
+			}
+		}
+	}
+
+	return false
+}
+
+func writeSvgStartElement(out *bytes.Buffer, t xml.StartElement) {
+	out.WriteString("<" + svgQualifiedName(t.Name))
+	for _, attr := range t.Attr {
+		if !isSafeSvgAttribute(attr) {
+			continue
+		}
+		out.WriteString(" " + svgQualifiedName(attr.Name) + `="`)
+		xml.EscapeText(out, []byte(attr.Value))
+		out.WriteString(`"`)
+	}
+	out.WriteString(">")
+}
+
+func isSafeSvgAttribute(attr xml.Attr) bool {
+	name := strings.ToLower(attr.Name.Local)
+	space := strings.ToLower(attr.Name.Space)
+	value := strings.TrimSpace(attr.Value)
+
+	switch {
+	case space == "xmlns" || (space == "" && name == "xmlns"):
+		return true
+	case strings.HasPrefix(name, "on"):
+		return false
+	case space == "xml" && name == "base":
+		return false
+	case svgReferenceAttributes[name]:
+		return strings.HasPrefix(value, "#")
+	case name == "style":
+		return isSafeSvgStyle(value)
+	}
+
+	return !hasExternalSvgUrl(value)
+}
+
+// isSafeSvgStyle reports whether the css neither imports the style sheets nor refers to the external resources
+func isSafeSvgStyle(css string) bool {
+	lower := strings.ToLower(css)
+	if strings.Contains(lower, "@import") || strings.Contains(lower, "expression(") || strings.Contains(lower, "javascript:") {
+		return false
+	}
+
+	return !hasExternalSvgUrl(css)
+}
+
+// hasExternalSvgUrl reports whether the value contains url(...) pointing elsewhere than the element of the same document.
+// The values with the CSS escapes are treated as external, as the escapes can spell url( or @import past the check,
+// and so are image-set(...) and image(...) loading the images from the plain strings.
+func hasExternalSvgUrl(value string) bool {
+	lower := strings.ToLower(value)
+	if strings.Contains(lower, `\`) || strings.Contains(lower, "image-set(") || strings.Contains(lower, "image(") {
+		return true
+	}
+	for {
+		i := strings.Index(lower, "url(")
+		if i < 0 {
+			return strings.Contains(lower, "javascript:")
+		}
+		lower = lower[i+len("url("):]
+		target := strings.TrimLeft(lower, " \t\r\n'\"")
+		if !strings.HasPrefix(target, "#") {
+			return true
+		}
+	}
+}
+
+func svgQualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeSvg(t *testing.T) {
+	tests := []struct {
+		name, input, expected string
+	}{
+		{
+			name:     "clean image is kept",
+			input:    `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M0 0h24v24H0z" fill="url(#g)"/></svg>`,
+			expected: `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M0 0h24v24H0z" fill="url(#g)"></path></svg>`,
+		},
+		{
+			name:     "scripts and handlers are removed",
+			input:    `<svg onload="alert(1)"><script>alert(2)</script><g><SCRIPT><![CDATA[alert(3)]]></SCRIPT><rect onClick="alert(4)" width="1"/></g></svg>`,
+			expected: `<svg><g><rect width="1"></rect></g></svg>`,
+		},
+		{
+			name:     "foreignObject is removed with its content",
+			input:    `<svg><foreignObject><body xmlns="http://www.w3.org/1999/xhtml"><img src="x" onerror="alert(1)"/></body></foreignObject><circle r="1"/></svg>`,
+			expected: `<svg><circle r="1"></circle></svg>`,
+		},
+		{
+			name: "external references are removed",
+			input: `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a xlink:href="javascript:alert(1)"><text>x</text></a>` +
+				`<use href="https://evil.example/sprite.svg#icon"/><use xlink:href="#icon"/><image href="//evil.example/a.png"/>` +
+				`<rect fill="url(https://evil.example/track)" style="fill: url('http://evil.example')"/></svg>`,
+			expected: `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a><text>x</text></a><use></use><use xlink:href="#icon"></use><image></image><rect></rect></svg>`,
+		},
+		{
+			name:     "animations of the links and handlers are removed",
+			input:    `<svg><a><set attributeName="href" to="javascript:alert(1)"/><animate attributeName="opacity" values="0;1"/></a></svg>`,
+			expected: `<svg><a><animate attributeName="opacity" values="0;1"></animate></a></svg>`,
+		},
+		{
+			name:     "style sheets importing the external files are removed",
+			input:    `<svg><style>@import url(https://evil.example/a.css);</style><style>.a{fill:red}</style></svg>`,
+			expected: `<svg><style></style><style>.a{fill:red}</style></svg>`,
+		},
+		{
+			name: "css escapes are removed",
+			input: `<svg><style>@\69mport "//evil.example/a.css";</style><style>.a{background:\75rl(http://evil.example)}</style>` +
+				`<rect style="fill: \75rl(http://evil.example)" fill="\75rl(http://evil.example)"/></svg>`,
+			expected: `<svg><style></style><style></style><rect></rect></svg>`,
+		},
+		{
+			name:     "style sheets split by comments and cdata are checked as a whole",
+			input:    `<svg><style>@imp<!-- x -->ort "//evil.example/a.css";</style><style>@imp<![CDATA[ort "//evil.example/b.css";]]></style><style>.a{fill:red}<!-- x -->.b{fill:blue}</style></svg>`,
+			expected: `<svg><style></style><style></style><style>.a{fill:red}.b{fill:blue}</style></svg>`,
+		},
+		{
+			name:     "image sets are removed",
+			input:    `<svg><style>.a{background:image-set("//evil.example/a.png" 1x)}</style><rect style="background: -webkit-image-set('//evil.example/a.png' 1x)"/></svg>`,
+			expected: `<svg><style></style><rect></rect></svg>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sanitized, err := SanitizeSvg([]byte(test.input))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(sanitized))
+		})
+	}
+}
+
+func TestSanitizeSvgRejects(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`not xml`,
+		`<html><body/></html>`,
+		`<svg><g></svg>`,
+		`<svg></svg><svg></svg>`,
+		`<!DOCTYPE svg [<!ENTITY x "<script>alert(1)</script>">]><svg>&x;</svg>`,
+		`<svg>&unknown;</svg>`,
+	} {
+		_, err := SanitizeSvg([]byte(input))
+		assert.ErrorIsf(t, err, ErrInvalidSvg, "input %q should be rejected", input)
+	}
+}
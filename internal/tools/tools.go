@@ -141,26 +141,28 @@ func ToInt64(i any) (int64, error) {
 }
 
 // Slugify generates an Url-friendly version of the input string.
-// It converts all letters to lowercase and replaces spaces with hyphens.
+// It transliterates cyrillic letters, converts all letters to lowercase and replaces spaces with hyphens.
 // It allows alphanumeric characters, hyphens, and underscores to remain unchanged.
-// It ignores non-ASCII characters.
+// It ignores the other non-ASCII characters and punctuation, repeated and edge hyphens are removed.
 func Slugify(s string) string {
 	var buf bytes.Buffer
 
-	for _, r := range s {
+	for _, r := range CyrillicToLatin(s) {
 		switch {
 		case r > unicode.MaxASCII:
 			continue
 		case unicode.IsLetter(r):
 			buf.WriteRune(unicode.ToLower(r))
-		case unicode.IsDigit(r), r == '_', r == '-':
+		case unicode.IsDigit(r), r == '_':
 			buf.WriteRune(r)
-		case unicode.IsSpace(r):
-			buf.WriteRune('-')
+		case unicode.IsSpace(r), r == '-':
+			if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '-' {
+				buf.WriteRune('-')
+			}
 		}
 	}
 
-	return buf.String()
+	return strings.TrimRight(buf.String(), "-")
 }
 
 func GetFullURL(r *http.Request, isDebug bool) string {
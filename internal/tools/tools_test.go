@@ -0,0 +1,25 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Grand Theft Auto 5", "grand-theft-auto-5"},
+		{"PUBG: BATTLEGROUNDS", "pubg-battlegrounds"},
+		{"Ведьмак 3: Дикая Охота", "vedmak-3-dikaya-ohota"},
+		{"  Half-Life  -  Alyx ", "half-life-alyx"},
+		{"snake_case", "snake_case"},
+		{"™®", ""},
+	}
+
+	for _, test := range tests {
+		assert.Equalf(t, test.expected, Slugify(test.input), "slug of %q", test.input)
+	}
+}
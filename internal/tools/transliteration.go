@@ -31,6 +31,11 @@ func Transliterate(text string) string {
 	return cyrillicToLatin(text)
 }
 
+// CyrillicToLatin lowercases the text and transliterates its cyrillic letters, leaving the other characters unchanged.
+func CyrillicToLatin(text string) string {
+	return cyrillicToLatin(strings.ToLower(text))
+}
+
 func isLatin(text string) bool {
 	for _, r := range text {
 		if r >= 'а' && r <= 'я' {
@@ -67,27 +72,30 @@ func cyrillicToLatin(text string) string {
 }
 
 func EngToRus(input string) string {
-	var result strings.Builder
+	return switchLayout(input, engLayout, rusLayout)
+}
 
-	for _, char := range input {
-		engIndex := strings.IndexRune(string(engLayout), char)
-		if engIndex != -1 {
-			result.WriteRune(rusLayout[engIndex])
-		} else {
-			result.WriteRune(char)
-		}
-	}
+func RusToEng(input string) string {
+	return switchLayout(input, rusLayout, engLayout)
+}
 
-	return result.String()
+// SwitchKeyboardLayout converts the text typed with the wrong keyboard layout, e.g. "пеф" to "gta" and "uf" to "га".
+// The text is lowercased and the direction is chosen by the presence of cyrillic letters.
+func SwitchKeyboardLayout(text string) string {
+	text = strings.ToLower(text)
+	if isLatin(text) {
+		return EngToRus(text)
+	}
+	return RusToEng(text)
 }
 
-func RusToEng(input string) string {
+func switchLayout(input string, from, to []rune) string {
 	var result strings.Builder
 
 	for _, char := range input {
-		rusIndex := strings.IndexRune(string(rusLayout), char)
-		if rusIndex != -1 && rusIndex < len(engLayout) {
-			result.WriteRune(engLayout[rusIndex])
+		index := indexRune(from, char)
+		if index != -1 && index < len(to) {
+			result.WriteRune(to[index])
 		} else {
 			result.WriteRune(char)
 		}
@@ -95,3 +103,13 @@ func RusToEng(input string) string {
 
 	return result.String()
 }
+
+// indexRune returns the rune index, unlike strings.IndexRune which returns the byte index
+func indexRune(runes []rune, r rune) int {
+	for i, v := range runes {
+		if v == r {
+			return i
+		}
+	}
+	return -1
+}
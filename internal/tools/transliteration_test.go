@@ -0,0 +1,30 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwitchKeyboardLayout(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"пеф", "gta"},
+		{"ПЕФ", "gta"},
+		{"пеф 5", "gta 5"},
+		{"uf", "га"},
+		{"Hfcn", "раст"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		assert.Equalf(t, test.expected, SwitchKeyboardLayout(test.input), "layout of %q should be switched", test.input)
+	}
+}
+
+func TestRusToEng(t *testing.T) {
+	assert.Equalf(t, "ghbdtn", RusToEng("привет"), "every cyrillic letter should be mapped to its key")
+	assert.Equalf(t, "привет", EngToRus("ghbdtn"), "every latin letter should be mapped to its key")
+}
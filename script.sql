@@ -3,6 +3,7 @@ SET timezone = 'UTC';
 CREATE SCHEMA IF NOT EXISTS account;
 CREATE SCHEMA IF NOT EXISTS product;
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp" SCHEMA account;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
 
 --select * from account.user;
 --select * from account.account;
@@ -48,7 +49,51 @@ CREATE TABLE account.role
     commentary   text		 NULL
 );
 CREATE UNIQUE INDEX IF NOT EXISTS account_role_name_idx ON account.role (lower(role_name));
-INSERT INTO account.role(role_name) VALUES ('user'), ('admin');
+INSERT INTO account.role(role_name) VALUES ('user'), ('admin'), ('support'), ('content manager'), ('finance'), ('seller');
+
+
+
+DROP TABLE IF EXISTS account.permission CASCADE;
+CREATE TABLE account.permission
+(
+    permission_no       smallserial PRIMARY KEY,
+    permission_name     text        NOT NULL UNIQUE,
+    created_at          timestamp   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at         timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary          text		NULL
+);
+INSERT INTO account.permission(permission_name) VALUES
+    ('catalog.read'), ('catalog.write'),
+    ('content.read'), ('content.write'),
+    ('orders.read'),
+    ('users.read'), ('users.block'), ('users.password_reset'), ('users.impersonate'),
+    ('employees.manage'), ('security.manage'), ('database.manage'),
+    ('audit.read'),
+    ('reviews.moderate'),
+    ('reports.read'),
+    ('sellers.manage'), ('payouts.approve');
+
+
+
+DROP TABLE IF EXISTS account.role_permission CASCADE;
+CREATE TABLE account.role_permission
+(
+    role_no             smallint    NOT NULL,
+    permission_no       smallint    NOT NULL,
+    created_at          timestamp   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (role_no, permission_no),
+    FOREIGN KEY (role_no) REFERENCES account.role(role_no) ON DELETE CASCADE,
+    FOREIGN KEY (permission_no) REFERENCES account.permission(permission_no) ON DELETE CASCADE
+);
+-- The admin is the super-admin and has all the permissions
+INSERT INTO account.role_permission(role_no, permission_no)
+SELECT ar.role_no, ap.permission_no FROM account.role ar CROSS JOIN account.permission ap WHERE ar.role_name = 'admin';
+INSERT INTO account.role_permission(role_no, permission_no)
+SELECT ar.role_no, ap.permission_no FROM account.role ar JOIN account.permission ap ON ap.permission_name IN ('catalog.read', 'orders.read', 'users.read', 'users.block', 'users.password_reset', 'users.impersonate', 'security.manage', 'reviews.moderate') WHERE ar.role_name = 'support';
+INSERT INTO account.role_permission(role_no, permission_no)
+SELECT ar.role_no, ap.permission_no FROM account.role ar JOIN account.permission ap ON ap.permission_name IN ('catalog.read', 'catalog.write', 'content.read', 'content.write', 'reviews.moderate') WHERE ar.role_name = 'content manager';
+INSERT INTO account.role_permission(role_no, permission_no)
+SELECT ar.role_no, ap.permission_no FROM account.role ar JOIN account.permission ap ON ap.permission_name IN ('catalog.read', 'orders.read', 'users.read', 'reports.read', 'payouts.approve') WHERE ar.role_name = 'finance';
 
 
 
@@ -77,10 +122,13 @@ DROP TABLE IF EXISTS account.user CASCADE;
 CREATE TABLE account.user
 (
     user_account            uuid        NOT NULL UNIQUE,
-    email                   text        NOT NULL UNIQUE,
+    email                   text        NULL UNIQUE,
     nickname                text        NOT NULL UNIQUE,
-    password 				text		NOT NULL,
-	salt_for_password       text        NOT NULL,
+    password 				text		NULL,
+	salt_for_password       text        NULL,
+    user_region             smallint    NULL,
+    -- The blob key of the profile image, NULL without the image
+    profile_image           text        NULL,
     modified_at         	timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
     commentary			    text		NULL,
     FOREIGN KEY (user_account) REFERENCES account.account(account_id)
@@ -90,17 +138,32 @@ INSERT INTO account.user(user_account, email, nickname, password, salt_for_passw
 
 
 
--- DROP TABLE IF EXISTS account.telegram_user CASCADE;
--- CREATE TABLE account.telegram_user
--- (
---     account_id               uuid        NOT NULL UNIQUE,
---     telegram_id              text        NOT NULL UNIQUE,
---     username                 text        NOT NULL,
---     photo_url                text        NOT NULL,
---     modified_at         	    timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
---     commentary			    text		NULL,
---     FOREIGN KEY (account_id) REFERENCES account.account(account_id)
--- );
+DROP TABLE IF EXISTS account.telegram_user CASCADE;
+CREATE TABLE account.telegram_user
+(
+    account_id               uuid        NOT NULL UNIQUE,
+    telegram_id              text        NOT NULL UNIQUE,
+    username                 text        NULL,
+    photo_url                text        NULL,
+    created_at               timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at         	 timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary			     text		NULL,
+    FOREIGN KEY (account_id) REFERENCES account.account(account_id)
+);
+
+
+
+DROP TABLE IF EXISTS account.google_user CASCADE;
+CREATE TABLE account.google_user
+(
+    account_id               uuid        NOT NULL UNIQUE,
+    google_id                text        NOT NULL UNIQUE,
+    email                    text        NOT NULL,
+    created_at               timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at         	 timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary			     text		NULL,
+    FOREIGN KEY (account_id) REFERENCES account.account(account_id)
+);
 
 
 
@@ -122,6 +185,23 @@ INSERT INTO account.employee(account_id, surname, name, patronymic, login, passw
 
 
 
+DROP TABLE IF EXISTS account.impersonation CASCADE;
+CREATE TABLE account.impersonation
+(
+    impersonation_id        uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    employee_account        uuid        NOT NULL,
+    user_account            uuid        NOT NULL,
+    reason                  text        NOT NULL,
+    ip                      text        NOT NULL,
+    expires_at              timestamp   NOT NULL,
+    created_at              timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (employee_account) REFERENCES account.account(account_id),
+    FOREIGN KEY (user_account) REFERENCES account.account(account_id)
+);
+CREATE INDEX IF NOT EXISTS impersonation_user_account_idx ON account.impersonation (user_account);
+
+
+
 DROP TABLE IF EXISTS product.state CASCADE;
 CREATE TABLE product.state
 (
@@ -204,23 +284,101 @@ INSERT INTO product.item(item_name) VALUES ('key/code'), ('link');
 
 
 
+-- The keys of the global region are activated everywhere, the other ones only in their own region
+DROP TABLE IF EXISTS product.region CASCADE;
+CREATE TABLE product.region
+(
+    region_no       smallserial	PRIMARY KEY,
+    region_name     text 		NOT NULL UNIQUE,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at    	timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary	    text		NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS product_region_name_idx ON product.region (lower(region_name));
+INSERT INTO product.region(region_name) VALUES ('global'), ('ru/cis'), ('eu');
+
+ALTER TABLE account.user ADD FOREIGN KEY (user_region) REFERENCES product.region(region_no) ON DELETE SET NULL;
+
+
+
+DROP TABLE IF EXISTS product.platform CASCADE;
+CREATE TABLE product.platform
+(
+    platform_no     smallserial	PRIMARY KEY,
+    platform_name   text 		NOT NULL UNIQUE,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at    	timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary	    text		NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS product_platform_name_idx ON product.platform (lower(platform_name));
+INSERT INTO product.platform(platform_name) VALUES ('pc'), ('playstation 4'), ('playstation 5'), ('xbox one'), ('xbox series x|s'), ('nintendo switch'), ('android'), ('ios');
+
+
+
+-- The instruction of the global region is used for the regions without their own instruction
+DROP TABLE IF EXISTS product.activation_instruction CASCADE;
+CREATE TABLE product.activation_instruction
+(
+    service_no      smallint    NOT NULL,
+    region_no       smallint    NOT NULL,
+    instruction     text        NOT NULL,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at    	timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (service_no, region_no),
+    FOREIGN KEY (service_no) REFERENCES product.service(service_no) ON DELETE CASCADE,
+    FOREIGN KEY (region_no) REFERENCES product.region(region_no) ON DELETE CASCADE
+);
+INSERT INTO product.activation_instruction(service_no, region_no, instruction) VALUES
+(1, 1, 'Откройте клиент Steam, выберите «Игры» → «Активировать в Steam...» и введите ключ.'),
+(3, 1, 'Откройте Epic Games Launcher, нажмите на профиль → «Активировать код» и введите ключ.');
+
+
+
 DROP TABLE IF EXISTS product.product CASCADE;
 CREATE TABLE product.product
 (
     product_id      uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
     product_name    text        NOT NULL UNIQUE,
+    slug            text        NOT NULL UNIQUE,
     description     text        NOT NULL,
     tags            text        NULL,
     created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
     modified_at     timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
     commentary		text		NULL
 );
-INSERT INTO product.product(product_id, product_name, tags, description) VALUES
-('9beaf75e-2925-4815-bcb6-1dd364293848', 'Grand Theft Auto 5', 'gta 5, gta5, gtao, gtav gta v', 'Лос-Сантос – город солнца, старлеток и вышедших в тираж звезд. Некогда предмет зависти всего западного мира, ныне это пристанище дрянных реалити-шоу, задыхающееся в тисках экономических проблем. В центре всей заварухи – троица совершенно разных преступников, отчаянно пытающихся ухватить удачу за хвост в непрекращающейся борьбе за место под солнцем. Бывший член уличной банды Франклин старается завязать с прошлым. Отошедший от дел грабитель банков Майкл обнаруживает, что в честной жизни все не так радужно, как представлялось. Повернутый на насилии псих Тревор перебивается от одного дельца к другому в надежде сорвать крупный куш. Исчерпав варианты, эти трое ставят на кон собственные жизни и учиняют серию дерзких ограблений, в которых – или пан, или пропал.'),
-('af153d1a-263c-4e77-a4d0-fb11ce781365', 'Red Dead Redemption 2', 'rdr2, rdr 2, rdo', 'Америка, 1899 год. Артур Морган и другие подручные Датча ван дер Линде вынуждены пуститься в бега. Их банде предстоит участвовать в кражах, грабежах и перестрелках в самом сердце Америки. За ними по пятам идут федеральные агенты и лучшие в стране охотники за головами, а саму банду разрывают внутренние противоречия. Артуру предстоит выбрать, что для него важнее: его собственные идеалы или же верность людям, которые его взрастили.'),
-('85f8d115-ca4b-4db5-b416-6828e4c0e90a', 'Warframe', NULL, 'Пробудитесь в роли неудержимого воина и сражайтесь вместе с друзьями в этой сюжетной бесплатной онлайн-игре. Столкнитесь с враждующими фракциями в обширной межпланетной системе, следуя указаниям загадочной Лотос, повышайте уровень своего Варфрейма, создайте арсенал разрушительной огневой мощи, и откройте свой истинный потенциал в огромных открытых мирах этого захватывающего сражения от третьего лица.'),
-('573b8cea-bbfa-4415-8f16-1b793a97c85f', 'PUBG: BATTLEGROUNDS', NULL, 'Высаживайтесь в стратегически важных местах, добывайте оружие и припасы и постарайтесь выжить и остаться последней командой на одном из многочисленных полей боя.'),
-('7a33fa78-df96-4b7e-ac64-4f152ca2022f', 'Superliminal', NULL, 'Восприятие – это реальность. В этой умопомрачительной головоломке от первого лица вам предстоит сбежать из сюрреалистического мира снов, решая невозможные загадки при помощи перспективы.');
+INSERT INTO product.product(product_id, product_name, slug, tags, description) VALUES
+('9beaf75e-2925-4815-bcb6-1dd364293848', 'Grand Theft Auto 5', 'grand-theft-auto-5', 'gta 5, gta5, gtao, gtav gta v', 'Лос-Сантос – город солнца, старлеток и вышедших в тираж звезд. Некогда предмет зависти всего западного мира, ныне это пристанище дрянных реалити-шоу, задыхающееся в тисках экономических проблем. В центре всей заварухи – троица совершенно разных преступников, отчаянно пытающихся ухватить удачу за хвост в непрекращающейся борьбе за место под солнцем. Бывший член уличной банды Франклин старается завязать с прошлым. Отошедший от дел грабитель банков Майкл обнаруживает, что в честной жизни все не так радужно, как представлялось. Повернутый на насилии псих Тревор перебивается от одного дельца к другому в надежде сорвать крупный куш. Исчерпав варианты, эти трое ставят на кон собственные жизни и учиняют серию дерзких ограблений, в которых – или пан, или пропал.'),
+('af153d1a-263c-4e77-a4d0-fb11ce781365', 'Red Dead Redemption 2', 'red-dead-redemption-2', 'rdr2, rdr 2, rdo', 'Америка, 1899 год. Артур Морган и другие подручные Датча ван дер Линде вынуждены пуститься в бега. Их банде предстоит участвовать в кражах, грабежах и перестрелках в самом сердце Америки. За ними по пятам идут федеральные агенты и лучшие в стране охотники за головами, а саму банду разрывают внутренние противоречия. Артуру предстоит выбрать, что для него важнее: его собственные идеалы или же верность людям, которые его взрастили.'),
+('85f8d115-ca4b-4db5-b416-6828e4c0e90a', 'Warframe', 'warframe', NULL, 'Пробудитесь в роли неудержимого воина и сражайтесь вместе с друзьями в этой сюжетной бесплатной онлайн-игре. Столкнитесь с враждующими фракциями в обширной межпланетной системе, следуя указаниям загадочной Лотос, повышайте уровень своего Варфрейма, создайте арсенал разрушительной огневой мощи, и откройте свой истинный потенциал в огромных открытых мирах этого захватывающего сражения от третьего лица.'),
+('573b8cea-bbfa-4415-8f16-1b793a97c85f', 'PUBG: BATTLEGROUNDS', 'pubg-battlegrounds', NULL, 'Высаживайтесь в стратегически важных местах, добывайте оружие и припасы и постарайтесь выжить и остаться последней командой на одном из многочисленных полей боя.'),
+('7a33fa78-df96-4b7e-ac64-4f152ca2022f', 'Superliminal', 'superliminal', NULL, 'Восприятие – это реальность. В этой умопомрачительной головоломке от первого лица вам предстоит сбежать из сюрреалистического мира снов, решая невозможные загадки при помощи перспективы.');
+
+
+DROP TABLE IF EXISTS product.slug_history CASCADE;
+CREATE TABLE product.slug_history
+(
+    slug            text        PRIMARY KEY,
+    product_id      uuid        NOT NULL,
+    created_at      timestamp   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES product.product(product_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS slug_history_product_id_idx ON product.slug_history(product_id);
+
+
+
+DROP TABLE IF EXISTS product.image CASCADE;
+CREATE TABLE product.image
+(
+    image_id        uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    product_id      uuid        NOT NULL,
+    position        smallint    NOT NULL CHECK ( position >= 0 ),
+    width           integer     NOT NULL CHECK ( width > 0 ),
+    height          integer     NOT NULL CHECK ( height > 0 ),
+    content_hash    text        NOT NULL,
+    created_at      timestamp   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES product.product(product_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS image_product_id_position_idx ON product.image(product_id, position);
 
 
 
@@ -234,7 +392,16 @@ CREATE TABLE product.variant
     variant_state       smallint    NOT NULL DEFAULT 1,
     variant_subtype     integer     NOT NULL,
     last_change_state   timestamp   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- The variant with the release time is sold as a pre-order while it is out of stock
+    preorder_release_at timestamp   NULL,
     variant_item        smallint    NOT NULL,
+    variant_region      smallint    NOT NULL DEFAULT 1,
+    variant_platform    smallint    NULL,
+    -- The variant with the supplier of the config gets the missing content from its API when the order is paid
+    variant_supplier    varchar(64) NULL,
+    supplier_sku        varchar(128) NULL,
+    -- The cost price of a single content minted by the supplier
+    supplier_cost       numeric     NULL CHECK ( supplier_cost >= 0 ),
     mask                text        NOT NULL,
     quantity_current    integer     NOT NULL CHECK ( quantity_current >= 0 ) DEFAULT 0,
     quantity_sold       integer     NOT NULL CHECK ( quantity_sold >= 0 ) DEFAULT 0,
@@ -251,8 +418,12 @@ CREATE TABLE product.variant
     FOREIGN KEY (variant_subtype) REFERENCES product.subtype(subtype_no),
     FOREIGN KEY (variant_service) REFERENCES product.service(service_no),
     FOREIGN KEY (variant_item) REFERENCES product.item(item_no),
+    FOREIGN KEY (variant_region) REFERENCES product.region(region_no),
+    FOREIGN KEY (variant_platform) REFERENCES product.platform(platform_no),
     FOREIGN KEY (variant_account) REFERENCES account.account(account_id),
     UNIQUE (variant_name, variant_service, variant_subtype),
+    CHECK ( (variant_supplier IS NULL) = (supplier_sku IS NULL) ),
+    CHECK ( variant_supplier IS NOT NULL OR supplier_cost IS NULL ),
     CHECK (
         (discount_money = 0 AND discount_percent = 0::smallint)
             OR
@@ -261,6 +432,45 @@ CREATE TABLE product.variant
         (discount_money > 0 AND discount_percent = 0::smallint)
         )
 );
+DROP TABLE IF EXISTS product.price_history CASCADE;
+CREATE TABLE product.price_history
+(
+    history_no          bigserial   PRIMARY KEY,
+    variant_id          uuid        NOT NULL,
+    price               numeric     NOT NULL,
+    discount_money      numeric     NOT NULL,
+    discount_percent    smallint    NOT NULL,
+    final_price         numeric     NOT NULL,
+    action_id           uuid        NULL,
+    changed_at          timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (variant_id) REFERENCES product.variant(variant_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS price_history_variant_id_idx ON product.price_history (variant_id, changed_at);
+
+-- Records the own price of the variant on every change, the admin action is taken from the app.audit_action session setting.
+-- The campaign prices are not recorded here, they are kept with the periods in product.campaign.
+CREATE OR REPLACE FUNCTION product.log_price_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.price = OLD.price AND NEW.discount_money = OLD.discount_money AND NEW.discount_percent = OLD.discount_percent THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO product.price_history(variant_id, price, discount_money, discount_percent, final_price, action_id)
+    VALUES (NEW.variant_id, NEW.price, NEW.discount_money, NEW.discount_percent,
+            CASE
+                WHEN NEW.discount_money > 0::numeric THEN NEW.price - NEW.discount_money
+                WHEN NEW.discount_percent > 0 THEN NEW.price * (1 - NEW.discount_percent / 100.0)
+                ELSE NEW.price
+                END,
+            NULLIF(current_setting('app.audit_action', true), '')::uuid);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER price_history AFTER INSERT OR UPDATE OF price, discount_money, discount_percent ON product.variant FOR EACH ROW EXECUTE FUNCTION product.log_price_change();
+
 INSERT INTO product.variant(product_id, variant_id, variant_name, variant_service, variant_state, variant_subtype, variant_item, mask, price, discount_money, discount_percent, variant_account)VALUES
 ('9beaf75e-2925-4815-bcb6-1dd364293848', '96c7074d-a205-4489-ba38-e5ebbcb676cd', 'Grand Theft Auto 5: Premium Edition', 1, 2, 1, 1, 'XXXXX-XXXXX-XXXXX', 1199, 0, 0, '4ad0f276-b11b-4c17-a160-3671699f0694'),
 ('9beaf75e-2925-4815-bcb6-1dd364293848', 'e8fac47e-cff7-4a98-9ff9-1524eb826bc3', 'Grand Theft Auto 5: Premium Edition', 7, 2, 3, 1, 'XXXXX-00000000-YYYYY', 1755, 100, 0, '4ad0f276-b11b-4c17-a160-3671699f0694'),
@@ -283,13 +493,61 @@ CREATE TABLE product.order
 (
     order_id        uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
     order_account   uuid        NOT NULL,
+    order_variant   uuid        NOT NULL,
     price           numeric     NOT NULL CHECK ( price >= 0 ),
+    order_campaign  uuid        NULL,
+    order_region    smallint    NULL,
+    region_acknowledged bool    NOT NULL DEFAULT false,
+    -- The pre-order awaits the content until it is uploaded, the paid pre-orders get it in the order of the payment
+    awaiting_content bool       NOT NULL DEFAULT false,
+    -- The last claim of the order awaiting the supplier by the supplier fulfiller, see ClaimSupplierOrders
+    supplier_claimed_at timestamp NULL,
     paid            bool        NOT NULL DEFAULT false,
+    paid_at         timestamp   NULL,
+    fulfilled_at    timestamp   NULL,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at     timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary		text		NULL,
+    FOREIGN KEY (order_account) REFERENCES account.account(account_id),
+    FOREIGN KEY (order_variant) REFERENCES product.variant(variant_id),
+    FOREIGN KEY (order_region) REFERENCES product.region(region_no) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS order_awaiting_content_idx ON product.order (order_variant, paid_at) WHERE awaiting_content;
+
+
+
+DROP TABLE IF EXISTS product.supplier CASCADE;
+CREATE TABLE product.supplier
+(
+    supplier_no     smallserial	PRIMARY KEY,
+    supplier_name   text 		NOT NULL UNIQUE,
+    contact         text        NULL,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at    	timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary	    text		NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS product_supplier_name_idx ON product.supplier (lower(supplier_name));
+
+
+
+-- The batch is a single upload of the content, its cost price is the price of a single content of the batch
+DROP TABLE IF EXISTS product.content_batch CASCADE;
+CREATE TABLE product.content_batch
+(
+    batch_id        uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    batch_variant   uuid        NOT NULL,
+    batch_supplier  smallint    NULL,
+    cost_price      numeric     NULL CHECK ( cost_price >= 0 ),
+    quantity        integer     NOT NULL CHECK ( quantity > 0 ),
+    batch_account   uuid        NOT NULL,
     created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
     modified_at     timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
     commentary		text		NULL,
-    FOREIGN KEY (order_account) REFERENCES account.account(account_id)
+    FOREIGN KEY (batch_variant) REFERENCES product.variant(variant_id),
+    FOREIGN KEY (batch_supplier) REFERENCES product.supplier(supplier_no),
+    FOREIGN KEY (batch_account) REFERENCES account.account(account_id)
 );
+CREATE INDEX IF NOT EXISTS content_batch_variant_idx ON product.content_batch (batch_variant);
 
 
 
@@ -298,64 +556,541 @@ CREATE TABLE product.content
 (
     content_id      uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
     content_variant uuid        NOT NULL,
-    content_order   uuid        UNIQUE NULL DEFAULT NULL,
+    content_order   uuid        NULL DEFAULT NULL,
+    -- The content minted by the supplier API gets a batch of its own with the supplier and the cost price of the variant
+    content_batch   uuid        NULL,
     data            text        NOT NULL,
     created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
     modified_at     timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
     commentary		text		NULL,
     FOREIGN KEY (content_variant) REFERENCES product.variant(variant_id),
-    FOREIGN KEY (content_order) REFERENCES product.order(order_id)
+    FOREIGN KEY (content_order) REFERENCES product.order(order_id),
+    FOREIGN KEY (content_batch) REFERENCES product.content_batch(batch_id)
+);
+-- The order of a bundle holds a content of every component
+CREATE INDEX IF NOT EXISTS content_order_idx ON product.content (content_order);
+CREATE INDEX IF NOT EXISTS content_variant_free_idx ON product.content (content_variant) WHERE content_order IS NULL;
+
+
+
+-- The seller is the account selling its own variants (variant_account), the commission is kept from every sale
+DROP TABLE IF EXISTS account.seller CASCADE;
+CREATE TABLE account.seller
+(
+    seller_account      uuid        PRIMARY KEY,
+    commission_percent  numeric     NOT NULL CHECK ( commission_percent >= 0 AND commission_percent <= 100 ) DEFAULT 10,
+    created_at          timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at         timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary		    text		NULL,
+    FOREIGN KEY (seller_account) REFERENCES account.account(account_id)
+);
+
+
+
+-- The requested payout reserves its amount of the balance until it is approved or rejected by the admin.
+-- The balance at the request time is kept as the statement the admin approves.
+DROP TABLE IF EXISTS account.seller_payout CASCADE;
+CREATE TABLE account.seller_payout
+(
+    payout_id       uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    seller_account  uuid        NOT NULL,
+    amount          numeric     NOT NULL CHECK ( amount > 0 ),
+    balance         numeric     NOT NULL,
+    payout_state    text        NOT NULL CHECK ( payout_state IN ('requested', 'approved', 'rejected') ) DEFAULT 'requested',
+    decided_by      uuid        NULL,
+    decided_at      timestamp   NULL,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at     timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary		text		NULL,
+    FOREIGN KEY (seller_account) REFERENCES account.seller(seller_account),
+    FOREIGN KEY (decided_by) REFERENCES account.account(account_id)
+);
+CREATE INDEX IF NOT EXISTS seller_payout_account_idx ON account.seller_payout (seller_account, created_at);
+
+
+
+-- The ledger of the seller balance: the paid order credits the price without the commission, the approved payout debits its amount
+DROP TABLE IF EXISTS account.seller_ledger CASCADE;
+CREATE TABLE account.seller_ledger
+(
+    entry_id        uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    seller_account  uuid        NOT NULL,
+    entry_order     uuid        NULL UNIQUE,
+    entry_payout    uuid        NULL UNIQUE,
+    gross           numeric     NOT NULL,
+    commission      numeric     NOT NULL DEFAULT 0,
+    amount          numeric     NOT NULL,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (seller_account) REFERENCES account.seller(seller_account),
+    FOREIGN KEY (entry_order) REFERENCES product.order(order_id),
+    FOREIGN KEY (entry_payout) REFERENCES account.seller_payout(payout_id),
+    CHECK ( (entry_order IS NULL) <> (entry_payout IS NULL) )
+);
+CREATE INDEX IF NOT EXISTS seller_ledger_account_idx ON account.seller_ledger (seller_account, created_at);
+
+
+
+-- The bundle is a variant sold as a set of the component variants for its own price.
+-- It has no content, the order of the bundle takes one content of every component.
+DROP TABLE IF EXISTS product.bundle_component CASCADE;
+CREATE TABLE product.bundle_component
+(
+    bundle_variant_id       uuid        NOT NULL,
+    component_variant_id    uuid        NOT NULL,
+    created_at              timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (bundle_variant_id, component_variant_id),
+    CHECK ( bundle_variant_id <> component_variant_id ),
+    FOREIGN KEY (bundle_variant_id) REFERENCES product.variant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (component_variant_id) REFERENCES product.variant(variant_id)
+);
+CREATE INDEX IF NOT EXISTS bundle_component_component_idx ON product.bundle_component (component_variant_id);
+
+
+
+-- The reviews are left by the buyers of the product, one per buyer, and shown after the moderation
+DROP TABLE IF EXISTS product.review CASCADE;
+CREATE TABLE product.review
+(
+    review_id           uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    product_id          uuid        NOT NULL,
+    review_account      uuid        NOT NULL,
+    rating              smallint    NOT NULL CHECK ( rating >= 1 AND rating <= 5 ),
+    review_text         text        NOT NULL,
+    review_state        text        NOT NULL CHECK ( review_state IN ('pending', 'published', 'rejected') ) DEFAULT 'pending',
+    moderation_reason   text        NULL,
+    moderated_by        uuid        NULL,
+    moderated_at        timestamp   NULL,
+    created_at          timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at         timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary		    text		NULL,
+    UNIQUE (product_id, review_account),
+    FOREIGN KEY (product_id) REFERENCES product.product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (review_account) REFERENCES account.account(account_id) ON DELETE CASCADE,
+    FOREIGN KEY (moderated_by) REFERENCES account.account(account_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS review_product_state_idx ON product.review (product_id, review_state, created_at);
+CREATE INDEX IF NOT EXISTS review_state_idx ON product.review (review_state, created_at);
+
+
+
+-- The variants saved by the users. With the notify flag the user is e-mailed once when the variant is back in stock,
+-- the notified_at is set then and reset by the next subscription.
+DROP TABLE IF EXISTS product.wishlist CASCADE;
+CREATE TABLE product.wishlist
+(
+    account_id      uuid        NOT NULL,
+    variant_id      uuid        NOT NULL,
+    notify          bool        NOT NULL DEFAULT false,
+    notified_at     timestamp   NULL,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at     timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, variant_id),
+    FOREIGN KEY (account_id) REFERENCES account.account(account_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES product.variant(variant_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS wishlist_pending_notice_idx ON product.wishlist (variant_id) WHERE notify AND notified_at IS NULL;
+
+
+
+DROP TABLE IF EXISTS product.campaign CASCADE;
+CREATE TABLE product.campaign
+(
+    campaign_id         uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    campaign_name       text        NOT NULL,
+    starts_at           timestamp   NOT NULL,
+    ends_at             timestamp   NOT NULL,
+    priority            integer     NOT NULL DEFAULT 0,
+    discount_money      numeric     NOT NULL CHECK ( discount_money >= 0 ) DEFAULT 0,
+    discount_percent    smallint    NOT NULL CHECK ( discount_percent >= 0 AND discount_percent <= 100 ) DEFAULT 0,
+    campaign_account    uuid        NOT NULL,
+    created_at          timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified_at         timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    commentary		    text		NULL,
+    FOREIGN KEY (campaign_account) REFERENCES account.account(account_id),
+    CHECK ( ends_at > starts_at ),
+    CHECK (
+        (discount_money = 0 AND discount_percent > 0::smallint)
+            OR
+        (discount_money > 0 AND discount_percent = 0::smallint)
+        )
+);
+CREATE INDEX IF NOT EXISTS campaign_period_idx ON product.campaign (starts_at, ends_at);
+ALTER TABLE product.order ADD FOREIGN KEY (order_campaign) REFERENCES product.campaign(campaign_id) ON DELETE SET NULL;
+
+
+
+-- Exactly one of the target columns is set, the campaign applies to the variants matching any of its targets
+DROP TABLE IF EXISTS product.campaign_target CASCADE;
+CREATE TABLE product.campaign_target
+(
+    target_id       uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    campaign_id     uuid        NOT NULL,
+    variant_id      uuid        NULL,
+    product_id      uuid        NULL,
+    service_no      smallint    NULL,
+    type_no         smallint    NULL,
+    FOREIGN KEY (campaign_id) REFERENCES product.campaign(campaign_id) ON DELETE CASCADE,
+    FOREIGN KEY (variant_id) REFERENCES product.variant(variant_id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES product.product(product_id) ON DELETE CASCADE,
+    FOREIGN KEY (service_no) REFERENCES product.service(service_no) ON DELETE CASCADE,
+    FOREIGN KEY (type_no) REFERENCES product.type(type_no) ON DELETE CASCADE,
+    CHECK ( num_nonnulls(variant_id, product_id, service_no, type_no) = 1 )
 );
+CREATE INDEX IF NOT EXISTS campaign_target_campaign_id_idx ON product.campaign_target (campaign_id);
 
 
 
-DROP MATERIALIZED VIEW IF EXISTS product.product_variants_summary_all_data;
+DROP MATERIALIZED VIEW IF EXISTS product.product_variants_summary_all_data CASCADE;
 CREATE MATERIALIZED VIEW product.product_variants_summary_all_data AS
 SELECT
     t.type_name,
     st.subtype_name,
     s.service_name,
     p.product_name,
+    p.slug AS product_slug,
     pv.variant_name,
     ps.state_name,
     pv.price,
-    pv.discount_money,
-    pv.discount_percent,
-    CASE
-        WHEN pv.discount_money > 0::numeric THEN pv.price - pv.discount_money
-        WHEN pv.discount_percent > 0 THEN pv.price * (1 - pv.discount_percent / 100.0)
-        ELSE pv.price
-        END AS final_price,
     i.item_name,
+    r.region_name,
+    pl.platform_name,
     pv.mask,
-    pv.quantity_current,
-    pv.quantity_sold,
-    CASE
-        WHEN pv.quantity_current = 0 THEN 'out of stock'
-        WHEN pv.quantity_current = 1 THEN 'last in stock'
-        WHEN pv.quantity_current > 1 AND pv.quantity_current < 10 THEN 'limited stock'
-        WHEN pv.quantity_current >= 10 AND pv.quantity_current < 30 THEN 'adequate stock'
-        WHEN pv.quantity_current >= 30 THEN 'large stock'
-        ELSE 'error'
-        END AS text_quantity,
     p.description,
     p.tags,
     p.product_id,
     pv.variant_id,
-    pv.variant_account
+    pv.variant_account,
+    setweight(to_tsvector('simple', p.product_name || ' ' || COALESCE(pv.variant_name, '')), 'A') ||
+    setweight(to_tsvector('russian', p.product_name || ' ' || COALESCE(pv.variant_name, '')), 'A') ||
+    setweight(to_tsvector('english', p.product_name || ' ' || COALESCE(pv.variant_name, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(p.tags, '')), 'B') ||
+    setweight(to_tsvector('russian', p.description), 'C') ||
+    setweight(to_tsvector('english', p.description), 'D') AS search_vector,
+    lower(p.product_name || ' ' || COALESCE(pv.variant_name, '') || ' ' || COALESCE(p.tags, '')) AS search_text
 FROM
     product.variant pv
         JOIN product.product p ON pv.product_id = p.product_id
         JOIN product.service s ON pv.variant_service = s.service_no
         JOIN product.state ps ON pv.variant_state = ps.state_no
         JOIN product.item i ON pv.variant_item = i.item_no
+        JOIN product.region r ON pv.variant_region = r.region_no
+        LEFT JOIN product.platform pl ON pv.variant_platform = pl.platform_no
         JOIN product.subtype st ON pv.variant_subtype = st.subtype_no
         JOIN product.type t ON st.type_no = t.type_no;
 
 
 
+-- The unique index lets the summary be refreshed concurrently without blocking the storefront reads
+CREATE UNIQUE INDEX IF NOT EXISTS product_variants_summary_variant_id_idx ON product.product_variants_summary_all_data (variant_id);
+CREATE INDEX IF NOT EXISTS product_variants_summary_search_vector_idx ON product.product_variants_summary_all_data USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS product_variants_summary_search_text_idx ON product.product_variants_summary_all_data USING gin (search_text gin_trgm_ops);
+
+
+
+-- The prices depend on the time of the campaigns, so they are calculated at query time instead of the materialized view.
+-- The best campaign of the variant is the running one with the highest priority, then with the lowest price.
+-- The campaign replaces the own discount of the variant only if it makes the price lower.
+CREATE OR REPLACE VIEW product.variant_price AS
+SELECT
+    pv.variant_id,
+    pv.price,
+    CASE WHEN c.final_price < own.final_price THEN c.discount_money ELSE pv.discount_money END AS discount_money,
+    CASE WHEN c.final_price < own.final_price THEN c.discount_percent ELSE pv.discount_percent END AS discount_percent,
+    LEAST(own.final_price, COALESCE(c.final_price, own.final_price)) AS final_price,
+    CASE WHEN c.final_price < own.final_price THEN c.campaign_id END AS campaign_id,
+    CASE WHEN c.final_price < own.final_price THEN c.campaign_name END AS campaign_name,
+    CASE WHEN c.final_price < own.final_price THEN c.ends_at END AS campaign_ends_at
+FROM
+    product.variant pv
+        JOIN product.subtype st ON pv.variant_subtype = st.subtype_no
+        CROSS JOIN LATERAL (
+            SELECT CASE
+                WHEN pv.discount_money > 0::numeric THEN pv.price - pv.discount_money
+                WHEN pv.discount_percent > 0 THEN pv.price * (1 - pv.discount_percent / 100.0)
+                ELSE pv.price
+                END AS final_price
+        ) own
+        LEFT JOIN LATERAL (
+            SELECT
+                pc.campaign_id,
+                pc.campaign_name,
+                pc.ends_at,
+                LEAST(pc.discount_money, pv.price) AS discount_money,
+                pc.discount_percent,
+                CASE
+                    WHEN pc.discount_money > 0::numeric THEN GREATEST(pv.price - pc.discount_money, 0)
+                    ELSE pv.price * (1 - pc.discount_percent / 100.0)
+                    END AS final_price
+            FROM product.campaign pc
+            WHERE pc.starts_at <= LOCALTIMESTAMP AND pc.ends_at > LOCALTIMESTAMP
+                AND EXISTS (
+                    SELECT 1 FROM product.campaign_target ct
+                    WHERE ct.campaign_id = pc.campaign_id
+                        AND (ct.variant_id = pv.variant_id OR ct.product_id = pv.product_id OR ct.service_no = pv.variant_service OR ct.type_no = st.type_no)
+                )
+            ORDER BY pc.priority DESC, final_price, pc.starts_at DESC
+            LIMIT 1
+        ) c ON true;
+
+
+
+-- The stock of the bundle is the stock of its scarcest component, a deleted component makes the bundle unavailable.
+-- The other variants have their own stock.
+CREATE OR REPLACE VIEW product.variant_stock AS
+SELECT
+    pv.variant_id,
+    COALESCE(bs.quantity_current, pv.quantity_current) AS quantity_current,
+    bs.quantity_current IS NOT NULL AS is_bundle,
+    COALESCE(bs.components, '{}') AS bundle_components
+FROM
+    product.variant pv
+        LEFT JOIN LATERAL (
+            SELECT
+                min(CASE WHEN cs.state_name = 'deleted' THEN 0 ELSE cv.quantity_current END) AS quantity_current,
+                array_agg(cp.product_name || ' - ' || cv.variant_name ORDER BY cp.product_name, cv.variant_name) AS components
+            FROM product.bundle_component bc
+                JOIN product.variant cv ON cv.variant_id = bc.component_variant_id
+                JOIN product.state cs ON cs.state_no = cv.variant_state
+                JOIN product.product cp ON cp.product_id = cv.product_id
+            WHERE bc.bundle_variant_id = pv.variant_id
+        ) bs ON true;
+
+
+
+-- The delivered content of the order, the contents of the bundle components are titled with their names
+CREATE OR REPLACE VIEW product.order_content AS
+SELECT
+    pc.content_order AS order_id,
+    string_agg(
+        CASE WHEN pc.content_variant = po.order_variant THEN pc.data
+        ELSE pp.product_name || ' - ' || pv.variant_name || E':\n' || pc.data END,
+        E'\n\n' ORDER BY pp.product_name, pv.variant_name, pc.content_id) AS data
+FROM
+    product.content pc
+        JOIN product.order po ON po.order_id = pc.content_order
+        JOIN product.variant pv ON pv.variant_id = pc.content_variant
+        JOIN product.product pp ON pp.product_id = pv.product_id
+GROUP BY pc.content_order;
+
+
+
+-- The sold content with its share of the order price and its cost price, the price of the bundle order is split equally
+-- between the contents of its components. The cost of the seller content is the share of the seller,
+-- otherwise it is NULL if the content has no batch or the cost price of the batch is unknown.
+CREATE OR REPLACE VIEW product.content_sale AS
+SELECT
+    pc.content_id,
+    pc.content_order AS order_id,
+    po.order_variant,
+    pc.content_variant,
+    cb.batch_supplier,
+    po.paid_at,
+    po.price / count(*) OVER (PARTITION BY pc.content_order) AS revenue,
+    COALESCE(sl.amount / count(*) OVER (PARTITION BY pc.content_order), cb.cost_price) AS cost
+FROM
+    product.content pc
+        JOIN product.order po ON po.order_id = pc.content_order AND po.paid
+        LEFT JOIN product.content_batch cb ON cb.batch_id = pc.content_batch
+        LEFT JOIN account.seller_ledger sl ON sl.entry_order = po.order_id;
+
+
+
+-- The activation instruction of the variant is the one of its service and region, then the one of its service and the global region
+CREATE OR REPLACE VIEW product.variant_instruction AS
+SELECT
+    pv.variant_id,
+    ai.instruction
+FROM
+    product.variant pv
+        JOIN LATERAL (
+            SELECT pai.instruction
+            FROM product.activation_instruction pai
+                JOIN product.region r ON r.region_no = pai.region_no
+            WHERE pai.service_no = pv.variant_service AND (pai.region_no = pv.variant_region OR r.region_name = 'global')
+            ORDER BY pai.region_no = pv.variant_region DESC
+            LIMIT 1
+        ) ai ON true;
+
+
+
+-- The rating of the product is calculated from the published reviews only
+CREATE OR REPLACE VIEW product.product_rating AS
+SELECT
+    product_id,
+    round(avg(rating), 2) AS rating,
+    count(*) AS review_count
+FROM product.review
+WHERE review_state = 'published'
+GROUP BY product_id;
+
+
+
+-- The storefront reads the summary with the current prices and stock through this view,
+-- so the orders and the content uploads do not need the summary to be refreshed.
+-- The lowest price of 30 days is the reference shown next to the discount: the lowest own price of the variant in force
+-- during the 30 days before the current reduction started. The reduction starts with the own price in force or with the applied
+-- campaign if it started later, so the price in force is not its own reference. Without an earlier price it is the own price in force.
+-- The earlier campaign prices do not count: the campaigns are edited and deleted, so their past prices are not recorded.
+CREATE OR REPLACE VIEW product.product_variants_live AS
+SELECT
+    pvs.*,
+    vs.quantity_current,
+    pv.quantity_sold,
+    pv.preorder_release_at,
+    pv.variant_supplier,
+    pv.supplier_sku,
+    pv.variant_supplier IS NOT NULL AS on_demand,
+    CASE
+        WHEN vs.quantity_current = 0 AND pv.preorder_release_at IS NOT NULL THEN 'pre-order'
+        WHEN vs.quantity_current = 0 AND pv.variant_supplier IS NOT NULL THEN 'on demand'
+        WHEN vs.quantity_current = 0 THEN 'out of stock'
+        WHEN vs.quantity_current = 1 THEN 'last in stock'
+        WHEN vs.quantity_current > 1 AND vs.quantity_current < 10 THEN 'limited stock'
+        WHEN vs.quantity_current >= 10 AND vs.quantity_current < 30 THEN 'adequate stock'
+        WHEN vs.quantity_current >= 30 THEN 'large stock'
+        ELSE 'error'
+        END AS text_quantity,
+    vp.discount_money,
+    vp.discount_percent,
+    vp.final_price,
+    vp.campaign_id,
+    vp.campaign_name,
+    vp.campaign_ends_at,
+    lp.lowest_price_30d,
+    pr.rating,
+    COALESCE(pr.review_count, 0) AS review_count,
+    vs.bundle_components
+FROM
+    product.product_variants_summary_all_data pvs
+        JOIN product.variant pv ON pvs.variant_id = pv.variant_id
+        JOIN product.variant_stock vs ON pvs.variant_id = vs.variant_id
+        JOIN product.variant_price vp ON pvs.variant_id = vp.variant_id
+        LEFT JOIN product.product_rating pr ON pvs.product_id = pr.product_id
+        LEFT JOIN product.campaign pc ON pc.campaign_id = vp.campaign_id
+        LEFT JOIN LATERAL (
+            SELECT ph.final_price, GREATEST(ph.changed_at, pc.starts_at) AS reduced_at
+            FROM product.price_history ph
+            WHERE ph.variant_id = pvs.variant_id
+            ORDER BY ph.changed_at DESC, ph.history_no DESC
+            LIMIT 1
+        ) cur ON true
+        LEFT JOIN LATERAL (
+            SELECT COALESCE(min(ph.final_price), cur.final_price) AS lowest_price_30d
+            FROM product.price_history ph
+            WHERE ph.variant_id = pvs.variant_id
+                AND ph.changed_at < cur.reduced_at
+                AND ph.changed_at >= COALESCE(
+                    (SELECT max(phs.changed_at) FROM product.price_history phs WHERE phs.variant_id = pvs.variant_id AND phs.changed_at <= cur.reduced_at - interval '30 days'),
+                    '-infinity'::timestamp)
+        ) lp ON true;
+
+
+
 REFRESH MATERIALIZED VIEW product.product_variants_summary_all_data;
-SELECT * FROM product.product_variants_summary_all_data;
+SELECT * FROM product.product_variants_live;
+
+
+
+CREATE SCHEMA IF NOT EXISTS audit;
+
+DROP TABLE IF EXISTS audit.admin_action CASCADE;
+CREATE TABLE audit.admin_action
+(
+    action_id       uuid        PRIMARY KEY DEFAULT account.UUID_GENERATE_V4(),
+    actor_account   uuid        NOT NULL,
+    method          text        NOT NULL,
+    route           text        NOT NULL,
+    query           text        NOT NULL DEFAULT '',
+    ip              text        NOT NULL,
+    status_code     smallint    NULL,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (actor_account) REFERENCES account.account(account_id)
+);
+CREATE INDEX IF NOT EXISTS admin_action_actor_idx ON audit.admin_action (actor_account, created_at);
+CREATE INDEX IF NOT EXISTS admin_action_created_at_idx ON audit.admin_action (created_at);
+
+
+
+DROP TABLE IF EXISTS audit.row_change CASCADE;
+CREATE TABLE audit.row_change
+(
+    change_no       bigserial   PRIMARY KEY,
+    action_id       uuid        NOT NULL,
+    table_name      text        NOT NULL,
+    operation       text        NOT NULL,
+    entity_id       text        NULL,
+    before          jsonb       NULL,
+    after           jsonb       NULL,
+    diff            jsonb       NOT NULL,
+    created_at      timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (action_id) REFERENCES audit.admin_action(action_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS row_change_action_idx ON audit.row_change (action_id);
+CREATE INDEX IF NOT EXISTS row_change_entity_idx ON audit.row_change (table_name, entity_id);
+
+
+
+-- Records the row change made during the admin action set in the app.audit_action session setting.
+-- The first trigger argument is the key column, the others are the columns excluded from the record.
+CREATE OR REPLACE FUNCTION audit.log_row_change() RETURNS trigger AS $$
+DECLARE
+    action      text := NULLIF(current_setting('app.audit_action', true), '');
+    old_row     jsonb;
+    new_row     jsonb;
+    changes     jsonb;
+BEGIN
+    IF action IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW);
+    END IF;
+    FOR i IN 1 .. TG_NARGS - 1 LOOP
+        old_row := old_row - TG_ARGV[i];
+        new_row := new_row - TG_ARGV[i];
+    END LOOP;
+
+    SELECT COALESCE(jsonb_object_agg(k.key, jsonb_build_object('old', old_row -> k.key, 'new', new_row -> k.key)), '{}'::jsonb)
+    INTO changes
+    FROM (SELECT jsonb_object_keys(COALESCE(old_row, '{}'::jsonb) || COALESCE(new_row, '{}'::jsonb)) AS key) k
+    WHERE k.key NOT IN ('modified_at', 'last_activity')
+      AND (old_row -> k.key) IS DISTINCT FROM (new_row -> k.key);
+
+    IF TG_OP = 'UPDATE' AND changes = '{}'::jsonb THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO audit.row_change(action_id, table_name, operation, entity_id, before, after, diff)
+    VALUES (action::uuid, TG_TABLE_SCHEMA || '.' || TG_TABLE_NAME, lower(TG_OP), COALESCE(new_row, old_row) ->> TG_ARGV[0], old_row, new_row, changes);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON account.account FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('account_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON account.user FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('user_account', 'password', 'salt_for_password');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON account.employee FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('account_id', 'password', 'salt_for_password');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.product FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('product_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.image FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('image_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.variant FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('variant_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.content FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('content_id', 'data');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.type FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('type_no');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.subtype FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('subtype_no');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.service FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('service_no');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.order FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('order_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.campaign FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('campaign_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.campaign_target FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('target_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.review FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('review_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.bundle_component FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('bundle_variant_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.activation_instruction FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('service_no');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.supplier FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('supplier_no');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON product.content_batch FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('batch_id');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON account.seller FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('seller_account');
+CREATE TRIGGER audit_row_change AFTER INSERT OR UPDATE OR DELETE ON account.seller_payout FOR EACH ROW EXECUTE FUNCTION audit.log_row_change('payout_id');
 
 
 